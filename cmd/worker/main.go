@@ -16,22 +16,42 @@ func main() {
 	config.InitConfig()
 	repo.InitMysql()
 	repo.InitRedis()
-	storage.InitMinio()
+	storage.InitStorage()
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	log.Println("workers started: download + activity")
+	// 集群模式下由 Worker 负责迁移 启动时继续未完成的迁移任务
+	if _, ok := storage.Default.(*storage.ClusterStore); ok {
+		storage.StartMigrationMonitor(ctx, config.StorageConfigInstance.MigrationInterval)
+	}
+
+	log.Println("workers started: download + activity + quota + scrub + upload sweeper + version pruner + archive sweeper")
 
-	errCh := make(chan error, 2)
+	errCh := make(chan error, 7)
 	go func() {
 		errCh <- worker.RunDownloadWorker(ctx)
 	}()
 	go func() {
 		errCh <- worker.RunActivityWorker(ctx)
 	}()
+	go func() {
+		errCh <- worker.RunQuotaReconcileWorker(ctx)
+	}()
+	go func() {
+		errCh <- worker.RunScrubWorker(ctx)
+	}()
+	go func() {
+		errCh <- worker.RunUploadSweepWorker(ctx)
+	}()
+	go func() {
+		errCh <- worker.RunVersionPruneWorker(ctx)
+	}()
+	go func() {
+		errCh <- worker.RunArchiveSweepWorker(ctx)
+	}()
 
-	for i := 0; i < 2; i++ {
+	for i := 0; i < 7; i++ {
 		err := <-errCh
 		if err != nil {
 			log.Fatalf("worker stopped: %v", err)
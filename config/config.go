@@ -43,6 +43,39 @@ type Config struct {
 	DownloadAllowPrivate      bool
 	DownloadAllowedHosts      []string
 	DownloadMaxBytes          int64
+	UserDefaultSpace          int64
+	QuotaReconcileInterval    time.Duration
+	StorageBackend            string
+	LocalStorageRoot          string
+	LocalStorageSecret        string
+	LocalStorageBaseURL       string
+	AdminUsers                []string
+	ScrubInterval             time.Duration
+	UploadSessionTTL          time.Duration
+	UploadSweepInterval       time.Duration
+	UploadPresignExpiry       time.Duration
+	VersionKeep               int
+	VersionRetentionDays      int
+	VersionPruneInterval      time.Duration
+	ExtractMaxEntries         int
+	ExtractMaxSize            int64
+	ExtractMaxRatio           int
+	SimpleUploadMaxSize       int64
+	DedupScope                string
+	ArchiveTaskTTL            time.Duration
+	ArchiveSweepInterval      time.Duration
+
+	// 下载限速与并发 DownloadTiers 按用户的 tier 取 未设置或未知的 tier 使用 DownloadDefaultTier
+	DownloadDefaultTier DownloadTier
+	DownloadTiers       map[string]DownloadTier
+}
+
+// DownloadTier holds the download limits of a user tier; 0 means unlimited.
+type DownloadTier struct {
+	Rate         int64 // 该用户所有下载合计的速率 字节/秒
+	Streams      int   // 该用户同时进行的下载数
+	ShareRate    int64 // 该用户每个分享的下载速率
+	ShareStreams int   // 该用户每个分享同时进行的下载数
 }
 
 var AppConfig Config
@@ -162,6 +195,42 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	return parsed
 }
 
+// parseDownloadTiers parses "name=rate/streams/share_rate/share_streams,..."; omitted or empty
+// fields keep the value of base.
+func parseDownloadTiers(raw string, base DownloadTier) map[string]DownloadTier {
+	tiers := map[string]DownloadTier{}
+	for _, item := range strings.Split(raw, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(item), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			continue
+		}
+		tier := base
+		for i, field := range strings.Split(spec, "/") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			value, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || value < 0 {
+				continue
+			}
+			switch i {
+			case 0:
+				tier.Rate = value
+			case 1:
+				tier.Streams = int(value)
+			case 2:
+				tier.ShareRate = value
+			case 3:
+				tier.ShareStreams = int(value)
+			}
+		}
+		tiers[name] = tier
+	}
+	return tiers
+}
+
 // InitConfig loads configuration and initializes sub-configs.
 func InitConfig() {
 	bucketNameTest := getEnv("BUCKET_NAME_TEST", "")
@@ -188,6 +257,12 @@ func InitConfig() {
 		"DOWNLOAD_RETRY_DELAYS",
 		[]time.Duration{10 * time.Second, 30 * time.Second, 2 * time.Minute, 10 * time.Minute, 30 * time.Minute},
 	)
+	downloadTier := DownloadTier{
+		Rate:         getEnvInt64("DOWNLOAD_USER_RATE", 0),
+		Streams:      getEnvInt("DOWNLOAD_USER_STREAMS", 0),
+		ShareRate:    getEnvInt64("DOWNLOAD_SHARE_RATE", 0),
+		ShareStreams: getEnvInt("DOWNLOAD_SHARE_STREAMS", 0),
+	}
 	AppConfig = Config{
 		JWTSecret:                 getEnv("JWT_SECRET", "l=ax+b"),
 		DBHost:                    getEnv("DB_HOST", "localhost"),
@@ -222,6 +297,30 @@ func InitConfig() {
 		DownloadAllowPrivate:      getEnvBool("DOWNLOAD_ALLOW_PRIVATE", false),
 		DownloadAllowedHosts:      getEnvList("DOWNLOAD_ALLOW_HOSTS", nil),
 		DownloadMaxBytes:          getEnvInt64("DOWNLOAD_MAX_BYTES", 0),
+		UserDefaultSpace:          getEnvInt64("USER_DEFAULT_SPACE", 10*1024*1024*1024),
+		QuotaReconcileInterval:    getEnvDuration("QUOTA_RECONCILE_INTERVAL", time.Hour),
+		StorageBackend:            strings.ToLower(getEnv("STORAGE_BACKEND", "minio")),
+		LocalStorageRoot:          getEnv("LOCAL_STORAGE_ROOT", "./data/objects"),
+		LocalStorageSecret:        getEnv("LOCAL_STORAGE_SECRET", ""),
+		LocalStorageBaseURL:       getEnv("LOCAL_STORAGE_BASE_URL", "http://localhost:8000"),
+		AdminUsers:                getEnvList("ADMIN_USERS", nil),
+		ScrubInterval:             getEnvDuration("SCRUB_INTERVAL", 24*time.Hour),
+		UploadSessionTTL:          getEnvDuration("UPLOAD_SESSION_TTL", 24*time.Hour),
+		UploadSweepInterval:       getEnvDuration("UPLOAD_SWEEP_INTERVAL", time.Hour),
+		UploadPresignExpiry:       getEnvDuration("UPLOAD_PRESIGN_EXPIRY", 5*time.Minute),
+		VersionKeep:               getEnvInt("VERSION_KEEP", 10),
+		VersionRetentionDays:      getEnvInt("VERSION_RETENTION_DAYS", 30),
+		VersionPruneInterval:      getEnvDuration("VERSION_PRUNE_INTERVAL", time.Hour),
+		ExtractMaxEntries:         getEnvInt("EXTRACT_MAX_ENTRIES", 10000),
+		ExtractMaxSize:            getEnvInt64("EXTRACT_MAX_SIZE", 10<<30),
+		ExtractMaxRatio:           getEnvInt("EXTRACT_MAX_RATIO", 100),
+		SimpleUploadMaxSize:       getEnvInt64("SIMPLE_UPLOAD_MAX_SIZE", 100<<20),
+		DedupScope:                strings.ToLower(getEnv("DEDUP_SCOPE", "global")),
+		ArchiveTaskTTL:            getEnvDuration("ARCHIVE_TASK_TTL", 24*time.Hour),
+		ArchiveSweepInterval:      getEnvDuration("ARCHIVE_SWEEP_INTERVAL", 10*time.Minute),
+
+		DownloadDefaultTier: downloadTier,
+		DownloadTiers:       parseDownloadTiers(getEnv("DOWNLOAD_TIERS", ""), downloadTier),
 	}
 
 	InitStorageConfig()
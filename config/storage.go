@@ -1,6 +1,11 @@
 package config
 
-import "sync"
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
 
 // StorageConfig holds storage and migration settings.
 type StorageConfig struct {
@@ -10,6 +15,12 @@ type StorageConfig struct {
 	EnableSharding      bool                 `json:"enable_sharding"`       //是否切分大文件
 	ShardSize           int64                `json:"shard_size"`            // 切分大文件大小
 	MigrationThreshold  int                  `json:"migration_threshold"`   // 磁盘使用率达到多少启动迁移
+	MigrationInterval   time.Duration        `json:"migration_interval"`    // 迁移检查间隔
+
+	HealthCheckInterval    time.Duration `json:"health_check_interval"`    // 节点探活间隔
+	HealthCheckTimeout     time.Duration `json:"health_check_timeout"`     // 单次探活超时
+	HealthFailThreshold    int           `json:"health_fail_threshold"`    // 连续失败多少次摘除节点
+	HealthRecoverThreshold int           `json:"health_recover_threshold"` // 连续成功多少次恢复节点
 }
 
 // MinioClusterConfig describes a MinIO cluster node.
@@ -30,29 +41,69 @@ var StorageConfigInstance *StorageConfig
 var storageConfigOnce sync.Once
 
 // InitStorageConfig initializes storage config.
-// 目前仍是单 Minio 架构
+// 未配置 MINIO_CLUSTER_NODES 时仍是单 Minio 节点
 func InitStorageConfig() {
 	storageConfigOnce.Do(func() {
+		clusters := parseClusterNodes(getEnv("MINIO_CLUSTER_NODES", ""))
+		if len(clusters) == 0 {
+			clusters = []MinioClusterConfig{
+				newClusterNode("cluster1", getEnv("MINIO_HOST", "localhost"), getEnv("MINIO_PORT", "9000")),
+			}
+		}
 		StorageConfigInstance = &StorageConfig{
-			MinioClusters: []MinioClusterConfig{
-				{
-					Name:      "cluster1",
-					Host:      getEnv("MINIO_HOST", "localhost"),
-					Port:      getEnv("MINIO_PORT", "9000"),
-					Username:  getEnv("MINIO_USERNAME", "minioadmin"),
-					Password:  getEnv("MINIO_PASSWORD", "minioadmin"),
-					UseSSL:    false,
-					Available: true,
-					UsedSize:  0,
-					TotalSize: 100 * 1024 * 1024 * 1024, // 100GB
-					Weight:    1,
-				},
-			},
-			ReplicaCount:        2,
-			LoadBalanceStrategy: "round_robin",
+			MinioClusters:       clusters,
+			ReplicaCount:        getEnvInt("STORAGE_REPLICA_COUNT", 2),
+			LoadBalanceStrategy: strings.ToLower(getEnv("STORAGE_LOAD_BALANCE", "round_robin")),
 			EnableSharding:      true,
 			ShardSize:           10 * 1024 * 1024, // 10MB
-			MigrationThreshold:  80,
+			MigrationThreshold:  getEnvInt("STORAGE_MIGRATION_THRESHOLD", 80),
+			MigrationInterval:   getEnvDuration("STORAGE_MIGRATION_INTERVAL", 10*time.Minute),
+
+			HealthCheckInterval:    getEnvDuration("STORAGE_HEALTH_INTERVAL", 10*time.Second),
+			HealthCheckTimeout:     getEnvDuration("STORAGE_HEALTH_TIMEOUT", 5*time.Second),
+			HealthFailThreshold:    getEnvInt("STORAGE_HEALTH_FAIL_THRESHOLD", 3),
+			HealthRecoverThreshold: getEnvInt("STORAGE_HEALTH_RECOVER_THRESHOLD", 2),
 		}
 	})
 }
+
+// newClusterNode builds a node config sharing the MinIO credentials.
+func newClusterNode(name, host, port string) MinioClusterConfig {
+	return MinioClusterConfig{
+		Name:      name,
+		Host:      host,
+		Port:      port,
+		Username:  getEnv("MINIO_USERNAME", "minioadmin"),
+		Password:  getEnv("MINIO_PASSWORD", "minioadmin"),
+		UseSSL:    false,
+		Available: true,
+		UsedSize:  0,
+		TotalSize: getEnvInt64("MINIO_NODE_TOTAL_SIZE", 100*1024*1024*1024), // 100GB
+		Weight:    1,
+	}
+}
+
+// parseClusterNodes parses "name=host:port[@weight],name2=host2:port2[@weight]".
+func parseClusterNodes(raw string) []MinioClusterConfig {
+	var nodes []MinioClusterConfig
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		name, addr, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		addr, rawWeight, hasWeight := strings.Cut(strings.TrimSpace(addr), "@")
+		host, port, ok := strings.Cut(addr, ":")
+		if !ok || host == "" || port == "" {
+			continue
+		}
+		node := newClusterNode(strings.TrimSpace(name), host, port)
+		if hasWeight {
+			if weight, err := strconv.Atoi(strings.TrimSpace(rawWeight)); err == nil && weight > 0 {
+				node.Weight = weight
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
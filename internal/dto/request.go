@@ -5,12 +5,17 @@ import "mime/multipart"
 type UploadFileByHashRequest struct {
 	UserId   uint64                `json:"-"`
 	FileId   uint64                `json:"file_id"`
-	FileName string                `json:"file_name" binding:"required"`
+	FileName string                `json:"file_name" binding:"required_without=RelativePath"`
 	Size     int64                 `json:"size" binding:"required"`
 	Hash     string                `json:"hash" binding:"required"`
 	ParentId uint64                `json:"parent_id"`
 	File     *multipart.FileHeader `json:"-"`
 	IsDir    bool                  `json:"is_dir"`
+	Proof    string                `json:"proof"` // 对服务端挑战的应答 见 dto.ProofChallenge
+	// RelativePath 如 "photos/2024/a.jpg" 相对 ParentId 缺失的中间文件夹自动创建 文件名取最后一段
+	RelativePath string `json:"relative_path"`
+	// ConflictPolicy 重名时的处理: fail (默认) / rename / overwrite / skip
+	ConflictPolicy string `json:"conflict_policy"`
 }
 
 type MultipartInitRequest struct {
@@ -22,23 +27,66 @@ type MultipartInitRequest struct {
 	ChunkSize   int64  `json:"chunk_size"`
 	TotalChunks int    `json:"total_chunks"`
 	ParentId    uint64 `json:"parent_id"`
+	Proof       string `json:"proof"`
+	Presign     bool   `json:"presign"` // 返回各未上传分片的预签名 PUT 地址 客户端直传存储后调用 confirm
+	// RelativePath 秒传命中时在此路径下创建文件 否则 complete 时需再次携带
+	RelativePath string `json:"relative_path"`
+	// ConflictPolicy 记录在上传会话上 complete 未携带时沿用
+	ConflictPolicy string `json:"conflict_policy"`
 }
 
 type MultipartUploadChunkRequest struct {
 	UploadID   string
 	BucketName string
 	ChunkIndex int
+	FileHash   string
+	Checksum   string // 客户端声明的分片校验和 md5:<hex> 或 crc32c:<hex> 为空时服务端计算 md5
 	File       *multipart.FileHeader
 }
 
+type MultipartAbortRequest struct {
+	UploadID string `json:"upload_id" binding:"required"`
+}
+
+type MultipartConfirmRequest struct {
+	UploadID string         `json:"upload_id" binding:"required"`
+	Chunks   []ChunkConfirm `json:"chunks" binding:"required,min=1"`
+}
+
+// ChunkConfirm reports a chunk PUT directly to storage; Checksum is md5:<hex> or crc32c:<hex> and optional.
+type ChunkConfirm struct {
+	Index    int    `json:"index"`
+	Checksum string `json:"checksum"`
+}
+
 type MultipartCompleteRequest struct {
 	FileId      uint64 `json:"file_id"`
 	FileHash    string `json:"file_hash" binding:"required"`
-	FileName    string `json:"file_name" binding:"required"`
+	FileName    string `json:"file_name" binding:"required_without=RelativePath"`
 	FileSize    int64  `json:"file_size" binding:"gte=0"`
 	TotalChunks int    `json:"total_chunks" binding:"gte=0"`
 	ParentId    uint64 `json:"parent_id"`
 	IsDir       bool   `json:"is_dir"`
+	// RelativePath 合并完成后按路径创建中间文件夹 见 UploadFileByHashRequest
+	RelativePath   string `json:"relative_path"`
+	ConflictPolicy string `json:"conflict_policy"`
+}
+
+// UploadManifestRequest declares a tree of folders and files under ParentId before uploading it.
+type UploadManifestRequest struct {
+	ParentId uint64          `json:"parent_id"`
+	Entries  []ManifestEntry `json:"entries" binding:"required,min=1,dive"`
+	// ConflictPolicy 只作用于文件 路径上已存在的文件夹总是复用
+	ConflictPolicy string `json:"conflict_policy"`
+}
+
+// ManifestEntry is one folder or file of a manifest; Path is relative, e.g. "photos/2024/a.jpg".
+type ManifestEntry struct {
+	Path  string `json:"path" binding:"required"`
+	IsDir bool   `json:"is_dir"`
+	Size  int64  `json:"size"`
+	Hash  string `json:"hash"`  // 可选 提供时尝试秒传
+	Proof string `json:"proof"` // 对秒传挑战的应答
 }
 
 type HttpOfflineDownloadRequest struct {
@@ -46,10 +94,30 @@ type HttpOfflineDownloadRequest struct {
 	FileName string `json:"file_name" binding:"required"`
 }
 
+// DownloadTaskControlRequest names the task to cancel, pause or resume.
+type DownloadTaskControlRequest struct {
+	TaskID uint64 `json:"task_id" binding:"required"`
+}
+
+// SimpleUploadRequest carries the form fields of a single-request upload; the content is the "file" part.
+type SimpleUploadRequest struct {
+	FileName       string `form:"file_name"` // 为空时取表单文件名
+	ParentID       uint64 `form:"parent_id"`
+	RelativePath   string `form:"relative_path"`
+	ConflictPolicy string `form:"conflict_policy"`
+}
+
+type ExtractArchiveRequest struct {
+	FileID         uint64 `json:"file_id" binding:"required"`
+	ParentID       uint64 `json:"parent_id"`
+	ConflictPolicy string `json:"conflict_policy"`
+}
+
 type URLUploadRequest struct {
-	URL      string `json:"url" binding:"required"`
-	FileName string `json:"file_name"`
-	ParentID uint64 `json:"parent_id"`
+	URL            string `json:"url" binding:"required"`
+	FileName       string `json:"file_name"`
+	ParentID       uint64 `json:"parent_id"`
+	ConflictPolicy string `json:"conflict_policy"`
 }
 
 type MinioDownloadRequest struct {
@@ -60,6 +128,11 @@ type MinioDownloadRequest struct {
 type ArchiveDownloadRequest struct {
 	FileIDs []uint64 `json:"file_ids" binding:"required"`
 	Name    string   `json:"name"`
+
+	// Format zip / zip64 / tar / tar.gz 为空时按内容选择 zip 或 zip64
+	Format string `json:"format"`
+	// Compression auto / deflate / store 只对 zip 生效
+	Compression string `json:"compression"`
 }
 
 type LoginRequest struct {
@@ -103,13 +176,15 @@ type FileRenameRequest struct {
 }
 
 type FileMoveRequest struct {
-	FileIDs  []uint64 `json:"file_ids" binding:"required"`
-	TargetID *uint64  `json:"target_id"`
+	FileIDs        []uint64 `json:"file_ids" binding:"required"`
+	TargetID       *uint64  `json:"target_id"`
+	ConflictPolicy string   `json:"conflict_policy"` // fail (默认) / rename / overwrite / skip
 }
 
 type FileCopyRequest struct {
-	FileIDs  []uint64 `json:"file_ids" binding:"required"`
-	TargetID *uint64  `json:"target_id"`
+	FileIDs        []uint64 `json:"file_ids" binding:"required"`
+	TargetID       *uint64  `json:"target_id"`
+	ConflictPolicy string   `json:"conflict_policy"`
 }
 
 type FolderUploadRequest struct {
@@ -123,7 +198,13 @@ type BatchDeleteRequest struct {
 }
 
 type RestoreFileRequest struct {
-	FileID uint64 `json:"file_id" binding:"required"`
+	FileID         uint64 `json:"file_id" binding:"required"`
+	ConflictPolicy string `json:"conflict_policy"`
+}
+
+type FileVersionRequest struct {
+	FileID    uint64 `json:"file_id" binding:"required"`
+	VersionID uint64 `json:"version_id" binding:"required"`
 }
 
 type DeleteFileRequest struct {
@@ -135,8 +216,22 @@ type UpdateUserProfileRequest struct {
 	Email     *string `json:"email"`
 	AvatarURL *string `json:"avatar_url"`
 	Bio       *string `json:"bio"`
+
+	// 历史版本保留规则 0 表示不限制 负数恢复为系统默认值
+	VersionKeep *int `json:"version_keep"`
+	VersionDays *int `json:"version_days"`
 }
 
 type FavoriteRequest struct {
 	FileID uint64 `json:"file_id" binding:"required"`
 }
+
+type SetUserTenantRequest struct {
+	UserID   uint64 `json:"user_id" binding:"required"`
+	TenantID uint64 `json:"tenant_id"` // 0 表示移出租户
+}
+
+type SetUserTierRequest struct {
+	UserID uint64 `json:"user_id" binding:"required"`
+	Tier   string `json:"tier"` // 为空时恢复默认限制
+}
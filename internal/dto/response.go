@@ -2,18 +2,92 @@
 
 // FastUploadResponse is the response for instant upload.
 type FastUploadResponse struct {
-	Instant    bool   `json:"instant"`
-	NeedUpload bool   `json:"need_upload,omitempty"`
-	Reason     string `json:"reason,omitempty"`
-	FileId     uint64 `json:"file_id,omitempty"`
-	UploadId   string `json:"upload_id,omitempty"`
+	Instant    bool            `json:"instant"`
+	NeedUpload bool            `json:"need_upload,omitempty"`
+	Reason     string          `json:"reason,omitempty"`
+	FileId     uint64          `json:"file_id,omitempty"`
+	UploadId   string          `json:"upload_id,omitempty"`
+	NeedProof  bool            `json:"need_proof,omitempty"`
+	Challenge  *ProofChallenge `json:"challenge,omitempty"`
+	FileName   string          `json:"file_name,omitempty"` // 重名策略处理后实际使用的文件名
+	Action     string          `json:"action,omitempty"`    // 见 EntryResult.Action
 }
 
 // MultiPartFileResponse is the response for multipart uploads.
 type MultiPartFileResponse struct {
-	Instant  bool   `json:"instant"`
-	UploadID string `json:"upload_id,omitempty"`
-	Uploaded []int  `json:"uploaded,omitempty"`
+	Instant   bool            `json:"instant"`
+	UploadID  string          `json:"upload_id,omitempty"`
+	Uploaded  []int           `json:"uploaded,omitempty"`
+	Chunks    []UploadedChunk `json:"chunks,omitempty"` // 已上传分片的大小与校验和 续传时客户端可据此比对
+	NeedProof bool            `json:"need_proof,omitempty"`
+	Challenge *ProofChallenge `json:"challenge,omitempty"`
+	FileId    uint64          `json:"file_id,omitempty"`
+	FileName  string          `json:"file_name,omitempty"`
+	Action    string          `json:"action,omitempty"` // 秒传或按 skip 策略跳过时返回
+
+	PresignedChunks  []PresignedChunk `json:"presigned_chunks,omitempty"`
+	PresignExpiresAt int64            `json:"presign_expires_at,omitempty"` // unix 秒
+}
+
+// PresignedChunk is a URL the client PUTs one chunk of exactly Size bytes to.
+type PresignedChunk struct {
+	Index int    `json:"index"`
+	Size  int64  `json:"size"`
+	URL   string `json:"url"`
+}
+
+// UploadedChunk describes a chunk the server already holds.
+type UploadedChunk struct {
+	Index    int    `json:"index"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// UploadManifestResponse lists the folders of a manifest and where each file goes.
+type UploadManifestResponse struct {
+	Folders []ManifestFolder `json:"folders"`
+	Files   []ManifestFile   `json:"files"`
+}
+
+// ManifestFolder maps a folder path of the manifest to its ID.
+type ManifestFolder struct {
+	Path string `json:"path"`
+	ID   uint64 `json:"id"`
+}
+
+// ManifestFile tells the client where to upload a file, or that it was instant-uploaded.
+type ManifestFile struct {
+	Path     string `json:"path"`
+	ParentId uint64 `json:"parent_id"`
+	FileName string `json:"file_name"`
+	Error    string `json:"error,omitempty"`
+	FastUploadResponse
+}
+
+// ProofChallenge asks the client to prove it holds the file content.
+// proof = hex(sha256(nonce + content[offset:offset+length]))
+type ProofChallenge struct {
+	Nonce  string `json:"nonce"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// EntryResult reports where an entry ended up after a create, move, copy or restore.
+type EntryResult struct {
+	SourceID uint64 `json:"source_id,omitempty"`
+	FileID   uint64 `json:"file_id"`
+	Name     string `json:"name"`
+	Action   string `json:"action"` // ok / renamed / overwritten / merged / skipped
+}
+
+// SimpleUploadResponse is the response for a single-request upload.
+type SimpleUploadResponse struct {
+	FileId   uint64 `json:"file_id"`
+	FileName string `json:"file_name"`
+	Action   string `json:"action"` // 见 EntryResult.Action
+	Hash     string `json:"hash,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Deduped  bool   `json:"deduped,omitempty"` // 内容已存在 复用了已有对象
 }
 
 
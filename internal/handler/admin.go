@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"CloudVault/internal/dto"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListStorageNodes returns the health state of every storage cluster node.
+func ListStorageNodes(c *gin.Context) {
+	checker := storage.GetHealthChecker()
+	if checker == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "storage cluster not enabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"nodes": checker.Snapshot()})
+}
+
+// ListScrubIssues returns objects the scrubber could not recover.
+func ListScrubIssues(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	issues, err := service.ListScrubIssues(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list scrub issues failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"issues": issues})
+}
+
+// MigrateDedupScope re-keys existing file objects to the configured DEDUP_SCOPE.
+func MigrateDedupScope(c *gin.Context) {
+	result, err := service.MigrateDedupScope(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "migrate dedup scope failed: " + err.Error(), "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// SetUserTenant assigns a user to a tenant for tenant-scoped dedup.
+func SetUserTenant(c *gin.Context) {
+	var req dto.SetUserTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if err := service.SetUserTenant(req.UserID, req.TenantID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "set tenant failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": req.UserID, "tenant_id": req.TenantID})
+}
+
+// SetUserTier assigns a user to a download tier of DOWNLOAD_TIERS.
+func SetUserTier(c *gin.Context) {
+	var req dto.SetUserTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if err := service.SetUserTier(req.UserID, req.Tier); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case errors.Is(err, service.ErrUnknownTier):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "set tier failed: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": req.UserID, "tier": strings.ToLower(strings.TrimSpace(req.Tier))})
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"CloudVault/internal/service"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// objectETag is the entity tag of an object; its content hash never changes.
+func objectETag(obj *model.FileObject) string {
+	return strconv.Quote(obj.Hash)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when no entity tag is sent.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return utils.ETagMatch(inm, etag)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || modified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	return err == nil && !modified.Truncate(time.Second).After(t)
+}
+
+// serveObject streams obj with validators, answering conditional and Range requests (206, with
+// multipart/byteranges for several ranges). Callers set Content-Disposition beforehand.
+// modified is when the user's file last changed; the deduplicated object may be older than that
+// content, e.g. after a version restore.
+// fromStart reports whether the response carried the first byte, so a download that resumes or
+// seeks is recorded once. Errors before anything was written can still be reported by the caller.
+func serveObject(c *gin.Context, obj *model.FileObject, modified time.Time, contentType string) (written int64, fromStart bool, err error) {
+	etag := objectETag(obj)
+	modified = modified.UTC()
+	c.Header("ETag", etag)
+	if !modified.IsZero() {
+		c.Header("Last-Modified", modified.Format(http.TimeFormat))
+	}
+	c.Header("Accept-Ranges", "bytes")
+
+	if notModified(c.Request, etag, modified) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Status(http.StatusNotModified)
+		} else {
+			c.Status(http.StatusPreconditionFailed)
+		}
+		c.Writer.WriteHeaderNow()
+		return 0, false, nil
+	}
+
+	var ranges []utils.ByteRange
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" &&
+		utils.IfRangeMatch(c.GetHeader("If-Range"), etag, modified) {
+		ranges, err = utils.ParseRange(rangeHeader, obj.Size)
+		if errors.Is(err, utils.ErrRangeNotSatisfiable) {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", obj.Size))
+			c.Status(http.StatusRequestedRangeNotSatisfiable)
+			c.Writer.WriteHeaderNow()
+			return 0, false, nil
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		reader, info, err := service.MinioDownloadObject(c.Request.Context(), obj.ObjectName)
+		if err != nil {
+			return 0, false, err
+		}
+		defer reader.Close()
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+		c.Status(http.StatusOK)
+		written, err = io.Copy(c.Writer, reader)
+		return written, true, err
+	case 1:
+		r := ranges[0]
+		reader, _, err := service.MinioDownloadObjectRange(c.Request.Context(), obj.ObjectName, r.Start, r.Length)
+		if err != nil {
+			return 0, false, err
+		}
+		defer reader.Close()
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Range", r.ContentRange(obj.Size))
+		c.Header("Content-Length", strconv.FormatInt(r.Length, 10))
+		c.Status(http.StatusPartialContent)
+		written, err = io.Copy(c.Writer, reader)
+		return written, r.Start == 0, err
+	}
+	return serveRanges(c, obj, contentType, ranges)
+}
+
+// serveRanges writes several ranges of obj as multipart/byteranges.
+func serveRanges(c *gin.Context, obj *model.FileObject, contentType string, ranges []utils.ByteRange) (int64, bool, error) {
+	// 第一段先打开 对象缺失时还能返回错误而不是半截响应
+	first, _, err := service.MinioDownloadObjectRange(c.Request.Context(), obj.ObjectName, ranges[0].Start, ranges[0].Length)
+	if err != nil {
+		return 0, false, err
+	}
+	partHeader := func(r utils.ByteRange) textproto.MIMEHeader {
+		return textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {r.ContentRange(obj.Size)},
+		}
+	}
+	// 先对空输出走一遍 得到 Content-Length
+	counter := &countingWriter{}
+	mw := multipart.NewWriter(counter)
+	for _, r := range ranges {
+		_, _ = mw.CreatePart(partHeader(r))
+		counter.n += r.Length
+	}
+	_ = mw.Close()
+
+	boundary := mw.Boundary()
+	mw = multipart.NewWriter(c.Writer)
+	if err := mw.SetBoundary(boundary); err != nil {
+		_ = first.Close()
+		return 0, false, err
+	}
+	c.Header("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	c.Header("Content-Length", strconv.FormatInt(counter.n, 10))
+	c.Status(http.StatusPartialContent)
+	var written int64
+	for i, r := range ranges {
+		reader := first
+		if i > 0 {
+			if reader, _, err = service.MinioDownloadObjectRange(c.Request.Context(), obj.ObjectName, r.Start, r.Length); err != nil {
+				return written, ranges[0].Start == 0, err
+			}
+		}
+		part, err := mw.CreatePart(partHeader(r))
+		if err == nil {
+			var n int64
+			n, err = io.Copy(part, reader)
+			written += n
+		}
+		_ = reader.Close()
+		if err != nil {
+			return written, ranges[0].Start == 0, err
+		}
+	}
+	return written, ranges[0].Start == 0, mw.Close()
+}
+
+// throttledResponse sends the response body through the rate limits of a download.
+type throttledResponse struct {
+	gin.ResponseWriter
+	body io.Writer
+}
+
+func (w *throttledResponse) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+func (w *throttledResponse) WriteString(s string) (int, error) {
+	return w.body.Write([]byte(s))
+}
+
+// limitDownload answers 429 when acquiring the download stream failed on a concurrency limit and
+// otherwise throttles the response to its byte rates. Callers release the stream when done.
+func limitDownload(c *gin.Context, stream *service.DownloadStream, err error, errKey string) bool {
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrTooManyStreams) {
+			status = http.StatusTooManyRequests
+			c.Header("Retry-After", "5")
+		}
+		c.JSON(status, gin.H{errKey: err.Error()})
+		return false
+	}
+	if body := stream.Writer(c.Writer); body != io.Writer(c.Writer) {
+		c.Writer = &throttledResponse{ResponseWriter: c.Writer, body: body}
+	}
+	return true
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -1,14 +1,17 @@
 package handler
 
 import (
+	"CloudVault/config"
 	"CloudVault/internal/dto"
 	"CloudVault/internal/service"
 	"CloudVault/internal/storage"
 	"CloudVault/internal/task"
+	"CloudVault/model"
 	"CloudVault/utils"
-	"archive/zip"
+	"context"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
 	neturl "net/url"
 	"path"
@@ -17,6 +20,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // UploadFileByHash handles hash-based instant upload.
@@ -32,6 +36,87 @@ func UploadFileByHash(c *gin.Context) {
 		&req,
 	)
 	if err != nil {
+		if status, ok := uploadErrorStatus(err); ok {
+			utils.FailStatus(c, status, err)
+			return
+		}
+		utils.Fail(c, err)
+		return
+	}
+	utils.Success(c, resp)
+}
+
+// UploadFile handles a single-request multipart/form-data upload of one small file.
+// 表单字段: file (必填)、file_name、parent_id、relative_path、conflict_policy
+func UploadFile(c *gin.Context) {
+	if max := config.AppConfig.SimpleUploadMaxSize; max > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max+1<<20) // 留出表单字段的余量
+	}
+	// 超过限制时 读取表单先失败 ShouldBind 与 FormFile 都可能返回 MaxBytesError
+	var tooLarge *http.MaxBytesError
+	var req dto.SimpleUploadRequest
+	if err := c.ShouldBind(&req); err != nil {
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrFileTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrFileTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file required"})
+		return
+	}
+	if req.FileName == "" && req.RelativePath == "" {
+		req.FileName = path.Base(strings.ReplaceAll(fileHeader.Filename, "\\", "/"))
+		if req.FileName == "." || req.FileName == "/" {
+			req.FileName = ""
+		}
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		utils.Fail(c, err)
+		return
+	}
+	defer file.Close()
+
+	userID := c.MustGet("user_id").(uint64)
+	resp, err := service.SimpleUpload(c.Request.Context(), userID, req, file, fileHeader.Size)
+	if err != nil {
+		if errors.Is(err, service.ErrFileTooLarge) {
+			utils.FailStatus(c, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		if status, ok := uploadErrorStatus(err); ok {
+			utils.FailStatus(c, status, err)
+			return
+		}
+		utils.Fail(c, err)
+		return
+	}
+	utils.Success(c, resp)
+}
+
+// UploadManifest creates the folders of a tree to be uploaded and tells the client
+// where each file goes; files with a known hash are instant-uploaded.
+func UploadManifest(c *gin.Context) {
+	var req dto.UploadManifestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	resp, err := service.ApplyUploadManifest(c.Request.Context(), userID, req)
+	if err != nil {
+		if status, ok := uploadErrorStatus(err); ok {
+			utils.FailStatus(c, status, err)
+			return
+		}
 		utils.Fail(c, err)
 		return
 	}
@@ -64,6 +149,30 @@ func HttpOfflineDownload(c *gin.Context) {
 	c.JSON(200, gin.H{"msg": "download task created", "task_id": downloadTask.ID})
 }
 
+// ExtractArchive queues the extraction of a stored ZIP or TAR archive into a folder.
+func ExtractArchive(c *gin.Context) {
+	var req dto.ExtractArchiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	extractTask, err := task.CreateExtractTask(userID, req.FileID, req.ParentID, req.ConflictPolicy)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, service.ErrInvalidArchive), errors.Is(err, service.ErrParentNotFound),
+			errors.Is(err, service.ErrInvalidConflictPolicy):
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "extract task created", "task_id": extractTask.ID})
+}
+
 // UploadFileByURL downloads a URL and stores it in MinIO as a user file.
 func UploadFileByURL(c *gin.Context) {
 	var req dto.URLUploadRequest
@@ -80,12 +189,21 @@ func UploadFileByURL(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "file_name required"})
 		return
 	}
+	policy, err := service.ParseConflictPolicy(req.ConflictPolicy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	var parentID *uint64
 	if req.ParentID != 0 {
 		parentID = &req.ParentID
 	}
-	file, err := service.UploadFromURL(c.Request.Context(), userID, req.URL, fileName, parentID)
+	file, result, err := service.UploadFromURL(c.Request.Context(), userID, req.URL, fileName, parentID, policy)
 	if err != nil {
+		if status, ok := conflictErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -95,9 +213,56 @@ func UploadFileByURL(c *gin.Context) {
 		"name":      file.Name,
 		"size":      file.Size,
 		"parent_id": file.ParentID,
+		"action":    result.Action,
 	})
 }
 
+// quotaErrorStatus maps quota errors to 413 (file larger than the whole quota) or 507.
+func quotaErrorStatus(err error) (int, bool) {
+	var quotaErr *service.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return 0, false
+	}
+	if quotaErr.TooLarge() {
+		return http.StatusRequestEntityTooLarge, true
+	}
+	return http.StatusInsufficientStorage, true
+}
+
+// uploadErrorStatus extends quotaErrorStatus with content verification errors.
+func uploadErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, service.ErrInvalidHash),
+		errors.Is(err, service.ErrInvalidChecksum),
+		errors.Is(err, service.ErrChunkLayout),
+		errors.Is(err, service.ErrChunkIndex),
+		errors.Is(err, service.ErrChunkNotUploaded),
+		errors.Is(err, service.ErrInvalidPath),
+		errors.Is(err, service.ErrParentNotFound):
+		return http.StatusBadRequest, true
+	case errors.Is(err, service.ErrPathConflict):
+		return http.StatusConflict, true
+	case errors.Is(err, service.ErrUploadRemoved):
+		return http.StatusNotFound, true
+	case errors.Is(err, service.ErrContentHashMismatch),
+		errors.Is(err, service.ErrChunkChecksumMismatch),
+		errors.Is(err, service.ErrChunkSizeMismatch):
+		return http.StatusUnprocessableEntity, true
+	}
+	return conflictErrorStatus(err)
+}
+
+// conflictErrorStatus maps conflict_policy errors of uploads, moves, copies and restores to HTTP status codes.
+func conflictErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, service.ErrInvalidConflictPolicy):
+		return http.StatusBadRequest, true
+	case errors.Is(err, service.ErrNameConflict):
+		return http.StatusConflict, true
+	}
+	return quotaErrorStatus(err)
+}
+
 func inferFileNameFromURL(rawURL string) string {
 	parsed, err := neturl.Parse(strings.TrimSpace(rawURL))
 	if err != nil {
@@ -110,73 +275,131 @@ func inferFileNameFromURL(rawURL string) string {
 	return base
 }
 
-// DownloadArchive downloads multiple files or folders as a zip archive.
-func DownloadArchive(c *gin.Context) {
+// archiveRequest loads the entries and options of a batch download, answering errors itself.
+func archiveRequest(c *gin.Context) (*dto.ArchiveDownloadRequest, []service.ArchiveEntry, *service.ArchiveEstimate, bool) {
 	var req dto.ArchiveDownloadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
-		return
+		return nil, nil, nil, false
 	}
 	if len(req.FileIDs) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "file_ids required"})
-		return
+		return nil, nil, nil, false
+	}
+	opts, err := service.ParseArchiveOptions(req.Format, req.Compression)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, nil, false
 	}
 	userID := c.MustGet("user_id").(uint64)
 	entries, err := service.BuildArchiveEntries(userID, req.FileIDs)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, nil, false
+	}
+	est, err := service.EstimateArchive(entries, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "estimate": est})
+		return nil, nil, nil, false
+	}
+	return &req, entries, est, true
+}
+
+// EstimateArchive returns the size and resolved format of a batch download before it starts.
+func EstimateArchive(c *gin.Context) {
+	_, _, est, ok := archiveRequest(c)
+	if !ok {
 		return
 	}
+	c.JSON(http.StatusOK, est)
+}
 
-	name := req.Name
-	if name == "" {
-		name = "archive.zip"
+// DownloadArchive downloads multiple files or folders as a zip, zip64, tar or tar.gz archive.
+// 中途读取失败的文件写入 ARCHIVE_ERRORS.txt 失败数量通过 X-Archive-Errors trailer 返回
+func DownloadArchive(c *gin.Context) {
+	req, entries, est, ok := archiveRequest(c)
+	if !ok {
+		return
 	}
-	name = utils.SanitizeHeaderFilename(name)
+	if storage.Default == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "storage not initialized"})
+		return
+	}
+	stream, err := service.AcquireUserDownload(c.Request.Context(), c.MustGet("user_id").(uint64))
+	if !limitDownload(c, stream, err, "error") {
+		return
+	}
+	defer stream.Release()
+
+	name := utils.SanitizeHeaderFilename(service.ArchiveFileName(req.Name, est.Format))
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
-	c.Header("Content-Type", "application/zip")
-
-	zipWriter := zip.NewWriter(c.Writer)
-	defer zipWriter.Close()
-
-	for _, entry := range entries {
-		if entry.IsDir {
-			if _, err := zipWriter.Create(entry.ZipPath); err != nil {
-				c.Status(http.StatusInternalServerError)
-				return
-			}
-			continue
-		}
-		if entry.FileObj == nil {
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-		if storage.Default == nil {
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-		object, _, err := storage.Default.GetObject( // 获取文件
-			c.Request.Context(),
-			entry.FileObj.BucketName,
-			entry.FileObj.ObjectName,
-		)
-		if err != nil {
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-		writer, err := zipWriter.Create(entry.ZipPath) // 写入路径信息
-		if err != nil {
-			_ = object.Close()
-			c.Status(http.StatusInternalServerError)
-			return
+	c.Header("Content-Type", service.ArchiveContentType(est.Format))
+	c.Header("Trailer", "X-Archive-Errors")
+	c.Status(http.StatusOK)
+
+	result, err := service.WriteArchive(c.Request.Context(), c.Writer, entries, service.ArchiveOptions{
+		Format:      est.Format,
+		Compression: est.Compression,
+	})
+	if err != nil { // 响应已开始 只能中断
+		log.Printf("archive download failed: %v", err)
+		return
+	}
+	c.Writer.Header().Set("X-Archive-Errors", strconv.Itoa(len(result.Errors)))
+}
+
+// CreateArchiveTask queues a batch download to be built in the background; the archive is fetched
+// later through GetArchiveTask, so large folders do not hold a connection for the whole run.
+func CreateArchiveTask(c *gin.Context) {
+	var req dto.ArchiveDownloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	archiveTask, err := task.CreateArchiveTask(userID, req.FileIDs, req.Name, service.ArchiveOptions{
+		Format:      req.Format,
+		Compression: req.Compression,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, service.ErrArchiveFormat), errors.Is(err, service.ErrArchiveNeedsZip64):
+			status = http.StatusBadRequest
 		}
-		if _, err := io.Copy(writer, object); err != nil { // 流式写入
-			_ = object.Close()
-			c.Status(http.StatusInternalServerError)
-			return
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "archive task created", "task_id": archiveTask.ID})
+}
+
+// GetArchiveTask returns the status of an archive task, with a download link once it has completed.
+func GetArchiveTask(c *gin.Context) {
+	taskID, err := strconv.ParseUint(c.Param("taskID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid task id"})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	archiveTask, url, err := task.GetArchiveTask(c.Request.Context(), userID, taskID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		case errors.Is(err, task.ErrArchiveExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error(), "task": archiveTask})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
-		_ = object.Close()
+		return
 	}
+	resp := gin.H{"task": archiveTask}
+	if url != "" {
+		resp["url"] = url
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // GetFileList returns a user's file list.
@@ -236,13 +459,24 @@ func MoveFiles(c *gin.Context) {
 		return
 	}
 
+	policy, err := service.ParseConflictPolicy(req.ConflictPolicy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	userID := c.MustGet("user_id").(uint64)
-	if err := service.MoveFiles(userID, req.FileIDs, req.TargetID); err != nil {
+	results, err := service.MoveFilesWithPolicy(userID, req.FileIDs, req.TargetID, policy)
+	if err != nil {
+		if status, ok := conflictErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": "move files failed: " + err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "move files failed: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"msg": "success"})
+	c.JSON(http.StatusOK, gin.H{"msg": "success", "results": results})
 }
 
 // CopyFiles copies files or folders to a target.
@@ -253,13 +487,24 @@ func CopyFiles(c *gin.Context) {
 		return
 	}
 
+	policy, err := service.ParseConflictPolicy(req.ConflictPolicy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	userID := c.MustGet("user_id").(uint64)
-	if err := service.CopyFiles(userID, req.FileIDs, req.TargetID); err != nil {
+	results, err := service.CopyFilesWithPolicy(userID, req.FileIDs, req.TargetID, policy)
+	if err != nil {
+		if status, ok := conflictErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": "copy files failed: " + err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "copy files failed: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"msg": "success"})
+	c.JSON(http.StatusOK, gin.H{"msg": "success", "results": results})
 }
 
 // CreateFolder creates a folder.
@@ -361,3 +606,42 @@ func ListDownloadTasks(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
 }
+
+// CancelDownloadTask cancels an offline task; a running transfer stops and its partial object is removed.
+func CancelDownloadTask(c *gin.Context) {
+	controlDownloadTask(c, task.CancelDownloadTask)
+}
+
+// PauseDownloadTask pauses an offline task until it is resumed.
+func PauseDownloadTask(c *gin.Context) {
+	controlDownloadTask(c, task.PauseDownloadTask)
+}
+
+// ResumeDownloadTask queues a paused offline task again.
+func ResumeDownloadTask(c *gin.Context) {
+	controlDownloadTask(c, task.ResumeDownloadTask)
+}
+
+func controlDownloadTask(c *gin.Context, action func(context.Context, uint64, uint64) (*model.DownloadTask, error)) {
+	var req dto.DownloadTaskControlRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	downloadTask, err := action(c.Request.Context(), userID, req.TaskID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		case errors.Is(err, task.ErrTaskState):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "task": downloadTask})
+		case errors.Is(err, task.ErrTaskNotControllable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"task": downloadTask})
+}
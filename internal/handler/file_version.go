@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"CloudVault/internal/dto"
+	"CloudVault/internal/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// versionErrorStatus maps service errors of the version endpoints to HTTP status codes.
+func versionErrorStatus(err error) int {
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, service.ErrVersionNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// ListFileVersions lists the earlier versions of a file.
+func ListFileVersions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint64)
+	fileID, err := strconv.ParseUint(strings.TrimSpace(c.Param("fileID")), 10, 64)
+	if err != nil || fileID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+	file, versions, err := service.ListFileVersions(userID, fileID)
+	if err != nil {
+		c.JSON(versionErrorStatus(err), gin.H{"error": "list versions failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"file": file, "versions": versions})
+}
+
+// FileVersionDownloadURL returns a presigned download URL for one version of a file.
+func FileVersionDownloadURL(c *gin.Context) {
+	var req dto.FileVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "download failed: " + err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	file, version, err := service.GetFileVersion(userID, req.FileID, req.VersionID)
+	if err != nil {
+		c.JSON(versionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	fileObj, err := service.GetFileObjectById(version.ObjectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	name := versionFileName(file.Name, version.Version)
+	url, err := service.GetDownloadURL(c.Request.Context(), fileObj.BucketName, fileObj.ObjectName, name, 10*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"url":     url,
+		"name":    name,
+		"size":    version.Size,
+		"version": version.Version,
+	})
+}
+
+// RestoreFileVersion makes a version the current content of a file.
+func RestoreFileVersion(c *gin.Context) {
+	var req dto.FileVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	file, err := service.RestoreFileVersion(userID, req.FileID, req.VersionID)
+	if err != nil {
+		c.JSON(versionErrorStatus(err), gin.H{"error": "restore version failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "success", "file": file})
+}
+
+// versionFileName names a downloaded version "report.v2.pdf" so it does not clash with the current file.
+func versionFileName(name string, version int) string {
+	ext := ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name, ext = name[:i], name[i:]
+	}
+	return fmt.Sprintf("%s.v%d%s", name, version, ext)
+}
@@ -8,8 +8,8 @@ import (
 	"CloudVault/internal/service"
 	"CloudVault/model"
 	"CloudVault/utils"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"path"
@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // MinioDownloadFile streams a file from MinIO.
@@ -55,7 +56,7 @@ func MinioDownloadFile(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "file_id or file_hash required"})
 			return
 		}
-		fileObj, err = service.GetFileObjectByHash(hash)
+		fileObj, err = service.GetFileObjectByHash(userID, hash)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 			return
@@ -67,37 +68,37 @@ func MinioDownloadFile(c *gin.Context) {
 		}
 	}
 
-	object, info, err := service.MinioDownloadObject(
-		c.Request.Context(),
-		fileObj.ObjectName,
-	)
-	if err != nil {
-		c.JSON(404, gin.H{"error": err.Error()})
+	stream, err := service.AcquireUserDownload(c.Request.Context(), userID)
+	if !limitDownload(c, stream, err, "error") {
 		return
 	}
-	defer object.Close()
+	defer stream.Release()
 
 	fileName := userFile.Name
 	if fileName == "" {
-		fileName = path.Base(info.ObjectName)
+		fileName = path.Base(fileObj.ObjectName)
 	}
 	fileName = utils.SanitizeHeaderFilename(fileName)
-	contentType := service.GetContentBook(fileName)
-	if contentType == "" {
-		contentType = "application/octet-stream"
-	}
 	c.Header(
 		"Content-Disposition",
 		fmt.Sprintf("attachment; filename=\"%s\"", fileName),
 	)
-	c.Header("Content-Type", contentType)
-	c.Header("Content-Length", fmt.Sprintf("%d", info.Size))
+	c.Header("X-Content-Type-Options", "nosniff")
 
-	written, err := io.Copy(c.Writer, object)
+	// 支持 Range / 条件请求 断点续传和拖动进度只在包含开头时记一次下载
+	written, fromStart, err := serveObject(c, fileObj, userFile.UpdatedAt, service.ObjectContentType(fileObj, fileName))
 	if err != nil {
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
 		log.Println("download error:", err)
 		return
 	}
+	if !fromStart {
+		return
+	}
 	// 下载后的行为记录 && 下载统计
 	_ = service.RecordRecentAccess(userID, userFile.ID, "download")
 	_ = activity.Emit(c.Request.Context(), userID, activity.ActionDownload, userFile.ID, written)
@@ -138,7 +139,7 @@ func MinioDownloadURL(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "file_id or file_hash required"})
 			return
 		}
-		fileObj, err = service.GetFileObjectByHash(hash)
+		fileObj, err = service.GetFileObjectByHash(userID, hash)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 			return
@@ -178,6 +179,10 @@ func MultiPartFileInit(c *gin.Context) {
 	req.UserId = c.MustGet("user_id").(uint64)
 	resp, err := service.MultiPartFileInit(c.Request.Context(), req)
 	if err != nil {
+		if status, ok := uploadErrorStatus(err); ok {
+			utils.FailStatus(c, status, err)
+			return
+		}
 		utils.Fail(c, err)
 		return
 	}
@@ -219,18 +224,69 @@ func MultipartUploadChunk(c *gin.Context) {
 		UploadID:   uploadID,
 		BucketName: config.AppConfig.BucketName,
 		ChunkIndex: chunkIndex,
+		FileHash:   session.FileHash,
+		Checksum:   c.PostForm("checksum"),
 		File:       file,
 	}
 	if err := service.UploadChunk(
 		c.Request.Context(),
 		req,
 	); err != nil {
+		if status, ok := uploadErrorStatus(err); ok {
+			c.JSON(status, gin.H{"msg": err.Error()})
+			return
+		}
 		c.JSON(500, gin.H{"msg": err.Error()})
 		return
 	}
 	c.JSON(200, gin.H{"msg": "ok"})
 }
 
+// MultipartAbort cancels an in-flight multipart upload and removes its chunks.
+func MultipartAbort(c *gin.Context) {
+	var req dto.MultipartAbortRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"msg": err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	if err := service.AbortUpload(c.Request.Context(), userID, req.UploadID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(404, gin.H{"msg": "upload session not found"})
+		case errors.Is(err, service.ErrUploadInProgress):
+			c.JSON(409, gin.H{"msg": err.Error()})
+		default:
+			c.JSON(500, gin.H{"msg": err.Error()})
+		}
+		return
+	}
+	c.JSON(200, gin.H{"msg": "upload aborted"})
+}
+
+// MultipartConfirm records chunks uploaded directly to storage through presigned URLs.
+// 出错时返回已确认的分片 客户端只需重传出错的分片
+func MultipartConfirm(c *gin.Context) {
+	var req dto.MultipartConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"msg": err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	confirmed, err := service.ConfirmChunks(c.Request.Context(), userID, req)
+	if err != nil {
+		status := 500
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = 404
+		} else if s, ok := uploadErrorStatus(err); ok {
+			status = s
+		}
+		c.JSON(status, gin.H{"msg": err.Error(), "chunks": confirmed})
+		return
+	}
+	c.JSON(200, gin.H{"msg": "ok", "chunks": confirmed})
+}
+
 // MultipartComplete completes multipart upload.
 func MultipartComplete(c *gin.Context) {
 	var req dto.MultipartCompleteRequest
@@ -255,10 +311,9 @@ func MultipartComplete(c *gin.Context) {
 	if req.FileSize <= 0 && session.FileSize > 0 {
 		req.FileSize = session.FileSize
 	}
-	lockKey := "lock:merge:" + strconv.FormatUint(userID, 10) + ":" + req.FileHash
 	lock := repo.NewRedisLock(
 		repo.Redis,
-		lockKey,
+		service.UploadMergeLockKey(userID, req.FileHash),
 		30*time.Second,
 	)
 	ctx := c.Request.Context()
@@ -267,13 +322,18 @@ func MultipartComplete(c *gin.Context) {
 		return
 	}
 	defer lock.Unlock(ctx)
-	if err := service.CompleteFile(
+	result, err := service.CompleteFile(
 		c.Request.Context(),
 		req,
 		userName,
-	); err != nil {
+	)
+	if err != nil {
+		if status, ok := uploadErrorStatus(err); ok {
+			c.JSON(status, gin.H{"msg": err.Error()})
+			return
+		}
 		c.JSON(500, gin.H{"msg": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"msg": "upload completed"})
+	c.JSON(200, gin.H{"msg": "upload completed", "file": result})
 }
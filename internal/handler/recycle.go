@@ -30,13 +30,24 @@ func RestoreFile(c *gin.Context) {
 		return
 	}
 
+	policy, err := service.ParseConflictPolicy(req.ConflictPolicy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	userID := c.MustGet("user_id").(uint64)
-	if err := service.RestoreFile(uint(userID), uint(req.FileID)); err != nil {
+	result, err := service.RestoreFileWithPolicy(uint(userID), uint(req.FileID), policy)
+	if err != nil {
+		if status, ok := conflictErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": "restore file failed: " + err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "restore file failed: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"msg": "success"})
+	c.JSON(http.StatusOK, gin.H{"msg": "success", "file": result})
 }
 
 // DeleteFileRecord 彻底删除文件
@@ -6,7 +6,6 @@ import (
 	"CloudVault/internal/service"
 	"CloudVault/utils"
 	"fmt"
-	"io"
 	"log"
 	"strings"
 
@@ -71,34 +70,34 @@ func ShareDownload(c *gin.Context) {
 		return
 	}
 
-	object, info, err := service.MinioDownloadObject(
-		c.Request.Context(),
-		fileObject.ObjectName,
-	)
-	if err != nil {
-		c.JSON(500, gin.H{"msg": err.Error()})
+	stream, err := service.AcquireShareDownload(c.Request.Context(), share)
+	if !limitDownload(c, stream, err, "msg") {
 		return
 	}
-	defer object.Close()
+	defer stream.Release()
 
 	// 设置响应头阶段
 	safeName := utils.SanitizeHeaderFilename(userFile.Name)
 	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, safeName))
-	contentType := service.GetContentBook(userFile.Name)
-	if contentType == "" {
-		contentType = "application/octet-stream"
-	}
-	c.Header("Content-Type", contentType)
-	c.Header("Content-Length", fmt.Sprintf("%d", info.Size))
+	c.Header("X-Content-Type-Options", "nosniff")
 
-	if _, err := io.Copy(c.Writer, object); err != nil {
+	written, fromStart, err := serveObject(c, fileObject, userFile.UpdatedAt, service.ObjectContentType(fileObject, userFile.Name))
+	if err != nil {
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(500, gin.H{"msg": err.Error()})
+			return
+		}
 		log.Printf("share download stream failed: %v", err)
 		return
 	}
+	if !fromStart { // 续传或分段请求不重复记录访问
+		return
+	}
 	_ = service.LogShareAccess(share, service.ShareAccessMeta{ // 记录分享访问日志
 		VisitorIP: c.ClientIP(),
 		UserAgent: c.Request.UserAgent(),
 		Referer:   c.Request.Referer(),
 	})
-	_ = activity.Emit(c.Request.Context(), share.UserID, activity.ActionDownload, share.FileID, info.Size) //记录下载行为埋点
+	_ = activity.Emit(c.Request.Context(), share.UserID, activity.ActionDownload, share.FileID, written) //记录下载行为埋点
 }
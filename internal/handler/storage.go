@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"CloudVault/internal/storage"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LocalObjectDownload serves presigned GET URLs issued by the local filesystem store.
+func LocalObjectDownload(c *gin.Context) {
+	store, ok := storage.Default.(*storage.LocalStore)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "local storage disabled"})
+		return
+	}
+	bucket := c.Param("bucket")
+	object := strings.TrimPrefix(c.Param("object"), "/")
+	query := c.Request.URL.Query()
+	if err := store.VerifyPresigned(bucket, object, query, time.Now()); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, info, err := store.GetObject(c.Request.Context(), bucket, object)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, storage.ErrInvalidObjectName) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "object not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	contentType := query.Get("response-content-type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	headers := map[string]string{}
+	if disposition := query.Get("response-content-disposition"); disposition != "" {
+		headers["Content-Disposition"] = disposition
+	}
+	c.DataFromReader(http.StatusOK, info.Size, contentType, reader, headers)
+}
+
+// LocalObjectUpload accepts presigned PUT URLs issued by the local filesystem store.
+func LocalObjectUpload(c *gin.Context) {
+	store, ok := storage.Default.(*storage.LocalStore)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "local storage disabled"})
+		return
+	}
+	bucket := c.Param("bucket")
+	object := strings.TrimPrefix(c.Param("object"), "/")
+	if err := store.VerifyPresignedPut(bucket, object, c.Request.URL.Query(), time.Now()); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Request.ContentLength < 0 {
+		c.JSON(http.StatusLengthRequired, gin.H{"error": "content length required"})
+		return
+	}
+	if err := store.PutObject(c.Request.Context(), bucket, object, c.Request.Body, c.Request.ContentLength, storage.PutOptions{}); err != nil {
+		if errors.Is(err, storage.ErrInvalidObjectName) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"CloudVault/internal/service"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// tus 1.0 协议 https://tus.io/protocols/resumable-upload
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum"
+
+	statusChecksumMismatch = 460 // tus checksum 扩展定义的状态码
+)
+
+// tusResumable checks the Tus-Resumable request header and echoes it on the response.
+func tusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseTusMetadata decodes "key base64,key base64" pairs; a key may have no value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, errors.New("invalid Upload-Metadata")
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// tusErrorStatus maps service errors of the tus endpoints to HTTP status codes.
+func tusErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrTusOffsetMismatch), errors.Is(err, service.ErrUploadInProgress):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrTusTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrChunkChecksumMismatch):
+		return statusChecksumMismatch
+	case errors.Is(err, service.ErrInvalidChecksum), errors.Is(err, service.ErrParentNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrTusBusy):
+		return http.StatusLocked
+	}
+	if status, ok := uploadErrorStatus(err); ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// TusOptions advertises the supported tus version and extensions.
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Checksum-Algorithm", strings.Join(service.TusChecksumAlgorithms, ","))
+	c.Status(http.StatusNoContent)
+}
+
+// TusCreate creates an upload (creation extension).
+// Upload-Metadata 支持 filename (或 name)、relativePath、parent_id 与 conflict_policy
+func TusCreate(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Defer-Length is not supported"})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Upload-Length"})
+		return
+	}
+	rawMeta := c.GetHeader("Upload-Metadata")
+	meta, err := parseTusMetadata(rawMeta)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := meta["relativePath"] // 上传文件夹时 Uppy 等客户端携带的相对路径
+	if name == "" {
+		name = meta["filename"]
+	}
+	if name == "" {
+		name = meta["name"]
+	}
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filename metadata required"})
+		return
+	}
+	var parentID uint64
+	if value := meta["parent_id"]; value != "" {
+		if parentID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid parent_id"})
+			return
+		}
+	}
+
+	userID := c.MustGet("user_id").(uint64)
+	userName := c.GetString("username")
+	session, err := service.CreateTusUpload(c.Request.Context(), userID, userName, name, parentID, length, rawMeta, meta["conflict_policy"])
+	if err != nil {
+		c.JSON(tusErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+session.UploadID)
+	c.Status(http.StatusCreated)
+}
+
+// TusHead returns the current offset of an upload.
+func TusHead(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	session, offset, err := service.GetTusUpload(userID, c.Param("uploadID"))
+	if err != nil {
+		c.AbortWithStatus(tusErrorStatus(err))
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.FileSize, 10))
+	if session.Metadata != "" {
+		c.Header("Upload-Metadata", session.Metadata)
+	}
+	c.Status(http.StatusOK)
+}
+
+// TusPatch appends bytes to an upload; the last PATCH completes the file.
+func TusPatch(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "content type must be application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Upload-Offset"})
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	newOffset, err := service.WriteTusChunk(
+		c.Request.Context(),
+		userID,
+		c.GetString("username"),
+		c.Param("uploadID"),
+		offset,
+		c.Request.Body,
+		c.GetHeader("Upload-Checksum"),
+	)
+	if err != nil {
+		c.JSON(tusErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// TusDelete terminates an upload and removes the received data (termination extension).
+func TusDelete(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	userID := c.MustGet("user_id").(uint64)
+	if err := service.AbortUpload(c.Request.Context(), userID, c.Param("uploadID")); err != nil {
+		c.JSON(tusErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TusMethodOverride serves clients that can only send POST, via X-HTTP-Method-Override.
+func TusMethodOverride(c *gin.Context) {
+	switch strings.ToUpper(c.GetHeader("X-HTTP-Method-Override")) {
+	case http.MethodPatch:
+		TusPatch(c)
+	case http.MethodDelete:
+		TusDelete(c)
+	case http.MethodHead:
+		TusHead(c)
+	default:
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "unsupported method"})
+	}
+}
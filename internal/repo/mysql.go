@@ -21,6 +21,7 @@ var Db *gorm.DB
 func autoMigrateAll(db *gorm.DB) {
 	db.AutoMigrate(&model.User{})
 	db.AutoMigrate(&model.FileObject{})
+	migrateFileObjectIndexes(db)
 	db.AutoMigrate(&model.UserFile{})
 	migrateUserFileIndexes(db)
 	db.AutoMigrate(&model.FileChunk{})
@@ -31,6 +32,12 @@ func autoMigrateAll(db *gorm.DB) {
 	db.AutoMigrate(&model.UserFavorite{})
 	db.AutoMigrate(&model.UserRecent{})
 	db.AutoMigrate(&model.ShareAccessLog{})
+	db.AutoMigrate(&model.ObjectReplica{})
+	db.AutoMigrate(&model.ReplicaTombstone{})
+	db.AutoMigrate(&model.MigrationJob{})
+	db.AutoMigrate(&model.MigrationItem{})
+	db.AutoMigrate(&model.ObjectScrubIssue{})
+	db.AutoMigrate(&model.FileVersion{})
 }
 
 // migrateUserFileIndexes keeps user_file uniqueness aligned with active/deleted state.
@@ -54,6 +61,28 @@ func migrateUserFileIndexes(db *gorm.DB) {
 	}
 }
 
+// migrateFileObjectIndexes drops the old global unique index on hash; uniqueness is now per
+// dedup scope (dedup_key, hash). 旧数据的 dedup_key 为空 即全局范围
+func migrateFileObjectIndexes(db *gorm.DB) {
+	if db == nil {
+		return
+	}
+	migrator := db.Migrator()
+	const oldIndex = "idx_file_object_hash"
+	const newIndex = "uk_object_dedup_hash"
+
+	if migrator.HasIndex(&model.FileObject{}, oldIndex) {
+		if err := migrator.DropIndex(&model.FileObject{}, oldIndex); err != nil {
+			log.Printf("drop index %s failed: %v", oldIndex, err)
+		}
+	}
+	if !migrator.HasIndex(&model.FileObject{}, newIndex) {
+		if err := migrator.CreateIndex(&model.FileObject{}, newIndex); err != nil {
+			log.Printf("create index %s failed: %v", newIndex, err)
+		}
+	}
+}
+
 // InitMysql initializes the main MySQL connection.
 func InitMysql() {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
@@ -108,6 +137,16 @@ func InitMysqlTest() {
 	Db = db
 }
 
+// IsDuplicateKeyError reports whether err is a unique index violation (MySQL or SQLite).
+func IsDuplicateKeyError(err error) bool {
+	var mysqlErr *mysqlDriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey) ||
+		strings.Contains(strings.ToLower(err.Error()), "unique constraint failed")
+}
+
 func isUnknownDatabaseError(err error) bool {
 	var mysqlErr *mysqlDriver.MySQLError
 	if errors.As(err, &mysqlErr) {
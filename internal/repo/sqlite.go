@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"log"
+
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// OpenSqlite opens a SQLite database and migrates all models.
+// dsn 可以是文件路径 也可以是 "file:name?mode=memory&cache=shared" 形式的内存库
+func OpenSqlite(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	// SQLite 只允许单写 统一走一个连接 避免 database is locked
+	sqlDB.SetMaxOpenConns(1)
+
+	autoMigrateAll(db)
+	return db, nil
+}
+
+// InitSqlite initializes Db with SQLite, used for hermetic tests and local development.
+func InitSqlite(dsn string) {
+	db, err := OpenSqlite(dsn)
+	if err != nil {
+		log.Fatal("init sqlite fail", err)
+	}
+	log.Println("init sqlite success")
+	Db = db
+}
+
+// UseDB injects an already opened database handle.
+func UseDB(db *gorm.DB) {
+	Db = db
+}
+
+// UseRedis injects an already connected Redis client, e.g. one backed by miniredis.
+func UseRedis(client *redis.Client) {
+	Redis = client
+}
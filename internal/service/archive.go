@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"time"
 )
 
 type ArchiveEntry struct {
 	ZipPath string
 	FileObj *model.FileObject
 	IsDir   bool
+	ModTime time.Time // 文件最后修改时间 写入压缩包条目
 }
 
 func sanitizeArchiveName(name string) string { // 保证安全
@@ -40,6 +42,7 @@ func BuildArchiveEntries(userID uint64, fileIDs []uint64) ([]ArchiveEntry, error
 			entries = append(entries, ArchiveEntry{
 				ZipPath: dirPath + "/",
 				IsDir:   true,
+				ModTime: file.UpdatedAt,
 			})
 			if err := collectArchiveChildren(userID, file.ID, dirPath, &entries); err != nil {
 				return nil, err
@@ -57,6 +60,7 @@ func BuildArchiveEntries(userID uint64, fileIDs []uint64) ([]ArchiveEntry, error
 			ZipPath: sanitizeArchiveName(file.Name),
 			FileObj: obj,
 			IsDir:   false,
+			ModTime: file.UpdatedAt,
 		})
 	}
 	return entries, nil
@@ -75,6 +79,7 @@ func collectArchiveChildren(userID, parentID uint64, prefix string, entries *[]A
 			*entries = append(*entries, ArchiveEntry{
 				ZipPath: childPath + "/",
 				IsDir:   true,
+				ModTime: child.UpdatedAt,
 			})
 			if err := collectArchiveChildren(userID, child.ID, childPath, entries); err != nil {
 				return err
@@ -92,6 +97,7 @@ func collectArchiveChildren(userID, parentID uint64, prefix string, entries *[]A
 			ZipPath: childPath,
 			FileObj: obj,
 			IsDir:   false,
+			ModTime: child.UpdatedAt,
 		})
 	}
 	return nil
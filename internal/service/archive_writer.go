@@ -0,0 +1,424 @@
+package service
+
+import (
+	"CloudVault/internal/storage"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Archive formats of batch downloads.
+const (
+	ArchiveZip   = "zip"   // 经典 zip 需要 ZIP64 时拒绝 兼容老旧解压工具
+	ArchiveZip64 = "zip64" // 超过 4GB 或 65535 个条目时写 ZIP64 记录
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+)
+
+// Compression modes of zip entries; tar.gz always compresses the whole stream.
+const (
+	CompressAuto    = "auto"    // 已压缩的媒体与压缩包只存储 其余 deflate
+	CompressDeflate = "deflate" // 全部 deflate
+	CompressStore   = "store"   // 全部只存储
+)
+
+// ArchiveErrorsName is the manifest appended when some files could not be read.
+const ArchiveErrorsName = "ARCHIVE_ERRORS.txt"
+
+const (
+	zip32Max        = math.MaxUint32
+	zip32MaxEntries = math.MaxUint16
+)
+
+var (
+	ErrArchiveFormat     = errors.New("unsupported archive format")
+	ErrArchiveNeedsZip64 = errors.New("archive exceeds zip limits, use zip64")
+)
+
+// ArchiveOptions selects the format of a batch download.
+type ArchiveOptions struct {
+	Format      string `json:"format"`
+	Compression string `json:"compression"`
+}
+
+// ArchiveEstimate is the pre-flight summary of a batch download.
+type ArchiveEstimate struct {
+	Format        string `json:"format"`
+	Compression   string `json:"compression"`
+	Files         int    `json:"files"`
+	Folders       int    `json:"folders"`
+	ContentSize   int64  `json:"content_size"`
+	EstimatedSize int64  `json:"estimated_size"` // 只存储时接近实际大小 压缩时为上限
+	NeedsZip64    bool   `json:"needs_zip64"`
+}
+
+// ArchiveError records a file left out of, or truncated in, an archive.
+type ArchiveError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ArchiveResult summarizes a written archive.
+type ArchiveResult struct {
+	Files   int            `json:"files"`
+	Folders int            `json:"folders"`
+	Bytes   int64          `json:"bytes"` // 写入的文件内容字节数
+	Errors  []ArchiveError `json:"errors,omitempty"`
+}
+
+// ParseArchiveOptions validates format and compression; empty values pick the defaults
+// (zip, switching to zip64 when needed, and auto compression).
+func ParseArchiveOptions(format, compression string) (ArchiveOptions, error) {
+	opts := ArchiveOptions{
+		Format:      strings.ToLower(strings.TrimSpace(format)),
+		Compression: strings.ToLower(strings.TrimSpace(compression)),
+	}
+	switch opts.Format {
+	case "", ArchiveZip, ArchiveZip64, ArchiveTar, ArchiveTarGz:
+	case "tgz":
+		opts.Format = ArchiveTarGz
+	default:
+		return opts, fmt.Errorf("%w: %s", ErrArchiveFormat, format)
+	}
+	switch opts.Compression {
+	case "":
+		opts.Compression = CompressAuto
+	case CompressAuto, CompressDeflate, CompressStore:
+	default:
+		return opts, fmt.Errorf("%w: compression %s", ErrArchiveFormat, compression)
+	}
+	return opts, nil
+}
+
+// ArchiveExt returns the file extension of format.
+func ArchiveExt(format string) string {
+	switch format {
+	case ArchiveTar:
+		return ".tar"
+	case ArchiveTarGz:
+		return ".tar.gz"
+	}
+	return ".zip"
+}
+
+// ArchiveContentType returns the MIME type of format.
+func ArchiveContentType(format string) string {
+	switch format {
+	case ArchiveTar:
+		return "application/x-tar"
+	case ArchiveTarGz:
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// ArchiveFileName returns the download name of an archive, adding the extension of format.
+func ArchiveFileName(name, format string) string {
+	ext := ArchiveExt(format)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "archive"
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ext) {
+		name += ext
+	}
+	return name
+}
+
+// EstimateArchive sizes the archive of entries and resolves the format: an empty format becomes
+// zip64 only when the content needs it. Explicit zip fails with ErrArchiveNeedsZip64 then.
+func EstimateArchive(entries []ArchiveEntry, opts ArchiveOptions) (*ArchiveEstimate, error) {
+	est := &ArchiveEstimate{Format: opts.Format, Compression: opts.Compression}
+	if est.Compression == "" {
+		est.Compression = CompressAuto
+	}
+	var zipSize, tarSize int64
+	for _, e := range entries {
+		name := int64(len(e.ZipPath))
+		var size int64
+		if e.IsDir {
+			est.Folders++
+		} else {
+			est.Files++
+			if e.FileObj != nil {
+				size = e.FileObj.Size
+			}
+			if size >= zip32Max {
+				est.NeedsZip64 = true
+			}
+		}
+		est.ContentSize += size
+		// zip: 本地头 30 + 目录项 46 + 两处名字与扩展时间戳 + 数据描述符 24 + ZIP64 扩展 28
+		zipSize += 30 + 46 + 2*(name+9) + 24 + 28 + deflateBound(size)
+		// tar: 512 头 + 长名字的 PAX 头 + 按 512 对齐的内容
+		tarSize += 512 + (size+511)/512*512
+		if name > 100 {
+			tarSize += 1024 + (name+511)/512*512
+		}
+	}
+	zipSize += 22 + 56 + 20 + int64(len(ArchiveErrorsName))
+	tarSize += 1024
+	if len(entries) >= zip32MaxEntries || est.ContentSize >= zip32Max || zipSize >= zip32Max {
+		est.NeedsZip64 = true
+	}
+
+	switch est.Format {
+	case "":
+		est.Format = ArchiveZip
+		if est.NeedsZip64 {
+			est.Format = ArchiveZip64
+		}
+	case ArchiveZip:
+		if est.NeedsZip64 {
+			return est, ErrArchiveNeedsZip64
+		}
+	}
+	switch est.Format {
+	case ArchiveTar:
+		est.EstimatedSize = tarSize
+	case ArchiveTarGz:
+		est.EstimatedSize = deflateBound(tarSize) + 18
+	default:
+		est.EstimatedSize = zipSize
+	}
+	return est, nil
+}
+
+// deflateBound is the largest deflate output for size bytes (stored blocks of 64KB).
+func deflateBound(size int64) int64 {
+	return size + 5*(size/65535+1)
+}
+
+// WriteArchive streams entries to w in the format of opts. A file that cannot be read is left out
+// (or truncated, if the read fails half-way) and listed in ARCHIVE_ERRORS.txt at the end, so the
+// archive stays well-formed; only write errors abort it.
+func WriteArchive(ctx context.Context, w io.Writer, entries []ArchiveEntry, opts ArchiveOptions) (*ArchiveResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	est, err := EstimateArchive(entries, opts)
+	if err != nil {
+		return nil, err
+	}
+	if storage.Default == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	sink := &archiveSink{w: w}
+	var aw archiveWriter
+	switch est.Format {
+	case ArchiveTar:
+		aw = &tarArchive{tw: tar.NewWriter(sink)}
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(sink)
+		aw = &tarArchive{tw: tar.NewWriter(gz), gz: gz}
+	default:
+		aw = &zipArchive{zw: zip.NewWriter(sink), compression: est.Compression}
+	}
+
+	result := &ArchiveResult{}
+	fail := func(path string, err error) {
+		result.Errors = append(result.Errors, ArchiveError{Path: path, Error: err.Error()})
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if entry.IsDir {
+			if err := aw.dir(entry); err != nil {
+				return result, err
+			}
+			result.Folders++
+			continue
+		}
+		if entry.FileObj == nil {
+			fail(entry.ZipPath, errors.New("file has no object"))
+			continue
+		}
+		object, _, err := storage.Default.GetObject(ctx, entry.FileObj.BucketName, entry.FileObj.ObjectName)
+		if err != nil { // 打不开的文件不写入 记入错误清单
+			fail(entry.ZipPath, err)
+			continue
+		}
+		n, err := aw.file(entry, object)
+		_ = object.Close()
+		result.Bytes += n
+		if err != nil {
+			if sink.err != nil || ctx.Err() != nil { // 客户端断开等写入错误 无法继续
+				return result, err
+			}
+			fail(entry.ZipPath, fmt.Errorf("truncated after %d of %d bytes: %w", n, entry.FileObj.Size, err))
+		}
+		result.Files++
+	}
+	if len(result.Errors) > 0 {
+		if err := aw.manifest(errorManifest(result.Errors)); err != nil {
+			return result, err
+		}
+	}
+	return result, aw.close()
+}
+
+func errorManifest(errs []ArchiveError) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("The following files could not be read completely:\n\n")
+	for _, e := range errs {
+		fmt.Fprintf(&buf, "%s\t%s\n", e.Path, e.Error)
+	}
+	return buf.Bytes()
+}
+
+// archiveSink remembers write errors of the response, to tell them from read errors.
+type archiveSink struct {
+	w   io.Writer
+	err error
+}
+
+func (s *archiveSink) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err != nil {
+		s.err = err
+	}
+	return n, err
+}
+
+type archiveWriter interface {
+	dir(entry ArchiveEntry) error
+	file(entry ArchiveEntry, r io.Reader) (int64, error)
+	manifest(data []byte) error
+	close() error
+}
+
+type zipArchive struct {
+	zw          *zip.Writer
+	compression string
+}
+
+func (a *zipArchive) dir(entry ArchiveEntry) error {
+	_, err := a.zw.CreateHeader(&zip.FileHeader{Name: entry.ZipPath, Method: zip.Store, Modified: entry.ModTime})
+	return err
+}
+
+func (a *zipArchive) file(entry ArchiveEntry, r io.Reader) (int64, error) {
+	method := zip.Deflate
+	switch a.compression {
+	case CompressStore:
+		method = zip.Store
+	case CompressAuto:
+		if isCompressedType(ObjectContentType(entry.FileObj, entry.ZipPath)) {
+			method = zip.Store
+		}
+	}
+	w, err := a.zw.CreateHeader(&zip.FileHeader{Name: entry.ZipPath, Method: method, Modified: entry.ModTime})
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(w, r)
+}
+
+func (a *zipArchive) manifest(data []byte) error {
+	w, err := a.zw.CreateHeader(&zip.FileHeader{Name: ArchiveErrorsName, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (a *zipArchive) close() error {
+	return a.zw.Close()
+}
+
+type tarArchive struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (a *tarArchive) dir(entry ArchiveEntry) error {
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     entry.ZipPath,
+		Mode:     0o755,
+		ModTime:  entry.ModTime.Truncate(time.Second),
+	})
+}
+
+func (a *tarArchive) file(entry ArchiveEntry, r io.Reader) (int64, error) {
+	size := entry.FileObj.Size
+	if err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entry.ZipPath,
+		Mode:     0o644,
+		Size:     size,
+		ModTime:  entry.ModTime.Truncate(time.Second),
+	}); err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(a.tw, io.LimitReader(r, size))
+	if err == nil && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && n < size { // 头部已声明大小 补零保持 tar 结构完整
+		if _, padErr := io.CopyN(a.tw, zeroReader{}, size-n); padErr != nil {
+			return n, padErr
+		}
+	}
+	return n, err
+}
+
+func (a *tarArchive) manifest(data []byte) error {
+	if err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     ArchiveErrorsName,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := a.tw.Write(data)
+	return err
+}
+
+func (a *tarArchive) close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	if a.gz != nil {
+		return a.gz.Close()
+	}
+	return nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// isCompressedType reports content that deflate would not shrink.
+func isCompressedType(contentType string) bool {
+	base := mediaType(contentType)
+	switch base {
+	case "image/bmp", "image/x-icon", "image/svg+xml", "image/tiff", "audio/wav":
+		return false
+	case "application/zip", "application/gzip", "application/x-bzip2", "application/x-xz",
+		"application/x-7z-compressed", "application/vnd.rar", "application/java-archive",
+		"application/vnd.android.package-archive", "application/epub+zip", "application/pdf",
+		"font/woff", "font/woff2":
+		return true
+	}
+	if strings.HasPrefix(base, "application/vnd.openxmlformats-officedocument.") ||
+		strings.HasPrefix(base, "application/vnd.oasis.opendocument.") {
+		return true
+	}
+	return strings.HasPrefix(base, "image/") || strings.HasPrefix(base, "audio/") || strings.HasPrefix(base, "video/")
+}
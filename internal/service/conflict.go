@@ -0,0 +1,437 @@
+package service
+
+import (
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConflictPolicy decides what happens when an entry lands on a name already taken in the folder.
+type ConflictPolicy string
+
+const (
+	ConflictFail      ConflictPolicy = "fail"      // 默认 返回 ErrNameConflict
+	ConflictRename    ConflictPolicy = "rename"    // 改名为 "a (1).txt"
+	ConflictOverwrite ConflictPolicy = "overwrite" // 文件替换内容 文件夹合并
+	ConflictSkip      ConflictPolicy = "skip"      // 保留已有条目 不做改动
+)
+
+// Actions reported in dto.EntryResult.
+const (
+	ActionOK          = "ok"
+	ActionRenamed     = "renamed"
+	ActionOverwritten = "overwritten"
+	ActionMerged      = "merged"
+	ActionSkipped     = "skipped"
+)
+
+const maxRenameAttempts = 1000
+
+var (
+	// ErrNameConflict is returned when the name is taken and the policy does not resolve it.
+	ErrNameConflict = errors.New("file with same name already exists")
+	// ErrInvalidConflictPolicy is returned for an unknown conflict_policy value.
+	ErrInvalidConflictPolicy = errors.New("conflict_policy must be fail, rename, overwrite or skip")
+	// ErrEntrySkipped is returned by creates under ConflictSkip so callers can undo their work.
+	ErrEntrySkipped = errors.New("entry skipped: name already exists")
+)
+
+// ParseConflictPolicy parses a request value; empty means ConflictFail.
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictRename, ConflictOverwrite, ConflictSkip:
+		return policy, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidConflictPolicy, value)
+}
+
+// findSibling returns the active entry called name under parentID, or nil when the name is free.
+func findSibling(tx *gorm.DB, userID uint64, parentID *uint64, name string, excludeID uint64) (*model.UserFile, error) {
+	var existing model.UserFile
+	query := tx.Where("user_id = ? AND name = ? AND is_deleted = 0", userID, name)
+	if parentID == nil || *parentID == 0 {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	if err := query.First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// renameCandidate returns "report (n).pdf" for files and "photos (n)" for folders.
+func renameCandidate(name string, isDir bool, n int) string {
+	ext := ""
+	if !isDir {
+		ext = path.Ext(name)
+		if ext == name { // ".bashrc" 没有扩展名
+			ext = ""
+		}
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// conflictPlan is where an entry ends up once the policy has been applied.
+type conflictPlan struct {
+	name     string
+	action   string
+	existing *model.UserFile // overwritten / merged / skipped 时的已有条目
+}
+
+// planPlacement applies policy to name under parentID; excludeID is the entry being moved, if any.
+func planPlacement(tx *gorm.DB, userID uint64, parentID *uint64, name string, isDir bool, policy ConflictPolicy, excludeID uint64) (conflictPlan, error) {
+	existing, err := findSibling(tx, userID, parentID, name, excludeID)
+	if err != nil {
+		return conflictPlan{}, err
+	}
+	if existing == nil {
+		return conflictPlan{name: name, action: ActionOK}, nil
+	}
+	switch policy {
+	case ConflictSkip:
+		return conflictPlan{name: existing.Name, action: ActionSkipped, existing: existing}, nil
+	case ConflictRename:
+		for n := 1; n <= maxRenameAttempts; n++ {
+			candidate := renameCandidate(name, isDir, n)
+			taken, err := findSibling(tx, userID, parentID, candidate, excludeID)
+			if err != nil {
+				return conflictPlan{}, err
+			}
+			if taken == nil {
+				return conflictPlan{name: candidate, action: ActionRenamed}, nil
+			}
+		}
+	case ConflictOverwrite:
+		// 文件与文件夹之间不互相覆盖
+		if existing.IsDir != isDir {
+			break
+		}
+		if isDir {
+			return conflictPlan{name: existing.Name, action: ActionMerged, existing: existing}, nil
+		}
+		return conflictPlan{name: existing.Name, action: ActionOverwritten, existing: existing}, nil
+	}
+	return conflictPlan{}, fmt.Errorf("%w: %s", ErrNameConflict, name)
+}
+
+// entryOps applies a conflict policy to a batch of creates, moves, copies and restores inside one
+// transaction, and defers the side effects (object refs, caches) to finish.
+type entryOps struct {
+	tx       *gorm.DB
+	userID   uint64
+	policy   ConflictPolicy
+	released []uint64            // 提交后需减引用的对象
+	touched  map[uint64]struct{} // 需要失效列表缓存的目录
+	charged  bool
+}
+
+func newEntryOps(tx *gorm.DB, userID uint64, policy ConflictPolicy) *entryOps {
+	return &entryOps{tx: tx, userID: userID, policy: policy, touched: make(map[uint64]struct{})}
+}
+
+func (o *entryOps) touch(parentID *uint64) {
+	o.touched[cacheParentID(parentID)] = struct{}{}
+}
+
+// finish runs after commit: drops replaced objects and clears caches.
+func (o *entryOps) finish() {
+	for _, objectID := range o.released {
+		_ = RemoveObject(objectID)
+	}
+	for id := range o.touched {
+		pid := id
+		invalidateFileListCache(o.userID, &pid)
+	}
+	if o.charged || len(o.released) > 0 {
+		_ = utils.InvalidateUserInfoCache(context.Background(), o.userID)
+	}
+}
+
+func (o *entryOps) reserve(size int64) error {
+	o.charged = true
+	return reserveSpace(o.tx, o.userID, size)
+}
+
+func (o *entryOps) release(size int64) error {
+	o.charged = true
+	return releaseSpace(o.tx, o.userID, size)
+}
+
+func (o *entryOps) increaseRef(objectID *uint64) error {
+	if objectID == nil {
+		return nil
+	}
+	if err := o.tx.Model(&model.FileObject{}).
+		Where("id = ?", *objectID).
+		UpdateColumn("ref_count", gorm.Expr("ref_count + 1")).Error; err != nil {
+		return err
+	}
+	_ = utils.InvalidateFileObjectCache(context.Background(), *objectID)
+	return nil
+}
+
+// overwrite points the existing file at objectID and keeps the replaced content as a version.
+// 保留原条目 ID 分享与收藏等引用不受影响
+func (o *entryOps) overwrite(existing *model.UserFile, objectID *uint64, size int64) error {
+	if objectID == nil {
+		return fmt.Errorf("file must have objectId")
+	}
+	if existing.ObjectID != nil && *existing.ObjectID == *objectID { // 内容相同 不产生新版本 调用方多加的引用提交后归还
+		o.released = append(o.released, *objectID)
+		o.touch(existing.ParentID)
+		return nil
+	}
+	// 旧内容转为历史版本 继续占用空间 直到被保留规则清理
+	if err := o.reserve(size); err != nil {
+		return err
+	}
+	if err := saveVersion(o.tx, existing); err != nil {
+		return err
+	}
+	if err := o.tx.Model(&model.UserFile{}).
+		Where("id = ?", existing.ID).
+		Updates(map[string]interface{}{
+			"object_id": *objectID,
+			"size":      size,
+		}).Error; err != nil {
+		return err
+	}
+	o.touch(existing.ParentID)
+	return nil
+}
+
+// drop permanently removes a file row whose content now lives in another entry.
+// 被移走条目自己的历史版本一并删除
+func (o *entryOps) drop(file *model.UserFile) error {
+	if err := o.tx.Unscoped().Delete(&model.UserFile{}, file.ID).Error; err != nil {
+		return err
+	}
+	versionBytes, objects, err := purgeFileVersions(o.tx, file.ID)
+	if err != nil {
+		return err
+	}
+	o.released = append(o.released, objects...)
+	o.touch(file.ParentID)
+	return o.release(file.Size + versionBytes)
+}
+
+// dropMergedDir removes a folder whose children were merged elsewhere.
+// 回收站里还有它的子条目时保留文件夹本身 放进回收站
+func (o *entryOps) dropMergedDir(dir *model.UserFile) error {
+	var remaining int64
+	if err := o.tx.Unscoped().Model(&model.UserFile{}).Where("parent_id = ?", dir.ID).Count(&remaining).Error; err != nil {
+		return err
+	}
+	o.touch(dir.ParentID)
+	if remaining == 0 {
+		return o.tx.Unscoped().Delete(&model.UserFile{}, dir.ID).Error
+	}
+	if dir.IsDeleted {
+		return nil
+	}
+	now := time.Now()
+	return o.tx.Model(&model.UserFile{}).
+		Where("id = ?", dir.ID).
+		Updates(map[string]interface{}{
+			"is_deleted": true,
+			"deleted_at": &now,
+		}).Error
+}
+
+func (o *entryOps) activeChildren(dirID uint64) ([]model.UserFile, error) {
+	var children []model.UserFile
+	err := o.tx.Where("user_id = ? AND parent_id = ? AND is_deleted = 0", o.userID, dirID).Find(&children).Error
+	return children, err
+}
+
+// create adds a new entry under file.ParentID.
+func (o *entryOps) create(file *model.UserFile) (dto.EntryResult, error) {
+	plan, err := planPlacement(o.tx, o.userID, file.ParentID, file.Name, file.IsDir, o.policy, 0)
+	if err != nil {
+		return dto.EntryResult{}, err
+	}
+	switch plan.action {
+	case ActionSkipped:
+		return entryResult(plan.existing.ID, plan), ErrEntrySkipped
+	case ActionOverwritten:
+		if err := o.overwrite(plan.existing, file.ObjectID, file.Size); err != nil {
+			return dto.EntryResult{}, err
+		}
+		return entryResult(plan.existing.ID, plan), nil
+	case ActionMerged: // 文件夹已存在 直接复用
+		return entryResult(plan.existing.ID, plan), nil
+	}
+	if !file.IsDir {
+		if err := o.reserve(file.Size); err != nil {
+			return dto.EntryResult{}, err
+		}
+	}
+	file.Name = plan.name
+	if err := o.tx.Create(file).Error; err != nil {
+		return dto.EntryResult{}, err
+	}
+	o.touch(file.ParentID)
+	return entryResult(file.ID, plan), nil
+}
+
+// move places file under targetID; a merged folder moves its children one by one.
+func (o *entryOps) move(file *model.UserFile, targetID *uint64) (dto.EntryResult, error) {
+	plan, err := planPlacement(o.tx, o.userID, targetID, file.Name, file.IsDir, o.policy, file.ID)
+	if err != nil {
+		return dto.EntryResult{}, err
+	}
+	switch plan.action {
+	case ActionSkipped:
+		return entryResult(plan.existing.ID, plan), nil
+	case ActionOverwritten:
+		if err := o.overwrite(plan.existing, file.ObjectID, file.Size); err != nil {
+			return dto.EntryResult{}, err
+		}
+		return entryResult(plan.existing.ID, plan), o.drop(file)
+	case ActionMerged:
+		if err := o.mergeInto(file, plan.existing, o.move); err != nil {
+			return dto.EntryResult{}, err
+		}
+		return entryResult(plan.existing.ID, plan), o.dropMergedDir(file)
+	}
+	if err := o.tx.Model(&model.UserFile{}).
+		Where("id = ?", file.ID).
+		Updates(map[string]interface{}{
+			"parent_id": targetID,
+			"name":      plan.name,
+		}).Error; err != nil {
+		return dto.EntryResult{}, err
+	}
+	o.touch(file.ParentID)
+	o.touch(targetID)
+	return entryResult(file.ID, plan), nil
+}
+
+// copy duplicates file (and a folder's subtree) under targetID.
+func (o *entryOps) copy(file *model.UserFile, targetID *uint64) (dto.EntryResult, error) {
+	plan, err := planPlacement(o.tx, o.userID, targetID, file.Name, file.IsDir, o.policy, 0)
+	if err != nil {
+		return dto.EntryResult{}, err
+	}
+	switch plan.action {
+	case ActionSkipped:
+		return entryResult(plan.existing.ID, plan), nil
+	case ActionOverwritten:
+		if err := o.overwrite(plan.existing, file.ObjectID, file.Size); err != nil {
+			return dto.EntryResult{}, err
+		}
+		return entryResult(plan.existing.ID, plan), o.increaseRef(file.ObjectID)
+	case ActionMerged:
+		return entryResult(plan.existing.ID, plan), o.mergeInto(file, plan.existing, o.copy)
+	}
+	newFile := &model.UserFile{
+		UserID:   o.userID,
+		ParentID: targetID,
+		Name:     plan.name,
+		IsDir:    file.IsDir,
+		ObjectID: file.ObjectID,
+		Size:     file.Size,
+	}
+	if !newFile.IsDir {
+		if err := o.reserve(newFile.Size); err != nil {
+			return dto.EntryResult{}, err
+		}
+	}
+	if err := o.tx.Create(newFile).Error; err != nil {
+		return dto.EntryResult{}, err
+	}
+	if err := o.increaseRef(file.ObjectID); err != nil {
+		return dto.EntryResult{}, err
+	}
+	o.touch(targetID)
+	if file.IsDir {
+		// 新文件夹是空的 子条目不会再冲突
+		if err := o.mergeInto(file, newFile, o.copy); err != nil {
+			return dto.EntryResult{}, err
+		}
+	}
+	return entryResult(newFile.ID, plan), nil
+}
+
+// restore takes a recycled entry back to its folder.
+func (o *entryOps) restore(file *model.UserFile) (dto.EntryResult, error) {
+	plan, err := planPlacement(o.tx, o.userID, file.ParentID, file.Name, file.IsDir, o.policy, file.ID)
+	if err != nil {
+		return dto.EntryResult{}, err
+	}
+	switch plan.action {
+	case ActionSkipped: // 留在回收站
+		return entryResult(plan.existing.ID, plan), nil
+	case ActionOverwritten:
+		if err := o.overwrite(plan.existing, file.ObjectID, file.Size); err != nil {
+			return dto.EntryResult{}, err
+		}
+		return entryResult(plan.existing.ID, plan), o.drop(file)
+	case ActionMerged:
+		if err := o.mergeInto(file, plan.existing, o.move); err != nil {
+			return dto.EntryResult{}, err
+		}
+		return entryResult(plan.existing.ID, plan), o.dropMergedDir(file)
+	}
+	if err := o.tx.Model(&model.UserFile{}).
+		Unscoped().
+		Where("id = ?", file.ID).
+		Updates(map[string]interface{}{
+			"is_deleted": false,
+			"deleted_at": nil,
+			"name":       plan.name,
+		}).Error; err != nil {
+		return dto.EntryResult{}, err
+	}
+	o.touch(file.ParentID)
+	return entryResult(file.ID, plan), nil
+}
+
+// mergeInto applies op (move or copy) to every active child of src with dst as the target.
+func (o *entryOps) mergeInto(src, dst *model.UserFile, op func(*model.UserFile, *uint64) (dto.EntryResult, error)) error {
+	children, err := o.activeChildren(src.ID)
+	if err != nil {
+		return err
+	}
+	for i := range children {
+		if _, err := op(&children[i], &dst.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func entryResult(fileID uint64, plan conflictPlan) dto.EntryResult {
+	return dto.EntryResult{FileID: fileID, Name: plan.name, Action: plan.action}
+}
+
+// runEntryOps runs fn in a transaction and finishes the batch on success.
+func runEntryOps(userID uint64, policy ConflictPolicy, fn func(o *entryOps) error) error {
+	var ops *entryOps
+	if err := repo.Db.Transaction(func(tx *gorm.DB) error {
+		ops = newEntryOps(tx, userID, policy)
+		return fn(ops)
+	}); err != nil {
+		return err
+	}
+	ops.finish()
+	return nil
+}
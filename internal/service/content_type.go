@@ -0,0 +1,237 @@
+package service
+
+import (
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	defaultContentType = "application/octet-stream"
+	plainTextType      = "text/plain; charset=utf-8"
+	sniffLen           = 512 // 与 http.DetectContentType 读取的长度一致
+)
+
+// contentTypes maps lower-case file extensions to MIME types.
+var contentTypes = map[string]string{
+	// 图片
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+	".ico":  "image/x-icon",
+	".avif": "image/avif",
+	".heic": "image/heic",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".svg":  "image/svg+xml",
+	// 音频
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+	".aac":  "audio/aac",
+	".m4a":  "audio/mp4",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/opus",
+	".mid":  "audio/midi",
+	".midi": "audio/midi",
+	// 视频
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".ogv":  "video/ogg",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".avi":  "video/x-msvideo",
+	".flv":  "video/x-flv",
+	".wmv":  "video/x-ms-wmv",
+	".3gp":  "video/3gpp",
+	".ts":   "video/mp2t",
+	// 文档
+	".pdf":  "application/pdf",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".rtf":  "application/rtf",
+	".epub": "application/epub+zip",
+	// 文本与代码
+	".txt":  plainTextType,
+	".log":  plainTextType,
+	".md":   "text/markdown; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".tsv":  "text/tab-separated-values; charset=utf-8",
+	".json": "application/json",
+	".xml":  "application/xml",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".toml": "application/toml",
+	".ini":  plainTextType,
+	".html": "text/html; charset=utf-8",
+	".htm":  "text/html; charset=utf-8",
+	".css":  "text/css; charset=utf-8",
+	".js":   "text/javascript; charset=utf-8",
+	".mjs":  "text/javascript; charset=utf-8",
+	".go":   plainTextType,
+	".py":   plainTextType,
+	".java": plainTextType,
+	".c":    plainTextType,
+	".h":    plainTextType,
+	".cpp":  plainTextType,
+	".rs":   plainTextType,
+	".sh":   plainTextType,
+	".sql":  plainTextType,
+	// 压缩包
+	".zip": "application/zip",
+	".tar": "application/x-tar",
+	".gz":  "application/gzip",
+	".tgz": "application/gzip",
+	".bz2": "application/x-bzip2",
+	".xz":  "application/x-xz",
+	".7z":  "application/x-7z-compressed",
+	".rar": "application/vnd.rar",
+	".jar": "application/java-archive",
+	".apk": "application/vnd.android.package-archive",
+	// 字体
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+// inlineContentTypes can be rendered by the browser without running scripts.
+// SVG、HTML、XML 可以携带脚本 不在其中
+var inlineContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"image/x-icon":    true,
+	"image/avif":      true,
+	"application/pdf": true,
+}
+
+// GetContentBook returns content type by file extension.
+func GetContentBook(filename string) string {
+	if ct, ok := contentTypes[strings.ToLower(path.Ext(filename))]; ok {
+		return ct
+	}
+	return defaultContentType
+}
+
+// SniffContentType detects the type of content from its first bytes. The extension only refines
+// a generic result (plain text, zip, unknown binary), so a renamed file keeps its real type.
+func SniffContentType(head []byte, filename string) string {
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	sniffed := http.DetectContentType(head)
+	byName := GetContentBook(filename)
+	base := mediaType(sniffed)
+	switch {
+	case base == "text/plain":
+		// 文本类扩展名 (md、json、csv、源码等) 更具体 但 html/svg 仍按文本处理 避免借扩展名绕过
+		if isTextType(byName) && !isActiveType(byName) {
+			return byName
+		}
+		if strings.EqualFold(path.Ext(filename), ".svg") && bytes.Contains(head, []byte("<svg")) {
+			return "image/svg+xml"
+		}
+	case base == "text/xml":
+		if mediaType(byName) == "image/svg+xml" || bytes.Contains(head, []byte("<svg")) {
+			return "image/svg+xml"
+		}
+		return "application/xml"
+	case base == "application/zip":
+		// docx、xlsx、epub、jar 等都是 zip 容器
+		if byName != defaultContentType && !isTextType(byName) && !strings.HasPrefix(byName, "image/") {
+			return byName
+		}
+	case base == defaultContentType:
+		if !isTextType(byName) && !isActiveType(byName) {
+			return byName
+		}
+	}
+	return sniffed
+}
+
+// InlineContentType returns the type a file may be rendered inline with; ok is false when it must
+// be downloaded as an attachment. Text is always served as text/plain so markup never executes.
+func InlineContentType(contentType string) (string, bool) {
+	base := mediaType(contentType)
+	switch {
+	case inlineContentTypes[base]:
+		return base, true
+	case strings.HasPrefix(base, "audio/"), strings.HasPrefix(base, "video/"):
+		return base, true
+	case isActiveType(contentType):
+		return "", false
+	case isTextType(contentType):
+		return plainTextType, true
+	}
+	return "", false
+}
+
+// ObjectContentType returns the sniffed type of obj, or the type implied by name for objects
+// stored before sniffing was added.
+func ObjectContentType(obj *model.FileObject, name string) string {
+	if obj != nil && obj.ContentType != "" {
+		return obj.ContentType
+	}
+	return GetContentBook(name)
+}
+
+// DetectObjectContentType sniffs the type of a stored object from its first bytes.
+func DetectObjectContentType(ctx context.Context, bucket, object, filename string) string {
+	if storage.Default == nil {
+		return GetContentBook(filename)
+	}
+	reader, _, err := storage.Default.GetObject(ctx, bucket, object)
+	if err != nil {
+		return GetContentBook(filename)
+	}
+	defer reader.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return GetContentBook(filename)
+	}
+	return SniffContentType(head[:n], filename)
+}
+
+func mediaType(contentType string) string {
+	base, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(base))
+}
+
+func isTextType(contentType string) bool {
+	base := mediaType(contentType)
+	switch base {
+	case "application/json", "application/xml", "application/yaml", "application/toml", "image/svg+xml":
+		return true
+	}
+	return strings.HasPrefix(base, "text/")
+}
+
+// isActiveType reports types a browser may execute scripts in.
+func isActiveType(contentType string) bool {
+	switch mediaType(contentType) {
+	case "text/html", "image/svg+xml", "application/xhtml+xml", "application/xml", "text/xml", "text/javascript":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Dedup scopes, set by DEDUP_SCOPE.
+const (
+	DedupGlobal = "global" // 所有用户共享 (默认 兼容旧数据)
+	DedupUser   = "user"   // 只在同一用户的文件之间去重
+	DedupTenant = "tenant" // 同一租户内去重 未分配租户的用户按 user 处理
+	DedupNone   = "none"   // 不去重 每次上传都保存一份
+)
+
+const dedupMigrateBatch = 500
+
+// DedupMigrationResult summarizes a MigrateDedupScope run.
+type DedupMigrationResult struct {
+	Scope     string `json:"scope"`
+	Scanned   int    `json:"scanned"`
+	Rekeyed   int    `json:"rekeyed"`
+	Shared    int    `json:"shared"`    // 被多个范围引用 保留原 key
+	Conflicts int    `json:"conflicts"` // 目标范围内已有相同 hash 的对象 保留原 key
+}
+
+// dedupScope returns the configured scope; unknown values fall back to global.
+func dedupScope() string {
+	switch scope := config.AppConfig.DedupScope; scope {
+	case DedupUser, DedupTenant, DedupNone:
+		return scope
+	}
+	return DedupGlobal
+}
+
+// dedupKeyFor returns the key objects of userID are deduplicated under in scope;
+// ok is false when the scope does not deduplicate.
+func dedupKeyFor(scope string, userID uint64) (key string, ok bool, err error) {
+	switch scope {
+	case DedupNone:
+		return "", false, nil
+	case DedupUser:
+		return fmt.Sprintf("u:%d", userID), true, nil
+	case DedupTenant:
+		var tenants []uint64
+		if err := repo.Db.Model(&model.User{}).Where("id = ?", userID).Pluck("tenant_id", &tenants).Error; err != nil {
+			return "", false, err
+		}
+		if len(tenants) == 0 || tenants[0] == 0 {
+			return fmt.Sprintf("u:%d", userID), true, nil
+		}
+		return fmt.Sprintf("t:%d", tenants[0]), true, nil
+	}
+	return "", true, nil
+}
+
+// newDedupKey returns the key a new object created by userID is stored under.
+// 不去重时每个对象独占一个 key 唯一索引不会冲突
+func newDedupKey(userID uint64) (string, error) {
+	key, ok, err := dedupKeyFor(dedupScope(), userID)
+	if err != nil || ok {
+		return key, err
+	}
+	return "o:" + utils.GetToken(), nil
+}
+
+// objectNameFor names the storage object of new content; without dedup the same content may be
+// stored several times, so the name gets a random suffix.
+func objectNameFor(userName, hash string) string {
+	if dedupScope() == DedupNone {
+		return BuildObjectName(userName, hash+"-"+utils.GetToken())
+	}
+	return BuildObjectName(userName, hash)
+}
+
+// MigrateDedupScope moves existing objects to the dedup key of the configured scope, so that
+// changing DEDUP_SCOPE also applies to content stored before. An object referenced from more than
+// one scope, or whose target key already holds the same hash, keeps its key: it stays valid for
+// the files using it, it is just no longer found for dedup.
+func MigrateDedupScope(ctx context.Context) (*DedupMigrationResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	scope := dedupScope()
+	result := &DedupMigrationResult{Scope: scope}
+	if scope == DedupNone { // 不去重时不会按 key 查找 旧数据无需改动
+		return result, nil
+	}
+	var lastID uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		var objects []model.FileObject
+		if err := repo.Db.Where("id > ?", lastID).Order("id asc").Limit(dedupMigrateBatch).Find(&objects).Error; err != nil {
+			return result, err
+		}
+		if len(objects) == 0 {
+			return result, nil
+		}
+		for i := range objects {
+			obj := &objects[i]
+			lastID = obj.ID
+			result.Scanned++
+			target, shared, err := migrationDedupKey(scope, obj)
+			if err != nil {
+				return result, err
+			}
+			if shared {
+				result.Shared++
+				continue
+			}
+			if target == obj.DedupKey {
+				continue
+			}
+			var taken int64
+			if err := repo.Db.Model(&model.FileObject{}).
+				Where("dedup_key = ? AND hash = ?", target, obj.Hash).
+				Count(&taken).Error; err != nil {
+				return result, err
+			}
+			if taken > 0 {
+				result.Conflicts++
+				continue
+			}
+			if err := repo.Db.Model(&model.FileObject{}).
+				Where("id = ?", obj.ID).
+				Update("dedup_key", target).Error; err != nil {
+				if repo.IsDuplicateKeyError(err) { // 检查之后有并发上传占用了目标 key
+					result.Conflicts++
+					continue
+				}
+				return result, err
+			}
+			_ = utils.InvalidateFileObjectHashCache(ctx, obj.DedupKey, obj.Hash)
+			_ = utils.InvalidateFileObjectCache(ctx, obj.ID)
+			result.Rekeyed++
+		}
+	}
+}
+
+// migrationDedupKey returns the key obj belongs to in scope, judged by the users referencing it
+// through files (including the recycle bin) and versions; shared is true when they fall into
+// different keys.
+func migrationDedupKey(scope string, obj *model.FileObject) (key string, shared bool, err error) {
+	var owners []uint64
+	if err := repo.Db.Unscoped().Model(&model.UserFile{}).
+		Where("object_id = ?", obj.ID).
+		Distinct().
+		Pluck("user_id", &owners).Error; err != nil {
+		return "", false, err
+	}
+	var versionOwners []uint64
+	if err := repo.Db.Model(&model.FileVersion{}).
+		Where("object_id = ?", obj.ID).
+		Distinct().
+		Pluck("user_id", &versionOwners).Error; err != nil {
+		return "", false, err
+	}
+	owners = append(owners, versionOwners...)
+	if len(owners) == 0 { // 无人引用 归属创建者
+		owners = []uint64{obj.UserID}
+	}
+	keys := make(map[string]struct{}, 1)
+	for _, userID := range owners {
+		k, _, err := dedupKeyFor(scope, userID)
+		if err != nil {
+			return "", false, err
+		}
+		keys[k] = struct{}{}
+		key = k
+	}
+	return key, len(keys) > 1, nil
+}
+
+// SetUserTenant assigns userID to tenantID (0 = none). Objects the user already stored keep their
+// key until MigrateDedupScope is run again.
+func SetUserTenant(userID, tenantID uint64) error {
+	res := repo.Db.Model(&model.User{}).Where("id = ?", userID).Update("tenant_id", tenantID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		var count int64
+		if err := repo.Db.Model(&model.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/utils"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Dependencies are the handles the service layer reads through package globals.
+// Zero fields keep whatever is already configured.
+type Dependencies struct {
+	DB    *gorm.DB
+	Redis *redis.Client
+	Cache utils.Cache
+	Store storage.Store
+}
+
+// Configure injects dependencies, e.g. SQLite + miniredis + MemoryStore for hermetic tests.
+func Configure(deps Dependencies) {
+	if deps.DB != nil {
+		repo.UseDB(deps.DB)
+	}
+	if deps.Redis != nil {
+		repo.UseRedis(deps.Redis)
+	}
+	switch {
+	case deps.Cache != nil:
+		utils.UseCache(deps.Cache)
+	case deps.Redis != nil:
+		utils.UseCache(utils.NewRedisCache(deps.Redis))
+	}
+	if deps.Store != nil {
+		storage.Default = deps.Store
+	}
+}
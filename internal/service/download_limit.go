@@ -0,0 +1,302 @@
+package service
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	downloadStreamLease = time.Minute // 实例崩溃时并发名额最多占用这么久
+	downloadMinChunk    = 1 << 10
+	downloadMaxChunk    = 64 << 10
+)
+
+var (
+	// ErrTooManyStreams is returned when a user or share already runs the maximum number of downloads.
+	ErrTooManyStreams = errors.New("too many concurrent downloads")
+	// ErrUnknownTier is returned for a tier missing from DOWNLOAD_TIERS.
+	ErrUnknownTier = errors.New("unknown download tier")
+)
+
+// streamAcquireScript takes a slot in a sorted set of leases scored by their expiry.
+// KEYS[1] 并发集合 ARGV: 上限 token 当前毫秒 租约毫秒
+var streamAcquireScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[3])
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], tonumber(ARGV[3]) + tonumber(ARGV[4]), ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return 1
+`)
+
+// rateTakeScript takes n bytes from a token bucket shared by all API instances. The bucket may go
+// negative; the result is how many milliseconds the caller waits before writing.
+// KEYS[1] 令牌桶 ARGV: 速率 (字节/秒) 桶容量 本次字节数 当前毫秒
+var rateTakeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	local added = math.floor((now - ts) * rate / 1000)
+	if added > 0 then
+		tokens = math.min(burst, tokens + added)
+		ts = now
+	end
+end
+tokens = tokens - n
+redis.call("HSET", KEYS[1], "tokens", tokens, "ts", ts)
+redis.call("PEXPIRE", KEYS[1], 60000)
+if tokens >= 0 then
+	return 0
+end
+return math.ceil(-tokens * 1000 / rate)
+`)
+
+// DownloadTierFor returns the download limits of the user's tier.
+func DownloadTierFor(userID uint64) config.DownloadTier {
+	var user model.User
+	if err := repo.Db.Select("id", "tier").Where("id = ?", userID).First(&user).Error; err == nil && user.Tier != "" {
+		if tier, ok := config.AppConfig.DownloadTiers[strings.ToLower(user.Tier)]; ok {
+			return tier
+		}
+	}
+	return config.AppConfig.DownloadDefaultTier
+}
+
+// SetUserTier assigns userID to a tier of DOWNLOAD_TIERS; an empty tier restores the defaults.
+func SetUserTier(userID uint64, tier string) error {
+	tier = strings.ToLower(strings.TrimSpace(tier))
+	if tier != "" {
+		if _, ok := config.AppConfig.DownloadTiers[tier]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownTier, tier)
+		}
+	}
+	res := repo.Db.Model(&model.User{}).Where("id = ?", userID).Update("tier", tier)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		var count int64
+		if err := repo.Db.Model(&model.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+	}
+	return nil
+}
+
+// downloadLimit is one set of limits a download counts against.
+type downloadLimit struct {
+	name    string // Redis key 后缀 如 user:1 / share:<shareID>
+	rate    int64
+	streams int
+}
+
+// DownloadStream is an admitted download. Wrap the response with Writer and call Release when
+// the download ends.
+type DownloadStream struct {
+	ctx    context.Context
+	limits []downloadLimit
+	token  string
+	held   []string
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// AcquireUserDownload admits a download of the user's own files under the limits of their tier.
+func AcquireUserDownload(ctx context.Context, userID uint64) (*DownloadStream, error) {
+	tier := DownloadTierFor(userID)
+	return acquireDownload(ctx, downloadLimit{
+		name:    "user:" + strconv.FormatUint(userID, 10),
+		rate:    tier.Rate,
+		streams: tier.Streams,
+	})
+}
+
+// AcquireShareDownload admits a download through a share under the share limits of its owner's tier.
+func AcquireShareDownload(ctx context.Context, share *model.FileShare) (*DownloadStream, error) {
+	tier := DownloadTierFor(share.UserID)
+	return acquireDownload(ctx, downloadLimit{
+		name:    "share:" + share.ShareID,
+		rate:    tier.ShareRate,
+		streams: tier.ShareStreams,
+	})
+}
+
+func acquireDownload(ctx context.Context, limits ...downloadLimit) (*DownloadStream, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := &DownloadStream{ctx: ctx, limits: limits, token: utils.GetToken(), stop: make(chan struct{})}
+	if repo.Redis == nil { // 未启用 Redis 时不限制
+		return s, nil
+	}
+	now := time.Now().UnixMilli()
+	for _, limit := range limits {
+		if limit.streams <= 0 {
+			continue
+		}
+		key := "download:streams:" + limit.name
+		ok, err := streamAcquireScript.Run(ctx, repo.Redis, []string{key},
+			limit.streams, s.token, now, downloadStreamLease.Milliseconds()).Int()
+		if err != nil { // Redis 故障时放行 不影响下载
+			log.Printf("download limit: acquire %s failed: %v", key, err)
+			continue
+		}
+		if ok == 0 {
+			s.Release()
+			return nil, ErrTooManyStreams
+		}
+		s.held = append(s.held, key)
+	}
+	if len(s.held) > 0 {
+		go s.keepAlive()
+	}
+	return s, nil
+}
+
+// keepAlive renews the leases of a running download until it is released.
+func (s *DownloadStream) keepAlive() {
+	ticker := time.NewTicker(downloadStreamLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			expiry := float64(time.Now().Add(downloadStreamLease).UnixMilli())
+			for _, key := range s.held {
+				// XX 只续期仍存在的租约 已释放的不会被重新加入
+				_ = repo.Redis.ZAddXX(context.Background(), key, redis.Z{Score: expiry, Member: s.token}).Err()
+				_ = repo.Redis.PExpire(context.Background(), key, downloadStreamLease).Err()
+			}
+		}
+	}
+}
+
+// Release frees the concurrency slots of the download; it is safe to call more than once.
+func (s *DownloadStream) Release() {
+	s.once.Do(func() {
+		close(s.stop)
+		for _, key := range s.held {
+			_ = repo.Redis.ZRem(context.Background(), key, s.token).Err()
+		}
+	})
+}
+
+// Writer returns w throttled to the byte rates of the download, or w itself without rate limits.
+func (s *DownloadStream) Writer(w io.Writer) io.Writer {
+	if repo.Redis == nil {
+		return w
+	}
+	var rated []downloadLimit
+	minRate := int64(0)
+	for _, limit := range s.limits {
+		if limit.rate <= 0 {
+			continue
+		}
+		rated = append(rated, limit)
+		if minRate == 0 || limit.rate < minRate {
+			minRate = limit.rate
+		}
+	}
+	if len(rated) == 0 {
+		return w
+	}
+	// 每次取约 1/8 秒的量 低速时也能平滑输出
+	chunk := int(minRate / 8)
+	if chunk < downloadMinChunk {
+		chunk = downloadMinChunk
+	}
+	if chunk > downloadMaxChunk {
+		chunk = downloadMaxChunk
+	}
+	return &throttledWriter{w: w, ctx: s.ctx, limits: rated, chunk: chunk}
+}
+
+// throttledWriter writes in chunks, waiting on the Redis token buckets of its limits before each.
+type throttledWriter struct {
+	w      io.Writer
+	ctx    context.Context
+	limits []downloadLimit
+	chunk  int
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > t.chunk {
+			n = t.chunk
+		}
+		if err := t.wait(n); err != nil {
+			return written, err
+		}
+		m, err := t.w.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// wait blocks until every limit has n bytes available.
+func (t *throttledWriter) wait(n int) error {
+	var delay time.Duration
+	now := time.Now().UnixMilli()
+	for _, limit := range t.limits {
+		burst := limit.rate
+		if burst < int64(t.chunk) {
+			burst = int64(t.chunk)
+		}
+		ms, err := rateTakeScript.Run(t.ctx, repo.Redis, []string{"download:rate:" + limit.name},
+			limit.rate, burst, n, now).Int64()
+		if err != nil { // Redis 故障时不限速
+			if t.ctx.Err() != nil {
+				return t.ctx.Err()
+			}
+			continue
+		}
+		if d := time.Duration(ms) * time.Millisecond; d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
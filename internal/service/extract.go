@@ -0,0 +1,496 @@
+package service
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidArchive is returned for content that is not a supported or readable archive.
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrArchiveLimit is returned when an archive exceeds the entry, size or ratio limits.
+	ErrArchiveLimit = errors.New("archive exceeds extraction limits")
+)
+
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+)
+
+// ExtractOptions controls where and how an archive is extracted.
+type ExtractOptions struct {
+	ParentID uint64 // 解压到的文件夹 0 为根目录
+	Policy   ConflictPolicy
+	Progress func(percent int)
+}
+
+// ExtractResult summarizes an extraction.
+type ExtractResult struct {
+	Files   int   `json:"files"`
+	Folders int   `json:"folders"` // 新建或复用的文件夹
+	Skipped int   `json:"skipped"` // 不安全路径、链接与设备文件 以及按 skip 策略跳过的文件
+	Bytes   int64 `json:"bytes"`
+}
+
+// ArchiveFormatByName returns the archive format implied by a file name, or "".
+func ArchiveFormatByName(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(lower, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return archiveTarGz
+	}
+	return ""
+}
+
+// CheckExtractSource validates an extraction request before it is queued and returns the archive.
+func CheckExtractSource(userID, fileID, parentID uint64) (*model.UserFile, error) {
+	var archive model.UserFile
+	if err := repo.Db.
+		Where("id = ? AND user_id = ? AND is_dir = 0 AND is_deleted = 0", fileID, userID).
+		First(&archive).Error; err != nil {
+		return nil, err
+	}
+	if archive.ObjectID == nil || ArchiveFormatByName(archive.Name) == "" {
+		return nil, fmt.Errorf("%w: only .zip, .tar, .tar.gz and .tgz are supported", ErrInvalidArchive)
+	}
+	if err := checkParentFolder(repo.Db, userID, parentID); err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// detectArchiveFormat sniffs the archive format from the first bytes of its content.
+func detectArchiveFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return archiveZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return archiveTarGz
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return archiveTar
+	}
+	return ""
+}
+
+// archiveEntryPath splits an entry name into safe path segments; nil means the entry is skipped.
+// 与 sanitizeArchiveName 同理 绝对路径与 ../ 被折叠在目标文件夹之内 不会越界 (Zip Slip)
+func archiveEntryPath(name string) []string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.ContainsRune(name, '\x00') {
+		return nil
+	}
+	parts := make([]string, 0)
+	for _, part := range strings.Split(name, "/") {
+		if strings.TrimSpace(part) == "" || part == "." {
+			continue
+		}
+		part = sanitizeArchiveName(part)
+		if len(part) > 255 {
+			return nil
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 || len(parts) > maxPathDepth {
+		return nil
+	}
+	return parts
+}
+
+// extractor writes the entries of one archive into the user's files.
+type extractor struct {
+	ctx      context.Context
+	userID   uint64
+	userName string
+	opts     ExtractOptions
+
+	maxEntries int
+	maxBytes   int64 // 解压后总大小上限 取 EXTRACT_MAX_SIZE 与压缩比上限中较小者
+	entries    int
+	folders    map[string]uint64
+	spool      *os.File
+	result     ExtractResult
+}
+
+// ExtractArchive streams a stored ZIP or TAR archive out of storage and recreates its tree under
+// opts.ParentID. Every file goes through the same hash dedup as uploads, and the entry count,
+// total uncompressed size and compression ratio are limited to stop zip bombs.
+func ExtractArchive(ctx context.Context, userID uint64, archive *model.UserFile, opts ExtractOptions) (*ExtractResult, error) {
+	if archive.IsDir || archive.ObjectID == nil {
+		return nil, fmt.Errorf("%w: not a file", ErrInvalidArchive)
+	}
+	if storage.Default == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	obj, err := GetFileObjectById(*archive.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	userName, err := FindUserNameById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkParentFolder(repo.Db, userID, opts.ParentID); err != nil {
+		return nil, err
+	}
+
+	x := &extractor{
+		ctx:        ctx,
+		userID:     userID,
+		userName:   userName,
+		opts:       opts,
+		maxEntries: config.AppConfig.ExtractMaxEntries,
+		maxBytes:   config.AppConfig.ExtractMaxSize,
+		folders:    map[string]uint64{"": opts.ParentID},
+	}
+	if ratio := int64(config.AppConfig.ExtractMaxRatio); ratio > 0 {
+		limit := ratio * obj.Size
+		if limit < 1<<20 { // 小文件按比例限制过严 至少允许 1MB
+			limit = 1 << 20
+		}
+		if x.maxBytes <= 0 || limit < x.maxBytes {
+			x.maxBytes = limit
+		}
+	}
+	if x.spool, err = os.CreateTemp("", "extract-*"); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = x.spool.Close()
+		_ = os.Remove(x.spool.Name())
+	}()
+
+	reader, _, err := storage.Default.GetObject(ctx, obj.BucketName, obj.ObjectName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	counted := &countingReader{r: reader}
+	buffered := bufio.NewReader(counted)
+	head, _ := buffered.Peek(512)
+	switch detectArchiveFormat(head) {
+	case archiveZip:
+		err = x.extractZip(buffered, obj.Size)
+	case archiveTar:
+		err = x.extractTar(buffered, counted, obj.Size)
+	case archiveTarGz:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(buffered); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		err = x.extractTar(gz, counted, obj.Size)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format", ErrInvalidArchive)
+	}
+	return &x.result, err
+}
+
+// countingReader counts the bytes read from the stored archive for progress reporting.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (x *extractor) progress(done, total int64) {
+	if x.opts.Progress == nil || total <= 0 {
+		return
+	}
+	percent := int(done * 100 / total)
+	if percent > 99 { // 100 留给任务完成
+		percent = 99
+	}
+	x.opts.Progress(percent)
+}
+
+// extractZip spools the archive to a temp file first: the zip central directory sits at the end.
+func (x *extractor) extractZip(r io.Reader, size int64) error {
+	spool, err := os.CreateTemp("", "extract-zip-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+	if _, err := io.Copy(spool, r); err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(spool, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	// 先按声明的条目数与大小快速拒绝 实际读取时再按真实字节数限制
+	if x.maxEntries > 0 && len(zr.File) > x.maxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, x.maxEntries)
+	}
+	var declared uint64
+	for _, f := range zr.File {
+		declared += f.UncompressedSize64
+	}
+	if x.maxBytes > 0 && declared > uint64(x.maxBytes) {
+		return fmt.Errorf("%w: uncompressed size over %d bytes", ErrArchiveLimit, x.maxBytes)
+	}
+	for i, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir() || strings.HasSuffix(f.Name, "/"):
+			err = x.addDir(f.Name)
+		case mode.IsRegular():
+			err = x.addZipFile(f)
+		default: // 符号链接等
+			err = x.skip()
+		}
+		if err != nil {
+			return err
+		}
+		x.progress(int64(i+1), int64(len(zr.File)))
+	}
+	return nil
+}
+
+func (x *extractor) addZipFile(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, f.Name, err)
+	}
+	defer rc.Close()
+	return x.addFile(f.Name, rc)
+}
+
+// extractTar reads entries straight from the storage stream.
+func (x *extractor) extractTar(r io.Reader, counted *countingReader, size int64) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.addDir(hdr.Name)
+		case tar.TypeReg:
+			err = x.addFile(hdr.Name, tr)
+		case tar.TypeXGlobalHeader:
+			continue
+		default: // 链接、设备文件等
+			err = x.skip()
+		}
+		if err != nil {
+			return err
+		}
+		x.progress(counted.n, size)
+	}
+}
+
+// count enforces the entry limit and checks for cancellation.
+func (x *extractor) count() error {
+	if err := x.ctx.Err(); err != nil {
+		return err
+	}
+	x.entries++
+	if x.maxEntries > 0 && x.entries > x.maxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, x.maxEntries)
+	}
+	return nil
+}
+
+func (x *extractor) skip() error {
+	if err := x.count(); err != nil {
+		return err
+	}
+	x.result.Skipped++
+	return nil
+}
+
+func (x *extractor) addDir(name string) error {
+	if err := x.count(); err != nil {
+		return err
+	}
+	parts := archiveEntryPath(name)
+	if parts == nil { // "./" 等根目录条目
+		return nil
+	}
+	_, err := x.folder(parts)
+	return err
+}
+
+// folder returns the ID of the folder for dirs, creating missing ones; existing folders are reused.
+func (x *extractor) folder(dirs []string) (uint64, error) {
+	key := strings.Join(dirs, "/")
+	if id, ok := x.folders[key]; ok {
+		return id, nil
+	}
+	parent, err := x.folder(dirs[:len(dirs)-1])
+	if err != nil {
+		return 0, err
+	}
+	id, err := MkdirAll(x.userID, parent, dirs[len(dirs)-1:])
+	if err != nil {
+		return 0, err
+	}
+	x.folders[key] = id
+	x.result.Folders++
+	return id, nil
+}
+
+// addFile spools one entry to disk while hashing it, then links or stores the content.
+func (x *extractor) addFile(name string, r io.Reader) error {
+	if err := x.count(); err != nil {
+		return err
+	}
+	parts := archiveEntryPath(name)
+	if parts == nil {
+		x.result.Skipped++
+		return nil
+	}
+	parentID, err := x.folder(parts[:len(parts)-1])
+	if err != nil {
+		return err
+	}
+
+	if _, err := x.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := x.spool.Truncate(0); err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	remaining := x.maxBytes - x.result.Bytes
+	src := r
+	if x.maxBytes > 0 {
+		src = io.LimitReader(r, remaining+1) // 不信任条目头中声明的大小 按实际字节数限制
+	}
+	size, err := io.Copy(io.MultiWriter(x.spool, hasher), src)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, name, err)
+	}
+	if x.maxBytes > 0 && size > remaining {
+		return fmt.Errorf("%w: uncompressed size over %d bytes", ErrArchiveLimit, x.maxBytes)
+	}
+	if _, err := x.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	x.result.Bytes += size
+
+	fileName := parts[len(parts)-1]
+	err = x.storeFile(parentID, fileName, hex.EncodeToString(hasher.Sum(nil)), size)
+	if errors.Is(err, ErrEntrySkipped) {
+		x.result.Skipped++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	x.result.Files++
+	return nil
+}
+
+// storeFile references an existing object with the same hash, or uploads the spooled content.
+func (x *extractor) storeFile(parentID uint64, name, hash string, size int64) error {
+	var (
+		objectID   uint64
+		objectName string
+		createdNew bool
+	)
+	bucket := config.AppConfig.BucketName
+	head := make([]byte, sniffLen)
+	n, _ := x.spool.ReadAt(head, 0)
+	contentType := SniffContentType(head[:n], name)
+	put := func(object string) error {
+		return storage.Default.PutObject(x.ctx, bucket, object, x.spool, size, storage.PutOptions{
+			ContentType: contentType,
+			Hash:        hash,
+		})
+	}
+	existing, err := GetFileObjectByHash(x.userID, hash)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil {
+		available, checkErr := isFileObjectAvailable(x.ctx, existing)
+		if checkErr != nil {
+			return checkErr
+		}
+		if !available { // hash 存在但对象丢失 用本次内容补回
+			if err := put(existing.ObjectName); err != nil {
+				return err
+			}
+			if err := repo.Db.Model(&model.FileObject{}).
+				Where("id = ?", existing.ID).
+				Updates(map[string]interface{}{"bucket_name": bucket, "size": size}).Error; err != nil {
+				return err
+			}
+		}
+		if err := IncreaseRefCount(existing.ID); err != nil {
+			return err
+		}
+		objectID = existing.ID
+	} else {
+		objectName = objectNameFor(x.userName, hash)
+		if err := put(objectName); err != nil {
+			return err
+		}
+		obj := &model.FileObject{
+			UserID:      x.userID,
+			BucketName:  bucket,
+			Hash:        hash,
+			ObjectName:  objectName,
+			Size:        size,
+			ContentType: contentType,
+			RefCount:    1,
+		}
+		if err := CreateFilesObject(obj); err != nil {
+			_ = storage.Default.RemoveObject(x.ctx, bucket, objectName)
+			return err
+		}
+		objectID = obj.ID
+		createdNew = true
+	}
+
+	_, err = CreateUserFileEntryWithPolicy(&model.UserFile{
+		UserID:   x.userID,
+		ParentID: parentIDPtr(parentID),
+		Name:     name,
+		ObjectID: &objectID,
+		Size:     size,
+	}, x.opts.Policy)
+	if err != nil { // 回滚
+		if createdNew {
+			_ = storage.Default.RemoveObject(x.ctx, bucket, objectName)
+			_ = repo.Db.Delete(&model.FileObject{}, objectID).Error
+		} else {
+			_, _ = DecreaseRefCount(objectID)
+		}
+	}
+	return err
+}
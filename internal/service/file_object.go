@@ -7,14 +7,16 @@ import (
 	"CloudVault/internal/storage"
 	"CloudVault/model"
 	"CloudVault/utils"
-	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"path"
+	"strings"
 	"time"
 
 	"golang.org/x/net/context"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 const fileObjectCacheTTL = 5 * time.Minute
@@ -28,7 +30,7 @@ func cacheFileObject(ctx context.Context, obj *model.FileObject) {
 	}
 	_ = utils.SetFileObjectToCache(ctx, obj.ID, obj, fileObjectCacheTTL)
 	if obj.Hash != "" {
-		_ = utils.SetFileObjectIDByHash(ctx, obj.Hash, obj.ID, fileObjectCacheTTL)
+		_ = utils.SetFileObjectIDByHash(ctx, obj.DedupKey, obj.Hash, obj.ID, fileObjectCacheTTL)
 	}
 	if obj.BucketName != "" && obj.ObjectName != "" {
 		_ = utils.SetFileObjectIDByPath(ctx, obj.BucketName, obj.ObjectName, obj.ID, fileObjectCacheTTL)
@@ -54,8 +56,15 @@ func DeleteMinioFile(fileObject *model.FileObject) error {
 	)
 }
 
-// CreateFilesObject inserts a file object record.
+// CreateFilesObject inserts a file object record, keyed under the dedup scope of its creator.
 func CreateFilesObject(dir *model.FileObject) error {
+	if dir.DedupKey == "" {
+		key, err := newDedupKey(dir.UserID)
+		if err != nil {
+			return err
+		}
+		dir.DedupKey = key
+	}
 	if err := repo.Db.Model(&model.FileObject{}).Create(dir).Error; err != nil {
 		return err
 	}
@@ -87,21 +96,29 @@ func GetFileByObject(bucket, object string) (*model.FileObject, error) {
 	return &file, err
 }
 
-// GetFileObjectByHash finds a file object by hash.
-func GetFileObjectByHash(hash string) (*model.FileObject, error) {
-	if id, ok := utils.GetFileObjectIDByHash(context.Background(), hash); ok {
+// GetFileObjectByHash finds a file object by hash within the dedup scope of userID.
+// 不去重时总是返回 gorm.ErrRecordNotFound
+func GetFileObjectByHash(userID uint64, hash string) (*model.FileObject, error) {
+	key, ok, err := dedupKeyFor(dedupScope(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if id, ok := utils.GetFileObjectIDByHash(context.Background(), key, hash); ok {
 		obj, err := GetFileObjectById(id)
-		if err == nil {
+		if err == nil && obj.DedupKey == key {
 			return obj, nil
 		}
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			_ = utils.InvalidateFileObjectHashCache(context.Background(), hash)
+		if err == nil || errors.Is(err, gorm.ErrRecordNotFound) { // 对象已删除或已迁移到其他范围
+			_ = utils.InvalidateFileObjectHashCache(context.Background(), key, hash)
 		} else {
 			return nil, err
 		}
 	}
 	var obj model.FileObject
-	err := repo.Db.Where("hash = ?", hash).First(&obj).Error
+	err = repo.Db.Where("dedup_key = ? AND hash = ?", key, hash).First(&obj).Error
 	if err == nil {
 		cacheFileObject(context.Background(), &obj)
 	}
@@ -177,7 +194,14 @@ func FastUpload(
 	ctx context.Context,
 	req *dto.UploadFileByHashRequest,
 ) (*dto.FastUploadResponse, error) {
-	obj, err := GetFileObjectByHash(req.Hash)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	policy, err := ParseConflictPolicy(req.ConflictPolicy)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := GetFileObjectByHash(req.UserId, req.Hash)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return &dto.FastUploadResponse{
@@ -209,29 +233,89 @@ func FastUpload(
 		}, nil
 	}
 
-	if err := IncreaseRefCount(obj.ID); err != nil {
+	// 只凭 hash 不能引用他人的对象 需先证明持有文件内容
+	allowed, challenge, err := authorizeInstantUpload(ctx, req.UserId, obj, req.Proof)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		reason := "proof_required"
+		if req.Proof != "" {
+			reason = "proof_mismatch"
+		}
+		return &dto.FastUploadResponse{
+			Instant:    false,
+			NeedUpload: req.Proof != "",
+			NeedProof:  true,
+			Challenge:  challenge,
+			Reason:     reason,
+		}, nil
+	}
+
+	result, err := linkObject(req.UserId, req.ParentId, req.FileName, req.RelativePath, obj, policy)
+	if errors.Is(err, ErrEntrySkipped) {
+		return &dto.FastUploadResponse{
+			Instant:  false,
+			Reason:   ActionSkipped,
+			FileId:   result.FileID,
+			FileName: result.Name,
+			Action:   result.Action,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dto.FastUploadResponse{
+		Instant:  true,
+		FileId:   result.FileID,
+		FileName: result.Name,
+		Action:   result.Action,
+	}, nil
+}
+
+// linkObject adds obj to the user's files as an instant upload.
+func linkObject(userID, parentID uint64, fileName, relativePath string, obj *model.FileObject, policy ConflictPolicy) (*dto.EntryResult, error) {
+	parent, name, err := uploadTarget(userID, parentID, fileName, relativePath)
+	if err != nil {
 		return nil, err
 	}
-	var parentID *uint64
-	if req.ParentId != 0 {
-		parentID = &req.ParentId
+	if err := IncreaseRefCount(obj.ID); err != nil {
+		return nil, err
 	}
 	userFile := &model.UserFile{
-		UserID:   req.UserId,
-		ParentID: parentID,
-		Name:     req.FileName,
+		UserID:   userID,
+		ParentID: parent,
+		Name:     name,
 		ObjectID: &obj.ID,
 		Size:     obj.Size,
 		IsDir:    false,
 	}
-	if err := CreateUserFileEntry(userFile); err != nil { // 创建文件失败 回滚引用计数
+	result, err := CreateUserFileEntryWithPolicy(userFile, policy)
+	if err != nil { // 创建文件失败或跳过 回滚引用计数
 		_, _ = DecreaseRefCount(obj.ID)
-		return nil, err
 	}
-	return &dto.FastUploadResponse{
-		Instant: true,
-		FileId:  userFile.ID,
-	}, nil
+	return result, err
+}
+
+// peekUploadConflict finds the entry an upload to fileName / relativePath would collide with,
+// without creating any folder; nil when the name is free or a folder on the path is missing.
+func peekUploadConflict(userID, parentID uint64, fileName, relativePath string) (*model.UserFile, error) {
+	parts := []string{fileName}
+	if relativePath != "" {
+		var err error
+		if parts, err = splitRelativePath(relativePath); err != nil {
+			return nil, err
+		}
+	}
+	parent := parentIDPtr(parentID)
+	for _, dir := range parts[:len(parts)-1] {
+		folder, err := findSibling(repo.Db, userID, parent, dir, 0)
+		if err != nil || folder == nil || !folder.IsDir {
+			return nil, err
+		}
+		parent = &folder.ID
+	}
+	return findSibling(repo.Db, userID, parent, parts[len(parts)-1], 0)
 }
 
 // GetUploadSessionByHash loads an upload session by hash and user.
@@ -266,12 +350,45 @@ func CheckChunkNum(userID uint64, hash string, chunks *[]model.FileChunk) error
 	}
 	return repo.Db.
 		Where("upload_id = ? AND status = 1", session.UploadID).
+		Order("chunk_index asc").
 		Find(chunks).Error
 }
 
 // MultiPartFileInit initializes multipart upload.
 func MultiPartFileInit(ctx context.Context, req dto.MultipartInitRequest) (*dto.MultiPartFileResponse, error) {
-	if obj, err := GetFileObjectByHash(req.Hash); err == nil { // db
+	if !storage.IsSHA256Hex(req.Hash) { // 完成时会校验内容 非 SHA-256 的 hash 不可能通过
+		return nil, ErrInvalidHash
+	}
+	if req.RelativePath != "" {
+		if _, err := splitRelativePath(req.RelativePath); err != nil {
+			return nil, err
+		}
+	}
+	policy, err := ParseConflictPolicy(req.ConflictPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if policy == ConflictFail || policy == ConflictSkip { // 上传前先看名字 免得传完才发现冲突
+		existing, err := peekUploadConflict(req.UserId, req.ParentId, req.FileName, req.RelativePath)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && policy == ConflictFail {
+			return nil, fmt.Errorf("%w: %s", ErrNameConflict, existing.Name)
+		}
+		if existing != nil {
+			return &dto.MultiPartFileResponse{
+				FileId:   existing.ID,
+				FileName: existing.Name,
+				Action:   ActionSkipped,
+			}, nil
+		}
+	}
+	if err := CheckQuota(req.UserId, req.Size); err != nil { // 容量不足时不再创建会话
+		return nil, err
+	}
+	var challenge *dto.ProofChallenge
+	if obj, err := GetFileObjectByHash(req.UserId, req.Hash); err == nil { // db
 		available, checkErr := isFileObjectAvailable(ctx, obj) // minio
 		if checkErr != nil {
 			return nil, checkErr
@@ -279,27 +396,23 @@ func MultiPartFileInit(ctx context.Context, req dto.MultipartInitRequest) (*dto.
 		if !available {
 			goto uploadFlow
 		}
-		if err := IncreaseRefCount(obj.ID); err != nil {
-			return nil, err
-		}
-		var parentID *uint64
-		if req.ParentId != 0 {
-			parentID = &req.ParentId
+		allowed, ch, authErr := authorizeInstantUpload(ctx, req.UserId, obj, req.Proof)
+		if authErr != nil {
+			return nil, authErr
 		}
-		userFile := &model.UserFile{
-			UserID:   req.UserId,
-			ParentID: parentID,
-			Name:     req.FileName,
-			ObjectID: &obj.ID,
-			Size:     obj.Size,
-			IsDir:    false,
+		if !allowed { // 未通过持有证明 照常走分片上传 同时下发挑战供客户端选择
+			challenge = ch
+			goto uploadFlow
 		}
-		if err := CreateUserFileEntry(userFile); err != nil {
-			_, _ = DecreaseRefCount(obj.ID)
+		result, err := linkObject(req.UserId, req.ParentId, req.FileName, req.RelativePath, obj, policy)
+		if err != nil && !errors.Is(err, ErrEntrySkipped) {
 			return nil, err
 		}
 		return &dto.MultiPartFileResponse{
-			Instant: true,
+			Instant:  err == nil,
+			FileId:   result.FileID,
+			FileName: result.Name,
+			Action:   result.Action,
 		}, nil
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) { // 如果不是没有找到记录 也即是产生了其他错误
 		return nil, err
@@ -311,8 +424,14 @@ uploadFlow: // hash noExist || no fileObject
 		return nil, err
 	}
 	uploaded := make([]int, 0, len(chunks))
+	uploadedChunks := make([]dto.UploadedChunk, 0, len(chunks))
 	for _, c := range chunks {
 		uploaded = append(uploaded, c.ChunkIndex)
+		uploadedChunks = append(uploadedChunks, dto.UploadedChunk{
+			Index:    c.ChunkIndex,
+			Size:     c.ChunkSize,
+			Checksum: c.Checksum,
+		})
 	}
 	if len(uploaded) == 0 {
 		if err := CreateUploadSession(req); err != nil {
@@ -324,11 +443,23 @@ uploadFlow: // hash noExist || no fileObject
 	if err := repo.Db.Where("file_hash = ? AND user_id = ?", req.Hash, req.UserId).Order("id desc").First(&session).Error; err == nil {
 		uploadID = session.UploadID
 	}
-	return &dto.MultiPartFileResponse{
-		Instant:  false,
-		UploadID: uploadID,
-		Uploaded: uploaded,
-	}, nil
+	resp := &dto.MultiPartFileResponse{
+		Instant:   false,
+		UploadID:  uploadID,
+		Uploaded:  uploaded,
+		Chunks:    uploadedChunks,
+		NeedProof: challenge != nil,
+		Challenge: challenge,
+	}
+	if req.Presign && uploadID != "" {
+		parts, expiresAt, err := presignChunks(ctx, &session, uploaded)
+		if err != nil {
+			return nil, err
+		}
+		resp.PresignedChunks = parts
+		resp.PresignExpiresAt = expiresAt.Unix()
+	}
+	return resp, nil
 }
 
 // CreateUploadSession creates an upload session record.
@@ -343,6 +474,13 @@ func CreateUploadSession(req dto.MultipartInitRequest) error {
 		TotalChunks: req.TotalChunks,
 		Status:      0,
 	}
+	if req.ConflictPolicy != "" {
+		policy, err := ParseConflictPolicy(req.ConflictPolicy)
+		if err != nil {
+			return err
+		}
+		session.ConflictPolicy = string(policy)
+	}
 	return repo.Db.Create(&session).Error
 }
 
@@ -357,43 +495,58 @@ func UploadChunk(
 		return err
 	}
 	defer src.Close()
-	objectPath := fmt.Sprintf("chunks/%s/%d", req.UploadID, req.ChunkIndex)
+	objectPath := chunkObjectPath(req.UploadID, req.ChunkIndex)
 	if storage.Default == nil {
 		return fmt.Errorf("storage not initialized")
 	}
+	algo, declared, checksummer, err := parseChunkChecksum(req.Checksum)
+	if err != nil {
+		return err
+	}
+	if err := checkUploadActive(req.UploadID); err != nil {
+		return err
+	}
+	// 先在本地读一遍校验分片 不合格的数据不会写入存储 覆盖已有的好分片
+	n, err := io.Copy(checksummer, src)
+	if err != nil {
+		return err
+	}
+	if n != req.File.Size {
+		return fmt.Errorf("%w: chunk %d read %d of %d bytes", ErrChunkChecksumMismatch, req.ChunkIndex, n, req.File.Size)
+	}
+	actual := hex.EncodeToString(checksummer.Sum(nil))
+	if declared != "" && declared != actual {
+		return fmt.Errorf("%w: chunk %d expected %s:%s, got %s", ErrChunkChecksumMismatch, req.ChunkIndex, algo, declared, actual)
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
 	if err := storage.Default.PutObject(
 		ctx,
 		req.BucketName,
 		objectPath,
 		src,
 		req.File.Size,
-		storage.PutOptions{},
+		storage.PutOptions{Hash: req.FileHash},
 	); err != nil {
 		return err
 	}
+	if err := touchUploadSession(req.UploadID); err != nil { // 有分片写入的会话不会被清理
+		return err
+	}
 	chunk := model.FileChunk{
 		UploadID:   req.UploadID,
 		ChunkIndex: req.ChunkIndex,
 		ChunkSize:  req.File.Size,
 		ChunkPath:  objectPath,
+		Checksum:   algo + ":" + actual,
 		Status:     1,
 	}
 	// 并发上传时 同一个分片被多次提交 导致数据库的混乱 所以需要幂等
-	//
-	return repo.Db.
-		Clauses(clause.OnConflict{
-			Columns: []clause.Column{
-				{Name: "upload_id"},
-				{Name: "chunk_index"},
-			},
-			DoUpdates: clause.AssignmentColumns([]string{
-				"chunk_size",
-				"chunk_path",
-				"status",
-				"updated_at",
-			}),
-		}).
-		Create(&chunk).Error
+	if err := saveChunkRecord(&chunk); err != nil {
+		return err
+	}
+	return keepChunk(ctx, &chunk)
 }
 
 // FindAllChunkFile loads all chunks for completion.
@@ -408,66 +561,99 @@ func FindAllChunkFile(userID uint64, chunks *[]model.FileChunk, req dto.Multipar
 		Find(chunks).Error
 }
 
-// CompleteFile composes chunks and creates file records.
+// CompleteFile composes chunks and creates file records; the result reports the name finally used.
 func CompleteFile(
 	ctx context.Context,
 	req dto.MultipartCompleteRequest,
 	userName string,
-) error {
+) (*dto.EntryResult, error) {
 	userId, err := FindIdByUsername(userName)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	session, err := GetUploadSessionByHash(userId, req.FileHash)
+	if err != nil {
+		return nil, err
+	}
+	return completeUpload(ctx, userId, userName, session, req, "")
+}
+
+// completeUpload verifies and merges the chunks of session into a file of userId.
+// staged is the SHA-256 of the staging object when the caller already merged the chunks.
+// 分片上传与 tus 上传共用 会话由调用方定位
+func completeUpload(
+	ctx context.Context,
+	userId uint64,
+	userName string,
+	session *model.UploadSession,
+	req dto.MultipartCompleteRequest,
+	staged string,
+) (*dto.EntryResult, error) {
 	chunks := make([]model.FileChunk, 0)
-	if err := FindAllChunkFile(userId, &chunks, req); err != nil {
-		return err
+	if err := repo.Db.
+		Where("upload_id = ? AND status = 1", session.UploadID).
+		Order("chunk_index asc").
+		Find(&chunks).Error; err != nil {
+		return nil, err
 	}
 	if len(chunks) != req.TotalChunks {
-		return errors.New("chunks not complete")
+		return nil, errors.New("chunks not complete")
+	}
+	if req.RelativePath != "" {
+		if _, err := splitRelativePath(req.RelativePath); err != nil {
+			return nil, err
+		}
+	}
+	if req.ConflictPolicy == "" {
+		req.ConflictPolicy = session.ConflictPolicy
+	}
+	policy, err := ParseConflictPolicy(req.ConflictPolicy)
+	if err != nil {
+		return nil, err
 	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
+	if err := CheckQuota(userId, req.FileSize); err != nil {
+		return nil, err
+	}
 	if storage.Default == nil {
-		return fmt.Errorf("storage not initialized")
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	var total int64
+	for _, c := range chunks {
+		total += c.ChunkSize
+	}
+	if total != session.FileSize || total != req.FileSize { // 分片大小之和必须与声明的文件大小一致
+		return nil, fmt.Errorf("%w: chunks %d bytes, file %d bytes", ErrChunkSizeMismatch, total, session.FileSize)
 	}
 	cleanupUploadData := func() { // 删除所有 chunk session 等
-		for _, c := range chunks {
-			_ = storage.Default.RemoveObject(ctx, config.AppConfig.BucketName, c.ChunkPath)
-		}
-		var session model.UploadSession
-		if err := repo.Db.Where("file_hash = ? AND user_id = ?", req.FileHash, userId).Order("id desc").First(&session).Error; err == nil {
-			repo.Db.Where("upload_id = ?", session.UploadID).Delete(&model.FileChunk{})
-			repo.Db.Delete(&session)
+		_ = removeUploadSession(ctx, session)
+	}
+
+	// 客户端声明的 hash 不可信 先合并到临时对象 校验合并结果后才复制到正式位置
+	bucket := config.AppConfig.BucketName
+	staging := stagingObjectPath(session.UploadID)
+	defer func() {
+		_ = storage.Default.RemoveObject(ctx, bucket, staging)
+	}()
+	if staged == "" {
+		if staged, err = stageUpload(ctx, session, chunks); err != nil {
+			return nil, err
 		}
 	}
+	if !strings.EqualFold(staged, req.FileHash) {
+		cleanupUploadData()
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrContentHashMismatch, req.FileHash, staged)
+	}
 	writeObject := func(objectName string) error {
-		if req.TotalChunks == 0 {
-			if req.FileSize != 0 {
-				return errors.New("invalid total_chunks")
-			}
-			return storage.Default.PutObject(
-				ctx,
-				config.AppConfig.BucketName,
-				objectName,
-				bytes.NewReader(nil),
-				0,
-				storage.PutOptions{},
-			)
-		}
-		srcs := make([]storage.CopySource, 0, len(chunks))
-		for _, c := range chunks {
-			srcs = append(srcs, storage.CopySource{
-				Bucket: config.AppConfig.BucketName,
-				Object: c.ChunkPath,
-			})
-		}
 		dst := storage.CopyDest{
-			Bucket: config.AppConfig.BucketName,
+			Bucket: bucket,
 			Object: objectName,
+			Hash:   req.FileHash,
 		}
-		return storage.Default.ComposeObject(ctx, dst, srcs...) // 调用 minio 客户端api
+		return storage.Default.ComposeObject(ctx, dst, storage.CopySource{Bucket: bucket, Object: staging})
 	}
 
 	var (
@@ -476,21 +662,21 @@ func CompleteFile(
 		createdNewObject bool
 		increasedRef     bool
 	)
-	existingObj, err := GetFileObjectByHash(req.FileHash)
+	existingObj, err := GetFileObjectByHash(userId, req.FileHash)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return err
+		return nil, err
 	}
 	if err == nil {
 		available, checkErr := isFileObjectAvailable(ctx, existingObj)
 		if checkErr != nil {
-			return checkErr
+			return nil, checkErr
 		}
 		if !available { // hash 存在 但对象不可用 更新并刷新缓存
 			oldBucket := existingObj.BucketName
 			oldObject := existingObj.ObjectName
 			dstObject = existingObj.ObjectName
 			if err := writeObject(dstObject); err != nil {
-				return err
+				return nil, err
 			}
 			if err := repo.Db.Model(&model.FileObject{}).
 				Where("id = ?", existingObj.ID).
@@ -499,7 +685,7 @@ func CompleteFile(
 					"object_name": dstObject,
 					"size":        req.FileSize,
 				}).Error; err != nil {
-				return err
+				return nil, err
 			}
 			existingObj.BucketName = config.AppConfig.BucketName
 			existingObj.ObjectName = dstObject
@@ -511,44 +697,45 @@ func CompleteFile(
 		}
 		// hash 存在＋对象可用
 		if err := IncreaseRefCount(existingObj.ID); err != nil {
-			return err
+			return nil, err
 		}
 		increasedRef = true
 		objectID = existingObj.ID
 	} else {
-		dstObject = BuildObjectName(userName, req.FileHash)
+		dstObject = objectNameFor(userName, req.FileHash)
 		if err := writeObject(dstObject); err != nil {
-			return err
+			return nil, err
 		}
 		obj := &model.FileObject{
-			UserID:     userId,
-			BucketName: config.AppConfig.BucketName,
-			Hash:       req.FileHash,
-			ObjectName: dstObject,
-			Size:       req.FileSize,
-			RefCount:   1,
+			UserID:      userId,
+			BucketName:  config.AppConfig.BucketName,
+			Hash:        req.FileHash,
+			ObjectName:  dstObject,
+			Size:        req.FileSize,
+			ContentType: DetectObjectContentType(ctx, config.AppConfig.BucketName, dstObject, uploadFileName(session, req)),
+			RefCount:    1,
 		}
 		if err := CreateFilesObject(obj); err != nil { // 回滚
 			_ = storage.Default.RemoveObject(ctx, config.AppConfig.BucketName, dstObject)
-			return err
+			return nil, err
 		}
 		objectID = obj.ID
 		createdNewObject = true
 	}
 
-	var parentID *uint64
-	if req.ParentId != 0 {
-		parentID = &req.ParentId
-	}
-	userFile := &model.UserFile{
-		UserID:   userId,
-		Name:     req.FileName,
-		ParentID: parentID,
-		IsDir:    false,
-		ObjectID: &objectID,
-		Size:     req.FileSize,
+	var result *dto.EntryResult
+	parentID, name, err := uploadTarget(userId, req.ParentId, req.FileName, req.RelativePath)
+	if err == nil {
+		result, err = CreateUserFileEntryWithPolicy(&model.UserFile{
+			UserID:   userId,
+			Name:     name,
+			ParentID: parentID,
+			IsDir:    false,
+			ObjectID: &objectID,
+			Size:     req.FileSize,
+		}, policy)
 	}
-	if err := CreateUserFileEntry(userFile); err != nil { // 回滚
+	if err != nil { // 回滚
 		if createdNewObject {
 			_ = storage.Default.RemoveObject(ctx, config.AppConfig.BucketName, dstObject)
 			_ = repo.Db.Delete(&model.FileObject{}, objectID).Error
@@ -556,11 +743,25 @@ func CompleteFile(
 		if increasedRef {
 			_, _ = DecreaseRefCount(objectID)
 		}
-		return err
+		if !errors.Is(err, ErrEntrySkipped) {
+			return nil, err
+		}
+		// 按 skip 策略丢弃刚上传的内容 会话照常清理
 	}
 
 	cleanupUploadData()
-	return nil
+	return result, nil
+}
+
+// uploadFileName returns the name a completed upload is stored under, for type detection.
+func uploadFileName(session *model.UploadSession, req dto.MultipartCompleteRequest) string {
+	if req.RelativePath != "" {
+		return path.Base(req.RelativePath)
+	}
+	if req.FileName != "" {
+		return req.FileName
+	}
+	return session.FileName
 }
 
 // FindObjectIdByName finds object ID by name.
@@ -586,14 +787,24 @@ func RemoveObject(objectId uint64) error {
 		return nil
 	}
 	// 如果是最后一个 则清理数据
-	if err := DeleteMinioFile(&fileObject); err != nil {
+	// 不同去重范围的对象可能指向同一个存储路径 仍被其他对象使用时只删除记录
+	var sharing int64
+	if err := repo.Db.Model(&model.FileObject{}).
+		Where("bucket_name = ? AND object_name = ? AND id <> ? AND ref_count > 0",
+			fileObject.BucketName, fileObject.ObjectName, objectId).
+		Count(&sharing).Error; err != nil {
 		return err
 	}
+	if sharing == 0 {
+		if err := DeleteMinioFile(&fileObject); err != nil {
+			return err
+		}
+	}
 	if err := repo.Db.Delete(&model.FileObject{}, objectId).Error; err != nil {
 		return err
 	}
 	_ = utils.InvalidateFileObjectCache(context.Background(), objectId)
-	_ = utils.InvalidateFileObjectHashCache(context.Background(), fileObject.Hash)
+	_ = utils.InvalidateFileObjectHashCache(context.Background(), fileObject.DedupKey, fileObject.Hash)
 	_ = utils.InvalidateFileObjectPathCache(context.Background(), fileObject.BucketName, fileObject.ObjectName)
 	var session model.UploadSession
 	if err := repo.Db.Where("file_hash = ? AND user_id = ?", fileObject.Hash, fileObject.UserID).Order("id desc").First(&session).Error; err != nil {
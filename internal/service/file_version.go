@@ -0,0 +1,269 @@
+package service
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const versionPruneBatch = 100
+
+// ErrVersionNotFound is returned for a version that does not belong to the file.
+var ErrVersionNotFound = errors.New("version not found")
+
+// saveVersion keeps the current content of file as its newest version inside tx.
+// 对象引用从条目转给版本记录 因此不增减 ref_count
+func saveVersion(tx *gorm.DB, file *model.UserFile) error {
+	if file.ObjectID == nil {
+		return nil
+	}
+	var latest int
+	if err := tx.Model(&model.FileVersion{}).
+		Where("user_file_id = ?", file.ID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&latest).Error; err != nil {
+		return err
+	}
+	return tx.Create(&model.FileVersion{
+		UserFileID: file.ID,
+		Version:    latest + 1,
+		UserID:     file.UserID,
+		ObjectID:   *file.ObjectID,
+		Size:       file.Size,
+	}).Error
+}
+
+// purgeFileVersions deletes every version of fileID inside tx and returns their bytes and objects.
+// 调用方负责归还容量 并在提交后对返回的对象减引用
+func purgeFileVersions(tx *gorm.DB, fileID uint64) (int64, []uint64, error) {
+	var versions []model.FileVersion
+	if err := tx.Where("user_file_id = ?", fileID).Find(&versions).Error; err != nil {
+		return 0, nil, err
+	}
+	if len(versions) == 0 {
+		return 0, nil, nil
+	}
+	var bytes int64
+	objects := make([]uint64, 0, len(versions))
+	for _, v := range versions {
+		res := tx.Delete(&model.FileVersion{}, v.ID)
+		if res.Error != nil {
+			return 0, nil, res.Error
+		}
+		if res.RowsAffected == 0 { // 已被清理任务删除
+			continue
+		}
+		bytes += v.Size
+		objects = append(objects, v.ObjectID)
+	}
+	return bytes, objects, nil
+}
+
+// removeFileVersions deletes every version of a file being permanently deleted and returns their bytes.
+func removeFileVersions(fileID uint64) (int64, error) {
+	bytes, objects, err := purgeFileVersions(repo.Db, fileID)
+	if err != nil {
+		return 0, err
+	}
+	for _, objectID := range objects {
+		if err := RemoveObject(objectID); err != nil {
+			return 0, err
+		}
+	}
+	return bytes, nil
+}
+
+// loadVersionedFile returns an active, non-folder file of the user.
+func loadVersionedFile(userID, fileID uint64) (*model.UserFile, error) {
+	var file model.UserFile
+	if err := repo.Db.
+		Where("id = ? AND user_id = ? AND is_dir = 0 AND is_deleted = 0", fileID, userID).
+		First(&file).Error; err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// ListFileVersions returns the earlier versions of a user's file, newest first.
+func ListFileVersions(userID, fileID uint64) (*model.UserFile, []model.FileVersion, error) {
+	file, err := loadVersionedFile(userID, fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var versions []model.FileVersion
+	if err := repo.Db.
+		Where("user_file_id = ?", fileID).
+		Order("version DESC").
+		Find(&versions).Error; err != nil {
+		return nil, nil, err
+	}
+	return file, versions, nil
+}
+
+// GetFileVersion returns one version of a user's file.
+func GetFileVersion(userID, fileID, versionID uint64) (*model.UserFile, *model.FileVersion, error) {
+	file, err := loadVersionedFile(userID, fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var version model.FileVersion
+	if err := repo.Db.
+		Where("id = ? AND user_file_id = ?", versionID, fileID).
+		First(&version).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrVersionNotFound
+		}
+		return nil, nil, err
+	}
+	return file, &version, nil
+}
+
+// RestoreFileVersion makes a version the current content of the file; the content it replaces
+// becomes the newest version, so a restore can itself be undone.
+// 两份内容都仍被保留 已用空间与引用计数都不变
+func RestoreFileVersion(userID, fileID, versionID uint64) (*model.UserFile, error) {
+	var file model.UserFile
+	err := repo.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Where("id = ? AND user_id = ? AND is_dir = 0 AND is_deleted = 0", fileID, userID).
+			First(&file).Error; err != nil {
+			return err
+		}
+		var version model.FileVersion
+		if err := tx.Where("id = ? AND user_file_id = ?", versionID, fileID).First(&version).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVersionNotFound
+			}
+			return err
+		}
+		// 与清理任务并发时 以删除成功为准 避免同一引用被转移两次
+		res := tx.Delete(&model.FileVersion{}, version.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVersionNotFound
+		}
+		if err := saveVersion(tx, &file); err != nil {
+			return err
+		}
+		file.ObjectID = &version.ObjectID
+		file.Size = version.Size
+		return tx.Model(&model.UserFile{}).
+			Where("id = ?", file.ID).
+			Updates(map[string]interface{}{
+				"object_id": version.ObjectID,
+				"size":      version.Size,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidateFileListCache(userID, file.ParentID)
+	return &file, nil
+}
+
+// versionRetention returns how many versions a user keeps per file and for how many days;
+// 0 disables a rule.
+func versionRetention(user *model.User) (keep, days int) {
+	keep, days = config.AppConfig.VersionKeep, config.AppConfig.VersionRetentionDays
+	if user.VersionKeep != nil {
+		keep = *user.VersionKeep
+	}
+	if user.VersionDays != nil {
+		days = *user.VersionDays
+	}
+	return keep, days
+}
+
+// PruneFileVersions deletes versions outside each user's retention rules and returns how many
+// were removed.
+func PruneFileVersions(ctx context.Context) (int, error) {
+	var userIDs []uint64
+	if err := repo.Db.Model(&model.FileVersion{}).Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		n, err := pruneUserVersions(userID, time.Now())
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// pruneUserVersions drops the versions of one user that are beyond the newest keep of their file
+// or older than the user's days.
+func pruneUserVersions(userID uint64, now time.Time) (int, error) {
+	var user model.User
+	if err := repo.Db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return 0, err
+	}
+	keep, days := versionRetention(&user)
+	if keep <= 0 && days <= 0 {
+		return 0, nil
+	}
+	var versions []model.FileVersion
+	if err := repo.Db.
+		Where("user_id = ?", userID).
+		Order("user_file_id, version DESC").
+		Find(&versions).Error; err != nil {
+		return 0, err
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	seen := make(map[uint64]int)
+	expired := make([]model.FileVersion, 0)
+	for _, v := range versions {
+		seen[v.UserFileID]++
+		if (keep > 0 && seen[v.UserFileID] > keep) || (days > 0 && v.CreatedAt.Before(cutoff)) {
+			expired = append(expired, v)
+		}
+	}
+
+	removed := 0
+	for start := 0; start < len(expired); start += versionPruneBatch {
+		end := start + versionPruneBatch
+		if end > len(expired) {
+			end = len(expired)
+		}
+		var objects []uint64
+		err := repo.Db.Transaction(func(tx *gorm.DB) error {
+			objects = objects[:0]
+			var bytes int64
+			for _, v := range expired[start:end] {
+				res := tx.Delete(&model.FileVersion{}, v.ID)
+				if res.Error != nil {
+					return res.Error
+				}
+				if res.RowsAffected == 0 { // 已被恢复
+					continue
+				}
+				bytes += v.Size
+				objects = append(objects, v.ObjectID)
+			}
+			return releaseSpace(tx, userID, bytes)
+		})
+		if err != nil {
+			return removed, err
+		}
+		for _, objectID := range objects {
+			_ = RemoveObject(objectID)
+		}
+		removed += len(objects)
+	}
+	if removed > 0 {
+		_ = utils.InvalidateUserInfoCache(context.Background(), userID)
+	}
+	return removed, nil
+}
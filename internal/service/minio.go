@@ -2,11 +2,13 @@ package service
 
 import (
 	"CloudVault/config"
+	"CloudVault/internal/dto"
 	"CloudVault/internal/repo"
 	"CloudVault/internal/storage"
 	"CloudVault/model"
 	"CloudVault/utils"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -53,6 +55,7 @@ func MinioUploadFile(
 				size,
 				storage.PutOptions{
 					ContentType: GetContentBook(filePath),
+					Hash:        hash,
 				},
 			); err != nil {
 				return err
@@ -85,17 +88,19 @@ func MinioUploadFile(
 			size,
 			storage.PutOptions{
 				ContentType: GetContentBook(filePath),
+				Hash:        hash,
 			},
 		); err != nil {
 			return err
 		}
 		fileObject := &model.FileObject{
-			UserID:     userId,
-			BucketName: bucketName,
-			ObjectName: objectName,
-			Size:       size,
-			Hash:       hash,
-			RefCount:   1,
+			UserID:      userId,
+			BucketName:  bucketName,
+			ObjectName:  objectName,
+			Size:        size,
+			Hash:        hash,
+			ContentType: DetectObjectContentType(ctx, bucketName, objectName, filePath),
+			RefCount:    1,
 		}
 		if err := CreateFilesObject(fileObject); err != nil {
 			return err
@@ -111,7 +116,7 @@ func MinioUploadFile(
 		IsDir:    false,
 		Size:     size,
 	}
-	if err := CreateUserFileEntry(file); err != nil {
+	if _, err := CreateUserFileEntryWithPolicy(file, ConflictRename); err != nil {
 		if createdNew {
 			if storage.Default != nil {
 				_ = storage.Default.RemoveObject(ctx, bucketName, objectName)
@@ -125,33 +130,6 @@ func MinioUploadFile(
 	return nil
 }
 
-// GetContentBook returns content type by file extension.
-func GetContentBook(filename string) string {
-	ext := strings.ToLower(path.Ext(filename))
-	switch ext {
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".png":
-		return "image/png"
-	case ".gif":
-		return "image/gif"
-	case ".txt":
-		return "text/plain; charset=utf-8"
-	case ".pdf":
-		return "application/pdf"
-	case ".zip":
-		return "application/zip"
-	case ".tar":
-		return "application/x-tar"
-	case ".gz":
-		return "application/gzip"
-	case ".mp4":
-		return "video/mp4"
-	default:
-		return "application/octet-stream"
-	}
-}
-
 // MinioDownloadObject downloads an object from MinIO.
 func MinioDownloadObject(
 	ctx context.Context,
@@ -170,6 +148,27 @@ func MinioDownloadObject(
 	return object, &info, nil
 }
 
+// MinioDownloadObjectRange downloads length bytes of an object from offset (length < 0 reads to
+// the end); info.Size is the size of the whole object.
+func MinioDownloadObjectRange(
+	ctx context.Context,
+	objectName string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, *storage.ObjectInfo, error) {
+	if objectName == "" {
+		return nil, nil, fmt.Errorf("object name missing")
+	}
+	if storage.Default == nil {
+		return nil, nil, fmt.Errorf("storage not initialized")
+	}
+	object, info, err := storage.Default.GetObjectRange(ctx, config.AppConfig.BucketName, objectName, offset, length)
+	if err != nil {
+		return nil, nil, err
+	}
+	return object, &info, nil
+}
+
 // GetDownloadURL returns a presigned download URL for a MinIO object.
 func GetDownloadURL(
 	ctx context.Context,
@@ -188,8 +187,8 @@ func GetDownloadURL(
 		ctx = context.Background()
 	}
 	contentType := GetContentBook(fileName)
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	if obj, err := GetFileByObject(bucketName, objectName); err == nil {
+		contentType = ObjectContentType(obj, fileName)
 	}
 	safeName := utils.SanitizeHeaderFilename(fileName)
 	disposition := fmt.Sprintf("attachment; filename=\"%s\"", safeName)
@@ -221,7 +220,11 @@ func MinioDownloadFile(
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	obj, err := GetFileObjectByHash(hash)
+	userID, err := FindIdByUsername(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, err := GetFileObjectByHash(userID, hash)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -370,6 +373,9 @@ func DownloadByHTTP(ctx context.Context, rawURL string, fileName string, userId
 			return 0, fmt.Errorf("content too large")
 		}
 	}
+	if err := CheckQuota(userId, resp.ContentLength); err != nil {
+		return 0, err
+	}
 	userName, err := FindUserNameById(userId)
 	if err != nil {
 		return 0, err
@@ -393,27 +399,41 @@ func DownloadByHTTP(ctx context.Context, rawURL string, fileName string, userId
 }
 
 // UploadFromURL downloads a remote file into MinIO and creates user/file-object records.
+// 重名按 policy 处理 fail / skip 在下载前判断
 func UploadFromURL(
 	ctx context.Context,
 	userID uint64,
 	rawURL string,
 	fileName string,
 	parentID *uint64,
-) (*model.UserFile, error) {
+	policy ConflictPolicy,
+) (*model.UserFile, *dto.EntryResult, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	if err := ValidateDownloadSourceURL(rawURL); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if policy == ConflictFail || policy == ConflictSkip {
+		existing, err := peekUploadConflict(userID, cacheParentID(parentID), fileName, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		if existing != nil && policy == ConflictFail {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNameConflict, existing.Name)
+		}
+		if existing != nil {
+			return existing, &dto.EntryResult{FileID: existing.ID, Name: existing.Name, Action: ActionSkipped}, nil
+		}
 	}
 	fileHash := utils.GetToken()
 	size, err := DownloadByHTTP(ctx, rawURL, fileHash, userID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	userName, err := FindUserNameById(userID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	objectName := BuildObjectName(userName, fileHash)
 	removeObject := func() {
@@ -423,16 +443,17 @@ func UploadFromURL(
 	}
 
 	fileObj := &model.FileObject{
-		UserID:     userID,
-		Hash:       fileHash,
-		BucketName: config.AppConfig.BucketName,
-		ObjectName: objectName,
-		Size:       size,
-		RefCount:   1,
+		UserID:      userID,
+		Hash:        fileHash,
+		BucketName:  config.AppConfig.BucketName,
+		ObjectName:  objectName,
+		Size:        size,
+		ContentType: DetectObjectContentType(ctx, config.AppConfig.BucketName, objectName, fileName),
+		RefCount:    1,
 	}
 	if err := CreateFilesObject(fileObj); err != nil {
 		removeObject()
-		return nil, err
+		return nil, nil, err
 	}
 
 	userFile := &model.UserFile{
@@ -443,10 +464,13 @@ func UploadFromURL(
 		ObjectID: &fileObj.ID,
 		Size:     size,
 	}
-	if err := CreateUserFileEntry(userFile); err != nil {
+	result, err := CreateUserFileEntryWithPolicy(userFile, policy)
+	if err != nil {
 		removeObject()
 		_ = repo.Db.Delete(&model.FileObject{}, fileObj.ID).Error
-		return nil, err
+		if !errors.Is(err, ErrEntrySkipped) {
+			return nil, nil, err
+		}
 	}
-	return userFile, nil
+	return userFile, result, nil
 }
@@ -29,12 +29,13 @@ func GetPreviewURL(ctx context.Context, userID, fileID uint64, expiry time.Durat
 	if storage.Default == nil {
 		return "", errors.New("storage not initialized")
 	}
-	contentType := GetContentBook(file.Name)
-	if contentType == "" {
-		contentType = "application/octet-stream"
-	}
 	safeName := utils.SanitizeHeaderFilename(file.Name)
+	contentType, inline := InlineContentType(ObjectContentType(&obj, file.Name))
 	disposition := fmt.Sprintf("inline; filename=\"%s\"", safeName) // inline 浏览器直接预览
+	if !inline {                                                    // HTML、SVG 等可执行脚本的类型不内联渲染 防止 XSS
+		contentType = ObjectContentType(&obj, file.Name)
+		disposition = fmt.Sprintf("attachment; filename=\"%s\"", safeName)
+	}
 	url, err := storage.Default.PresignedGetObjectWithResponse(
 		ctx,
 		obj.BucketName,
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// QuotaExceededError is returned when an upload would exceed the user's storage quota.
+type QuotaExceededError struct {
+	UserID    uint64
+	Requested int64
+	Used      uint64
+	Total     uint64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("storage quota exceeded: need %d bytes, used %d of %d", e.Requested, e.Used, e.Total)
+}
+
+// TooLarge reports whether the request can never fit, even with an empty drive.
+func (e *QuotaExceededError) TooLarge() bool {
+	return e.Requested > 0 && uint64(e.Requested) > e.Total
+}
+
+// IsQuotaExceeded reports whether err carries a QuotaExceededError.
+func IsQuotaExceeded(err error) bool {
+	var quotaErr *QuotaExceededError
+	return errors.As(err, &quotaErr)
+}
+
+// newQuotaError builds a QuotaExceededError from the current user row.
+func newQuotaError(db *gorm.DB, userID uint64, size int64) error {
+	var user model.User
+	if err := db.Select("id", "total_space", "use_space").Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	return &QuotaExceededError{
+		UserID:    userID,
+		Requested: size,
+		Used:      user.UseSpace,
+		Total:     user.TotalSpace,
+	}
+}
+
+// CheckQuota verifies that size bytes still fit into the user's quota without charging them.
+// total_space = 0 means unlimited.
+func CheckQuota(userID uint64, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	var user model.User
+	if err := repo.Db.Select("id", "total_space", "use_space").Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	if user.TotalSpace == 0 || user.UseSpace+uint64(size) <= user.TotalSpace {
+		return nil
+	}
+	return &QuotaExceededError{
+		UserID:    userID,
+		Requested: size,
+		Used:      user.UseSpace,
+		Total:     user.TotalSpace,
+	}
+}
+
+// reserveSpace charges size bytes to the user inside tx, failing if the quota would be exceeded.
+// 条件更新保证并发上传时不会超额
+func reserveSpace(tx *gorm.DB, userID uint64, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	res := tx.Model(&model.User{}).
+		Where("id = ? AND (total_space = 0 OR use_space + ? <= total_space)", userID, size).
+		UpdateColumn("use_space", gorm.Expr("use_space + ?", size))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return newQuotaError(tx, userID, size)
+	}
+	return nil
+}
+
+// ReleaseSpace returns size bytes to the user's quota.
+func ReleaseSpace(userID uint64, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	if err := releaseSpace(repo.Db, userID, size); err != nil {
+		return err
+	}
+	_ = utils.InvalidateUserInfoCache(context.Background(), userID)
+	return nil
+}
+
+// releaseSpace returns size bytes to the user's quota inside tx.
+func releaseSpace(tx *gorm.DB, userID uint64, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	return tx.Model(&model.User{}).
+		Where("id = ?", userID).
+		UpdateColumn("use_space", gorm.Expr("CASE WHEN use_space > ? THEN use_space - ? ELSE 0 END", size, size)).Error
+}
+
+// ReconcileUserSpace recomputes use_space from the user's file rows, recycled files and
+// earlier file versions included.
+func ReconcileUserSpace(userID uint64) (uint64, error) {
+	var used, versions int64
+	if err := repo.Db.Unscoped().Model(&model.UserFile{}).
+		Where("user_id = ? AND is_dir = ?", userID, false).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&used).Error; err != nil {
+		return 0, err
+	}
+	if err := repo.Db.Model(&model.FileVersion{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&versions).Error; err != nil {
+		return 0, err
+	}
+	used += versions
+	if used < 0 {
+		used = 0
+	}
+	if err := repo.Db.Model(&model.User{}).
+		Where("id = ?", userID).
+		UpdateColumn("use_space", uint64(used)).Error; err != nil {
+		return 0, err
+	}
+	_ = utils.InvalidateUserInfoCache(context.Background(), userID)
+	return uint64(used), nil
+}
+
+// ReconcileAllUserSpace recomputes use_space for every user in batches.
+func ReconcileAllUserSpace(ctx context.Context) (int, error) {
+	const batchSize = 200
+	var (
+		lastID uint64
+		count  int
+	)
+	for {
+		if ctx != nil {
+			if err := ctx.Err(); err != nil {
+				return count, err
+			}
+		}
+		var ids []uint64
+		if err := repo.Db.Model(&model.User{}).
+			Where("id > ?", lastID).
+			Order("id asc").
+			Limit(batchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return count, err
+		}
+		if len(ids) == 0 {
+			return count, nil
+		}
+		for _, id := range ids {
+			if _, err := ReconcileUserSpace(id); err != nil {
+				return count, err
+			}
+			count++
+		}
+		lastID = ids[len(ids)-1]
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// ScrubSummary counts the outcome of one scrub pass.
+type ScrubSummary struct {
+	Checked       int `json:"checked"`
+	Healthy       int `json:"healthy"`
+	Repaired      int `json:"repaired"`
+	Unrecoverable int `json:"unrecoverable"`
+	Skipped       int `json:"skipped"` // 副本所在节点不可用 本轮无法校验
+}
+
+// ScrubFileObject verifies the stored copies of obj by existence, size and SHA-256.
+// 集群模式下会从健康副本修复 单存储只能校验
+func ScrubFileObject(ctx context.Context, obj *model.FileObject) (*storage.ScrubResult, error) {
+	if storage.Default == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	if cluster, ok := storage.Default.(*storage.ClusterStore); ok {
+		return cluster.Cluster().ScrubObject(ctx, obj.BucketName, obj.ObjectName, obj.Size, obj.Hash)
+	}
+	result := &storage.ScrubResult{Broken: make(map[string]string)}
+	if err := storage.VerifyObject(ctx, storage.Default, obj.BucketName, obj.ObjectName, obj.Size, obj.Hash); err != nil {
+		result.Broken["default"] = err.Error()
+	} else {
+		result.Healthy = []string{"default"}
+	}
+	return result, nil
+}
+
+// PurgeReplicaTombstones deletes replicas of removed objects left on nodes that were down at the time.
+func PurgeReplicaTombstones(ctx context.Context) (int, error) {
+	cluster, ok := storage.Default.(*storage.ClusterStore)
+	if !ok {
+		return 0, nil
+	}
+	return cluster.Cluster().PurgeTombstones(ctx)
+}
+
+// ScrubFileObjects walks every file_object row in id order and scrubs it.
+func ScrubFileObjects(ctx context.Context) (ScrubSummary, error) {
+	const batchSize = 100
+	var (
+		summary ScrubSummary
+		lastID  uint64
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		var objects []model.FileObject
+		if err := repo.Db.Where("id > ?", lastID).
+			Order("id asc").
+			Limit(batchSize).
+			Find(&objects).Error; err != nil {
+			return summary, err
+		}
+		if len(objects) == 0 {
+			return summary, nil
+		}
+		for i := range objects {
+			obj := &objects[i]
+			lastID = obj.ID
+			result, err := ScrubFileObject(ctx, obj)
+			if err != nil {
+				if ctx.Err() != nil {
+					return summary, ctx.Err()
+				}
+				log.Printf("scrub: object %d failed: %v", obj.ID, err)
+				continue
+			}
+			summary.Checked++
+			switch {
+			case result.Unrecoverable():
+				summary.Unrecoverable++
+				log.Printf("scrub: object %d (%s) unrecoverable: %s", obj.ID, obj.ObjectName, result.Problem())
+				if err := reportScrubIssue(obj, result.Problem()); err != nil {
+					return summary, err
+				}
+				continue
+			case len(result.Healthy) == 0 && len(result.Repaired) == 0:
+				summary.Skipped++
+				continue
+			case len(result.Repaired) > 0:
+				summary.Repaired++
+				log.Printf("scrub: object %d (%s) repaired on %v", obj.ID, obj.ObjectName, result.Repaired)
+			default:
+				summary.Healthy++
+			}
+			if err := repo.Db.Where("file_object_id = ?", obj.ID).Delete(&model.ObjectScrubIssue{}).Error; err != nil {
+				return summary, err
+			}
+		}
+	}
+}
+
+func reportScrubIssue(obj *model.FileObject, detail string) error {
+	now := time.Now()
+	issue := model.ObjectScrubIssue{
+		FileObjectID: obj.ID,
+		BucketName:   obj.BucketName,
+		ObjectName:   obj.ObjectName,
+		Detail:       detail,
+		FirstSeenAt:  now,
+		LastSeenAt:   now,
+	}
+	return repo.Db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_object_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"detail", "last_seen_at"}),
+	}).Create(&issue).Error
+}
+
+// ListScrubIssues returns the objects the scrubber found unrecoverable, newest first.
+func ListScrubIssues(limit int) ([]model.ObjectScrubIssue, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var issues []model.ObjectScrubIssue
+	err := repo.Db.Order("last_seen_at desc").Limit(limit).Find(&issues).Error
+	return issues, err
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"gorm.io/gorm"
+)
+
+// ErrFileTooLarge is returned when a single-request upload exceeds SIMPLE_UPLOAD_MAX_SIZE.
+var ErrFileTooLarge = errors.New("file too large for a single-request upload")
+
+// hashingReader hashes and counts the bytes the store reads.
+type hashingReader struct {
+	r   io.Reader
+	sum hash.Hash
+	n   int64
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if n > 0 {
+		_, _ = h.sum.Write(p[:n])
+		h.n += int64(n)
+	}
+	return n, err
+}
+
+// SimpleUpload stores a small file sent in one request. The content is streamed to storage under
+// a fresh object name while its SHA-256 is computed; when an object with the same hash already
+// exists the new copy is dropped and the existing one is referenced instead.
+func SimpleUpload(
+	ctx context.Context,
+	userID uint64,
+	req dto.SimpleUploadRequest,
+	reader io.Reader,
+	size int64,
+) (*dto.SimpleUploadResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if max := config.AppConfig.SimpleUploadMaxSize; max > 0 && size > max {
+		return nil, fmt.Errorf("%w: limit %d bytes", ErrFileTooLarge, max)
+	}
+	policy, err := ParseConflictPolicy(req.ConflictPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if req.RelativePath != "" {
+		if _, err := splitRelativePath(req.RelativePath); err != nil {
+			return nil, err
+		}
+	} else if req.FileName == "" {
+		return nil, fmt.Errorf("%w: file name required", ErrInvalidPath)
+	}
+	if err := CheckQuota(userID, size); err != nil {
+		return nil, err
+	}
+	// fail / skip 在写入存储之前判断
+	if policy == ConflictFail || policy == ConflictSkip {
+		existing, err := peekUploadConflict(userID, req.ParentID, req.FileName, req.RelativePath)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && policy == ConflictFail {
+			return nil, fmt.Errorf("%w: %s", ErrNameConflict, existing.Name)
+		}
+		if existing != nil {
+			return &dto.SimpleUploadResponse{FileId: existing.ID, FileName: existing.Name, Action: ActionSkipped}, nil
+		}
+	}
+	if storage.Default == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	userName, err := FindUserNameById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, name, err := uploadTarget(userID, req.ParentID, req.FileName, req.RelativePath)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReaderSize(reader, sniffLen)
+	head, _ := buffered.Peek(sniffLen)
+	contentType := SniffContentType(head, name)
+
+	bucket := config.AppConfig.BucketName
+	objectName := BuildObjectName(userName, utils.GetToken()) // hash 在写完后才知道
+	hashed := &hashingReader{r: buffered, sum: sha256.New()}
+	if err := storage.Default.PutObject(ctx, bucket, objectName, hashed, size, storage.PutOptions{
+		ContentType: contentType,
+	}); err != nil {
+		return nil, err
+	}
+	removeUploaded := func() {
+		_ = storage.Default.RemoveObject(ctx, bucket, objectName)
+	}
+	if hashed.n != size {
+		removeUploaded()
+		return nil, fmt.Errorf("%w: got %d of %d bytes", ErrContentHashMismatch, hashed.n, size)
+	}
+	digest := hex.EncodeToString(hashed.sum.Sum(nil))
+
+	objectID, deduped, createdNew, err := storeUploadedObject(ctx, userID, digest, bucket, objectName, contentType, size)
+	if err != nil {
+		removeUploaded()
+		return nil, err
+	}
+	if deduped {
+		removeUploaded()
+	}
+
+	result, err := CreateUserFileEntryWithPolicy(&model.UserFile{
+		UserID:   userID,
+		ParentID: parent,
+		Name:     name,
+		ObjectID: &objectID,
+		Size:     size,
+	}, policy)
+	if err != nil { // 回滚
+		if createdNew {
+			removeUploaded()
+			_ = repo.Db.Delete(&model.FileObject{}, objectID).Error
+		} else {
+			_, _ = DecreaseRefCount(objectID)
+		}
+		if !errors.Is(err, ErrEntrySkipped) {
+			return nil, err
+		}
+	}
+	return &dto.SimpleUploadResponse{
+		FileId:   result.FileID,
+		FileName: result.Name,
+		Action:   result.Action,
+		Hash:     digest,
+		Size:     size,
+		Deduped:  deduped,
+	}, nil
+}
+
+// storeUploadedObject records an uploaded object, or references the existing object with the same
+// hash (deduped). An existing record whose content is missing is pointed at the new object.
+func storeUploadedObject(
+	ctx context.Context,
+	userID uint64,
+	digest, bucket, objectName, contentType string,
+	size int64,
+) (objectID uint64, deduped, createdNew bool, err error) {
+	existing, err := GetFileObjectByHash(userID, digest)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, false, err
+	}
+	if err == nil {
+		available, checkErr := isFileObjectAvailable(ctx, existing)
+		if checkErr != nil {
+			return 0, false, false, checkErr
+		}
+		if !available { // hash 存在但对象丢失 改为指向本次上传的对象
+			if err := repo.Db.Model(&model.FileObject{}).
+				Where("id = ?", existing.ID).
+				Updates(map[string]interface{}{
+					"bucket_name":  bucket,
+					"object_name":  objectName,
+					"size":         size,
+					"content_type": contentType,
+				}).Error; err != nil {
+				return 0, false, false, err
+			}
+			_ = utils.InvalidateFileObjectPathCache(ctx, existing.BucketName, existing.ObjectName)
+			_ = utils.InvalidateFileObjectCache(ctx, existing.ID)
+		}
+		if err := IncreaseRefCount(existing.ID); err != nil {
+			return 0, false, false, err
+		}
+		return existing.ID, available, false, nil
+	}
+
+	obj := &model.FileObject{
+		UserID:      userID,
+		BucketName:  bucket,
+		Hash:        digest,
+		ObjectName:  objectName,
+		Size:        size,
+		ContentType: contentType,
+		RefCount:    1,
+	}
+	if err := CreateFilesObject(obj); err != nil {
+		// 并发上传同一内容时唯一索引冲突 改为引用对方的对象
+		if other, findErr := GetFileObjectByHash(userID, digest); findErr == nil {
+			if err := IncreaseRefCount(other.ID); err != nil {
+				return 0, false, false, err
+			}
+			return other.ID, true, false, nil
+		}
+		return 0, false, false, err
+	}
+	return obj.ID, false, true, nil
+}
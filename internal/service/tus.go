@@ -0,0 +1,287 @@
+package service
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const tusMaxMetadata = 1024
+
+var (
+	// ErrTusOffsetMismatch is returned when a PATCH does not start at the current offset.
+	ErrTusOffsetMismatch = errors.New("upload offset mismatch")
+	// ErrTusTooLarge is returned when a PATCH would exceed the declared upload length.
+	ErrTusTooLarge = errors.New("upload exceeds declared length")
+	// ErrTusBusy is returned while another request is writing the same upload.
+	ErrTusBusy = errors.New("upload is locked by another request")
+	// ErrParentNotFound is returned when the target folder does not belong to the user.
+	ErrParentNotFound = errors.New("parent folder not found")
+)
+
+// TusChecksumAlgorithms lists the algorithms accepted in Upload-Checksum.
+var TusChecksumAlgorithms = []string{"md5", "sha1", "sha256"}
+
+// parseTusChecksum parses "Upload-Checksum: <algo> <base64>"; empty header returns a nil hasher.
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil, nil, nil
+	}
+	algo, encoded, ok := strings.Cut(header, " ")
+	if !ok {
+		return nil, nil, ErrInvalidChecksum
+	}
+	var hasher hash.Hash
+	switch strings.ToLower(algo) {
+	case "md5":
+		hasher = md5.New()
+	case "sha1":
+		hasher = sha1.New()
+	case "sha256":
+		hasher = sha256.New()
+	default:
+		return nil, nil, ErrInvalidChecksum
+	}
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(sum) != hasher.Size() {
+		return nil, nil, ErrInvalidChecksum
+	}
+	return hasher, sum, nil
+}
+
+// CreateTusUpload starts a tus upload of length bytes into parentID.
+// fileName 可以是 "photos/2024/a.jpg" 这样的相对路径
+// 长度为 0 的上传在创建时即完成
+func CreateTusUpload(
+	ctx context.Context,
+	userID uint64,
+	userName string,
+	fileName string,
+	parentID uint64,
+	length int64,
+	metadata string,
+	conflictPolicy string,
+) (*model.UploadSession, error) {
+	if len(metadata) > tusMaxMetadata {
+		return nil, fmt.Errorf("upload metadata longer than %d bytes", tusMaxMetadata)
+	}
+	if strings.Contains(fileName, "/") { // 相对路径 完成时创建中间文件夹
+		if _, err := splitRelativePath(fileName); err != nil || len(fileName) > 255 {
+			return nil, ErrInvalidPath
+		}
+	}
+	if parentID != 0 {
+		parent, err := GetUserFileById(parentID)
+		if err != nil || parent.UserID != userID || !parent.IsDir {
+			return nil, ErrParentNotFound
+		}
+	}
+	policy, err := ParseConflictPolicy(conflictPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckQuota(userID, length); err != nil {
+		return nil, err
+	}
+	session := &model.UploadSession{
+		UploadID:       utils.GetToken(),
+		UserID:         userID,
+		FileName:       fileName,
+		FileSize:       length,
+		ParentID:       parentID,
+		Metadata:       metadata,
+		ConflictPolicy: string(policy),
+	}
+	if err := repo.Db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		if err := finishTusUpload(ctx, userID, userName, session); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// GetTusUpload loads a user's upload and the number of bytes received so far.
+func GetTusUpload(userID uint64, uploadID string) (*model.UploadSession, int64, error) {
+	session, err := GetUploadSessionByUploadID(uploadID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if session.UserID != userID {
+		return nil, 0, gorm.ErrRecordNotFound
+	}
+	var offset int64
+	if err := repo.Db.Model(&model.FileChunk{}).
+		Where("upload_id = ? AND status = 1", uploadID).
+		Select("COALESCE(SUM(chunk_size), 0)").
+		Scan(&offset).Error; err != nil {
+		return nil, 0, err
+	}
+	return session, offset, nil
+}
+
+// WriteTusChunk appends body at offset as the next chunk and completes the upload
+// once the declared length is reached. It returns the new offset.
+// 每次 PATCH 存为一个分片对象 连接中断时已收到的字节也会保存 客户端可从新的 offset 续传
+func WriteTusChunk(
+	ctx context.Context,
+	userID uint64,
+	userName string,
+	uploadID string,
+	offset int64,
+	body io.Reader,
+	checksum string,
+) (int64, error) {
+	lock := repo.NewRedisLock(repo.Redis, "lock:tus:"+uploadID, 10*time.Minute)
+	if err := lock.Lock(ctx); err != nil {
+		return 0, ErrTusBusy
+	}
+	defer lock.Unlock(ctx)
+
+	session, current, err := GetTusUpload(userID, uploadID)
+	if err != nil {
+		return 0, err
+	}
+	if session.Status == uploadSessionRemoving {
+		return current, ErrUploadRemoved
+	}
+	if offset != current {
+		return current, ErrTusOffsetMismatch
+	}
+	verifier, want, err := parseTusChecksum(checksum)
+	if err != nil {
+		return current, err
+	}
+
+	tmp, err := os.CreateTemp("", "tus-chunk-*")
+	if err != nil {
+		return current, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	checksummer := md5.New()
+	writers := []io.Writer{tmp, checksummer}
+	if verifier != nil {
+		writers = append(writers, verifier)
+	}
+	remaining := session.FileSize - current
+	n, copyErr := io.Copy(io.MultiWriter(writers...), io.LimitReader(body, remaining+1))
+	if n > remaining {
+		return current, ErrTusTooLarge
+	}
+	if copyErr != nil && (verifier != nil || n == 0) { // 带校验和的请求不完整时无法校验 整体丢弃
+		return current, copyErr
+	}
+	if verifier != nil && !bytes.Equal(verifier.Sum(nil), want) {
+		return current, ErrChunkChecksumMismatch
+	}
+
+	if n > 0 {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return current, err
+		}
+		index := session.TotalChunks
+		objectPath := chunkObjectPath(session.UploadID, index)
+		if storage.Default == nil {
+			return current, fmt.Errorf("storage not initialized")
+		}
+		if err := storage.Default.PutObject(ctx, config.AppConfig.BucketName, objectPath, tmp, n, storage.PutOptions{}); err != nil {
+			return current, err
+		}
+		chunk := model.FileChunk{
+			UploadID:   session.UploadID,
+			ChunkIndex: index,
+			ChunkSize:  n,
+			ChunkPath:  objectPath,
+			Checksum:   "md5:" + hex.EncodeToString(checksummer.Sum(nil)),
+			Status:     1,
+		}
+		if err := repo.Db.Create(&chunk).Error; err != nil {
+			_ = storage.Default.RemoveObject(ctx, config.AppConfig.BucketName, objectPath)
+			return current, err
+		}
+		if err := keepChunk(ctx, &chunk); err != nil {
+			return current, err
+		}
+		if err := repo.Db.Model(&model.UploadSession{}).
+			Where("id = ?", session.ID).
+			Updates(map[string]interface{}{
+				"total_chunks": index + 1,
+				"updated_at":   time.Now(),
+			}).Error; err != nil {
+			return current, err
+		}
+		session.TotalChunks = index + 1
+		current += n
+	}
+	if copyErr != nil {
+		return current, copyErr
+	}
+	if current == session.FileSize {
+		return current, finishTusUpload(ctx, userID, userName, session)
+	}
+	return current, nil
+}
+
+// finishTusUpload merges and hashes the received content and hands the session to the regular
+// completion path, which applies hash dedup and creates the FileObject / UserFile records.
+func finishTusUpload(ctx context.Context, userID uint64, userName string, session *model.UploadSession) error {
+	chunks := make([]model.FileChunk, 0, session.TotalChunks)
+	if err := repo.Db.
+		Where("upload_id = ? AND status = 1", session.UploadID).
+		Order("chunk_index asc").
+		Find(&chunks).Error; err != nil {
+		return err
+	}
+	sum, err := stageUpload(ctx, session, chunks)
+	if err != nil {
+		return err
+	}
+	if err := repo.Db.Model(&model.UploadSession{}).
+		Where("id = ?", session.ID).
+		Update("file_hash", sum).Error; err != nil {
+		return err
+	}
+	session.FileHash = sum
+
+	lock := repo.NewRedisLock(repo.Redis, UploadMergeLockKey(userID, sum), uploadLockTTL)
+	if err := lock.Lock(ctx); err != nil {
+		return ErrUploadInProgress
+	}
+	defer lock.Unlock(ctx)
+	req := dto.MultipartCompleteRequest{
+		FileHash:    sum,
+		FileName:    session.FileName,
+		FileSize:    session.FileSize,
+		TotalChunks: len(chunks),
+		ParentId:    session.ParentID,
+	}
+	if strings.Contains(session.FileName, "/") {
+		req.RelativePath = session.FileName
+	}
+	_, err = completeUpload(ctx, userID, userName, session, req, sum)
+	return err
+}
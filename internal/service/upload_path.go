@@ -0,0 +1,283 @@
+package service
+
+import (
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/model"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxPathDepth       = 64
+	maxManifestEntries = 1000
+)
+
+var (
+	// ErrInvalidPath is returned for an empty, absolute or escaping relative path.
+	ErrInvalidPath = errors.New("invalid relative path")
+	// ErrPathConflict is returned when a file occupies a folder name on the path.
+	ErrPathConflict = errors.New("path conflicts with an existing file")
+)
+
+// splitRelativePath splits "photos/2024/a.jpg" into its segments.
+// 与 sanitizeArchiveName 相反 这里不做修正 不合法的路径直接拒绝
+func splitRelativePath(p string) ([]string, error) {
+	if p == "" || strings.HasPrefix(p, "/") || strings.ContainsAny(p, "\\\x00") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPath, p)
+	}
+	parts := strings.Split(strings.TrimSuffix(p, "/"), "/")
+	if len(parts) > maxPathDepth {
+		return nil, fmt.Errorf("%w: deeper than %d levels", ErrInvalidPath, maxPathDepth)
+	}
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" || part == "." || part == ".." || len(part) > 255 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPath, p)
+		}
+	}
+	return parts, nil
+}
+
+func parentIDPtr(parentID uint64) *uint64 {
+	if parentID == 0 {
+		return nil
+	}
+	return &parentID
+}
+
+// uploadTarget returns the folder and name an uploaded file is stored under.
+// relativePath 非空时在 parentID 下逐级创建缺失的文件夹 文件名取最后一段
+func uploadTarget(userID, parentID uint64, fileName, relativePath string) (*uint64, string, error) {
+	if relativePath == "" {
+		return parentIDPtr(parentID), fileName, nil
+	}
+	parts, err := splitRelativePath(relativePath)
+	if err != nil {
+		return nil, "", err
+	}
+	folder, err := MkdirAll(userID, parentID, parts[:len(parts)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	return parentIDPtr(folder), parts[len(parts)-1], nil
+}
+
+// MkdirAll creates the missing folders of dirs under parentID in one transaction and
+// returns the ID of the last one (parentID when dirs is empty).
+func MkdirAll(userID, parentID uint64, dirs []string) (uint64, error) {
+	var created []*uint64
+	current := parentID
+	err := repo.Db.Transaction(func(tx *gorm.DB) error {
+		if err := checkParentFolder(tx, userID, parentID); err != nil {
+			return err
+		}
+		for _, name := range dirs {
+			id, isNew, err := ensureFolder(tx, userID, current, name)
+			if err != nil {
+				return err
+			}
+			if isNew {
+				created = append(created, parentIDPtr(current))
+			}
+			current = id
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, parent := range created {
+		invalidateFileListCache(userID, parent)
+	}
+	return current, nil
+}
+
+func checkParentFolder(tx *gorm.DB, userID, parentID uint64) error {
+	if parentID == 0 {
+		return nil
+	}
+	var parent model.UserFile
+	if err := tx.Where("id = ? AND user_id = ? AND is_dir = 1 AND is_deleted = 0", parentID, userID).First(&parent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrParentNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// ensureFolder returns the folder name under parentID, creating it when missing.
+func ensureFolder(tx *gorm.DB, userID, parentID uint64, name string) (uint64, bool, error) {
+	find := func() (*model.UserFile, error) {
+		var existing model.UserFile
+		query := tx.Where("user_id = ? AND name = ? AND is_deleted = 0", userID, name)
+		if parentID == 0 {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", parentID)
+		}
+		if err := query.First(&existing).Error; err != nil {
+			return nil, err
+		}
+		if !existing.IsDir {
+			return nil, fmt.Errorf("%w: %s", ErrPathConflict, name)
+		}
+		return &existing, nil
+	}
+	existing, err := find()
+	if err == nil {
+		return existing.ID, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, err
+	}
+	dir := &model.UserFile{
+		UserID:   userID,
+		ParentID: parentIDPtr(parentID),
+		Name:     name,
+		IsDir:    true,
+	}
+	if err := tx.Create(dir).Error; err != nil {
+		// 并发创建同名文件夹时唯一索引冲突 取对方建好的
+		if existing, findErr := find(); findErr == nil {
+			return existing.ID, false, nil
+		}
+		return 0, false, err
+	}
+	return dir.ID, true, nil
+}
+
+// ApplyUploadManifest declares a whole tree before uploading it: every folder is created in one
+// transaction, files with a hash are instant-uploaded when possible, and the rest are returned
+// with the folder and name to upload them to.
+func ApplyUploadManifest(ctx context.Context, userID uint64, req dto.UploadManifestRequest) (*dto.UploadManifestResponse, error) {
+	if len(req.Entries) > maxManifestEntries {
+		return nil, fmt.Errorf("%w: more than %d entries", ErrInvalidPath, maxManifestEntries)
+	}
+	policy, err := ParseConflictPolicy(req.ConflictPolicy)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([][]string, len(req.Entries))
+	seen := make(map[string]bool, len(req.Entries))
+	var total int64
+	for i, entry := range req.Entries {
+		parts, err := splitRelativePath(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.Join(parts, "/")
+		if seen[key] {
+			return nil, fmt.Errorf("%w: duplicate entry %q", ErrInvalidPath, entry.Path)
+		}
+		seen[key] = true
+		paths[i] = parts
+		if !entry.IsDir {
+			total += entry.Size
+		}
+	}
+	if err := CheckQuota(userID, total); err != nil { // 整棵树放不下时一个文件夹也不建
+		return nil, err
+	}
+
+	// 所有文件夹在同一事务中创建 任一失败全部回滚
+	folders := map[string]uint64{"": req.ParentId}
+	var order []string
+	var touched []*uint64
+	err = repo.Db.Transaction(func(tx *gorm.DB) error {
+		if err := checkParentFolder(tx, userID, req.ParentId); err != nil {
+			return err
+		}
+		for i, entry := range req.Entries {
+			dirs := paths[i]
+			if !entry.IsDir {
+				dirs = dirs[:len(dirs)-1]
+			}
+			for depth := range dirs {
+				key := strings.Join(dirs[:depth+1], "/")
+				if _, ok := folders[key]; ok {
+					continue
+				}
+				parent := folders[strings.Join(dirs[:depth], "/")]
+				id, isNew, err := ensureFolder(tx, userID, parent, dirs[depth])
+				if err != nil {
+					return err
+				}
+				if isNew {
+					touched = append(touched, parentIDPtr(parent))
+				}
+				folders[key] = id
+				order = append(order, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, parent := range touched {
+		invalidateFileListCache(userID, parent)
+	}
+
+	resp := &dto.UploadManifestResponse{
+		Folders: make([]dto.ManifestFolder, 0, len(order)),
+		Files:   make([]dto.ManifestFile, 0, len(req.Entries)),
+	}
+	for _, key := range order {
+		resp.Folders = append(resp.Folders, dto.ManifestFolder{Path: key, ID: folders[key]})
+	}
+	for i, entry := range req.Entries {
+		if entry.IsDir {
+			continue
+		}
+		parts := paths[i]
+		file := dto.ManifestFile{
+			Path:     entry.Path,
+			ParentId: folders[strings.Join(parts[:len(parts)-1], "/")],
+			FileName: parts[len(parts)-1],
+		}
+		if entry.Hash == "" {
+			file.NeedUpload = true
+			if policy == ConflictFail || policy == ConflictSkip { // 与分片 init 一样 先按名字判断是否需要上传
+				existing, err := findSibling(repo.Db, userID, parentIDPtr(file.ParentId), file.FileName, 0)
+				switch {
+				case err != nil:
+					file.Error = err.Error()
+				case existing != nil && policy == ConflictFail:
+					file.NeedUpload = false
+					file.Error = fmt.Errorf("%w: %s", ErrNameConflict, existing.Name).Error()
+				case existing != nil:
+					file.NeedUpload = false
+					file.FileId = existing.ID
+					file.Action = ActionSkipped
+				}
+			}
+			resp.Files = append(resp.Files, file)
+			continue
+		}
+		fast, err := FastUpload(ctx, &dto.UploadFileByHashRequest{
+			UserId:         userID,
+			FileName:       file.FileName,
+			Size:           entry.Size,
+			Hash:           entry.Hash,
+			ParentId:       file.ParentId,
+			Proof:          entry.Proof,
+			ConflictPolicy: string(policy),
+		})
+		if err != nil { // 单个文件失败不影响其余条目 客户端可按普通上传重试
+			file.NeedUpload = true
+			file.Error = err.Error()
+		} else {
+			file.FastUploadResponse = *fast
+			if fast.FileName != "" {
+				file.FileName = fast.FileName
+			}
+		}
+		resp.Files = append(resp.Files, file)
+	}
+	return resp, nil
+}
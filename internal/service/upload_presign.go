@@ -0,0 +1,231 @@
+package service
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxPresignedChunks = 10000
+	// 预签名地址在确认后仍可写入 有效期只够客户端传完一个分片 续传时 init 会重新签发
+	defaultPresignExpiry = 5 * time.Minute
+	maxPresignExpiry     = time.Hour
+)
+
+var (
+	// ErrChunkLayout is returned when chunk_size and total_chunks cannot describe the file size.
+	ErrChunkLayout = errors.New("chunk_size and total_chunks do not match file size")
+	// ErrChunkIndex is returned for a chunk index outside the session.
+	ErrChunkIndex = errors.New("chunk index out of range")
+	// ErrChunkNotUploaded is returned when a confirmed chunk is not in storage.
+	ErrChunkNotUploaded = errors.New("chunk not uploaded")
+)
+
+func chunkObjectPath(uploadID string, index int) string {
+	return fmt.Sprintf("chunks/%s/%d", uploadID, index)
+}
+
+// expectedChunkSize returns the size of chunk index: ChunkSize for all but the last chunk.
+func expectedChunkSize(session *model.UploadSession, index int) int64 {
+	if index == session.TotalChunks-1 {
+		return session.FileSize - session.ChunkSize*int64(session.TotalChunks-1)
+	}
+	return session.ChunkSize
+}
+
+// checkChunkLayout validates that the session's chunk geometry covers FileSize exactly.
+func checkChunkLayout(session *model.UploadSession) error {
+	if session.ChunkSize <= 0 || session.TotalChunks <= 0 || session.TotalChunks > maxPresignedChunks {
+		return ErrChunkLayout
+	}
+	if last := expectedChunkSize(session, session.TotalChunks-1); last <= 0 || last > session.ChunkSize {
+		return ErrChunkLayout
+	}
+	return nil
+}
+
+// markPresigned records that chunks of session may be written without going through the API,
+// so removing the session deletes every chunk object up to TotalChunks.
+func markPresigned(session *model.UploadSession) error {
+	if session.Presigned {
+		return nil
+	}
+	if err := repo.Db.Model(&model.UploadSession{}).
+		Where("upload_id = ?", session.UploadID).
+		Update("presigned", true).Error; err != nil {
+		return err
+	}
+	session.Presigned = true
+	return nil
+}
+
+// presignChunks returns presigned PUT URLs for the chunks of session not uploaded yet.
+func presignChunks(ctx context.Context, session *model.UploadSession, uploaded []int) ([]dto.PresignedChunk, time.Time, error) {
+	if err := checkChunkLayout(session); err != nil {
+		return nil, time.Time{}, err
+	}
+	if storage.Default == nil {
+		return nil, time.Time{}, fmt.Errorf("storage not initialized")
+	}
+	if err := markPresigned(session); err != nil {
+		return nil, time.Time{}, err
+	}
+	expiry := config.AppConfig.UploadPresignExpiry
+	if expiry <= 0 {
+		expiry = defaultPresignExpiry
+	}
+	expiry = min(expiry, maxPresignExpiry)
+	done := make(map[int]bool, len(uploaded))
+	for _, index := range uploaded {
+		done[index] = true
+	}
+	expiresAt := time.Now().Add(expiry)
+	parts := make([]dto.PresignedChunk, 0, session.TotalChunks-len(uploaded))
+	for index := 0; index < session.TotalChunks; index++ {
+		if done[index] {
+			continue
+		}
+		url, err := storage.Default.PresignedPutObject(
+			ctx,
+			config.AppConfig.BucketName,
+			chunkObjectPath(session.UploadID, index),
+			expiry,
+			storage.PutOptions{Hash: session.FileHash},
+		)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		parts = append(parts, dto.PresignedChunk{
+			Index: index,
+			Size:  expectedChunkSize(session, index),
+			URL:   url,
+		})
+	}
+	return parts, expiresAt, nil
+}
+
+// ConfirmChunks records chunks the client PUT directly to storage.
+// A confirmed chunk can still be overwritten through its URL until it expires or the upload is
+// completed; CompleteFile hashes the merged result, so such a change is rejected there.
+// 逐个 stat 分片对象核对大小 有声明校验和时核对内容 通过后写入 FileChunk 供 CompleteFile 合并
+func ConfirmChunks(ctx context.Context, userID uint64, req dto.MultipartConfirmRequest) ([]dto.UploadedChunk, error) {
+	session, err := GetUploadSessionByUploadID(req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if session.Status == uploadSessionRemoving {
+		return nil, ErrUploadRemoved
+	}
+	if err := checkChunkLayout(session); err != nil {
+		return nil, err
+	}
+	if storage.Default == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	if err := markPresigned(session); err != nil {
+		return nil, err
+	}
+	bucket := config.AppConfig.BucketName
+	confirmed := make([]dto.UploadedChunk, 0, len(req.Chunks))
+	for _, item := range req.Chunks {
+		if item.Index < 0 || item.Index >= session.TotalChunks {
+			return confirmed, fmt.Errorf("%w: %d", ErrChunkIndex, item.Index)
+		}
+		algo, declared, checksummer, err := parseChunkChecksum(item.Checksum)
+		if err != nil {
+			return confirmed, err
+		}
+		objectPath := chunkObjectPath(session.UploadID, item.Index)
+		info, err := storage.Default.StatObject(ctx, bucket, objectPath)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return confirmed, fmt.Errorf("%w: %d", ErrChunkNotUploaded, item.Index)
+			}
+			return confirmed, err
+		}
+		if want := expectedChunkSize(session, item.Index); info.Size != want {
+			_ = storage.Default.RemoveObject(ctx, bucket, objectPath)
+			return confirmed, fmt.Errorf("%w: chunk %d has %d bytes, expected %d", ErrChunkSizeMismatch, item.Index, info.Size, want)
+		}
+		// 单次 PUT 的 ETag 通常就是 md5 与声明一致时免去读取 否则读出分片计算
+		actual := strings.ToLower(info.ETag)
+		if algo != "md5" || declared == "" || actual != declared {
+			if actual, err = readChunkChecksum(ctx, bucket, objectPath, checksummer); err != nil {
+				return confirmed, err
+			}
+		}
+		if declared != "" && declared != actual {
+			_ = storage.Default.RemoveObject(ctx, bucket, objectPath)
+			return confirmed, fmt.Errorf("%w: chunk %d expected %s:%s, got %s", ErrChunkChecksumMismatch, item.Index, algo, declared, actual)
+		}
+		chunk := model.FileChunk{
+			UploadID:   session.UploadID,
+			ChunkIndex: item.Index,
+			ChunkSize:  info.Size,
+			ChunkPath:  objectPath,
+			Checksum:   algo + ":" + actual,
+			Status:     1,
+		}
+		if err := saveChunkRecord(&chunk); err != nil {
+			return confirmed, err
+		}
+		if err := keepChunk(ctx, &chunk); err != nil {
+			return confirmed, err
+		}
+		confirmed = append(confirmed, dto.UploadedChunk{
+			Index:    chunk.ChunkIndex,
+			Size:     chunk.ChunkSize,
+			Checksum: chunk.Checksum,
+		})
+	}
+	return confirmed, touchUploadSession(session.UploadID)
+}
+
+func readChunkChecksum(ctx context.Context, bucket, objectPath string, checksummer hash.Hash) (string, error) {
+	reader, _, err := storage.Default.GetObject(ctx, bucket, objectPath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	if _, err := io.Copy(checksummer, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksummer.Sum(nil)), nil
+}
+
+// saveChunkRecord upserts a chunk row; the same chunk may be submitted more than once.
+func saveChunkRecord(chunk *model.FileChunk) error {
+	return repo.Db.
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{
+				{Name: "upload_id"},
+				{Name: "chunk_index"},
+			},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"chunk_size",
+				"chunk_path",
+				"checksum",
+				"status",
+				"updated_at",
+			}),
+		}).
+		Create(chunk).Error
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	uploadSweepBatch = 100
+	uploadLockTTL    = 30 * time.Second
+
+	// uploadSessionRemoving is the session status set before its chunks are deleted.
+	uploadSessionRemoving = -1
+)
+
+var (
+	// ErrUploadInProgress is returned when the session is being merged right now.
+	ErrUploadInProgress = errors.New("upload is being completed")
+	// ErrUploadRemoved is returned for chunk writes to a session that is gone or being removed.
+	ErrUploadRemoved = errors.New("upload session was removed")
+)
+
+// UploadMergeLockKey is the Redis lock held while a user's upload of hash is merged or removed.
+func UploadMergeLockKey(userID uint64, hash string) string {
+	return "lock:merge:" + strconv.FormatUint(userID, 10) + ":" + hash
+}
+
+// touchUploadSession marks a session as active so the sweeper keeps it.
+func touchUploadSession(uploadID string) error {
+	return repo.Db.Model(&model.UploadSession{}).
+		Where("upload_id = ?", uploadID).
+		Update("updated_at", time.Now()).Error
+}
+
+// checkUploadActive returns ErrUploadRemoved when the session is gone or being removed.
+func checkUploadActive(uploadID string) error {
+	session, err := GetUploadSessionByUploadID(uploadID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUploadRemoved
+	}
+	if err != nil {
+		return err
+	}
+	if session.Status == uploadSessionRemoving {
+		return ErrUploadRemoved
+	}
+	return nil
+}
+
+// keepChunk re-checks the session after chunk was stored and recorded, and deletes the chunk
+// when the session was removed meanwhile.
+// 清理先标记会话再读取分片记录 写入方先写记录再检查标记 两边至少有一方会删除这个分片
+func keepChunk(ctx context.Context, chunk *model.FileChunk) error {
+	err := checkUploadActive(chunk.UploadID)
+	if !errors.Is(err, ErrUploadRemoved) {
+		return err
+	}
+	if storage.Default != nil {
+		_ = storage.Default.RemoveObject(ctx, config.AppConfig.BucketName, chunk.ChunkPath)
+	}
+	_ = repo.Db.Where("upload_id = ? AND chunk_index = ?", chunk.UploadID, chunk.ChunkIndex).Delete(&model.FileChunk{}).Error
+	return err
+}
+
+// removeUploadSession deletes the chunk objects, chunk rows and the session itself.
+// 只删除有记录的分片对象 分片索引受 total_chunks 约束 客户端无法让清理无限扩大
+// 发放过预签名地址的会话还可能有未确认的分片 按 total_chunks 逐个删除 (预签名时已限制分片数)
+func removeUploadSession(ctx context.Context, session *model.UploadSession) error {
+	// 先标记再读取分片 之后写入的分片由写入方自行删除 (见 keepChunk) 不改 updated_at
+	if err := repo.Db.Model(&model.UploadSession{}).
+		Where("id = ?", session.ID).
+		UpdateColumn("status", uploadSessionRemoving).Error; err != nil {
+		return err
+	}
+	session.Status = uploadSessionRemoving
+	var chunks []model.FileChunk
+	if err := repo.Db.Where("upload_id = ?", session.UploadID).Find(&chunks).Error; err != nil {
+		return err
+	}
+	if storage.Default == nil {
+		return fmt.Errorf("storage not initialized")
+	}
+	paths := make([]string, 0, len(chunks))
+	recorded := make(map[string]bool, len(chunks))
+	for _, c := range chunks {
+		paths = append(paths, c.ChunkPath)
+		recorded[c.ChunkPath] = true
+	}
+	paths = append(paths, stagingObjectPath(session.UploadID)) // 合并中断时留下的临时对象
+	if session.Presigned && session.TotalChunks <= maxPresignedChunks {
+		for index := 0; index < session.TotalChunks; index++ {
+			if p := chunkObjectPath(session.UploadID, index); !recorded[p] {
+				paths = append(paths, p)
+			}
+		}
+	}
+	for _, p := range paths {
+		err := storage.Default.RemoveObject(ctx, config.AppConfig.BucketName, p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return repo.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ?", session.UploadID).Delete(&model.FileChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.UploadSession{}, session.ID).Error
+	})
+}
+
+// AbortUpload lets a user cancel their own in-flight multipart upload.
+func AbortUpload(ctx context.Context, userID uint64, uploadID string) error {
+	session, err := GetUploadSessionByUploadID(uploadID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID { // 不暴露他人的会话
+		return gorm.ErrRecordNotFound
+	}
+	lock := repo.NewRedisLock(repo.Redis, UploadMergeLockKey(userID, session.FileHash), uploadLockTTL)
+	if err := lock.Lock(ctx); err != nil {
+		return ErrUploadInProgress
+	}
+	defer lock.Unlock(ctx)
+	return removeUploadSession(ctx, session)
+}
+
+// SweepExpiredUploads removes sessions idle for longer than UploadSessionTTL.
+func SweepExpiredUploads(ctx context.Context) (int, error) {
+	ttl := config.AppConfig.UploadSessionTTL
+	if ttl <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-ttl)
+	removed := 0
+	var lastID uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		var sessions []model.UploadSession
+		if err := repo.Db.
+			Where("updated_at < ? AND id > ?", cutoff, lastID).
+			Order("id asc").
+			Limit(uploadSweepBatch).
+			Find(&sessions).Error; err != nil {
+			return removed, err
+		}
+		if len(sessions) == 0 {
+			return removed, nil
+		}
+		for i := range sessions {
+			session := &sessions[i]
+			lastID = session.ID
+			lock := repo.NewRedisLock(repo.Redis, UploadMergeLockKey(session.UserID, session.FileHash), uploadLockTTL)
+			if err := lock.Lock(ctx); err != nil { // 正在合并 下一轮再看
+				continue
+			}
+			err := removeUploadSession(ctx, session)
+			_ = lock.Unlock(ctx)
+			if err != nil {
+				log.Printf("upload sweeper: remove session %s failed: %v", session.UploadID, err)
+				continue
+			}
+			removed++
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	proofChallengeTTL = 5 * time.Minute
+	proofRangeSize    = 64 << 10 // 挑战读取的最大字节数
+)
+
+var (
+	// ErrInvalidHash is returned when the client-supplied hash is not a SHA-256 hex digest.
+	ErrInvalidHash = errors.New("hash must be a sha256 hex digest")
+	// ErrContentHashMismatch is returned when uploaded content does not match the claimed hash.
+	ErrContentHashMismatch = errors.New("content hash mismatch")
+	// ErrInvalidChecksum is returned for a malformed or unsupported chunk checksum.
+	ErrInvalidChecksum = errors.New("checksum must be md5:<hex> or crc32c:<hex>")
+	// ErrChunkChecksumMismatch is returned when a chunk does not match its declared checksum.
+	ErrChunkChecksumMismatch = errors.New("chunk checksum mismatch")
+	// ErrChunkSizeMismatch is returned when the uploaded chunks do not add up to the file size.
+	ErrChunkSizeMismatch = errors.New("chunk sizes do not add up to file size")
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// parseChunkChecksum splits "algo:hex" and returns a hasher for algo; empty means md5 computed by the server.
+func parseChunkChecksum(checksum string) (string, string, hash.Hash, error) {
+	checksum = strings.TrimSpace(checksum)
+	if checksum == "" {
+		return "md5", "", md5.New(), nil
+	}
+	algo, sum, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return "", "", nil, ErrInvalidChecksum
+	}
+	algo = strings.ToLower(strings.TrimSpace(algo))
+	sum = strings.ToLower(strings.TrimSpace(sum))
+	var hasher hash.Hash
+	switch algo {
+	case "md5":
+		hasher = md5.New()
+	case "crc32c":
+		hasher = crc32.New(crc32cTable)
+	default:
+		return "", "", nil, ErrInvalidChecksum
+	}
+	if raw, err := hex.DecodeString(sum); err != nil || len(raw) != hasher.Size() {
+		return "", "", nil, ErrInvalidChecksum
+	}
+	return algo, sum, hasher, nil
+}
+
+func proofChallengeKey(userID uint64, hash string) string {
+	return fmt.Sprintf("upload:proof:%d:%s", userID, strings.ToLower(hash))
+}
+
+// authorizeInstantUpload decides whether userID may reference obj without uploading it.
+// 已持有该对象的用户直接放行 其余用户必须回答随机区间的挑战 否则返回新的挑战
+func authorizeInstantUpload(ctx context.Context, userID uint64, obj *model.FileObject, proof string) (bool, *dto.ProofChallenge, error) {
+	if obj.Size == 0 || obj.UserID == userID {
+		return true, nil, nil
+	}
+	if _, err := GetUserFileByObjectID(userID, obj.ID); err == nil {
+		return true, nil, nil
+	}
+	if proof != "" {
+		ok, err := checkProof(ctx, userID, obj, proof)
+		if err != nil {
+			return false, nil, err
+		}
+		if ok {
+			return true, nil, nil
+		}
+	}
+	challenge, err := issueProofChallenge(ctx, userID, obj)
+	if err != nil {
+		return false, nil, err
+	}
+	return false, challenge, nil
+}
+
+// issueProofChallenge picks a random byte range of obj and remembers it for one answer.
+func issueProofChallenge(ctx context.Context, userID uint64, obj *model.FileObject) (*dto.ProofChallenge, error) {
+	length := int64(proofRangeSize)
+	if obj.Size < length {
+		length = obj.Size
+	}
+	offset, err := rand.Int(rand.Reader, big.NewInt(obj.Size-length+1))
+	if err != nil {
+		return nil, err
+	}
+	challenge := &dto.ProofChallenge{
+		Nonce:  utils.GetToken(),
+		Offset: offset.Int64(),
+		Length: length,
+	}
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.Redis.Set(ctx, proofChallengeKey(userID, obj.Hash), data, proofChallengeTTL).Err(); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// checkProof consumes the pending challenge and compares proof with the stored content.
+func checkProof(ctx context.Context, userID uint64, obj *model.FileObject, proof string) (bool, error) {
+	key := proofChallengeKey(userID, obj.Hash)
+	data, err := repo.Redis.Get(ctx, key).Bytes()
+	if err != nil {
+		return false, nil // 挑战不存在或已过期
+	}
+	_ = repo.Redis.Del(ctx, key).Err() // 每个挑战只能回答一次
+	var challenge dto.ProofChallenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return false, nil
+	}
+	expected, err := ComputeProof(ctx, obj, challenge)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(expected, strings.TrimSpace(proof)), nil
+}
+
+// ComputeProof answers a challenge from the stored object.
+func ComputeProof(ctx context.Context, obj *model.FileObject, challenge dto.ProofChallenge) (string, error) {
+	if storage.Default == nil {
+		return "", fmt.Errorf("storage not initialized")
+	}
+	reader, _, err := storage.Default.GetObject(ctx, obj.BucketName, obj.ObjectName)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	if _, err := io.CopyN(io.Discard, reader, challenge.Offset); err != nil {
+		return "", err
+	}
+	hasher := sha256.New()
+	hasher.Write([]byte(challenge.Nonce))
+	if _, err := io.CopyN(hasher, reader, challenge.Length); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// stagingObjectPath is where the chunks of an upload are merged before their content is checked.
+func stagingObjectPath(uploadID string) string {
+	return fmt.Sprintf("chunks/%s/merged", uploadID)
+}
+
+// stageUpload merges the chunks of session into its staging object and returns the SHA-256 of
+// that object. Only the staging object is copied to the final name afterwards.
+// 校验合并后的对象而不是分片 分片在校验后被覆盖也无法让对象内容与 hash 不符
+func stageUpload(ctx context.Context, session *model.UploadSession, chunks []model.FileChunk) (string, error) {
+	if storage.Default == nil {
+		return "", fmt.Errorf("storage not initialized")
+	}
+	bucket := config.AppConfig.BucketName
+	staging := stagingObjectPath(session.UploadID)
+	if !composable(chunks) { // 存储拒绝合并过小的分片 改为逐个读出写入
+		return streamChunks(ctx, bucket, staging, session, chunks)
+	}
+	srcs := make([]storage.CopySource, 0, len(chunks))
+	for _, c := range chunks {
+		srcs = append(srcs, storage.CopySource{Bucket: bucket, Object: c.ChunkPath})
+	}
+	if err := storage.Default.ComposeObject(ctx, storage.CopyDest{Bucket: bucket, Object: staging}, srcs...); err != nil {
+		return "", err
+	}
+	reader, _, err := storage.Default.GetObject(ctx, bucket, staging)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, reader)
+	if err != nil {
+		return "", err
+	}
+	if n != session.FileSize {
+		return "", fmt.Errorf("%w: merged %d bytes, file %d bytes", ErrChunkSizeMismatch, n, session.FileSize)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// composable reports whether every chunk but the last is large enough for ComposeObject.
+// tus 每次 PATCH 一个分片 客户端可以发很小的 PATCH
+func composable(chunks []model.FileChunk) bool {
+	if len(chunks) == 0 {
+		return false
+	}
+	for _, c := range chunks[:len(chunks)-1] {
+		if c.ChunkSize < storage.MinComposePartSize {
+			return false
+		}
+	}
+	return true
+}
+
+// streamChunks writes the chunks one after another into staging and returns the SHA-256 of the
+// bytes written.
+func streamChunks(ctx context.Context, bucket, staging string, session *model.UploadSession, chunks []model.FileChunk) (string, error) {
+	var total int64
+	for _, c := range chunks {
+		total += c.ChunkSize
+	}
+	if total != session.FileSize {
+		return "", fmt.Errorf("%w: chunks %d bytes, file %d bytes", ErrChunkSizeMismatch, total, session.FileSize)
+	}
+	pr, pw := io.Pipe()
+	copied := make(chan error, 1)
+	go func() {
+		for _, c := range chunks {
+			if err := copyChunk(ctx, pw, bucket, c); err != nil {
+				pw.CloseWithError(err)
+				copied <- err
+				return
+			}
+		}
+		pw.Close()
+		copied <- nil
+	}()
+	hasher := sha256.New()
+	err := storage.Default.PutObject(ctx, bucket, staging, io.TeeReader(pr, hasher), total, storage.PutOptions{})
+	pr.Close() // 写入失败时让读取分片的 goroutine 退出
+	copyErr := <-copied
+	if err != nil {
+		return "", err
+	}
+	if copyErr != nil {
+		return "", copyErr
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// copyChunk copies chunk c to w and checks that the object still has the recorded size.
+func copyChunk(ctx context.Context, w io.Writer, bucket string, c model.FileChunk) error {
+	reader, _, err := storage.Default.GetObject(ctx, bucket, c.ChunkPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if _, err := io.CopyN(w, reader, c.ChunkSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w: chunk %d is shorter than recorded", ErrChunkSizeMismatch, c.ChunkIndex)
+		}
+		return err
+	}
+	if n, _ := reader.Read(make([]byte, 1)); n > 0 {
+		return fmt.Errorf("%w: chunk %d is longer than recorded", ErrChunkSizeMismatch, c.ChunkIndex)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"CloudVault/config"
 	"CloudVault/internal/repo"
 	"CloudVault/model"
 	"CloudVault/utils"
@@ -19,6 +20,9 @@ func CreateUser(user *model.User) error {
 		return err
 	}
 	user.Password = hashed
+	if user.TotalSpace == 0 && config.AppConfig.UserDefaultSpace > 0 {
+		user.TotalSpace = uint64(config.AppConfig.UserDefaultSpace)
+	}
 	if err := repo.Db.Create(user).Error; err != nil {
 		return err
 	}
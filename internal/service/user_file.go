@@ -12,13 +12,60 @@ import (
 	"time"
 )
 
-// CreateUserFileEntry creates a file or folder entry.
+// CreateUserFileEntry creates a file or folder entry; a taken name fails with ErrNameConflict.
 func CreateUserFileEntry(userFile *model.UserFile) error {
+	_, err := CreateUserFileEntryWithPolicy(userFile, ConflictFail)
+	return err
+}
+
+// CreateUserFileEntryWithPolicy creates a file or folder entry, resolving a taken name with policy.
+// userFile 的 ID 与 Name 更新为最终落地的条目 跳过时返回 ErrEntrySkipped 与已有条目
+func CreateUserFileEntryWithPolicy(userFile *model.UserFile, policy ConflictPolicy) (*dto.EntryResult, error) {
 	if userFile.IsDir {
-		return CreateUserDir(userFile)
-	} else {
-		return CreateUserFile(userFile)
+		if userFile.ParentID != nil && *userFile.ParentID != 0 {
+			var parent model.UserFile
+			if err := repo.Db.
+				Where("id = ? AND user_id = ? AND is_dir = 1 AND is_deleted = 0",
+					userFile.ParentID, userFile.UserID).
+				First(&parent).Error; err != nil {
+				return nil, fmt.Errorf("parent not exist or not dir")
+			}
+		}
+	} else if userFile.ObjectID == nil {
+		return nil, fmt.Errorf("file must have objectId")
+	}
+	entry := &model.UserFile{
+		UserID:   userFile.UserID,
+		ParentID: userFile.ParentID,
+		Name:     userFile.Name,
+		IsDir:    userFile.IsDir,
+		ObjectID: userFile.ObjectID,
+		Size:     userFile.Size,
+	}
+	if entry.IsDir {
+		entry.ObjectID = nil
+		entry.Size = 0
+	}
+	var result dto.EntryResult
+	// 扣减容量与写入记录放在同一事务 任一失败都回滚
+	err := runEntryOps(userFile.UserID, policy, func(o *entryOps) error {
+		var err error
+		result, err = o.create(entry)
+		return err
+	})
+	if err != nil && !errors.Is(err, ErrEntrySkipped) {
+		return nil, err
+	}
+	// 更新传入对象的ID
+	userFile.ID = result.FileID
+	userFile.Name = result.Name
+	if err != nil {
+		return &result, err
+	}
+	if !userFile.IsDir {
+		_ = activity.Emit(context.Background(), userFile.UserID, activity.ActionUpload, result.FileID, userFile.Size)
 	}
+	return &result, nil
 }
 
 // cacheParentID normalizes parent ID for cache keys.
@@ -43,57 +90,6 @@ func getFileParentID(userID, fileID uint64) (*uint64, error) {
 	return file.ParentID, nil
 }
 
-// CreateUserFile creates a file entry.
-func CreateUserFile(userFile *model.UserFile) error {
-	if userFile.ObjectID == nil {
-		return fmt.Errorf("file must have objectId")
-	}
-	file := &model.UserFile{
-		UserID:   userFile.UserID,
-		ParentID: userFile.ParentID,
-		Name:     userFile.Name,
-		IsDir:    false,
-		ObjectID: userFile.ObjectID,
-		Size:     userFile.Size,
-	}
-	if err := repo.Db.Create(file).Error; err != nil {
-		return err
-	}
-	// 更新传入对象的ID
-	userFile.ID = file.ID
-	invalidateFileListCache(userFile.UserID, userFile.ParentID)
-	_ = activity.Emit(context.Background(), userFile.UserID, activity.ActionUpload, file.ID, file.Size)
-	return nil
-}
-
-// CreateUserDir creates a folder entry.
-func CreateUserDir(userFile *model.UserFile) error {
-	if userFile.ParentID != nil && *userFile.ParentID != 0 {
-		var parent model.UserFile
-		if err := repo.Db.
-			Where("id = ? AND user_id = ? AND is_dir = 1 AND is_deleted = 0",
-				userFile.ParentID, userFile.UserID).
-			First(&parent).Error; err != nil {
-			return fmt.Errorf("parent not exist or not dir")
-		}
-	}
-	dir := &model.UserFile{
-		UserID:   userFile.UserID,
-		ParentID: userFile.ParentID,
-		Name:     userFile.Name,
-		IsDir:    true,
-		ObjectID: nil,
-		Size:     0,
-	}
-	if err := repo.Db.Create(dir).Error; err != nil {
-		return err
-	}
-	// 更新传入对象的ID
-	userFile.ID = dir.ID
-	invalidateFileListCache(userFile.UserID, userFile.ParentID)
-	return nil
-}
-
 // GetDeletedFile returns a deleted file record.
 func GetDeletedFile(userID, fileID uint) (*model.UserFile, error) { // 查询单个文件
 	var file model.UserFile
@@ -134,23 +130,28 @@ func ListRecycleFiles(userID uint) ([]model.UserFile, error) {
 	return files, err
 }
 
-// RestoreFile restores a recycled file.
+// RestoreFile restores a recycled file; a taken name fails with ErrNameConflict.
 func RestoreFile(userID, fileID uint) error { // 恢复文件
-	parentID, err := getFileParentID(uint64(userID), uint64(fileID))
+	_, err := RestoreFileWithPolicy(userID, fileID, ConflictFail)
+	return err
+}
+
+// RestoreFileWithPolicy restores a recycled file, resolving a taken name in its folder with policy.
+func RestoreFileWithPolicy(userID, fileID uint, policy ConflictPolicy) (*dto.EntryResult, error) {
+	file, err := GetDeletedFile(userID, fileID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := repo.Db.Model(&model.UserFile{}).
-		Unscoped().
-		Where("id = ? AND user_id = ? AND is_deleted = 1", fileID, userID).
-		Updates(map[string]interface{}{
-			"is_deleted": false,
-			"deleted_at": nil,
-		}).Error; err != nil {
+	var result dto.EntryResult
+	if err := runEntryOps(uint64(userID), policy, func(o *entryOps) error {
+		var err error
+		result, err = o.restore(file)
 		return err
+	}); err != nil {
+		return nil, err
 	}
-	invalidateFileListCache(uint64(userID), parentID)
-	return nil
+	result.SourceID = file.ID
+	return &result, nil
 }
 
 // DeleteFileRecord permanently deletes a file record.
@@ -167,7 +168,11 @@ func DeleteFileRecord(userID, fileID uint) error {
 			return err
 		}
 	} else {
-		deletedBytes = file.Size
+		versionBytes, err := removeFileVersions(file.ID)
+		if err != nil {
+			return err
+		}
+		deletedBytes = file.Size + versionBytes
 		if err := repo.Db.Unscoped().Delete(&model.UserFile{}, fileID).Error; err != nil {
 			return err
 		}
@@ -184,6 +189,7 @@ func DeleteFileRecord(userID, fileID uint) error {
 		}
 	}
 	invalidateFileListCache(uint64(userID), file.ParentID)
+	_ = ReleaseSpace(uint64(userID), deletedBytes)
 	_ = activity.Emit(context.Background(), uint64(userID), activity.ActionDelete, uint64(fileID), deletedBytes)
 	return nil
 }
@@ -211,7 +217,11 @@ func deleteFolderRecursively(folderID uint64) (int64, error) {
 				return 0, err
 			}
 		} else {
-			deletedBytes += child.Size
+			versionBytes, err := removeFileVersions(child.ID)
+			if err != nil {
+				return 0, err
+			}
+			deletedBytes += child.Size + versionBytes
 
 			if err := repo.Db.Unscoped().Delete(&model.UserFile{}, child.ID).Error; err != nil {
 				return 0, err
@@ -353,70 +363,61 @@ func RenameFile(userID, fileID uint64, newName string) error {
 
 // MoveFiles 移动文件(支持批量)
 func MoveFiles(userID uint64, fileIDs []uint64, targetID *uint64) error {
+	_, err := MoveFilesWithPolicy(userID, fileIDs, targetID, ConflictFail)
+	return err
+}
+
+// MoveFilesWithPolicy moves files in one transaction, resolving taken names in the target with policy.
+func MoveFilesWithPolicy(userID uint64, fileIDs []uint64, targetID *uint64, policy ConflictPolicy) ([]dto.EntryResult, error) {
+	files, err := loadBatchSources(userID, fileIDs, targetID)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]dto.EntryResult, 0, len(files))
+	if err := runEntryOps(userID, policy, func(o *entryOps) error {
+		for i := range files {
+			result, err := o.move(&files[i], targetID)
+			if err != nil {
+				return err
+			}
+			result.SourceID = files[i].ID
+			results = append(results, result)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// loadBatchSources checks the target folder and loads the files of a move or copy.
+func loadBatchSources(userID uint64, fileIDs []uint64, targetID *uint64) ([]model.UserFile, error) {
 	if targetID != nil && *targetID != 0 {
 		var target model.UserFile
 		if err := repo.Db.Where("id = ? AND user_id = ? AND is_dir = 1 AND is_deleted = 0", *targetID, userID).First(&target).Error; err != nil {
-			return fmt.Errorf("target folder not found")
+			return nil, fmt.Errorf("target folder not found")
 		}
 
 		for _, fileID := range fileIDs {
 			if *targetID == fileID {
-				return fmt.Errorf("cannot move folder to itself")
+				return nil, fmt.Errorf("cannot move folder to itself")
 			}
 			// 检查目标是否为当前文件的子目录
 			if isChildFolder(userID, *targetID, fileID) {
-				return fmt.Errorf("cannot move folder to its subfolder")
+				return nil, fmt.Errorf("cannot move folder to its subfolder")
 			}
 		}
 	}
 
 	var files []model.UserFile
 	if err := repo.Db.Where("id IN ? AND user_id = ? AND is_deleted = 0", fileIDs, userID).Find(&files).Error; err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(files) != len(fileIDs) {
-		return fmt.Errorf("some files not found")
-	}
-
-	for _, file := range files {
-		var count int64
-		query := repo.Db.Model(&model.UserFile{}).
-			Where("user_id = ? AND name = ? AND is_deleted = 0", userID, file.Name)
-		if targetID == nil || *targetID == 0 {
-			query = query.Where("parent_id IS NULL")
-		} else {
-			query = query.Where("parent_id = ?", *targetID)
-		}
-		if err := query.Count(&count).Error; err != nil {
-			return err
-		}
-		if count > 0 {
-			return fmt.Errorf("file %s already exists in target folder", file.Name)
-		}
-	}
-
-	if err := repo.Db.Model(&model.UserFile{}).
-		Where("id IN ? AND user_id = ? AND is_deleted = 0", fileIDs, userID).
-		Update("parent_id", targetID).Error; err != nil {
-		return err
-	}
-
-	parentIDs := make(map[uint64]struct{})
-	for _, file := range files {
-		parentIDs[cacheParentID(file.ParentID)] = struct{}{}
-	}
-	for id := range parentIDs {
-		pid := id
-		invalidateFileListCache(userID, &pid)
+		return nil, fmt.Errorf("some files not found")
 	}
-	if targetID != nil {
-		invalidateFileListCache(userID, targetID)
-	} else {
-		root := uint64(0)
-		invalidateFileListCache(userID, &root)
-	}
-	return nil
+	return files, nil
 }
 
 // isChildFolder 检查folderID是否是parentID的子文件
@@ -443,90 +444,32 @@ func isChildFolder(userID, folderID, parentID uint64) bool {
 
 // CopyFiles 复制文件(支持批量)
 func CopyFiles(userID uint64, fileIDs []uint64, targetID *uint64) error {
+	_, err := CopyFilesWithPolicy(userID, fileIDs, targetID, ConflictFail)
+	return err
+}
 
-	if targetID != nil && *targetID != 0 {
-		var target model.UserFile
-		if err := repo.Db.Where("id = ? AND user_id = ? AND is_dir = 1 AND is_deleted = 0", *targetID, userID).First(&target).Error; err != nil {
-			return fmt.Errorf("target folder not found")
-		}
-	}
-
-	var files []model.UserFile
-	if err := repo.Db.Where("id IN ? AND user_id = ? AND is_deleted = 0", fileIDs, userID).Find(&files).Error; err != nil {
-		return err
-	}
-
-	if len(files) != len(fileIDs) {
-		return fmt.Errorf("some files not found")
+// CopyFilesWithPolicy copies files and folder trees in one transaction, resolving taken names with policy.
+// 复制进自身或子目录会无限递归 与移动一样拒绝
+func CopyFilesWithPolicy(userID uint64, fileIDs []uint64, targetID *uint64, policy ConflictPolicy) ([]dto.EntryResult, error) {
+	files, err := loadBatchSources(userID, fileIDs, targetID)
+	if err != nil {
+		return nil, err
 	}
-
-	// 逐个复制文件
-	for _, file := range files {
-		// 检查目标目录是否有重名
-		var count int64
-		query := repo.Db.Model(&model.UserFile{}).
-			Where("user_id = ? AND name = ? AND is_deleted = 0", userID, file.Name)
-		if targetID == nil || *targetID == 0 {
-			query = query.Where("parent_id IS NULL")
-		} else {
-			query = query.Where("parent_id = ?", *targetID)
-		}
-		if err := query.Count(&count).Error; err != nil {
-			return err
-		}
-		if count > 0 {
-			return fmt.Errorf("file %s already exists in target folder", file.Name)
-		}
-
-		// 创建新的文件记录
-		newFile := &model.UserFile{
-			UserID:   userID,
-			ParentID: targetID,
-			Name:     file.Name,
-			IsDir:    file.IsDir,
-			ObjectID: file.ObjectID,
-			Size:     file.Size,
-		}
-
-		if err := repo.Db.Create(newFile).Error; err != nil {
-			return err
-		}
-
-		// 若为文件夹，递归复制子文
-		if file.IsDir {
-			var children []model.UserFile
-			if err := repo.Db.Where("parent_id = ? AND is_deleted = 0", file.ID).Find(&children).Error; err != nil {
-				return err
-			}
-
-			childIDs := make([]uint64, 0, len(children))
-			for _, child := range children {
-				childIDs = append(childIDs, child.ID)
-			}
-
-			if len(childIDs) > 0 {
-				newParentID := newFile.ID
-				if err := CopyFiles(userID, childIDs, &newParentID); err != nil {
-					return err
-				}
-			}
-		}
-
-		// 对象引用计数加一
-		if file.ObjectID != nil {
-			if err := IncreaseRefCount(*file.ObjectID); err != nil {
+	results := make([]dto.EntryResult, 0, len(files))
+	if err := runEntryOps(userID, policy, func(o *entryOps) error {
+		for i := range files {
+			result, err := o.copy(&files[i], targetID)
+			if err != nil {
 				return err
 			}
+			result.SourceID = files[i].ID
+			results = append(results, result)
 		}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
-
-	if targetID != nil {
-		invalidateFileListCache(userID, targetID)
-	} else {
-		root := uint64(0)
-		invalidateFileListCache(userID, &root)
-	}
-	return nil
+	return results, nil
 }
 
 // BatchMoveToRecycle 批量移入回收
@@ -7,6 +7,7 @@ import (
 	"CloudVault/utils"
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -25,12 +26,17 @@ type UserProfile struct {
 	TotalSpace uint64    `json:"total_space"`
 	UseSpace   uint64    `json:"use_space"`
 	CreatedAt  time.Time `json:"created_at"`
+
+	// 实际生效的历史版本保留规则 0 表示不限制
+	VersionKeep int `json:"version_keep"`
+	VersionDays int `json:"version_days"`
 }
 
 func toUserProfile(user *model.User) *UserProfile {
 	if user == nil {
 		return nil
 	}
+	keep, days := versionRetention(user)
 	return &UserProfile{
 		ID:         user.ID,
 		UserName:   user.UserName,
@@ -42,6 +48,9 @@ func toUserProfile(user *model.User) *UserProfile {
 		TotalSpace: user.TotalSpace,
 		UseSpace:   user.UseSpace,
 		CreatedAt:  user.CreatedAt,
+
+		VersionKeep: keep,
+		VersionDays: days,
 	}
 }
 
@@ -75,6 +84,20 @@ func UpdateUserProfile(userID uint64, req *dto.UpdateUserProfileRequest) (*UserP
 	if req.Bio != nil {
 		updates["bio"] = strings.TrimSpace(*req.Bio)
 	}
+	if req.VersionKeep != nil {
+		value, err := versionRetentionUpdate(*req.VersionKeep, maxVersionKeep, "version_keep")
+		if err != nil {
+			return nil, err
+		}
+		updates["version_keep"] = value
+	}
+	if req.VersionDays != nil {
+		value, err := versionRetentionUpdate(*req.VersionDays, maxVersionDays, "version_days")
+		if err != nil {
+			return nil, err
+		}
+		updates["version_days"] = value
+	}
 	if req.Email != nil {
 		email := strings.TrimSpace(*req.Email)
 		if email == "" {
@@ -105,3 +128,19 @@ func UpdateUserProfile(userID uint64, req *dto.UpdateUserProfileRequest) (*UserP
 	_ = utils.InvalidateUserInfoCache(context.Background(), userID)
 	return GetUserProfileByID(userID)
 }
+
+const (
+	maxVersionKeep = 1000
+	maxVersionDays = 3650
+)
+
+// versionRetentionUpdate validates a retention setting; a negative value resets it to the default.
+func versionRetentionUpdate(value, max int, field string) (interface{}, error) {
+	if value < 0 {
+		return gorm.Expr("NULL"), nil
+	}
+	if value > max {
+		return nil, fmt.Errorf("%s must be at most %d", field, max)
+	}
+	return value, nil
+}
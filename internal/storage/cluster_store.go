@@ -0,0 +1,595 @@
+package storage
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/model"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ClusterStore implements Store on top of a StorageCluster.
+// 写入按副本数分发到多个节点并记录 placement 读取按 placement 顺序在可用节点间故障转移
+type ClusterStore struct {
+	cluster *StorageCluster
+}
+
+// NewClusterStore wraps cluster as a Store.
+func NewClusterStore(cluster *StorageCluster) *ClusterStore {
+	return &ClusterStore{cluster: cluster}
+}
+
+// Cluster returns the underlying cluster.
+func (s *ClusterStore) Cluster() *StorageCluster {
+	return s.cluster
+}
+
+// PutObject writes the object to ReplicaCount distinct nodes.
+func (s *ClusterStore) PutObject(ctx context.Context, bucket, object string, reader io.Reader, size int64, opts PutOptions) error {
+	return s.cluster.putReplicated(ctx, bucket, object, reader, size, opts)
+}
+
+// GetObject reads from the first available node holding a replica.
+func (s *ClusterStore) GetObject(ctx context.Context, bucket, object string) (io.ReadCloser, ObjectInfo, error) {
+	nodes, err := s.cluster.readNodes(ctx, bucket, object)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	lastErr := error(os.ErrNotExist)
+	for _, node := range nodes {
+		if !node.IsAvailable() {
+			continue
+		}
+		reader, info, err := node.Store.GetObject(ctx, bucket, object)
+		if err == nil {
+			return reader, info, nil
+		}
+		log.Printf("read %s/%s from node %s failed: %v", bucket, object, node.Name(), err)
+		lastErr = err
+	}
+	return nil, ObjectInfo{}, lastErr
+}
+
+// GetObjectRange reads part of an object from the first available node holding a replica.
+func (s *ClusterStore) GetObjectRange(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	nodes, err := s.cluster.readNodes(ctx, bucket, object)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	lastErr := error(os.ErrNotExist)
+	for _, node := range nodes {
+		if !node.IsAvailable() {
+			continue
+		}
+		reader, info, err := node.Store.GetObjectRange(ctx, bucket, object, offset, length)
+		if err == nil {
+			return reader, info, nil
+		}
+		if errors.Is(err, ErrInvalidRange) { // 范围越界与副本无关 不再尝试其他节点
+			return nil, ObjectInfo{}, err
+		}
+		log.Printf("read %s/%s from node %s failed: %v", bucket, object, node.Name(), err)
+		lastErr = err
+	}
+	return nil, ObjectInfo{}, lastErr
+}
+
+// RemoveObject deletes every replica and its placement records. Replicas on nodes that are down
+// are kept as tombstones and deleted by the scrubber later.
+func (s *ClusterStore) RemoveObject(ctx context.Context, bucket, object string) error {
+	sc := s.cluster
+	replicas, err := sc.replicas(ctx, bucket, object)
+	if err != nil {
+		return err
+	}
+	if len(replicas) == 0 { // 没有 placement 记录的旧对象 逐个节点尝试删除
+		for _, node := range sc.Nodes {
+			if node.IsAvailable() {
+				_ = node.Store.RemoveObject(ctx, bucket, object)
+			}
+		}
+		return nil
+	}
+	for _, replica := range replicas {
+		if err := sc.removeReplica(ctx, replica); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ComposeObject concatenates sources into dest and replicates the result.
+// 分片可能散落在不同节点 若有节点持有全部分片则在该节点服务端合并 否则流式拼接后重新写入
+func (s *ClusterStore) ComposeObject(ctx context.Context, dest CopyDest, sources ...CopySource) error {
+	sc := s.cluster
+	holder, err := sc.nodeHoldingAll(ctx, sources)
+	if err != nil {
+		return err
+	}
+	if holder == nil {
+		return s.composeByStream(ctx, dest, sources)
+	}
+
+	if err := holder.Store.ComposeObject(ctx, dest, sources...); err != nil {
+		return err
+	}
+	var size int64
+	for _, src := range sources {
+		replicas, err := sc.replicas(ctx, src.Bucket, src.Object)
+		if err != nil {
+			return err
+		}
+		if len(replicas) > 0 {
+			size += replicas[0].Size
+		}
+	}
+	holder.UpdateUsedSize(size)
+	if err := sc.recordReplica(ctx, dest.Bucket, dest.Object, holder, size); err != nil {
+		return err
+	}
+
+	targets, err := sc.selectReplicaNodes(placementKey(dest.Hash, dest.Object), sc.replicaCount())
+	if err != nil {
+		return nil // 至少已有一份 其余副本交给后续修复
+	}
+	copies := 1
+	for _, node := range targets {
+		if node == holder || copies >= sc.replicaCount() {
+			continue
+		}
+		written, err := sc.copyReplica(ctx, dest.Bucket, dest.Object, holder, node)
+		if err != nil {
+			log.Printf("replicate %s to node %s failed: %v", dest.Object, node.Name(), err)
+			continue
+		}
+		node.UpdateUsedSize(written)
+		if err := sc.recordReplica(ctx, dest.Bucket, dest.Object, node, written); err != nil {
+			return err
+		}
+		copies++
+	}
+	return nil
+}
+
+func (s *ClusterStore) composeByStream(ctx context.Context, dest CopyDest, sources []CopySource) error {
+	readers := make([]io.Reader, 0, len(sources))
+	closers := make([]io.Closer, 0, len(sources))
+	defer func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}()
+	for _, src := range sources {
+		reader, _, err := s.GetObject(ctx, src.Bucket, src.Object)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, reader)
+		closers = append(closers, reader)
+	}
+	return s.cluster.putReplicated(ctx, dest.Bucket, dest.Object, io.MultiReader(readers...), -1, PutOptions{Hash: dest.Hash})
+}
+
+// PresignedGetObject presigns against the first available replica.
+func (s *ClusterStore) PresignedGetObject(ctx context.Context, bucket, object string, expiry time.Duration) (string, error) {
+	return s.PresignedGetObjectWithResponse(ctx, bucket, object, expiry, nil)
+}
+
+// PresignedGetObjectWithResponse presigns against the first available replica.
+func (s *ClusterStore) PresignedGetObjectWithResponse(
+	ctx context.Context,
+	bucket,
+	object string,
+	expiry time.Duration,
+	params map[string]string,
+) (string, error) {
+	nodes, err := s.cluster.readNodes(ctx, bucket, object)
+	if err != nil {
+		return "", err
+	}
+	for _, node := range nodes {
+		if node.IsAvailable() {
+			return node.Store.PresignedGetObjectWithResponse(ctx, bucket, object, expiry, params)
+		}
+	}
+	return "", fmt.Errorf("no available replica for %s/%s", bucket, object)
+}
+
+// PresignedPutObject presigns the upload against the first node the object would be placed on.
+// 直传只落一份 不记录 placement 读取和删除时按无记录对象逐节点查找 合并时走流式拼接
+func (s *ClusterStore) PresignedPutObject(ctx context.Context, bucket, object string, expiry time.Duration, opts PutOptions) (string, error) {
+	nodes, err := s.cluster.selectReplicaNodes(placementKey(opts.Hash, object), 1)
+	if err != nil {
+		return "", err
+	}
+	if len(nodes) == 0 {
+		return "", fmt.Errorf("no available storage nodes")
+	}
+	return nodes[0].Store.PresignedPutObject(ctx, bucket, object, expiry, opts)
+}
+
+// StatObject stats the first available node holding the object.
+func (s *ClusterStore) StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	nodes, err := s.cluster.readNodes(ctx, bucket, object)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	lastErr := error(os.ErrNotExist)
+	for _, node := range nodes {
+		if !node.IsAvailable() {
+			continue
+		}
+		info, err := node.Store.StatObject(ctx, bucket, object)
+		if err == nil {
+			return info, nil
+		}
+		lastErr = err
+	}
+	return ObjectInfo{}, lastErr
+}
+
+// replicaCount returns how many copies each object should have.
+func (sc *StorageCluster) replicaCount() int {
+	count := 1
+	if config.StorageConfigInstance != nil && config.StorageConfigInstance.ReplicaCount > 0 {
+		count = config.StorageConfigInstance.ReplicaCount
+	}
+	if count > len(sc.Nodes) {
+		count = len(sc.Nodes)
+	}
+	return count
+}
+
+// PlacementNodes returns the nodes a new object keyed by hash would be written to.
+func (sc *StorageCluster) PlacementNodes(hash string) ([]*StorageNode, error) {
+	return sc.selectReplicaNodes(hash, sc.replicaCount())
+}
+
+// selectReplicaNodes picks up to count distinct available nodes for key.
+// hash 策略下主副本都沿哈希环顺时针选取 其他策略首个节点按负载均衡选出 其余沿节点顺序取后续可用节点
+func (sc *StorageCluster) selectReplicaNodes(key string, count int) ([]*StorageNode, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if usesHashPlacement() && key != "" {
+		nodes := sc.ringLocked().lookup(key, count)
+		if len(nodes) == 0 {
+			return nil, fmt.Errorf("no available storage nodes")
+		}
+		return nodes, nil
+	}
+
+	first, err := sc.selectLocked(key)
+	if err != nil {
+		return nil, err
+	}
+	start := 0
+	for i, node := range sc.Nodes {
+		if node == first {
+			start = i
+			break
+		}
+	}
+	nodes := []*StorageNode{first}
+	for i := 1; i < len(sc.Nodes) && len(nodes) < count; i++ {
+		node := sc.Nodes[(start+i)%len(sc.Nodes)]
+		if node.IsAvailable() {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// putReplicated writes reader to the selected replica nodes and records placement.
+func (sc *StorageCluster) putReplicated(ctx context.Context, bucket, object string, reader io.Reader, size int64, opts PutOptions) error {
+	nodes, err := sc.selectReplicaNodes(placementKey(opts.Hash, object), sc.replicaCount())
+	if err != nil {
+		return err
+	}
+
+	// 多副本需要重复读取 不可 Seek 或大小未知时先落到临时文件
+	seeker, _ := reader.(io.ReadSeeker)
+	if (len(nodes) > 1 && seeker == nil) || size < 0 {
+		spool, spoolSize, err := spoolToTemp(reader)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+		}()
+		seeker, size = spool, spoolSize
+	}
+	var offset int64
+	if seeker != nil {
+		if offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+
+	written := make([]*StorageNode, 0, len(nodes))
+	var lastErr error
+	for _, node := range nodes {
+		src := reader
+		if seeker != nil {
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+			src = seeker
+		}
+		if err := node.Store.PutObject(ctx, bucket, object, src, size, opts); err != nil {
+			log.Printf("put %s/%s to node %s failed: %v", bucket, object, node.Name(), err)
+			lastErr = err
+			continue
+		}
+		node.UpdateUsedSize(size)
+		if err := sc.recordReplica(ctx, bucket, object, node, size); err != nil {
+			return err
+		}
+		written = append(written, node)
+	}
+	if len(written) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no available storage nodes")
+		}
+		return lastErr
+	}
+	return sc.dropStaleReplicas(ctx, bucket, object, written)
+}
+
+// dropStaleReplicas removes replicas of an overwritten object that were not rewritten.
+func (sc *StorageCluster) dropStaleReplicas(ctx context.Context, bucket, object string, keep []*StorageNode) error {
+	replicas, err := sc.replicas(ctx, bucket, object)
+	if err != nil {
+		return err
+	}
+	for _, replica := range replicas {
+		kept := false
+		for _, node := range keep {
+			if node.Name() == replica.NodeName {
+				kept = true
+				break
+			}
+		}
+		if kept {
+			continue
+		}
+		if err := sc.removeReplica(ctx, replica); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeReplica deletes one replica and its placement record. When the node is down or the delete
+// fails, the record becomes a tombstone so the object is not orphaned on that node.
+func (sc *StorageCluster) removeReplica(ctx context.Context, replica model.ObjectReplica) error {
+	node := sc.nodeByName(replica.NodeName)
+	if node != nil && node.IsAvailable() {
+		err := node.Store.RemoveObject(ctx, replica.BucketName, replica.ObjectName)
+		if err == nil {
+			node.UpdateUsedSize(-replica.Size)
+			return sc.placement.RemoveReplica(ctx, replica.BucketName, replica.ObjectName, replica.NodeName)
+		}
+		log.Printf("remove %s/%s from node %s failed: %v", replica.BucketName, replica.ObjectName, node.Name(), err)
+	}
+	tombstones, ok := sc.placement.(ReplicaTombstones)
+	if !ok { // 无法记录待删除时保留 placement 记录 不丢失该副本
+		return nil
+	}
+	return tombstones.BuryReplica(ctx, replica)
+}
+
+// PurgeTombstones deletes the replicas left behind on nodes that were down when their object was
+// removed. Tombstones on nodes still unavailable are kept for the next pass.
+func (sc *StorageCluster) PurgeTombstones(ctx context.Context) (int, error) {
+	tombstones, ok := sc.placement.(ReplicaTombstones)
+	if !ok {
+		return 0, nil
+	}
+	purged := 0
+	var lastID uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		batch, err := tombstones.Tombstones(ctx, lastID, 100)
+		if err != nil {
+			return purged, err
+		}
+		if len(batch) == 0 {
+			return purged, nil
+		}
+		for _, tombstone := range batch {
+			lastID = tombstone.ID
+			node := sc.nodeByName(tombstone.NodeName)
+			if node == nil || !node.IsAvailable() {
+				continue
+			}
+			held, err := sc.holdsReplica(ctx, tombstone.BucketName, tombstone.ObjectName, node)
+			if err != nil {
+				return purged, err
+			}
+			if !held { // 已重新写入的副本不能删除 只清理记录
+				if err := node.Store.RemoveObject(ctx, tombstone.BucketName, tombstone.ObjectName); err != nil {
+					log.Printf("purge %s/%s from node %s failed: %v", tombstone.BucketName, tombstone.ObjectName, node.Name(), err)
+					continue
+				}
+				node.UpdateUsedSize(-tombstone.Size)
+			}
+			if err := tombstones.ForgetTombstone(ctx, tombstone); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+}
+
+// spoolToTemp copies reader into a temp file and rewinds it.
+func spoolToTemp(reader io.Reader) (*os.File, int64, error) {
+	tmp, err := os.CreateTemp("", "cluster-put-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(tmp, reader)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return nil, 0, err
+	}
+	return tmp, size, nil
+}
+
+// replicas returns the placement records of an object; nil when placement is disabled.
+func (sc *StorageCluster) replicas(ctx context.Context, bucket, object string) ([]model.ObjectReplica, error) {
+	if sc.placement == nil {
+		return nil, nil
+	}
+	return sc.placement.Replicas(ctx, bucket, object)
+}
+
+func (sc *StorageCluster) recordReplica(ctx context.Context, bucket, object string, node *StorageNode, size int64) error {
+	if sc.placement == nil {
+		return nil
+	}
+	return sc.placement.AddReplica(ctx, bucket, object, node.Name(), size)
+}
+
+// readNodes lists the nodes to read an object from, in placement order.
+// 没有 placement 记录的对象（如接入集群前写入）按节点顺序逐个尝试
+func (sc *StorageCluster) readNodes(ctx context.Context, bucket, object string) ([]*StorageNode, error) {
+	replicas, err := sc.replicas(ctx, bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	if len(replicas) == 0 {
+		return sc.Nodes, nil
+	}
+	nodes := make([]*StorageNode, 0, len(replicas))
+	for _, replica := range replicas {
+		if node := sc.nodeByName(replica.NodeName); node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// holdsReplica reports whether node has a recorded replica of the object.
+func (sc *StorageCluster) holdsReplica(ctx context.Context, bucket, object string, node *StorageNode) (bool, error) {
+	replicas, err := sc.replicas(ctx, bucket, object)
+	if err != nil {
+		return false, err
+	}
+	for _, replica := range replicas {
+		if replica.NodeName == node.Name() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nodeHoldingAll finds an available node that holds every source, or nil.
+func (sc *StorageCluster) nodeHoldingAll(ctx context.Context, sources []CopySource) (*StorageNode, error) {
+	if sc.placement == nil {
+		return nil, nil
+	}
+	for _, node := range sc.Nodes {
+		if !node.IsAvailable() {
+			continue
+		}
+		holdsAll := true
+		for _, src := range sources {
+			held, err := sc.holdsReplica(ctx, src.Bucket, src.Object, node)
+			if err != nil {
+				return nil, err
+			}
+			if !held {
+				holdsAll = false
+				break
+			}
+		}
+		if holdsAll {
+			return node, nil
+		}
+	}
+	return nil, nil
+}
+
+// copyReplica copies an object from one node to another and returns its size.
+func (sc *StorageCluster) copyReplica(ctx context.Context, bucket, object string, from, to *StorageNode) (int64, error) {
+	reader, info, err := from.Store.GetObject(ctx, bucket, object)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	if err := to.Store.PutObject(ctx, bucket, object, reader, info.Size, PutOptions{}); err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// nodeByName finds a node by its configured name.
+func (sc *StorageCluster) nodeByName(name string) *StorageNode {
+	for _, node := range sc.Nodes {
+		if node.Name() == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// LoadUsage seeds each node's UsedSize from placement records.
+func (sc *StorageCluster) LoadUsage(ctx context.Context) error {
+	if sc.placement == nil {
+		return nil
+	}
+	usage, err := sc.placement.NodeUsage(ctx)
+	if err != nil {
+		return err
+	}
+	for _, node := range sc.Nodes {
+		node.mu.Lock()
+		node.Cluster.UsedSize = usage[node.Name()]
+		node.mu.Unlock()
+	}
+	return nil
+}
+
+// InitCluster initializes the storage cluster as Default, persisting placement in the database.
+func InitCluster() {
+	if err := InitStorageCluster(); err != nil {
+		log.Fatalln("storage cluster error:", err)
+	}
+	cluster := globalStorageCluster
+	ctx := context.Background()
+	for _, node := range cluster.Nodes {
+		if node.Client == nil {
+			continue
+		}
+		exists, err := node.Client.BucketExists(ctx, config.AppConfig.BucketName)
+		if err != nil {
+			log.Fatalf("check bucket on node %s fail: %v", node.Name(), err)
+		}
+		if !exists {
+			if err := node.Client.MakeBucket(ctx, config.AppConfig.BucketName, minio.MakeBucketOptions{}); err != nil {
+				log.Fatalf("create bucket on node %s fail: %v", node.Name(), err)
+			}
+		}
+	}
+	cluster.SetPlacement(NewDBPlacement(repo.Db))
+	if err := cluster.LoadUsage(ctx); err != nil {
+		log.Printf("load storage node usage failed: %v", err)
+	}
+	StartHealthMonitor(ctx, cluster, config.AppConfig.BucketName)
+	Default = NewClusterStore(cluster)
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// ringVirtualNodes is the number of ring points per unit of node weight.
+const ringVirtualNodes = 160
+
+type ringPoint struct {
+	hash uint64
+	node *StorageNode
+}
+
+// hashRing is a weighted consistent-hash ring over storage nodes.
+// 每个节点按 Weight 放置若干虚拟节点 增删节点时只有落在其区间内的对象需要移动
+type hashRing struct {
+	points []ringPoint
+	nodes  []*StorageNode // 建环时的节点列表 用于判断是否需要重建
+}
+
+func ringHash(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// newHashRing places every node on the ring regardless of availability,
+// so a node going down does not reshuffle placement of other objects.
+func newHashRing(nodes []*StorageNode) *hashRing {
+	ring := &hashRing{nodes: append([]*StorageNode(nil), nodes...)}
+	for _, node := range nodes {
+		weight := node.Cluster.Weight
+		if weight <= 0 { // 未配置权重按 1 处理
+			weight = 1
+		}
+		for i := 0; i < weight*ringVirtualNodes; i++ {
+			ring.points = append(ring.points, ringPoint{
+				hash: ringHash(node.Name() + "#" + strconv.Itoa(i)),
+				node: node,
+			})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		if ring.points[i].hash == ring.points[j].hash {
+			return ring.points[i].node.Name() < ring.points[j].node.Name()
+		}
+		return ring.points[i].hash < ring.points[j].hash
+	})
+	return ring
+}
+
+// matches reports whether the ring was built from exactly these nodes.
+func (r *hashRing) matches(nodes []*StorageNode) bool {
+	if r == nil || len(r.nodes) != len(nodes) {
+		return false
+	}
+	for i := range nodes {
+		if r.nodes[i] != nodes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup walks clockwise from key and returns up to count distinct available nodes.
+func (r *hashRing) lookup(key string, count int) []*StorageNode {
+	if len(r.points) == 0 || count <= 0 {
+		return nil
+	}
+	h := ringHash(key)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	picked := make([]*StorageNode, 0, count)
+	seen := make(map[*StorageNode]bool, count)
+	for i := 0; i < len(r.points) && len(picked) < count; i++ {
+		node := r.points[(start+i)%len(r.points)].node
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		if node.IsAvailable() {
+			picked = append(picked, node)
+		}
+	}
+	return picked
+}
+
+// placementKey returns the ring key for an object: its content hash when known, otherwise its name.
+func placementKey(hash, object string) string {
+	if hash != "" {
+		return hash
+	}
+	return object
+}
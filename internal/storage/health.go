@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"CloudVault/config"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// healthCanaryPrefix is where probe objects are written on each node.
+const healthCanaryPrefix = ".healthcheck/"
+
+// NodeHealth is a snapshot of a storage node as seen by the health checker.
+type NodeHealth struct {
+	Name                 string    `json:"name"`
+	Available            bool      `json:"available"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+	ConsecutiveSuccesses int       `json:"consecutive_successes"`
+	LastCheckAt          time.Time `json:"last_check_at"`
+	LastChangeAt         time.Time `json:"last_change_at"`
+	LastError            string    `json:"last_error,omitempty"`
+	LatencyMs            int64     `json:"latency_ms"`
+	UsedSize             int64     `json:"used_size"`
+	TotalSize            int64     `json:"total_size"`
+	UsageRate            float64   `json:"usage_rate"`
+	Weight               int       `json:"weight"`
+}
+
+// HealthChecker periodically probes cluster nodes and flips StorageNode availability.
+// 连续失败 FailThreshold 次才摘除 连续成功 RecoverThreshold 次才恢复 避免抖动
+type HealthChecker struct {
+	cluster          *StorageCluster
+	bucket           string
+	interval         time.Duration
+	timeout          time.Duration
+	failThreshold    int
+	recoverThreshold int
+
+	mu    sync.Mutex
+	state map[string]*NodeHealth
+}
+
+// NewHealthChecker builds a checker using the thresholds in StorageConfigInstance.
+func NewHealthChecker(cluster *StorageCluster, bucket string) *HealthChecker {
+	h := &HealthChecker{
+		cluster:          cluster,
+		bucket:           bucket,
+		interval:         10 * time.Second,
+		timeout:          5 * time.Second,
+		failThreshold:    3,
+		recoverThreshold: 2,
+		state:            make(map[string]*NodeHealth),
+	}
+	if cfg := config.StorageConfigInstance; cfg != nil {
+		if cfg.HealthCheckInterval > 0 {
+			h.interval = cfg.HealthCheckInterval
+		}
+		if cfg.HealthCheckTimeout > 0 {
+			h.timeout = cfg.HealthCheckTimeout
+		}
+		if cfg.HealthFailThreshold > 0 {
+			h.failThreshold = cfg.HealthFailThreshold
+		}
+		if cfg.HealthRecoverThreshold > 0 {
+			h.recoverThreshold = cfg.HealthRecoverThreshold
+		}
+	}
+	return h
+}
+
+// CheckOnce probes every node once and applies the hysteresis rules.
+func (h *HealthChecker) CheckOnce(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, node := range h.cluster.Nodes {
+		wg.Add(1)
+		go func(node *StorageNode) {
+			defer wg.Done()
+			start := time.Now()
+			err := h.probe(ctx, node)
+			h.record(node, err, time.Since(start))
+		}(node)
+	}
+	wg.Wait()
+}
+
+// probe writes a small canary object and reads it back.
+func (h *HealthChecker) probe(ctx context.Context, node *StorageNode) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	object := healthCanaryPrefix + node.Name()
+	payload := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := node.Store.PutObject(ctx, h.bucket, object, bytes.NewReader(payload), int64(len(payload)), PutOptions{}); err != nil {
+		return err
+	}
+	reader, _, err := node.Store.GetObject(ctx, h.bucket, object)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, payload) {
+		return fmt.Errorf("canary mismatch")
+	}
+	return nil
+}
+
+func (h *HealthChecker) record(node *StorageNode, probeErr error, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state, ok := h.state[node.Name()]
+	if !ok {
+		state = &NodeHealth{Name: node.Name()}
+		h.state[node.Name()] = state
+	}
+	now := time.Now()
+	state.LastCheckAt = now
+	state.LatencyMs = latency.Milliseconds()
+
+	available := node.IsAvailable()
+	if probeErr != nil {
+		state.ConsecutiveFailures++
+		state.ConsecutiveSuccesses = 0
+		state.LastError = probeErr.Error()
+		if available && state.ConsecutiveFailures >= h.failThreshold {
+			node.SetAvailable(false)
+			state.LastChangeAt = now
+			log.Printf("storage node %s marked unavailable after %d failed checks: %v",
+				node.Name(), state.ConsecutiveFailures, probeErr)
+		}
+		return
+	}
+	state.ConsecutiveSuccesses++
+	state.ConsecutiveFailures = 0
+	state.LastError = ""
+	if !available && state.ConsecutiveSuccesses >= h.recoverThreshold {
+		node.SetAvailable(true)
+		state.LastChangeAt = now
+		log.Printf("storage node %s marked available after %d successful checks",
+			node.Name(), state.ConsecutiveSuccesses)
+	}
+}
+
+// Snapshot returns the current state of every node in cluster order.
+func (h *HealthChecker) Snapshot() []NodeHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make([]NodeHealth, 0, len(h.cluster.Nodes))
+	for _, node := range h.cluster.Nodes {
+		item := NodeHealth{Name: node.Name()}
+		if state, ok := h.state[node.Name()]; ok {
+			item = *state
+		}
+		node.mu.RLock()
+		item.Available = node.Cluster.Available
+		item.UsedSize = node.Cluster.UsedSize
+		item.TotalSize = node.Cluster.TotalSize
+		item.Weight = node.Cluster.Weight
+		node.mu.RUnlock()
+		item.UsageRate = node.GetUsageRate()
+		out = append(out, item)
+	}
+	return out
+}
+
+// Run probes on every interval until ctx is done.
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	h.CheckOnce(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.CheckOnce(ctx)
+		}
+	}
+}
+
+var globalHealthChecker *HealthChecker
+
+// GetHealthChecker returns the checker started by StartHealthMonitor, or nil.
+func GetHealthChecker() *HealthChecker {
+	return globalHealthChecker
+}
+
+// StartHealthMonitor 启动节点健康检查
+func StartHealthMonitor(ctx context.Context, cluster *StorageCluster, bucket string) *HealthChecker {
+	checker := NewHealthChecker(cluster, bucket)
+	globalHealthChecker = checker
+	go checker.Run(ctx)
+	log.Printf("Health monitor started with interval %v", checker.interval)
+	return checker
+}
@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"CloudVault/config"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	localExpiresParam   = "X-Expires"
+	localSignatureParam = "X-Signature"
+	localMethodParam    = "X-Method" // 只在 PUT 链接中出现 参与签名 下载链接不能用于上传
+	// LocalObjectRoute is the gin route prefix that serves presigned local objects.
+	LocalObjectRoute = "/api/storage/local"
+)
+
+var (
+	ErrInvalidObjectName = errors.New("invalid object name")
+	ErrPresignExpired    = errors.New("presigned url expired")
+	ErrPresignSignature  = errors.New("presigned url signature mismatch")
+)
+
+// LocalStore implements Store on a local directory: <root>/<bucket>/<object>.
+type LocalStore struct {
+	root    string
+	secret  []byte
+	baseURL string
+}
+
+// NewLocalStore builds a Store rooted at dir. Presigned URLs are signed with secret
+// and point at baseURL + LocalObjectRoute.
+func NewLocalStore(dir string, secret string, baseURL string) (*LocalStore, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, fmt.Errorf("local storage root missing")
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("local storage secret missing")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{
+		root:    abs,
+		secret:  []byte(secret),
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}, nil
+}
+
+// Root returns the directory backing the store.
+func (s *LocalStore) Root() string {
+	return s.root
+}
+
+// objectPath maps bucket/object to a file path, rejecting names that escape the root.
+// 与 sanitizeArchiveName 同理 防止 ../ 穿越到根目录之外
+func (s *LocalStore) objectPath(bucket, object string) (string, error) {
+	if bucket == "" || bucket == "." || bucket == ".." || strings.ContainsAny(bucket, `/\`) {
+		return "", ErrInvalidObjectName
+	}
+	if object == "" || strings.Contains(object, `\`) || strings.ContainsRune(object, 0) {
+		return "", ErrInvalidObjectName
+	}
+	if path.Clean("/"+object) != "/"+object {
+		return "", ErrInvalidObjectName
+	}
+	return filepath.Join(s.root, bucket, filepath.FromSlash(object)), nil
+}
+
+// writeFile streams reader into dst through a temp file so readers never see partial objects.
+func writeFile(dst string, reader io.Reader, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	src := reader
+	if size >= 0 {
+		src = io.LimitReader(reader, size)
+	}
+	written, err := io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("short write: expected %d bytes, got %d", size, written)
+	}
+	return os.Rename(tmpName, dst)
+}
+
+// PutObject writes an object to disk.
+func (s *LocalStore) PutObject(ctx context.Context, bucket, object string, reader io.Reader, size int64, opts PutOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dst, err := s.objectPath(bucket, object)
+	if err != nil {
+		return err
+	}
+	return writeFile(dst, reader, size)
+}
+
+// GetObject opens an object and returns its size.
+func (s *LocalStore) GetObject(ctx context.Context, bucket, object string) (io.ReadCloser, ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	src, err := s.objectPath(bucket, object)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if stat.IsDir() {
+		_ = file.Close()
+		return nil, ObjectInfo{}, os.ErrNotExist
+	}
+	return file, ObjectInfo{ObjectName: object, Size: stat.Size()}, nil
+}
+
+// GetObjectRange opens an object positioned at offset.
+func (s *LocalStore) GetObjectRange(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	reader, info, err := s.GetObject(ctx, bucket, object)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	file := reader.(*os.File)
+	if err := checkRange(offset, length, info.Size); err != nil {
+		_ = file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if length < 0 {
+		return file, info, nil
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(file, length), Closer: file}, info, nil
+}
+
+// StatObject returns the size of an object. ETag is left empty: computing it means reading the file.
+func (s *LocalStore) StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	src, err := s.objectPath(bucket, object)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	stat, err := os.Stat(src)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, os.ErrNotExist
+	}
+	return ObjectInfo{ObjectName: object, Size: stat.Size()}, nil
+}
+
+// RemoveObject deletes an object; missing objects are not an error, matching MinIO.
+func (s *LocalStore) RemoveObject(ctx context.Context, bucket, object string) error {
+	target, err := s.objectPath(bucket, object)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ComposeObject concatenates source objects into dest.
+func (s *LocalStore) ComposeObject(ctx context.Context, dest CopyDest, sources ...CopySource) error {
+	dst, err := s.objectPath(dest.Bucket, dest.Object)
+	if err != nil {
+		return err
+	}
+	readers := make([]io.Reader, 0, len(sources))
+	closers := make([]io.Closer, 0, len(sources))
+	defer func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}()
+	for _, src := range sources {
+		reader, _, err := s.GetObject(ctx, src.Bucket, src.Object)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, reader)
+		closers = append(closers, reader)
+	}
+	return writeFile(dst, io.MultiReader(readers...), -1)
+}
+
+// PresignedGetObject returns an HMAC-signed URL served by LocalObjectRoute.
+func (s *LocalStore) PresignedGetObject(ctx context.Context, bucket, object string, expiry time.Duration) (string, error) {
+	return s.PresignedGetObjectWithResponse(ctx, bucket, object, expiry, nil)
+}
+
+// PresignedGetObjectWithResponse returns a signed URL carrying response header overrides.
+func (s *LocalStore) PresignedGetObjectWithResponse(
+	ctx context.Context,
+	bucket,
+	object string,
+	expiry time.Duration,
+	params map[string]string,
+) (string, error) {
+	if _, err := s.objectPath(bucket, object); err != nil {
+		return "", err
+	}
+	values := url.Values{}
+	for key, value := range params {
+		if value == "" {
+			continue
+		}
+		values.Set(key, value)
+	}
+	return s.presign(bucket, object, expiry, values), nil
+}
+
+// PresignedPutObject returns a signed URL that accepts a PUT of the object body.
+func (s *LocalStore) PresignedPutObject(ctx context.Context, bucket, object string, expiry time.Duration, opts PutOptions) (string, error) {
+	if _, err := s.objectPath(bucket, object); err != nil {
+		return "", err
+	}
+	values := url.Values{}
+	values.Set(localMethodParam, http.MethodPut)
+	return s.presign(bucket, object, expiry, values), nil
+}
+
+// presign adds expiry and signature to values and builds the URL.
+func (s *LocalStore) presign(bucket, object string, expiry time.Duration, values url.Values) string {
+	values.Set(localExpiresParam, strconv.FormatInt(time.Now().Add(expiry).Unix(), 10))
+	values.Set(localSignatureParam, s.sign(bucket, object, values))
+
+	segments := strings.Split(object, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return fmt.Sprintf("%s%s/%s/%s?%s",
+		s.baseURL, LocalObjectRoute, url.PathEscape(bucket), strings.Join(segments, "/"), values.Encode())
+}
+
+// VerifyPresigned checks the signature and expiry of a presigned GET query.
+func (s *LocalStore) VerifyPresigned(bucket, object string, query url.Values, now time.Time) error {
+	return s.verifyPresigned(http.MethodGet, bucket, object, query, now)
+}
+
+// VerifyPresignedPut checks the signature and expiry of a presigned PUT query.
+func (s *LocalStore) VerifyPresignedPut(bucket, object string, query url.Values, now time.Time) error {
+	return s.verifyPresigned(http.MethodPut, bucket, object, query, now)
+}
+
+func (s *LocalStore) verifyPresigned(method, bucket, object string, query url.Values, now time.Time) error {
+	signed := query.Get(localMethodParam)
+	if signed == "" {
+		signed = http.MethodGet
+	}
+	if signed != method {
+		return ErrPresignSignature
+	}
+	expires, err := strconv.ParseInt(query.Get(localExpiresParam), 10, 64)
+	if err != nil {
+		return ErrPresignSignature
+	}
+	expected := s.sign(bucket, object, query)
+	if !hmac.Equal([]byte(expected), []byte(query.Get(localSignatureParam))) {
+		return ErrPresignSignature
+	}
+	if now.Unix() > expires {
+		return ErrPresignExpired
+	}
+	return nil
+}
+
+// sign computes the HMAC over bucket, object and all query params except the signature.
+func (s *LocalStore) sign(bucket, object string, values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if key == localSignatureParam {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(bucket + "\n" + object + "\n"))
+	for _, key := range keys {
+		mac.Write([]byte(key + "=" + values.Get(key) + "\n"))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// InitLocal initializes the local filesystem store as Default. LOCAL_STORAGE_SECRET is required;
+// it must differ from JWT_SECRET so a leak of one key does not forge the other.
+func InitLocal() {
+	secret := config.AppConfig.LocalStorageSecret
+	if secret == "" {
+		log.Fatalln("local storage error: LOCAL_STORAGE_SECRET is required")
+	}
+	if secret == config.AppConfig.JWTSecret {
+		log.Fatalln("local storage error: LOCAL_STORAGE_SECRET must differ from JWT_SECRET")
+	}
+	store, err := NewLocalStore(config.AppConfig.LocalStorageRoot, secret, config.AppConfig.LocalStorageBaseURL)
+	if err != nil {
+		log.Fatalln("local storage error:", err)
+	}
+	Default = store
+	log.Printf("local storage initialized at %s", store.Root())
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements Store in process memory. It is meant for hermetic tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewMemoryStore builds an empty in-memory Store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string][]byte)}
+}
+
+func memoryKey(bucket, object string) string {
+	return bucket + "/" + object
+}
+
+// PutObject stores a copy of the reader's content.
+func (s *MemoryStore) PutObject(ctx context.Context, bucket, object string, reader io.Reader, size int64, opts PutOptions) error {
+	if bucket == "" || object == "" {
+		return ErrInvalidObjectName
+	}
+	src := reader
+	if size >= 0 {
+		src = io.LimitReader(reader, size)
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("short write: expected %d bytes, got %d", size, len(data))
+	}
+	s.mu.Lock()
+	s.objects[memoryKey(bucket, object)] = data
+	s.mu.Unlock()
+	return nil
+}
+
+// GetObject returns a reader over a stored object.
+func (s *MemoryStore) GetObject(ctx context.Context, bucket, object string) (io.ReadCloser, ObjectInfo, error) {
+	s.mu.RLock()
+	data, ok := s.objects[memoryKey(bucket, object)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ObjectInfo{}, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), ObjectInfo{ObjectName: object, Size: int64(len(data))}, nil
+}
+
+// GetObjectRange returns a reader over part of a stored object.
+func (s *MemoryStore) GetObjectRange(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	s.mu.RLock()
+	data, ok := s.objects[memoryKey(bucket, object)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ObjectInfo{}, os.ErrNotExist
+	}
+	size := int64(len(data))
+	if err := checkRange(offset, length, size); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	end := size
+	if length >= 0 {
+		end = offset + length
+	}
+	return io.NopCloser(bytes.NewReader(data[offset:end])), ObjectInfo{ObjectName: object, Size: size}, nil
+}
+
+// RemoveObject deletes an object; missing objects are ignored.
+func (s *MemoryStore) RemoveObject(ctx context.Context, bucket, object string) error {
+	s.mu.Lock()
+	delete(s.objects, memoryKey(bucket, object))
+	s.mu.Unlock()
+	return nil
+}
+
+// ComposeObject concatenates source objects into dest.
+func (s *MemoryStore) ComposeObject(ctx context.Context, dest CopyDest, sources ...CopySource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var buf bytes.Buffer
+	for _, src := range sources {
+		data, ok := s.objects[memoryKey(src.Bucket, src.Object)]
+		if !ok {
+			return fmt.Errorf("compose source %s/%s: %w", src.Bucket, src.Object, os.ErrNotExist)
+		}
+		buf.Write(data)
+	}
+	s.objects[memoryKey(dest.Bucket, dest.Object)] = buf.Bytes()
+	return nil
+}
+
+// PresignedGetObject returns a memory:// URL; it is only useful for assertions.
+func (s *MemoryStore) PresignedGetObject(ctx context.Context, bucket, object string, expiry time.Duration) (string, error) {
+	return s.PresignedGetObjectWithResponse(ctx, bucket, object, expiry, nil)
+}
+
+// PresignedGetObjectWithResponse returns a memory:// URL carrying the response params.
+func (s *MemoryStore) PresignedGetObjectWithResponse(
+	ctx context.Context,
+	bucket,
+	object string,
+	expiry time.Duration,
+	params map[string]string,
+) (string, error) {
+	values := url.Values{}
+	for key, value := range params {
+		if value == "" {
+			continue
+		}
+		values.Set(key, value)
+	}
+	values.Set(localExpiresParam, fmt.Sprintf("%d", time.Now().Add(expiry).Unix()))
+	u := url.URL{Scheme: "memory", Host: bucket, Path: "/" + object, RawQuery: values.Encode()}
+	return u.String(), nil
+}
+
+// PresignedPutObject returns a memory:// URL for PUT; tests write the object with PutObject.
+func (s *MemoryStore) PresignedPutObject(ctx context.Context, bucket, object string, expiry time.Duration, opts PutOptions) (string, error) {
+	return s.PresignedGetObjectWithResponse(ctx, bucket, object, expiry, map[string]string{localMethodParam: http.MethodPut})
+}
+
+// StatObject returns the size and md5 ETag of a stored object.
+func (s *MemoryStore) StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	s.mu.RLock()
+	data, ok := s.objects[memoryKey(bucket, object)]
+	s.mu.RUnlock()
+	if !ok {
+		return ObjectInfo{}, os.ErrNotExist
+	}
+	sum := md5.Sum(data)
+	return ObjectInfo{ObjectName: object, Size: int64(len(data)), ETag: hex.EncodeToString(sum[:])}, nil
+}
+
+// Len returns the number of stored objects.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.objects)
+}
@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"CloudVault/model"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrationMaxAttempts bounds how often one object is retried within a job.
+const migrationMaxAttempts = 3
+
+// MigrationJournal persists migration jobs and their per-object state so a crashed
+// migration resumes where it stopped. DBPlacement implements it.
+type MigrationJournal interface {
+	CreateMigrationJob(ctx context.Context, source, target string, stopBelow int) (*model.MigrationJob, error)
+	UnfinishedMigrationJobs(ctx context.Context) ([]model.MigrationJob, error)
+	SetMigrationJobStatus(ctx context.Context, job *model.MigrationJob, status, errMsg string) error
+	EnqueueMigrationItems(ctx context.Context, job *model.MigrationJob, limit int) (int, error)
+	OpenMigrationItems(ctx context.Context, jobID uint64, limit int) ([]model.MigrationItem, error)
+	RetryMigrationItem(ctx context.Context, item *model.MigrationItem, errMsg string) error
+	CommitMigrationItem(ctx context.Context, item *model.MigrationItem, from, to string) error
+	FinishMigrationItem(ctx context.Context, item *model.MigrationItem, status, errMsg string) error
+}
+
+// CreateMigrationJob returns the unfinished job for source if any, otherwise creates one.
+func (p *DBPlacement) CreateMigrationJob(ctx context.Context, source, target string, stopBelow int) (*model.MigrationJob, error) {
+	var job model.MigrationJob
+	err := p.db.WithContext(ctx).
+		Where("source_node = ? AND status IN ?", source, []string{model.MigrationPending, model.MigrationRunning}).
+		Order("id asc").
+		First(&job).Error
+	if err == nil {
+		return &job, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	job = model.MigrationJob{
+		SourceNode: source,
+		TargetNode: target,
+		Status:     model.MigrationPending,
+		StopBelow:  stopBelow,
+	}
+	if err := p.db.WithContext(ctx).Create(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// UnfinishedMigrationJobs lists pending and running jobs, oldest first.
+func (p *DBPlacement) UnfinishedMigrationJobs(ctx context.Context) ([]model.MigrationJob, error) {
+	var jobs []model.MigrationJob
+	err := p.db.WithContext(ctx).
+		Where("status IN ?", []string{model.MigrationPending, model.MigrationRunning}).
+		Order("id asc").
+		Find(&jobs).Error
+	return jobs, err
+}
+
+// SetMigrationJobStatus updates a job's status; terminal states also set finished_at.
+func (p *DBPlacement) SetMigrationJobStatus(ctx context.Context, job *model.MigrationJob, status, errMsg string) error {
+	updates := map[string]interface{}{
+		"status":    status,
+		"error_msg": errMsg,
+	}
+	if status == model.MigrationCompleted || status == model.MigrationFailed {
+		now := time.Now()
+		updates["finished_at"] = &now
+		job.FinishedAt = &now
+	}
+	if err := p.db.WithContext(ctx).Model(&model.MigrationJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	job.Status = status
+	job.ErrorMsg = errMsg
+	return nil
+}
+
+// EnqueueMigrationItems turns the next source replicas after the job cursor into items.
+// 入队与游标推进在同一事务中 崩溃后不会漏掉或重复入队
+func (p *DBPlacement) EnqueueMigrationItems(ctx context.Context, job *model.MigrationJob, limit int) (int, error) {
+	count := 0
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var replicas []model.ObjectReplica
+		if err := tx.Where("node_name = ? AND id > ?", job.SourceNode, job.Cursor).
+			Order("id asc").
+			Limit(limit).
+			Find(&replicas).Error; err != nil {
+			return err
+		}
+		if len(replicas) == 0 {
+			return nil
+		}
+		items := make([]model.MigrationItem, 0, len(replicas))
+		for _, replica := range replicas {
+			items = append(items, model.MigrationItem{
+				JobID:      job.ID,
+				BucketName: replica.BucketName,
+				ObjectName: replica.ObjectName,
+				Size:       replica.Size,
+				Status:     model.MigrationPending,
+			})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&items).Error; err != nil {
+			return err
+		}
+		cursor := replicas[len(replicas)-1].ID
+		if err := tx.Model(&model.MigrationJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"replica_cursor": cursor,
+			"total":          gorm.Expr("total + ?", len(replicas)),
+		}).Error; err != nil {
+			return err
+		}
+		job.Cursor = cursor
+		job.Total += len(replicas)
+		count = len(replicas)
+		return nil
+	})
+	return count, err
+}
+
+// OpenMigrationItems lists items that still need work.
+func (p *DBPlacement) OpenMigrationItems(ctx context.Context, jobID uint64, limit int) ([]model.MigrationItem, error) {
+	var items []model.MigrationItem
+	err := p.db.WithContext(ctx).
+		Where("job_id = ? AND status IN ?", jobID, []string{model.MigrationPending, model.MigrationItemMoved}).
+		Order("id asc").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+// RetryMigrationItem records a failed attempt and leaves the item pending.
+func (p *DBPlacement) RetryMigrationItem(ctx context.Context, item *model.MigrationItem, errMsg string) error {
+	item.Attempts++
+	item.ErrorMsg = errMsg
+	return p.db.WithContext(ctx).Model(&model.MigrationItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"attempts":  item.Attempts,
+		"error_msg": errMsg,
+	}).Error
+}
+
+// CommitMigrationItem switches the replica to the target node and marks the item moved in one transaction.
+func (p *DBPlacement) CommitMigrationItem(ctx context.Context, item *model.MigrationItem, from, to string) error {
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var replica model.ObjectReplica
+		if err := tx.Where("bucket_name = ? AND object_name = ? AND node_name = ?", item.BucketName, item.ObjectName, from).
+			First(&replica).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&replica).Error; err != nil {
+			return err
+		}
+		if err := addReplica(tx, item.BucketName, item.ObjectName, to, item.Size); err != nil {
+			return err
+		}
+		return tx.Model(&model.MigrationItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+			"status":    model.MigrationItemMoved,
+			"sha256":    item.Sha256,
+			"error_msg": "",
+		}).Error
+	})
+	if err == nil {
+		item.Status = model.MigrationItemMoved
+	}
+	return err
+}
+
+// FinishMigrationItem moves an item to a terminal state and bumps the job counter.
+func (p *DBPlacement) FinishMigrationItem(ctx context.Context, item *model.MigrationItem, status, errMsg string) error {
+	counter := map[string]string{
+		model.MigrationItemDone:    "done",
+		model.MigrationItemSkipped: "skipped",
+		model.MigrationFailed:      "failed",
+	}[status]
+	if counter == "" {
+		return fmt.Errorf("invalid migration item status %q", status)
+	}
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.MigrationItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+			"status":    status,
+			"error_msg": errMsg,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.MigrationJob{}).Where("id = ?", item.JobID).
+			UpdateColumn(counter, gorm.Expr(counter+" + 1")).Error
+	})
+	if err == nil {
+		item.Status = status
+		item.ErrorMsg = errMsg
+	}
+	return err
+}
+
+// migrationJournal returns the journal behind the cluster placement.
+func (sc *StorageCluster) migrationJournal() (MigrationJournal, error) {
+	journal, ok := sc.placement.(MigrationJournal)
+	if !ok {
+		return nil, fmt.Errorf("storage migration journal not configured")
+	}
+	return journal, nil
+}
+
+// StartMigration moves every replica from source to target, persisting progress.
+func (sc *StorageCluster) StartMigration(ctx context.Context, source, target string) (*model.MigrationJob, error) {
+	journal, err := sc.migrationJournal()
+	if err != nil {
+		return nil, err
+	}
+	job, err := journal.CreateMigrationJob(ctx, source, target, 0)
+	if err != nil {
+		return nil, err
+	}
+	return job, sc.runMigrationJob(ctx, journal, job)
+}
+
+// ResumeMigrations continues every job left pending or running, e.g. after a crash.
+func (sc *StorageCluster) ResumeMigrations(ctx context.Context) error {
+	journal, err := sc.migrationJournal()
+	if err != nil {
+		return err
+	}
+	jobs, err := journal.UnfinishedMigrationJobs(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		log.Printf("Resuming migration job %d from %s to %s", jobs[i].ID, jobs[i].SourceNode, jobs[i].TargetNode)
+		if err := sc.runMigrationJob(ctx, journal, &jobs[i]); err != nil {
+			log.Printf("Migration job %d stopped: %v", jobs[i].ID, err)
+		}
+	}
+	return ctx.Err()
+}
+
+// runMigrationJob processes a job until it is drained, the source is below its threshold, or ctx ends.
+// ctx 结束或节点不可用时任务保持 running 下次从未完成的对象继续
+func (sc *StorageCluster) runMigrationJob(ctx context.Context, journal MigrationJournal, job *model.MigrationJob) error {
+	source, target := sc.nodeByName(job.SourceNode), sc.nodeByName(job.TargetNode)
+	if source == nil || target == nil || source == target {
+		return journal.SetMigrationJobStatus(ctx, job, model.MigrationFailed, "source or target node not found")
+	}
+	if !source.IsAvailable() || !target.IsAvailable() {
+		return fmt.Errorf("migration job %d: node %s or %s unavailable", job.ID, source.Name(), target.Name())
+	}
+	if job.Status != model.MigrationRunning {
+		if err := journal.SetMigrationJobStatus(ctx, job, model.MigrationRunning, ""); err != nil {
+			return err
+		}
+	}
+
+	for {
+		items, err := journal.OpenMigrationItems(ctx, job.ID, 100)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			if job.StopBelow > 0 && source.GetUsageRate() <= float64(job.StopBelow) {
+				return journal.SetMigrationJobStatus(ctx, job, model.MigrationCompleted, "")
+			}
+			added, err := journal.EnqueueMigrationItems(ctx, job, 100)
+			if err != nil {
+				return err
+			}
+			if added == 0 {
+				return journal.SetMigrationJobStatus(ctx, job, model.MigrationCompleted, "")
+			}
+			continue
+		}
+		for i := range items {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := sc.migrateItem(ctx, journal, &items[i], source, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// migrateItem advances one object: copy and verify, switch placement, then delete the source.
+// 只有数据库错误会中断任务 对象级错误记录在 item 上
+func (sc *StorageCluster) migrateItem(ctx context.Context, journal MigrationJournal, item *model.MigrationItem, source, target *StorageNode) error {
+	if item.Status == model.MigrationPending {
+		onSource, err := sc.holdsReplica(ctx, item.BucketName, item.ObjectName, source)
+		if err != nil {
+			return err
+		}
+		onTarget, err := sc.holdsReplica(ctx, item.BucketName, item.ObjectName, target)
+		if err != nil {
+			return err
+		}
+		if !onSource || onTarget { // 对象已删除 或目标节点已有副本 迁过去会少一份副本
+			return journal.FinishMigrationItem(ctx, item, model.MigrationItemSkipped, "")
+		}
+
+		sum, err := copyVerified(ctx, item, source, target)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			_ = target.Store.RemoveObject(ctx, item.BucketName, item.ObjectName)
+			if err := journal.RetryMigrationItem(ctx, item, err.Error()); err != nil {
+				return err
+			}
+			if item.Attempts >= migrationMaxAttempts {
+				log.Printf("Failed to migrate object %s: %s", item.ObjectName, item.ErrorMsg)
+				return journal.FinishMigrationItem(ctx, item, model.MigrationFailed, item.ErrorMsg)
+			}
+			return nil
+		}
+		item.Sha256 = sum
+		if err := journal.CommitMigrationItem(ctx, item, source.Name(), target.Name()); err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			// 复制期间对象被删除 源副本记录已不存在 删除目标上的拷贝后跳过
+			if err := sc.dropMigrationCopy(ctx, item, target); err != nil {
+				return err
+			}
+			return journal.FinishMigrationItem(ctx, item, model.MigrationItemSkipped, "source replica removed during copy")
+		}
+		// 更新节点使用
+		source.UpdateUsedSize(-item.Size)
+		target.UpdateUsedSize(item.Size)
+	}
+
+	// 从源节点删除对象 placement 已指向目标节点 删除失败只会留下孤儿对象
+	errMsg := ""
+	if err := source.Store.RemoveObject(ctx, item.BucketName, item.ObjectName); err != nil {
+		errMsg = "remove source replica: " + err.Error()
+		log.Printf("Failed to remove object %s from source: %v", item.ObjectName, err)
+	}
+	if err := journal.FinishMigrationItem(ctx, item, model.MigrationItemDone, errMsg); err != nil {
+		return err
+	}
+	log.Printf("Successfully migrated object %s from %s to %s", item.ObjectName, source.Name(), target.Name())
+	return nil
+}
+
+// dropMigrationCopy removes the copy written to target unless target has since been recorded as
+// holding a replica of the object.
+func (sc *StorageCluster) dropMigrationCopy(ctx context.Context, item *model.MigrationItem, target *StorageNode) error {
+	held, err := sc.holdsReplica(ctx, item.BucketName, item.ObjectName, target)
+	if err != nil || held {
+		return err
+	}
+	if err := target.Store.RemoveObject(ctx, item.BucketName, item.ObjectName); err != nil {
+		log.Printf("Failed to remove copy of %s from target: %v", item.ObjectName, err)
+	}
+	return nil
+}
+
+// copyVerified copies an object and reads the target copy back, comparing size and SHA-256.
+func copyVerified(ctx context.Context, item *model.MigrationItem, source, target *StorageNode) (string, error) {
+	reader, info, err := source.Store.GetObject(ctx, item.BucketName, item.ObjectName)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	if info.Size != item.Size {
+		return "", fmt.Errorf("source size %d does not match recorded size %d", info.Size, item.Size)
+	}
+	srcHash := sha256.New()
+	if err := target.Store.PutObject(ctx, item.BucketName, item.ObjectName, io.TeeReader(reader, srcHash), info.Size, PutOptions{}); err != nil {
+		return "", err
+	}
+	srcSum := hex.EncodeToString(srcHash.Sum(nil))
+
+	// 回读目标副本校验
+	copied, copiedInfo, err := target.Store.GetObject(ctx, item.BucketName, item.ObjectName)
+	if err != nil {
+		return "", err
+	}
+	defer copied.Close()
+	dstHash := sha256.New()
+	n, err := io.Copy(dstHash, copied)
+	if err != nil {
+		return "", err
+	}
+	if n != info.Size || copiedInfo.Size != info.Size {
+		return "", fmt.Errorf("size mismatch after copy: source %d, target %d", info.Size, n)
+	}
+	if dstSum := hex.EncodeToString(dstHash.Sum(nil)); dstSum != srcSum {
+		return "", fmt.Errorf("sha256 mismatch after copy: source %s, target %s", srcSum, dstSum)
+	}
+	return srcSum, nil
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"log"
 	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/minio/minio-go/v7"
@@ -21,6 +23,7 @@ type MinIOStorage struct {
 type ObjectInfo struct {
 	ObjectName string
 	Size       int64
+	ETag       string // 单次 PUT 写入的对象为内容的 md5 hex 其余情况可能为空或不是 md5
 }
 
 // MinioStore implements Store with a MinIO client.
@@ -59,6 +62,35 @@ func (s *MinioStore) GetObject(ctx context.Context, bucket, object string) (io.R
 	return obj, info, nil
 }
 
+// GetObjectRange fetches part of an object with a ranged GET.
+func (s *MinioStore) GetObjectRange(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	info, err := s.StatObject(ctx, bucket, object) // 带 Range 的响应只有分段长度 总大小先 Stat
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	if err := checkRange(offset, length, info.Size); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	if length == 0 || offset == info.Size {
+		return io.NopCloser(strings.NewReader("")), info, nil
+	}
+	opts := minio.GetObjectOptions{}
+	switch {
+	case length >= 0:
+		err = opts.SetRange(offset, offset+length-1)
+	case offset > 0: // SetRange(0, 0) 表示第一个字节 读全部时不设置 Range
+		err = opts.SetRange(offset, 0)
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	obj, err := s.client.GetObject(ctx, bucket, object, opts)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return obj, info, nil
+}
+
 // RemoveObject deletes an object from MinIO.
 func (s *MinioStore) RemoveObject(ctx context.Context, bucket, object string) error {
 	return s.client.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{})
@@ -95,6 +127,31 @@ func (s *MinioStore) PresignedGetObjectWithResponse(
 	return url.String(), nil
 }
 
+// PresignedPutObject returns a presigned URL for uploading an object directly to MinIO.
+func (s *MinioStore) PresignedPutObject(ctx context.Context, bucket, object string, expiry time.Duration, opts PutOptions) (string, error) {
+	url, err := s.client.PresignedPutObject(ctx, bucket, object, expiry)
+	if err != nil {
+		return "", err
+	}
+	return url.String(), nil
+}
+
+// StatObject returns the size and ETag of an object without reading it.
+func (s *MinioStore) StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	stat, err := s.client.StatObject(ctx, bucket, object, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ObjectInfo{}, fmt.Errorf("%s/%s: %w", bucket, object, os.ErrNotExist)
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		ObjectName: object,
+		Size:       stat.Size,
+		ETag:       strings.Trim(stat.ETag, `"`),
+	}, nil
+}
+
 // ComposeObject composes multiple source objects into a single destination object.
 func (s *MinioStore) ComposeObject(ctx context.Context, dest CopyDest, sources ...CopySource) error {
 	srcs := make([]minio.CopySrcOptions, 0, len(sources))
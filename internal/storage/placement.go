@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"CloudVault/model"
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Placement persists which storage nodes hold a replica of each object.
+type Placement interface {
+	Replicas(ctx context.Context, bucket, object string) ([]model.ObjectReplica, error)
+	AddReplica(ctx context.Context, bucket, object, node string, size int64) error
+	RemoveReplica(ctx context.Context, bucket, object, node string) error
+	ReplicasOnNode(ctx context.Context, node string, afterID uint64, limit int) ([]model.ObjectReplica, error)
+	NodeUsage(ctx context.Context) (map[string]int64, error)
+}
+
+// DBPlacement stores placement in the object_replica table.
+type DBPlacement struct {
+	db *gorm.DB
+}
+
+// NewDBPlacement builds a Placement backed by db.
+func NewDBPlacement(db *gorm.DB) *DBPlacement {
+	return &DBPlacement{db: db}
+}
+
+// Replicas lists the replicas of an object, oldest first.
+func (p *DBPlacement) Replicas(ctx context.Context, bucket, object string) ([]model.ObjectReplica, error) {
+	var replicas []model.ObjectReplica
+	err := p.db.WithContext(ctx).
+		Where("bucket_name = ? AND object_name = ?", bucket, object).
+		Order("id asc").
+		Find(&replicas).Error
+	return replicas, err
+}
+
+// AddReplica records a replica; re-adding an existing one refreshes its size.
+func (p *DBPlacement) AddReplica(ctx context.Context, bucket, object, node string, size int64) error {
+	return addReplica(p.db.WithContext(ctx), bucket, object, node, size)
+}
+
+func addReplica(db *gorm.DB, bucket, object, node string, size int64) error {
+	replica := model.ObjectReplica{
+		BucketName: bucket,
+		ObjectName: object,
+		NodeName:   node,
+		Size:       size,
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "bucket_name"}, {Name: "object_name"}, {Name: "node_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"size", "updated_at"}),
+	}).Create(&replica).Error; err != nil {
+		return err
+	}
+	// 同名对象重新写入该节点 之前的待删除记录作废 否则清理时会删掉新副本
+	return db.Where("bucket_name = ? AND object_name = ? AND node_name = ?", bucket, object, node).
+		Delete(&model.ReplicaTombstone{}).Error
+}
+
+// RemoveReplica forgets the replica held by node. Empty node removes every replica.
+func (p *DBPlacement) RemoveReplica(ctx context.Context, bucket, object, node string) error {
+	query := p.db.WithContext(ctx).Where("bucket_name = ? AND object_name = ?", bucket, object)
+	if node != "" {
+		query = query.Where("node_name = ?", node)
+	}
+	return query.Delete(&model.ObjectReplica{}).Error
+}
+
+// ReplicasOnNode pages through the replicas held by node in id order.
+func (p *DBPlacement) ReplicasOnNode(ctx context.Context, node string, afterID uint64, limit int) ([]model.ObjectReplica, error) {
+	var replicas []model.ObjectReplica
+	err := p.db.WithContext(ctx).
+		Where("node_name = ? AND id > ?", node, afterID).
+		Order("id asc").
+		Limit(limit).
+		Find(&replicas).Error
+	return replicas, err
+}
+
+// NodeUsage sums replica sizes per node, including replicas still waiting to be deleted.
+func (p *DBPlacement) NodeUsage(ctx context.Context) (map[string]int64, error) {
+	usage := make(map[string]int64)
+	for _, table := range []interface{}{&model.ObjectReplica{}, &model.ReplicaTombstone{}} {
+		var rows []struct {
+			NodeName string
+			Total    int64
+		}
+		if err := p.db.WithContext(ctx).Model(table).
+			Select("node_name, COALESCE(SUM(size), 0) AS total").
+			Group("node_name").
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			usage[row.NodeName] += row.Total
+		}
+	}
+	return usage, nil
+}
+
+// ReplicaTombstones persists replicas of removed objects that still have to be deleted from
+// their nodes. DBPlacement implements it.
+type ReplicaTombstones interface {
+	BuryReplica(ctx context.Context, replica model.ObjectReplica) error
+	Tombstones(ctx context.Context, afterID uint64, limit int) ([]model.ReplicaTombstone, error)
+	ForgetTombstone(ctx context.Context, tombstone model.ReplicaTombstone) error
+}
+
+// BuryReplica drops the placement record of a replica and records it for deferred deletion in one transaction.
+func (p *DBPlacement) BuryReplica(ctx context.Context, replica model.ObjectReplica) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bucket_name = ? AND object_name = ? AND node_name = ?",
+			replica.BucketName, replica.ObjectName, replica.NodeName).
+			Delete(&model.ObjectReplica{}).Error; err != nil {
+			return err
+		}
+		tombstone := model.ReplicaTombstone{
+			BucketName: replica.BucketName,
+			ObjectName: replica.ObjectName,
+			NodeName:   replica.NodeName,
+			Size:       replica.Size,
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "bucket_name"}, {Name: "object_name"}, {Name: "node_name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"size", "updated_at"}),
+		}).Create(&tombstone).Error
+	})
+}
+
+// Tombstones pages through the replicas waiting to be deleted in id order.
+func (p *DBPlacement) Tombstones(ctx context.Context, afterID uint64, limit int) ([]model.ReplicaTombstone, error) {
+	var tombstones []model.ReplicaTombstone
+	err := p.db.WithContext(ctx).
+		Where("id > ?", afterID).
+		Order("id asc").
+		Limit(limit).
+		Find(&tombstones).Error
+	return tombstones, err
+}
+
+// ForgetTombstone removes the record of a replica that has been deleted.
+func (p *DBPlacement) ForgetTombstone(ctx context.Context, tombstone model.ReplicaTombstone) error {
+	return p.db.WithContext(ctx).Delete(&model.ReplicaTombstone{}, tombstone.ID).Error
+}
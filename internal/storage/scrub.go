@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// ScrubResult describes the replicas of one object after a scrub pass.
+type ScrubResult struct {
+	Healthy     []string          `json:"healthy"`     // 校验通过的节点
+	Repaired    []string          `json:"repaired"`    // 从健康副本重新复制的节点
+	Broken      map[string]string `json:"broken"`      // 缺失或损坏且未修复的节点 -> 原因
+	Unreachable []string          `json:"unreachable"` // 不可用 本轮无法校验的节点
+}
+
+// Unrecoverable reports whether no good copy is left anywhere reachable or not.
+func (r *ScrubResult) Unrecoverable() bool {
+	return len(r.Healthy) == 0 && len(r.Repaired) == 0 && len(r.Unreachable) == 0
+}
+
+// Problem summarizes the broken replicas, e.g. for logs and reports.
+func (r *ScrubResult) Problem() string {
+	parts := make([]string, 0, len(r.Broken))
+	for node, reason := range r.Broken {
+		parts = append(parts, node+": "+reason)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// IsSHA256Hex reports whether s looks like a hex SHA-256 digest.
+func IsSHA256Hex(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// VerifyObject reads an object fully and checks its size and, when sha is a SHA-256 digest, its content.
+func VerifyObject(ctx context.Context, store Store, bucket, object string, size int64, sha string) error {
+	reader, info, err := store.GetObject(ctx, bucket, object)
+	if err != nil {
+		return fmt.Errorf("missing: %w", err)
+	}
+	defer reader.Close()
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, reader)
+	if err != nil {
+		return fmt.Errorf("read failed: %w", err)
+	}
+	if n != size || info.Size != size {
+		return fmt.Errorf("size mismatch: expected %d, got %d", size, n)
+	}
+	if IsSHA256Hex(sha) {
+		if sum := hex.EncodeToString(hasher.Sum(nil)); !strings.EqualFold(sum, sha) {
+			return fmt.Errorf("sha256 mismatch: expected %s, got %s", sha, sum)
+		}
+	}
+	return nil
+}
+
+// ScrubObject verifies every replica of an object, repairs broken or missing ones from a
+// healthy copy and tops the object back up to ReplicaCount copies.
+// hash 是 file_object.hash 既用于选点 也在是 SHA-256 时用于内容校验
+func (sc *StorageCluster) ScrubObject(ctx context.Context, bucket, object string, size int64, hash string) (*ScrubResult, error) {
+	result := &ScrubResult{Broken: make(map[string]string)}
+	replicas, err := sc.replicas(ctx, bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]*StorageNode, 0, len(sc.Nodes))
+	if len(replicas) == 0 { // 没有 placement 记录 在所有节点上找
+		candidates = append(candidates, sc.Nodes...)
+	} else {
+		for _, replica := range replicas {
+			if node := sc.nodeByName(replica.NodeName); node != nil {
+				candidates = append(candidates, node)
+			}
+		}
+	}
+
+	var source *StorageNode
+	var broken []*StorageNode
+	for _, node := range candidates {
+		if !node.IsAvailable() {
+			result.Unreachable = append(result.Unreachable, node.Name())
+			continue
+		}
+		if err := VerifyObject(ctx, node.Store, bucket, object, size, hash); err != nil {
+			if len(replicas) > 0 { // 没有记录时其余节点本就没有该对象
+				result.Broken[node.Name()] = err.Error()
+				broken = append(broken, node)
+			}
+			continue
+		}
+		result.Healthy = append(result.Healthy, node.Name())
+		if source == nil {
+			source = node
+		}
+		if len(replicas) == 0 {
+			if err := sc.recordReplica(ctx, bucket, object, node, size); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if source == nil {
+		if len(replicas) == 0 && len(result.Unreachable) == 0 {
+			result.Broken["*"] = "no replica found on any node"
+		}
+		return result, nil
+	}
+
+	for _, node := range broken {
+		if err := sc.repairReplica(ctx, bucket, object, size, hash, source, node); err != nil {
+			result.Broken[node.Name()] += "; repair failed: " + err.Error()
+			continue
+		}
+		delete(result.Broken, node.Name())
+		result.Repaired = append(result.Repaired, node.Name())
+	}
+
+	// 副本数不足时补齐到新节点 不可用节点上的副本仍计入 避免节点短暂下线引发大量复制
+	have := len(result.Healthy) + len(result.Repaired) + len(result.Unreachable)
+	want := sc.replicaCount()
+	if have >= want {
+		return result, nil
+	}
+	held := make(map[string]bool, len(candidates))
+	for _, node := range candidates {
+		held[node.Name()] = true
+	}
+	targets, err := sc.selectReplicaNodes(placementKey(hash, object), len(sc.Nodes))
+	if err != nil {
+		return result, nil
+	}
+	for _, node := range targets {
+		if have >= want {
+			break
+		}
+		if held[node.Name()] {
+			continue
+		}
+		if err := sc.repairReplica(ctx, bucket, object, size, hash, source, node); err != nil {
+			log.Printf("scrub: add replica of %s on %s failed: %v", object, node.Name(), err)
+			continue
+		}
+		result.Repaired = append(result.Repaired, node.Name())
+		have++
+	}
+	return result, nil
+}
+
+// repairReplica copies a verified object from source to target, verifies it and records placement.
+func (sc *StorageCluster) repairReplica(ctx context.Context, bucket, object string, size int64, hash string, source, target *StorageNode) error {
+	written, err := sc.copyReplica(ctx, bucket, object, source, target)
+	if err != nil {
+		return err
+	}
+	if err := VerifyObject(ctx, target.Store, bucket, object, size, hash); err != nil {
+		_ = target.Store.RemoveObject(ctx, bucket, object)
+		return err
+	}
+	held, err := sc.holdsReplica(ctx, bucket, object, target)
+	if err != nil {
+		return err
+	}
+	if !held {
+		target.UpdateUsedSize(written)
+	}
+	return sc.recordReplica(ctx, bucket, object, target, written)
+}
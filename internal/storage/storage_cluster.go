@@ -16,6 +16,7 @@ import (
 type StorageNode struct {
 	Cluster config.MinioClusterConfig
 	Client  *minio.Client
+	Store   Store // 节点上的对象读写 MinIO 节点即 MinioStore
 	mu      sync.RWMutex
 }
 
@@ -24,6 +25,8 @@ type StorageCluster struct {
 	Nodes      []*StorageNode
 	currentIdx int // 用于轮询
 	mu         sync.Mutex
+	placement  Placement // 记录每个对象的副本所在节点 为空时不做记录
+	ring       *hashRing // hash 策略使用的一致性哈希环 节点变化时重建
 }
 
 var globalStorageCluster *StorageCluster
@@ -69,9 +72,38 @@ func NewStorageNode(clusterConfig config.MinioClusterConfig) (*StorageNode, erro
 	return &StorageNode{
 		Cluster: clusterConfig,
 		Client:  client,
+		Store:   NewMinioStore(client),
 	}, nil
 }
 
+// NewStorageNodeWithStore builds a node on top of an arbitrary Store, e.g. MemoryStore in tests.
+func NewStorageNodeWithStore(clusterConfig config.MinioClusterConfig, store Store) *StorageNode {
+	return &StorageNode{
+		Cluster: clusterConfig,
+		Store:   store,
+	}
+}
+
+// NewStorageCluster builds a cluster from nodes; placement may be nil.
+func NewStorageCluster(nodes []*StorageNode, placement Placement) *StorageCluster {
+	return &StorageCluster{
+		Nodes:     nodes,
+		placement: placement,
+	}
+}
+
+// SetPlacement sets where replica locations are persisted.
+func (sc *StorageCluster) SetPlacement(placement Placement) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.placement = placement
+}
+
+// Name returns the node name used in placement records.
+func (sn *StorageNode) Name() string {
+	return sn.Cluster.Name
+}
+
 // GetStorageCluster 获取存储集群实例
 func GetStorageCluster() *StorageCluster {
 	if globalStorageCluster == nil {
@@ -86,7 +118,11 @@ func GetStorageCluster() *StorageCluster {
 func (sc *StorageCluster) SelectNode() (*StorageNode, error) {
 	sc.mu.Lock()
 	defer sc.mu.Unlock()
+	return sc.selectLocked("")
+}
 
+// selectLocked picks a node by the configured strategy; sc.mu must be held.
+func (sc *StorageCluster) selectLocked(key string) (*StorageNode, error) {
 	if len(sc.Nodes) == 0 {
 		return nil, fmt.Errorf("no available storage nodes")
 	}
@@ -97,7 +133,7 @@ func (sc *StorageCluster) SelectNode() (*StorageNode, error) {
 	case "least_conn":
 		return sc.selectLeastConn()
 	case "hash":
-		return sc.selectHash()
+		return sc.selectHash(key)
 	default:
 		return sc.selectRoundRobin()
 	}
@@ -143,10 +179,29 @@ func (sc *StorageCluster) selectLeastConn() (*StorageNode, error) {
 }
 
 // selectHash 基于哈希选择节点
-func (sc *StorageCluster) selectHash() (*StorageNode, error) {
-	// 这里简化实现，实际应该根据文件hash或其他key进行哈希
-	// 暂时使用轮询
-	return sc.selectRoundRobin()
+// key 为文件内容 hash 同一 hash 总是落到同一主节点
+func (sc *StorageCluster) selectHash(key string) (*StorageNode, error) {
+	if key == "" { // 没有 key 无法哈希 退回轮询
+		return sc.selectRoundRobin()
+	}
+	nodes := sc.ringLocked().lookup(key, 1)
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no available storage nodes")
+	}
+	return nodes[0], nil
+}
+
+// ringLocked returns the hash ring, rebuilding it when Nodes changed; sc.mu must be held.
+func (sc *StorageCluster) ringLocked() *hashRing {
+	if !sc.ring.matches(sc.Nodes) {
+		sc.ring = newHashRing(sc.Nodes)
+	}
+	return sc.ring
+}
+
+// usesHashPlacement reports whether the hash strategy is configured.
+func usesHashPlacement() bool {
+	return config.StorageConfigInstance != nil && config.StorageConfigInstance.LoadBalanceStrategy == "hash"
 }
 
 // IsAvailable 检查节点是否可
@@ -189,57 +244,19 @@ func (sc *StorageCluster) UploadFileWithReplication(
 	size int64,
 	opts minio.PutObjectOptions,
 ) error {
-	// 获取副本
-	replicaCount := config.StorageConfigInstance.ReplicaCount
-	if replicaCount > len(sc.Nodes) {
-		replicaCount = len(sc.Nodes)
-	}
-
-	// 上传到第一个节点
-	firstNode, err := sc.SelectNode()
-	if err != nil {
-		return err
-	}
-
-	_, err = firstNode.Client.PutObject(ctx, bucketName, objectName, reader, size, opts)
-	if err != nil {
-		return err
-	}
-
-	// 更新节点使用量
-	firstNode.UpdateUsedSize(size)
-
-	// 上传到其他节点（副本）
-	for i := 1; i < replicaCount; i++ {
-		node, err := sc.SelectNode()
-		if err != nil {
-			log.Printf("Failed to select node for replica %d: %v", i, err)
-			continue
-		}
-
-		// 重置reader位置
-		if _, err := reader.Seek(0, 0); err != nil {
-			log.Printf("Failed to seek reader for replica %d: %v", i, err)
-			continue
-		}
-
-		_, err = node.Client.PutObject(ctx, bucketName, objectName, reader, size, opts)
-		if err != nil {
-			log.Printf("Failed to upload replica %d: %v", i, err)
-			continue
-		}
-
-		// 更新节点使用
-		node.UpdateUsedSize(size)
-	}
-
-	return nil
+	// 副本写入与 ClusterStore.PutObject 相同 并记录到 placement
+	return sc.putReplicated(ctx, bucketName, objectName, reader, size, PutOptions{ContentType: opts.ContentType})
 }
 
 // CheckAndMigrate 检查并迁移文件
 func (sc *StorageCluster) CheckAndMigrate(ctx context.Context) error {
 	threshold := config.StorageConfigInstance.MigrationThreshold
 
+	// 先继续上次未完成的迁移任务
+	if err := sc.ResumeMigrations(ctx); err != nil {
+		log.Printf("Failed to resume migrations: %v", err)
+	}
+
 	for _, node := range sc.Nodes {
 		usageRate := node.GetUsageRate()
 		if usageRate > float64(threshold) {
@@ -270,50 +287,18 @@ func (sc *StorageCluster) CheckAndMigrate(ctx context.Context) error {
 }
 
 // migrateFiles 迁移文件
+// 迁移以任务形式持久化 每个对象校验大小与 SHA-256 后才切换 placement 并删除源副本
+// 源节点使用率回落到阈值以下即停止
 func (sc *StorageCluster) migrateFiles(ctx context.Context, sourceNode, targetNode *StorageNode) error {
-	bucketName := config.AppConfig.BucketName
-
-	// 列出源节点的所有对
-	objectsCh := sourceNode.Client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{})
-
-	for object := range objectsCh {
-		if object.Err != nil {
-			log.Printf("Error listing object: %v", object.Err)
-			continue
-		}
-
-		// 从源节点获取对象
-		src, err := sourceNode.Client.GetObject(ctx, bucketName, object.Key, minio.GetObjectOptions{})
-		if err != nil {
-			log.Printf("Failed to get object %s: %v", object.Key, err)
-			continue
-		}
-
-		// 上传到目标节
-		_, err = targetNode.Client.PutObject(ctx, bucketName, object.Key, src, object.Size, minio.PutObjectOptions{})
-		if err != nil {
-			log.Printf("Failed to upload object %s to target: %v", object.Key, err)
-			src.Close()
-			continue
-		}
-		src.Close()
-
-		// 从源节点删除对象
-		err = sourceNode.Client.RemoveObject(ctx, bucketName, object.Key, minio.RemoveObjectOptions{})
-		if err != nil {
-			log.Printf("Failed to remove object %s from source: %v", object.Key, err)
-			continue
-		}
-
-		// 更新节点使用
-		sourceNode.UpdateUsedSize(-object.Size)
-		targetNode.UpdateUsedSize(object.Size)
-
-		log.Printf("Successfully migrated object %s from %s to %s",
-			object.Key, sourceNode.Cluster.Name, targetNode.Cluster.Name)
+	journal, err := sc.migrationJournal()
+	if err != nil {
+		return err
 	}
-
-	return nil
+	job, err := journal.CreateMigrationJob(ctx, sourceNode.Name(), targetNode.Name(), config.StorageConfigInstance.MigrationThreshold)
+	if err != nil {
+		return err
+	}
+	return sc.runMigrationJob(ctx, journal, job)
 }
 
 // StartMigrationMonitor 启动迁移监控
@@ -324,6 +309,11 @@ func StartMigrationMonitor(ctx context.Context, interval time.Duration) {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
+		// 启动时立即继续崩溃前未完成的迁移任务
+		if err := cluster.ResumeMigrations(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Resume migrations failed: %v", err)
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -1,16 +1,27 @@
 ﻿package storage
 
 import (
+	"CloudVault/config"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"time"
 )
 
+// ErrInvalidRange is returned when a requested range lies outside the object.
+var ErrInvalidRange = errors.New("invalid object range")
+
 // PutOptions describes upload options for object storage.
 type PutOptions struct {
 	ContentType string
+	Hash        string // 文件内容 hash 集群按它选择副本节点 分片传所属文件的 hash 以便同节点合并
 }
 
+// MinComposePartSize is the smallest size S3-compatible stores accept for a ComposeObject
+// source other than the last one.
+const MinComposePartSize = 5 << 20
+
 // CopySource describes a source object for server-side composition.
 type CopySource struct {
 	Bucket string
@@ -21,6 +32,7 @@ type CopySource struct {
 type CopyDest struct {
 	Bucket string
 	Object string
+	Hash   string // 合并后文件的内容 hash 用于集群选点
 }
 
 // ReaderAtSeeker combines reader and seeker for object uploads.
@@ -29,13 +41,32 @@ type ReaderAtSeeker interface {
 	io.Seeker
 }
 
+// checkRange validates offset and length against an object of size bytes.
+func checkRange(offset, length, size int64) error {
+	if offset < 0 || offset > size || (length >= 0 && offset+length > size) {
+		return fmt.Errorf("%w: offset %d length %d size %d", ErrInvalidRange, offset, length, size)
+	}
+	return nil
+}
+
+// limitedReadCloser closes the underlying object of a limited reader.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
 // Store abstracts object storage operations.
 type Store interface {
 	PutObject(ctx context.Context, bucket, object string, reader io.Reader, size int64, opts PutOptions) error
 	GetObject(ctx context.Context, bucket, object string) (io.ReadCloser, ObjectInfo, error)
+	// GetObjectRange reads length bytes from offset (length < 0 reads to the end);
+	// info.Size is the size of the whole object.
+	GetObjectRange(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, ObjectInfo, error)
 	RemoveObject(ctx context.Context, bucket, object string) error
 	PresignedGetObject(ctx context.Context, bucket, object string, expiry time.Duration) (string, error)
 	PresignedGetObjectWithResponse(ctx context.Context, bucket, object string, expiry time.Duration, params map[string]string) (string, error)
+	PresignedPutObject(ctx context.Context, bucket, object string, expiry time.Duration, opts PutOptions) (string, error)
+	StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error)
 	ComposeObject(ctx context.Context, dest CopyDest, sources ...CopySource) error
 }
 
@@ -44,3 +75,15 @@ var Default Store
 
 // DefaultTest is the test object store instance.
 var DefaultTest Store
+
+// InitStorage initializes Default according to STORAGE_BACKEND (minio, local or cluster).
+func InitStorage() {
+	switch config.AppConfig.StorageBackend {
+	case "local":
+		InitLocal()
+	case "cluster":
+		InitCluster()
+	default:
+		InitMinio()
+	}
+}
@@ -0,0 +1,231 @@
+package task
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	taskTypeArchive   = "archive"
+	archiveSweepBatch = 100
+	// MinIO 的预签名链接最长 7 天
+	archiveMaxPresign = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrArchiveFailed wraps archive task errors a retry cannot fix, such as files removed after submission.
+	ErrArchiveFailed = errors.New("archive failed")
+	// ErrArchiveExpired is returned once the archive of a task has been deleted.
+	ErrArchiveExpired = errors.New("archive expired")
+)
+
+// archiveSource is the Source of an archive task.
+type archiveSource struct {
+	FileIDs     []uint64 `json:"file_ids"`
+	Format      string   `json:"format"`
+	Compression string   `json:"compression"`
+}
+
+// archiveSummary is the Result of a completed archive task.
+type archiveSummary struct {
+	*service.ArchiveResult
+	Size int64 `json:"size"` // 压缩包大小
+}
+
+// CreateArchiveTask queues building an archive of fileIDs into a temporary object, for folders too
+// large to stream in one request. The format is resolved now, so the worker never switches to zip64.
+func CreateArchiveTask(userID uint64, fileIDs []uint64, name string, opts service.ArchiveOptions) (*model.DownloadTask, error) {
+	if len(fileIDs) == 0 {
+		return nil, fmt.Errorf("file_ids required")
+	}
+	opts, err := service.ParseArchiveOptions(opts.Format, opts.Compression)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := service.BuildArchiveEntries(userID, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+	est, err := service.EstimateArchive(entries, opts)
+	if err != nil {
+		return nil, err
+	}
+	source, err := json.Marshal(archiveSource{FileIDs: fileIDs, Format: est.Format, Compression: est.Compression})
+	if err != nil {
+		return nil, err
+	}
+	task := &model.DownloadTask{
+		UserID:     userID,
+		Type:       taskTypeArchive,
+		Source:     string(source),
+		Bucket:     config.AppConfig.BucketName,
+		ObjectName: fmt.Sprintf("archives/%d/%s%s", userID, utils.GetToken(), service.ArchiveExt(est.Format)),
+		FileName:   service.ArchiveFileName(name, est.Format),
+		Status:     "pending",
+	}
+	if err := repo.Db.Create(task).Error; err != nil {
+		return nil, err
+	}
+	if err := enqueueDownloadTask(task.ID); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// processArchiveTask writes the archive of a claimed archive task to its temporary object.
+func processArchiveTask(ctx context.Context, task *model.DownloadTask) error {
+	var source archiveSource
+	if err := json.Unmarshal([]byte(task.Source), &source); err != nil {
+		return fmt.Errorf("%w: invalid source: %w", ErrArchiveFailed, err)
+	}
+	entries, err := service.BuildArchiveEntries(task.UserID, source.FileIDs)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrArchiveFailed, err)
+	}
+	opts := service.ArchiveOptions{Format: source.Format, Compression: source.Compression}
+	est, err := service.EstimateArchive(entries, opts)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrArchiveFailed, err)
+	}
+	if storage.Default == nil {
+		return fmt.Errorf("storage not initialized")
+	}
+
+	// 边打包边上传 大小未知 (-1) 由各存储后端处理
+	pr, pw := io.Pipe()
+	progress := &archiveProgress{taskID: task.ID, total: est.EstimatedSize}
+	var result *service.ArchiveResult
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		result, err = service.WriteArchive(ctx, io.MultiWriter(pw, progress), entries, opts)
+		_ = pw.CloseWithError(err)
+		done <- err
+	}()
+	putErr := storage.Default.PutObject(ctx, task.Bucket, task.ObjectName, pr, -1, storage.PutOptions{
+		ContentType: service.ArchiveContentType(est.Format),
+	})
+	_ = pr.CloseWithError(putErr) // 上传提前结束时让打包退出
+	writeErr := <-done
+	if putErr != nil || writeErr != nil {
+		_ = storage.Default.RemoveObject(context.Background(), task.Bucket, task.ObjectName)
+		if writeErr != nil {
+			return writeErr
+		}
+		return putErr
+	}
+
+	ttl := config.AppConfig.ArchiveTaskTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	summary, _ := json.Marshal(archiveSummary{ArchiveResult: result, Size: progress.written})
+	finishedAt := time.Now()
+	expiresAt := finishedAt.Add(ttl)
+	if err := completeDownloadTask(task.ID, map[string]interface{}{
+		"progress":    100,
+		"result":      string(summary),
+		"finished_at": &finishedAt,
+		"expires_at":  &expiresAt,
+	}); err != nil {
+		_ = storage.Default.RemoveObject(context.Background(), task.Bucket, task.ObjectName)
+		return err
+	}
+	return nil
+}
+
+// archiveProgress records the share of the estimated size written so far.
+type archiveProgress struct {
+	taskID  uint64
+	total   int64
+	written int64
+	last    int
+}
+
+func (p *archiveProgress) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	if p.total > 0 {
+		percent := int(p.written * 100 / p.total)
+		if percent > 99 { // 预估是上限 写完前不显示 100
+			percent = 99
+		}
+		if percent >= p.last+5 { // 每 5% 写一次库
+			p.last = percent
+			_ = repo.Db.Model(&model.DownloadTask{}).Where("id = ?", p.taskID).Update("progress", percent).Error
+		}
+	}
+	return len(b), nil
+}
+
+// GetArchiveTask returns an archive task of the user and, once it has completed, a presigned link
+// to the archive that stays valid until the task expires (at most 7 days).
+func GetArchiveTask(ctx context.Context, userID, taskID uint64) (*model.DownloadTask, string, error) {
+	var task model.DownloadTask
+	if err := repo.Db.
+		Where("id = ? AND user_id = ? AND type = ?", taskID, userID, taskTypeArchive).
+		First(&task).Error; err != nil {
+		return nil, "", err
+	}
+	if task.Status == "expired" {
+		return &task, "", ErrArchiveExpired
+	}
+	if task.Status != "completed" || task.ExpiresAt == nil {
+		return &task, "", nil
+	}
+	expiry := time.Until(*task.ExpiresAt)
+	if expiry <= 0 { // 已过期 等待清理
+		return &task, "", ErrArchiveExpired
+	}
+	if expiry > archiveMaxPresign {
+		expiry = archiveMaxPresign
+	}
+	url, err := service.GetDownloadURL(ctx, task.Bucket, task.ObjectName, task.FileName, expiry)
+	if err != nil {
+		return &task, "", err
+	}
+	return &task, url, nil
+}
+
+// SweepExpiredArchives deletes the archives of tasks past their expiry and marks the tasks expired.
+func SweepExpiredArchives(ctx context.Context) (int, error) {
+	if storage.Default == nil {
+		return 0, fmt.Errorf("storage not initialized")
+	}
+	removed := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		var tasks []model.DownloadTask
+		if err := repo.Db.
+			Where("type = ? AND status = ? AND expires_at < ?", taskTypeArchive, "completed", time.Now()).
+			Order("id asc").
+			Limit(archiveSweepBatch).
+			Find(&tasks).Error; err != nil {
+			return removed, err
+		}
+		if len(tasks) == 0 {
+			return removed, nil
+		}
+		for i := range tasks {
+			task := &tasks[i]
+			if err := storage.Default.RemoveObject(ctx, task.Bucket, task.ObjectName); err != nil {
+				return removed, fmt.Errorf("remove archive of task %d: %w", task.ID, err)
+			}
+			if err := repo.Db.Model(task).Update("status", "expired").Error; err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+}
@@ -36,25 +36,33 @@ func CreateDownloadTask(userID uint64, url, fileName string) (*model.DownloadTas
 	if err := repo.Db.Create(task).Error; err != nil {
 		return nil, err
 	}
+	if err := enqueueDownloadTask(task.ID); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// enqueueDownloadTask publishes a created task to the worker queue.
+func enqueueDownloadTask(taskID uint64) error {
 	msg := DownloadMessage{
-		TaskID:  task.ID,
+		TaskID:  taskID,
 		Attempt: 0,
 	}
 	body, err := json.Marshal(msg)
 	if err != nil {
-		markDownloadTaskFailed(task.ID, err)
-		return nil, err
+		markDownloadTaskFailed(taskID, err)
+		return err
 	}
 	publisher, err := mq.GetPublisher()
 	if err != nil {
-		markDownloadTaskFailed(task.ID, err)
-		return nil, err
+		markDownloadTaskFailed(taskID, err)
+		return err
 	}
 	if err := publisher.PublishTask(context.Background(), body); err != nil {
-		markDownloadTaskFailed(task.ID, err)
-		return nil, err
+		markDownloadTaskFailed(taskID, err)
+		return err
 	}
-	return task, nil
+	return nil
 }
 
 // ListDownloadTasks lists download tasks for a user.
@@ -95,38 +103,66 @@ func ProcessDownloadTask(ctx context.Context, taskID uint64) error {
 		return nil
 	}
 
-	size, err := service.DownloadByHTTP(
-		ctx,
-		task.Source,
-		task.ObjectName,
-		task.UserID,
-	)
+	// 暂停或取消通过 Redis 广播 取消 taskCtx 中断传输
+	taskCtx, done := watchDownloadTask(ctx, taskID)
+	defer done()
+	var err error
+	switch task.Type {
+	case taskTypeExtract:
+		err = processExtractTask(taskCtx, &task)
+	case taskTypeArchive:
+		err = processArchiveTask(taskCtx, &task)
+	default:
+		err = processHTTPTask(taskCtx, &task)
+	}
 	if err != nil {
-		return err
+		if stopped := taskStopped(taskCtx); stopped != nil {
+			return stopped
+		}
 	}
+	return err
+}
 
+// processHTTPTask downloads the URL of a claimed offline download task into a user file.
+func processHTTPTask(ctx context.Context, task *model.DownloadTask) error {
 	userName, err := service.FindUserNameById(task.UserID)
 	if err != nil {
 		return err
 	}
-
 	objectName := service.BuildObjectName(userName, task.ObjectName)
 	cleanupObject := func() {
 		if storage.Default != nil {
-			_ = storage.Default.RemoveObject(ctx, task.Bucket, objectName)
+			_ = storage.Default.RemoveObject(context.Background(), task.Bucket, objectName)
 		}
 	}
+
+	size, err := service.DownloadByHTTP(
+		ctx,
+		task.Source,
+		task.ObjectName,
+		task.UserID,
+	)
+	if err != nil {
+		cleanupObject() // 中断的传输可能留下部分写入的对象
+		return err
+	}
+	if stopped := taskStopped(ctx); stopped != nil { // 传输刚结束时被取消 不再创建文件
+		cleanupObject()
+		return stopped
+	}
+
 	createdNewObject := false
 	fileObj := &model.FileObject{
-		UserID:     task.UserID,
-		Hash:       task.ObjectName,
-		BucketName: task.Bucket,
-		ObjectName: objectName,
-		Size:       size,
-		RefCount:   1,
+		UserID:      task.UserID,
+		Hash:        task.ObjectName,
+		BucketName:  task.Bucket,
+		ObjectName:  objectName,
+		Size:        size,
+		ContentType: service.DetectObjectContentType(ctx, task.Bucket, objectName, task.FileName),
+		RefCount:    1,
 	}
 	if err := service.CreateFilesObject(fileObj); err != nil {
-		existingObj, getErr := service.GetFileObjectByHash(task.ObjectName)
+		existingObj, getErr := service.GetFileObjectByHash(task.UserID, task.ObjectName)
 		if getErr != nil {
 			cleanupObject()
 			return err
@@ -143,7 +179,8 @@ func ProcessDownloadTask(ctx context.Context, taskID uint64) error {
 		ObjectID: &fileObj.ID,
 		Size:     size,
 	}
-	if err := service.CreateUserFileEntry(userFile); err != nil {
+	// 离线下载完成时用户不在场 重名时自动改名
+	if _, err := service.CreateUserFileEntryWithPolicy(userFile, service.ConflictRename); err != nil {
 		if createdNewObject {
 			cleanupObject()
 			_ = repo.Db.Delete(&model.FileObject{}, fileObj.ID).Error
@@ -152,11 +189,18 @@ func ProcessDownloadTask(ctx context.Context, taskID uint64) error {
 	}
 
 	finishedAt := time.Now()
-	if err := repo.Db.Model(&task).Updates(map[string]interface{}{
-		"status":      "completed",
+	if err := completeDownloadTask(task.ID, map[string]interface{}{
 		"progress":    100,
 		"finished_at": &finishedAt,
-	}).Error; err != nil {
+	}); err != nil {
+		// 未能标记完成 (多为用户已停止) 时撤销刚创建的文件与容量 恢复或重试时重新下载
+		_ = repo.Db.Unscoped().Delete(&model.UserFile{}, userFile.ID).Error
+		_ = service.ReleaseSpace(task.UserID, size)
+		_ = utils.InvalidateUserFileListCache(context.Background(), task.UserID, 0)
+		if createdNewObject {
+			cleanupObject()
+			_ = repo.Db.Delete(&model.FileObject{}, fileObj.ID).Error
+		}
 		return err
 	}
 	_ = activity.Emit(context.Background(), task.UserID, activity.ActionDownload, userFile.ID, size)
@@ -166,7 +210,7 @@ func ProcessDownloadTask(ctx context.Context, taskID uint64) error {
 func markDownloadTaskFailed(taskID uint64, err error) {
 	finishedAt := time.Now()
 	_ = repo.Db.Model(&model.DownloadTask{}).
-		Where("id = ?", taskID).
+		Where("id = ? AND status NOT IN ?", taskID, StoppedStatuses).
 		Updates(map[string]interface{}{
 			"status":      "failed",
 			"error_msg":   err.Error(),
@@ -0,0 +1,101 @@
+package task
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const taskTypeExtract = "extract"
+
+// ErrExtractFailed wraps errors of extract tasks; they are not retried because a partial
+// extraction would be created again.
+var ErrExtractFailed = errors.New("extract failed")
+
+// CreateExtractTask queues the extraction of a stored archive into the folder parentID (0 = root).
+// 重名策略为空时按 rename 处理 与离线下载一致
+func CreateExtractTask(userID, fileID, parentID uint64, conflictPolicy string) (*model.DownloadTask, error) {
+	if conflictPolicy == "" {
+		conflictPolicy = string(service.ConflictRename)
+	}
+	if _, err := service.ParseConflictPolicy(conflictPolicy); err != nil {
+		return nil, err
+	}
+	archive, err := service.CheckExtractSource(userID, fileID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := service.GetFileObjectById(*archive.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	task := &model.DownloadTask{
+		UserID:         userID,
+		Type:           taskTypeExtract,
+		Source:         strconv.FormatUint(archive.ID, 10),
+		Bucket:         obj.BucketName,
+		ObjectName:     obj.ObjectName,
+		FileName:       archive.Name,
+		Status:         "pending",
+		ParentID:       parentID,
+		ConflictPolicy: conflictPolicy,
+	}
+	if err := repo.Db.Create(task).Error; err != nil {
+		return nil, err
+	}
+	if err := enqueueDownloadTask(task.ID); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// processExtractTask extracts the archive of a claimed extract task.
+func processExtractTask(ctx context.Context, task *model.DownloadTask) error {
+	fileID, err := strconv.ParseUint(task.Source, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid source %q", ErrExtractFailed, task.Source)
+	}
+	var archive model.UserFile
+	if err := repo.Db.
+		Where("id = ? AND user_id = ? AND is_deleted = 0", fileID, task.UserID).
+		First(&archive).Error; err != nil {
+		return fmt.Errorf("%w: %w", ErrExtractFailed, err)
+	}
+	policy, err := service.ParseConflictPolicy(task.ConflictPolicy)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrExtractFailed, err)
+	}
+
+	lastProgress := 0
+	result, err := service.ExtractArchive(ctx, task.UserID, &archive, service.ExtractOptions{
+		ParentID: task.ParentID,
+		Policy:   policy,
+		Progress: func(percent int) {
+			if percent < lastProgress+5 { // 每 5% 写一次库
+				return
+			}
+			lastProgress = percent
+			_ = repo.Db.Model(&model.DownloadTask{}).Where("id = ?", task.ID).Update("progress", percent).Error
+		},
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrExtractFailed, err)
+	}
+
+	summary, _ := json.Marshal(result)
+	finishedAt := time.Now()
+	return completeDownloadTask(task.ID, map[string]interface{}{
+		"progress":    100,
+		"result":      string(summary),
+		"finished_at": &finishedAt,
+	})
+}
@@ -0,0 +1,227 @@
+package task
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	taskStatusPaused   = "paused"
+	taskStatusCanceled = "canceled"
+
+	// taskControlChannel broadcasts pause and cancel requests to the workers running tasks.
+	taskControlChannel = "download:task:control"
+)
+
+// StoppedStatuses are the states set by users; retries and failures never overwrite them.
+var StoppedStatuses = []string{taskStatusPaused, taskStatusCanceled}
+
+var (
+	// ErrTaskCanceled is returned by a task interrupted because the user canceled it.
+	ErrTaskCanceled = errors.New("task canceled")
+	// ErrTaskPaused is returned by a task interrupted because the user paused it.
+	ErrTaskPaused = errors.New("task paused")
+	// ErrTaskState is returned when a task is not in a state the action applies to.
+	ErrTaskState = errors.New("invalid task state")
+	// ErrTaskNotControllable is returned for extract tasks; entries already extracted cannot be rolled back.
+	ErrTaskNotControllable = errors.New("task cannot be paused or canceled")
+)
+
+type controlMessage struct {
+	TaskID uint64 `json:"task_id"`
+	Status string `json:"status"`
+}
+
+// runningTasks maps the ID of each task running in this process to the cancel function of its context.
+var runningTasks sync.Map
+
+// CancelDownloadTask stops a task for good. A running transfer is interrupted and its partial
+// object removed by the worker.
+func CancelDownloadTask(ctx context.Context, userID, taskID uint64) (*model.DownloadTask, error) {
+	return stopDownloadTask(ctx, userID, taskID, taskStatusCanceled,
+		"pending", "retrying", "running", taskStatusPaused)
+}
+
+// PauseDownloadTask stops a task until ResumeDownloadTask. A running transfer is interrupted
+// like a cancel; resuming starts it again from the beginning.
+func PauseDownloadTask(ctx context.Context, userID, taskID uint64) (*model.DownloadTask, error) {
+	return stopDownloadTask(ctx, userID, taskID, taskStatusPaused, "pending", "retrying", "running")
+}
+
+// ResumeDownloadTask queues a paused task again.
+func ResumeDownloadTask(ctx context.Context, userID, taskID uint64) (*model.DownloadTask, error) {
+	task, err := loadControllableTask(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	res := repo.Db.Model(&model.DownloadTask{}).
+		Where("id = ? AND status = ?", taskID, taskStatusPaused).
+		Updates(map[string]interface{}{
+			"status":        "pending",
+			"progress":      0,
+			"error_msg":     "",
+			"next_retry_at": nil,
+		})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return task, fmt.Errorf("%w: task is %s", ErrTaskState, task.Status)
+	}
+	if err := enqueueDownloadTask(taskID); err != nil {
+		return nil, err
+	}
+	return loadControllableTask(userID, taskID)
+}
+
+func loadControllableTask(userID, taskID uint64) (*model.DownloadTask, error) {
+	var task model.DownloadTask
+	if err := repo.Db.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
+		return nil, err
+	}
+	if task.Type == taskTypeExtract {
+		return nil, ErrTaskNotControllable
+	}
+	return &task, nil
+}
+
+func stopDownloadTask(ctx context.Context, userID, taskID uint64, status string, from ...string) (*model.DownloadTask, error) {
+	task, err := loadControllableTask(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{
+		"status":        status,
+		"next_retry_at": nil,
+	}
+	if status == taskStatusCanceled {
+		finishedAt := time.Now()
+		updates["finished_at"] = &finishedAt
+	}
+	res := repo.Db.Model(&model.DownloadTask{}).
+		Where("id = ? AND status IN ?", taskID, from).
+		Updates(updates)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return task, fmt.Errorf("%w: task is %s", ErrTaskState, task.Status)
+	}
+	// 读取后 Worker 可能刚开始执行 不论之前的状态都广播
+	// 队列中的消息在领取时因状态不符被跳过
+	broadcastTaskControl(ctx, taskID, status)
+	return loadControllableTask(userID, taskID)
+}
+
+// completeDownloadTask records the result of a task unless the user stopped it meanwhile; then it
+// returns ErrTaskCanceled or ErrTaskPaused and the caller discards what the task produced.
+// 广播可能晚于任务完成 以数据库中的状态为准
+func completeDownloadTask(taskID uint64, updates map[string]interface{}) error {
+	updates["status"] = "completed"
+	res := repo.Db.Model(&model.DownloadTask{}).
+		Where("id = ? AND status NOT IN ?", taskID, StoppedStatuses).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	var current model.DownloadTask
+	if err := repo.Db.Select("id", "status").Where("id = ?", taskID).First(&current).Error; err != nil {
+		return err
+	}
+	if current.Status == taskStatusPaused {
+		return ErrTaskPaused
+	}
+	return ErrTaskCanceled
+}
+
+func broadcastTaskControl(ctx context.Context, taskID uint64, status string) {
+	if repo.Redis == nil {
+		return
+	}
+	payload, _ := json.Marshal(controlMessage{TaskID: taskID, Status: status})
+	if err := repo.Redis.Publish(ctx, taskControlChannel, payload).Err(); err != nil {
+		log.Printf("task control: publish %s of task %d failed: %v", status, taskID, err)
+	}
+}
+
+// watchDownloadTask returns a context canceled when the task is paused or canceled while it runs
+// in this process. done must be called when the task returns.
+func watchDownloadTask(ctx context.Context, taskID uint64) (context.Context, func()) {
+	taskCtx, cancel := context.WithCancelCause(ctx)
+	runningTasks.Store(taskID, cancel)
+	// 领取与登记之间到达的广播会错过 登记后再查一次状态
+	var current model.DownloadTask
+	if err := repo.Db.Select("id", "status").Where("id = ?", taskID).First(&current).Error; err == nil {
+		stopTask(taskID, current.Status)
+	}
+	return taskCtx, func() {
+		runningTasks.Delete(taskID)
+		cancel(nil)
+	}
+}
+
+// stopTask cancels the context of a task running in this process for a stopped status.
+func stopTask(taskID uint64, status string) {
+	value, ok := runningTasks.Load(taskID)
+	if !ok {
+		return
+	}
+	cancel := value.(context.CancelCauseFunc)
+	switch status {
+	case taskStatusCanceled:
+		cancel(ErrTaskCanceled)
+	case taskStatusPaused:
+		cancel(ErrTaskPaused)
+	}
+}
+
+// taskStopped returns ErrTaskCanceled or ErrTaskPaused once the user has stopped the task.
+func taskStopped(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrTaskCanceled) || errors.Is(cause, ErrTaskPaused) {
+		return cause
+	}
+	return nil
+}
+
+// ListenTaskControl interrupts tasks running in this process when they are paused or canceled.
+func ListenTaskControl(ctx context.Context, rdb *redis.Client, ready chan<- struct{}) {
+	pubsub := rdb.Subscribe(ctx, taskControlChannel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("task control: subscribe failed: %v", err)
+		close(ready)
+		return
+	}
+	close(ready)
+	ch := pubsub.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var control controlMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &control); err != nil {
+				log.Printf("task control: invalid message: %v", err)
+				continue
+			}
+			stopTask(control.TaskID, control.Status)
+		}
+	}
+}
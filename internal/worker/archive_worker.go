@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/task"
+	"context"
+	"log"
+	"time"
+)
+
+// RunArchiveSweepWorker periodically deletes the archives of expired archive tasks.
+func RunArchiveSweepWorker(ctx context.Context) error {
+	interval := config.AppConfig.ArchiveSweepInterval
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sweepArchives(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			sweepArchives(ctx)
+		}
+	}
+}
+
+func sweepArchives(ctx context.Context) {
+	removed, err := task.SweepExpiredArchives(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("archive sweeper: stopped after %d archives: %v", removed, err)
+		}
+		return
+	}
+	if removed > 0 {
+		log.Printf("archive sweeper: removed %d expired archives", removed)
+	}
+}
@@ -46,6 +46,13 @@ func RunDownloadWorker(ctx context.Context) error {
 		return err
 	}
 
+	// 暂停与取消的广播 打断本进程正在执行的任务
+	if repo.Redis != nil {
+		ready := make(chan struct{})
+		go task.ListenTaskControl(ctx, repo.Redis, ready)
+		<-ready
+	}
+
 	deliveries, err := client.Channel.Consume(
 		mq.QueueTasks,
 		"",
@@ -110,6 +117,10 @@ func handleDownloadMessage(ctx context.Context, client *mq.Client, limiter *rate
 	}
 
 	if err := task.ProcessDownloadTask(ctx, msg.TaskID); err != nil {
+		if errors.Is(err, task.ErrTaskCanceled) || errors.Is(err, task.ErrTaskPaused) { // 状态已由接口更新
+			_ = delivery.Ack(false)
+			return
+		}
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			_ = delivery.Nack(false, true)
 			return
@@ -136,6 +147,15 @@ func shouldRetry(err error) bool {
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return false
 	}
+	if service.IsQuotaExceeded(err) {
+		return false
+	}
+	if errors.Is(err, task.ErrExtractFailed) { // 已解压的部分不回滚 重试会重复创建
+		return false
+	}
+	if errors.Is(err, task.ErrArchiveFailed) { // 提交后文件被删除等 重试也无法恢复
+		return false
+	}
 	var httpErr *service.HTTPStatusError
 	if errors.As(err, &httpErr) {
 		if httpErr.StatusCode == http.StatusRequestTimeout || httpErr.StatusCode == http.StatusTooManyRequests {
@@ -158,15 +178,19 @@ func scheduleRetry(ctx context.Context, client *mq.Client, msg task.DownloadMess
 
 	delay := pickRetryDelay(nextAttempt, config.AppConfig.DownloadRetryDelays)
 	nextRetryAt := time.Now().Add(delay)
-	if err := repo.Db.Model(&model.DownloadTask{}).
-		Where("id = ?", msg.TaskID).
+	res := repo.Db.Model(&model.DownloadTask{}).
+		Where("id = ? AND status NOT IN ?", msg.TaskID, task.StoppedStatuses).
 		Updates(map[string]interface{}{
 			"status":        "retrying",
 			"error_msg":     procErr.Error(),
 			"retry_count":   nextAttempt,
 			"next_retry_at": &nextRetryAt,
-		}).Error; err != nil {
-		return err
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 { // 已被暂停或取消 不再重试
+		return nil
 	}
 
 	msg.Attempt = nextAttempt
@@ -179,14 +203,18 @@ func scheduleRetry(ctx context.Context, client *mq.Client, msg task.DownloadMess
 
 func markFailed(ctx context.Context, client *mq.Client, msg task.DownloadMessage, procErr error) error {
 	finishedAt := time.Now()
-	if err := repo.Db.Model(&model.DownloadTask{}).
-		Where("id = ?", msg.TaskID).
+	res := repo.Db.Model(&model.DownloadTask{}).
+		Where("id = ? AND status NOT IN ?", msg.TaskID, task.StoppedStatuses).
 		Updates(map[string]interface{}{
 			"status":      "failed",
 			"error_msg":   procErr.Error(),
 			"finished_at": &finishedAt,
-		}).Error; err != nil {
-		return err
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 { // 已被暂停或取消
+		return nil
 	}
 
 	dlq := dlqMessage{
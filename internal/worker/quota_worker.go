@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/service"
+	"context"
+	"log"
+	"time"
+)
+
+// RunQuotaReconcileWorker periodically recomputes user_db.use_space from user_file.
+func RunQuotaReconcileWorker(ctx context.Context) error {
+	interval := config.AppConfig.QuotaReconcileInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	reconcileQuota(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			reconcileQuota(ctx)
+		}
+	}
+}
+
+func reconcileQuota(ctx context.Context) {
+	count, err := service.ReconcileAllUserSpace(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("quota worker: reconcile failed after %d users: %v", count, err)
+		}
+		return
+	}
+	log.Printf("quota worker: reconciled %d users", count)
+}
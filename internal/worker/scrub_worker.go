@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/service"
+	"context"
+	"log"
+	"time"
+)
+
+// RunScrubWorker periodically verifies stored objects and repairs replicas.
+// SCRUB_INTERVAL <= 0 时不启动
+func RunScrubWorker(ctx context.Context) error {
+	interval := config.AppConfig.ScrubInterval
+	if interval <= 0 {
+		log.Println("scrub worker: disabled")
+		<-ctx.Done()
+		return nil
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			scrubObjects(ctx)
+		}
+	}
+}
+
+func scrubObjects(ctx context.Context) {
+	purged, err := service.PurgeReplicaTombstones(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("scrub worker: purge removed replicas failed: %v", err)
+	} else if purged > 0 {
+		log.Printf("scrub worker: purged %d replicas of removed objects", purged)
+	}
+	summary, err := service.ScrubFileObjects(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("scrub worker: stopped after %d objects: %v", summary.Checked, err)
+		}
+		return
+	}
+	log.Printf("scrub worker: checked %d objects, %d healthy, %d repaired, %d unrecoverable, %d skipped",
+		summary.Checked, summary.Healthy, summary.Repaired, summary.Unrecoverable, summary.Skipped)
+}
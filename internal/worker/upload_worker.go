@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/service"
+	"context"
+	"log"
+	"time"
+)
+
+// RunUploadSweepWorker periodically removes abandoned multipart upload sessions and their chunks.
+func RunUploadSweepWorker(ctx context.Context) error {
+	interval := config.AppConfig.UploadSweepInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sweepUploads(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			sweepUploads(ctx)
+		}
+	}
+}
+
+func sweepUploads(ctx context.Context) {
+	removed, err := service.SweepExpiredUploads(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("upload sweeper: stopped after %d sessions: %v", removed, err)
+		}
+		return
+	}
+	if removed > 0 {
+		log.Printf("upload sweeper: removed %d expired sessions", removed)
+	}
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/service"
+	"context"
+	"log"
+	"time"
+)
+
+// RunVersionPruneWorker periodically deletes file versions outside each user's retention rules.
+func RunVersionPruneWorker(ctx context.Context) error {
+	interval := config.AppConfig.VersionPruneInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	pruneVersions(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			pruneVersions(ctx)
+		}
+	}
+}
+
+func pruneVersions(ctx context.Context) {
+	removed, err := service.PruneFileVersions(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("version pruner: stopped after %d versions: %v", removed, err)
+		}
+		return
+	}
+	if removed > 0 {
+		log.Printf("version pruner: removed %d versions", removed)
+	}
+}
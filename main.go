@@ -14,7 +14,7 @@ func main() {
 	config.InitConfig()
 	repo.InitMysql()
 	repo.InitRedis()
-	storage.InitMinio()
+	storage.InitStorage()
 
 	ctx := context.Background()
 	if err := repo.EnableKeyspaceNotifications(ctx); err != nil {
@@ -7,7 +7,7 @@ type DownloadTask struct {
 
 	UserID uint64 `gorm:"column:user_id;index;not null" json:"user_id"`
 
-	Type   string `gorm:"column:type;type:varchar(32);not null" json:"type"` // http / magnet / torrent / share
+	Type   string `gorm:"column:type;type:varchar(32);not null" json:"type"` // http / magnet / torrent / share / extract / archive
 	Source string `gorm:"column:source;type:text;not null" json:"source"`
 
 	Bucket     string `gorm:"column:bucket;type:varchar(64);not null" json:"bucket"`
@@ -22,6 +22,14 @@ type DownloadTask struct {
 	StartedAt   *time.Time `gorm:"column:started_at" json:"started_at"`
 	FinishedAt  *time.Time `gorm:"column:finished_at" json:"finished_at"`
 
+	// extract 任务: Source 为压缩包的 user_file ID 解压到 ParentID 重名按 ConflictPolicy 处理
+	ParentID       uint64 `gorm:"column:parent_id;default:0" json:"parent_id"`
+	ConflictPolicy string `gorm:"column:conflict_policy;size:16" json:"conflict_policy,omitempty"`
+	Result         string `gorm:"column:result;type:text" json:"result,omitempty"` // 完成时的统计 JSON
+
+	// archive 任务: 打好的压缩包为临时对象 Bucket/ObjectName 到期后由清理任务删除
+	ExpiresAt *time.Time `gorm:"column:expires_at;index" json:"expires_at,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
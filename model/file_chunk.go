@@ -10,6 +10,7 @@ type FileChunk struct {
 	ChunkIndex int    `gorm:"column:chunk_index;not null;uniqueIndex:idx_upload_chunk"`
 	ChunkSize  int64  `gorm:"column:chunk_size;not null"`
 	ChunkPath  string `gorm:"column:chunk_path;size:512;not null"`
+	Checksum   string `gorm:"column:checksum;size:80"` // 服务端校验过的分片校验和 形如 md5:<hex> 或 crc32c:<hex>
 
 	Status int `gorm:"column:status;not null;default:0"`
 
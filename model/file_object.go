@@ -8,13 +8,17 @@ type FileObject struct {
 	UserID uint64 `gorm:"column:user_id;not null;" json:"user_id,omitempty"`
 	User   User   `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
 
-	Hash string `gorm:"column:hash;size:64;uniqueIndex;not null"`
+	// 同一去重范围内 hash 唯一 范围由 DEDUP_SCOPE 决定: 全局为空 按用户 "u:<id>" 按租户 "t:<id>"
+	DedupKey string `gorm:"column:dedup_key;size:40;not null;default:'';uniqueIndex:uk_object_dedup_hash,priority:1"`
+	Hash     string `gorm:"column:hash;size:64;not null;uniqueIndex:uk_object_dedup_hash,priority:2"`
 
 	BucketName string `gorm:"column:bucket_name;size:64;not null"`
 	ObjectName string `gorm:"column:object_name;size:512;not null"`
 
 	Size int64 `gorm:"column:size;not null"`
 
+	ContentType string `gorm:"column:content_type;size:128"` // 入库时按内容前 512 字节识别
+
 	RefCount int `gorm:"column:ref_count;not null;default:1"`
 
 	CreatedAt time.Time
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// FileVersion is an earlier content of a UserFile, kept when the file is overwritten.
+// 每个版本持有 ObjectID 的一个引用 大小计入用户已用空间
+type FileVersion struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+
+	UserFileID uint64 `gorm:"column:user_file_id;not null;uniqueIndex:uk_file_version,priority:1" json:"file_id"`
+	Version    int    `gorm:"column:version;not null;uniqueIndex:uk_file_version,priority:2" json:"version"`
+	UserID     uint64 `gorm:"column:user_id;not null;index" json:"-"`
+
+	ObjectID uint64 `gorm:"column:object_id;not null;index" json:"-"`
+	Size     int64  `gorm:"column:size;not null" json:"size"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"` // 被替换下来的时间
+}
+
+// TableName returns the database table name.
+func (FileVersion) TableName() string {
+	return "file_version"
+}
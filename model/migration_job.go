@@ -0,0 +1,65 @@
+package model
+
+import "time"
+
+// Migration job / item states.
+const (
+	MigrationPending   = "pending"
+	MigrationRunning   = "running"
+	MigrationCompleted = "completed"
+	MigrationFailed    = "failed"
+
+	MigrationItemMoved   = "moved"   // placement 已切换到目标节点 源副本待删除
+	MigrationItemDone    = "done"    // 源副本已删除
+	MigrationItemSkipped = "skipped" // 对象已删除或目标节点已有副本
+)
+
+// MigrationJob moves replicas from one storage node to another.
+// Cursor 记录已经入队的最后一个 object_replica.id 崩溃后从这里继续入队
+type MigrationJob struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+
+	SourceNode string `gorm:"column:source_node;size:64;not null;index" json:"source_node"`
+	TargetNode string `gorm:"column:target_node;size:64;not null" json:"target_node"`
+
+	Status    string `gorm:"column:status;type:varchar(32);index;not null" json:"status"`
+	StopBelow int    `gorm:"column:stop_below;not null;default:0" json:"stop_below"` // 源节点使用率(%)低于该值即停止 0 表示迁空
+	Cursor    uint64 `gorm:"column:replica_cursor;not null;default:0" json:"cursor"`
+	Total     int    `gorm:"column:total;not null;default:0" json:"total"`
+	Done      int    `gorm:"column:done;not null;default:0" json:"done"`
+	Skipped   int    `gorm:"column:skipped;not null;default:0" json:"skipped"`
+	Failed    int    `gorm:"column:failed;not null;default:0" json:"failed"`
+	ErrorMsg  string `gorm:"column:error_msg;type:text" json:"error_msg"`
+
+	FinishedAt *time.Time `gorm:"column:finished_at" json:"finished_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName returns the database table name.
+func (MigrationJob) TableName() string {
+	return "migration_job"
+}
+
+// MigrationItem is the per-object state of a migration job.
+type MigrationItem struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+
+	JobID      uint64 `gorm:"column:job_id;not null;uniqueIndex:uk_migration_item,priority:1" json:"job_id"`
+	BucketName string `gorm:"column:bucket_name;size:64;not null;uniqueIndex:uk_migration_item,priority:2" json:"bucket_name"`
+	ObjectName string `gorm:"column:object_name;size:512;not null;uniqueIndex:uk_migration_item,priority:3" json:"object_name"`
+
+	Size     int64  `gorm:"column:size;not null" json:"size"`
+	Sha256   string `gorm:"column:sha256;size:64" json:"sha256"`
+	Status   string `gorm:"column:status;type:varchar(32);index;not null" json:"status"`
+	Attempts int    `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	ErrorMsg string `gorm:"column:error_msg;type:text" json:"error_msg"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the database table name.
+func (MigrationItem) TableName() string {
+	return "migration_item"
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// ObjectReplica records that a storage node holds a copy of an object.
+// file_object 通过 bucket_name + object_name 关联 一个对象在每个副本节点各有一行
+type ObjectReplica struct {
+	ID uint64 `gorm:"primaryKey"`
+
+	BucketName string `gorm:"column:bucket_name;size:64;not null;uniqueIndex:uk_object_replica,priority:1"`
+	ObjectName string `gorm:"column:object_name;size:512;not null;uniqueIndex:uk_object_replica,priority:2"`
+	NodeName   string `gorm:"column:node_name;size:64;not null;uniqueIndex:uk_object_replica,priority:3;index"`
+
+	Size int64 `gorm:"column:size;not null"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName returns the database table name.
+func (ObjectReplica) TableName() string {
+	return "object_replica"
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// ObjectScrubIssue records a file object the scrubber could not find a good copy of.
+// 对象恢复正常后记录会被删除
+type ObjectScrubIssue struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+
+	FileObjectID uint64 `gorm:"column:file_object_id;uniqueIndex;not null" json:"file_object_id"`
+	BucketName   string `gorm:"column:bucket_name;size:64;not null" json:"bucket_name"`
+	ObjectName   string `gorm:"column:object_name;size:512;not null" json:"object_name"`
+	Detail       string `gorm:"column:detail;type:text" json:"detail"`
+
+	FirstSeenAt time.Time `gorm:"column:first_seen_at" json:"first_seen_at"`
+	LastSeenAt  time.Time `gorm:"column:last_seen_at" json:"last_seen_at"`
+}
+
+// TableName returns the database table name.
+func (ObjectScrubIssue) TableName() string {
+	return "object_scrub_issue"
+}
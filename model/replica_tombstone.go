@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// ReplicaTombstone records a replica of a removed object that could not be deleted because its
+// node was down. The scrubber deletes it once the node is back.
+type ReplicaTombstone struct {
+	ID uint64 `gorm:"primaryKey"`
+
+	BucketName string `gorm:"column:bucket_name;size:64;not null;uniqueIndex:uk_replica_tombstone,priority:1"`
+	ObjectName string `gorm:"column:object_name;size:512;not null;uniqueIndex:uk_replica_tombstone,priority:2"`
+	NodeName   string `gorm:"column:node_name;size:64;not null;uniqueIndex:uk_replica_tombstone,priority:3"`
+
+	Size int64 `gorm:"column:size;not null"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName returns the database table name.
+func (ReplicaTombstone) TableName() string {
+	return "replica_tombstone"
+}
@@ -17,8 +17,18 @@ type UploadSession struct {
 	ChunkSize   int64 `gorm:"column:chunk_size;not null"`
 	TotalChunks int   `gorm:"column:total_chunks;not null"`
 
+	// tus 上传在创建时确定目标目录 完成时才知道内容 hash
+	ParentID uint64 `gorm:"column:parent_id;not null;default:0"`
+	Metadata string `gorm:"column:metadata;size:1024"` // tus Upload-Metadata 原文
+
+	// 创建时选择的重名策略 complete 未指定时沿用
+	ConflictPolicy string `gorm:"column:conflict_policy;size:16"`
+
 	Status int `gorm:"column:status;not null;default:0"`
 
+	// 发放过预签名地址的会话 分片可能绕过 API 直接写入存储
+	Presigned bool `gorm:"column:presigned;not null;default:false"`
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -24,6 +24,14 @@ type User struct {
 	UseSpace   uint64 `gorm:"column:use_space;not null;default:0"`
 	CreatedAt  time.Time
 	DeletedAt  gorm.DeletedAt `gorm:"index"`
+
+	// 历史版本保留规则 为空时使用 VERSION_KEEP / VERSION_RETENTION_DAYS 0 表示该条规则不限制
+	VersionKeep *int `gorm:"column:version_keep"`
+	VersionDays *int `gorm:"column:version_days"`
+
+	TenantID uint64 `gorm:"column:tenant_id;not null;default:0;index"` // DEDUP_SCOPE=tenant 时同租户内去重 0 表示不属于任何租户
+
+	Tier string `gorm:"column:tier;type:varchar(32);not null;default:''"` // 下载限速档位 对应 DOWNLOAD_TIERS 为空时使用默认限制
 }
 
 // TableName returns the database table name.
@@ -30,17 +30,43 @@ func InitRouter() *gin.Engine {
 			file.POST("/copy", handler.CopyFiles)
 			file.POST("/folder", handler.CreateFolder)
 			file.POST("/delete", handler.BatchDeleteFiles)
+			file.POST("/upload", handler.UploadFile)
 			file.POST("/upload/hash", handler.UploadFileByHash)
 			file.POST("/upload/url", handler.UploadFileByURL)
 			file.POST("/download/minio", handler.MinioDownloadFile)
 			file.POST("/download/url", handler.MinioDownloadURL)
+			file.POST("/upload/manifest", handler.UploadManifest)
 			file.POST("/upload/multipart/init", handler.MultiPartFileInit)
 			file.POST("/upload/multipart/chunk", handler.MultipartUploadChunk)
+			file.POST("/upload/multipart/confirm", handler.MultipartConfirm)
 			file.POST("/upload/multipart/complete", handler.MultipartComplete)
+			file.POST("/upload/multipart/abort", handler.MultipartAbort)
 			file.POST("/download/offline", handler.HttpOfflineDownload)
 			file.POST("/download/archive", handler.DownloadArchive)
+			file.POST("/download/archive/estimate", handler.EstimateArchive)
+			file.POST("/download/archive/task", handler.CreateArchiveTask)
+			file.GET("/download/archive/task/:taskID", handler.GetArchiveTask)
+			file.POST("/extract", handler.ExtractArchive)
 			file.GET("/download/tasks", handler.ListDownloadTasks)
+			file.POST("/download/tasks/cancel", handler.CancelDownloadTask)
+			file.POST("/download/tasks/pause", handler.PauseDownloadTask)
+			file.POST("/download/tasks/resume", handler.ResumeDownloadTask)
 			file.GET("/preview/:fileID", handler.PreviewFile)
+			file.GET("/versions/:fileID", handler.ListFileVersions)
+			file.POST("/version/download", handler.FileVersionDownloadURL)
+			file.POST("/version/restore", handler.RestoreFileVersion)
+		}
+
+		// tus 断点续传协议 OPTIONS 用于能力发现 不需要登录
+		api.OPTIONS("/tus/files", handler.TusOptions)
+		api.OPTIONS("/tus/files/:uploadID", handler.TusOptions)
+		tus := auth.Group("/tus")
+		{
+			tus.POST("/files", handler.TusCreate)
+			tus.HEAD("/files/:uploadID", handler.TusHead)
+			tus.PATCH("/files/:uploadID", handler.TusPatch)
+			tus.DELETE("/files/:uploadID", handler.TusDelete)
+			tus.POST("/files/:uploadID", handler.TusMethodOverride)
 		}
 
 		recycle := auth.Group("/recycle")
@@ -67,7 +93,18 @@ func InitRouter() *gin.Engine {
 			user.GET("/common-dirs", handler.ListUserCommonDirs)
 			user.GET("/activity/summary", handler.GetUserActivitySummary)
 		}
+		admin := auth.Group("/admin")
+		admin.Use(utils.AdminMiddleware())
+		{
+			admin.GET("/storage/nodes", handler.ListStorageNodes)
+			admin.GET("/storage/scrub/issues", handler.ListScrubIssues)
+			admin.POST("/dedup/migrate", handler.MigrateDedupScope)
+			admin.POST("/user/tenant", handler.SetUserTenant)
+			admin.POST("/user/tier", handler.SetUserTier)
+		}
 		api.GET("/share/download/:shareID", handler.ShareDownload)
+		api.GET("/storage/local/:bucket/*object", handler.LocalObjectDownload)
+		api.PUT("/storage/local/:bucket/*object", handler.LocalObjectUpload)
 	}
 	return r
 }
@@ -895,6 +895,56 @@ async function hashFile(file) {
       .join("");
 }
 
+const CRC32C_TABLE = (() => {
+  const table = new Uint32Array(256);
+  for (let i = 0; i < 256; i += 1) {
+    let c = i;
+    for (let k = 0; k < 8; k += 1) {
+      c = c & 1 ? 0x82f63b78 ^ (c >>> 1) : c >>> 1;
+    }
+    table[i] = c >>> 0;
+  }
+  return table;
+})();
+
+// 分片校验和 crc32c:<hex> 服务端据此拒绝传输中损坏的分片
+async function chunkChecksum(blob) {
+  const bytes = new Uint8Array(await blob.arrayBuffer());
+  let crc = 0xffffffff;
+  for (let i = 0; i < bytes.length; i += 1) {
+    crc = CRC32C_TABLE[(crc ^ bytes[i]) & 0xff] ^ (crc >>> 8);
+  }
+  return `crc32c:${((crc ^ 0xffffffff) >>> 0).toString(16).padStart(8, "0")}`;
+}
+
+// 续传时只信任大小与校验和都和本地一致的分片
+async function verifiedChunks(file, chunkSize, chunks) {
+  const verified = new Set();
+  for (const chunk of chunks || []) {
+    const start = chunk.index * chunkSize;
+    const blob = file.slice(start, Math.min(file.size, start + chunkSize));
+    if (blob.size !== Number(chunk.size)) continue;
+    const checksum = String(chunk.checksum || "");
+    if (checksum.startsWith("crc32c:") && checksum !== (await chunkChecksum(blob))) continue;
+    verified.add(chunk.index);
+  }
+  return verified;
+}
+
+// 回答服务端的持有证明挑战: sha256(nonce + 文件指定区间)
+async function proveFile(file, challenge) {
+  const nonce = new TextEncoder().encode(challenge.nonce);
+  const start = Number(challenge.offset);
+  const range = await file.slice(start, start + Number(challenge.length)).arrayBuffer();
+  const buffer = new Uint8Array(nonce.length + range.byteLength);
+  buffer.set(nonce);
+  buffer.set(new Uint8Array(range), nonce.length);
+  const digest = await crypto.subtle.digest("SHA-256", buffer);
+  return Array.from(new Uint8Array(digest))
+      .map((b) => b.toString(16).padStart(2, "0"))
+      .join("");
+}
+
 function describeUploadTarget(path) {
   const normalized = normalizePath(path);
   return normalized ? normalized : "/";
@@ -981,7 +1031,7 @@ async function handleInstantUpload() {
 
     setStatus(status, "正在提交秒传...");
     const parentId = await resolveUploadTarget();
-    const data = await apiFetch("/file/upload/hash", {
+    const submit = (proof = "") => apiFetch("/file/upload/hash", {
       method: "POST",
       body: JSON.stringify({
         file_id: 0,
@@ -990,9 +1040,14 @@ async function handleInstantUpload() {
         hash,
         parent_id: parentId,
         is_dir: false,
+        proof,
       }),
     });
-    const result = unwrap(data) || {};
+    let result = unwrap(await submit()) || {};
+    if (result.need_proof && result.challenge && !result.need_upload) {
+      setStatus(status, "正在校验文件持有证明...");
+      result = unwrap(await submit(await proveFile(file, result.challenge))) || {};
+    }
     const instantHit = result.instant === true && Number(result.file_id) > 0;
     if (instantHit) {
       setStatus(status, "秒传成功。");
@@ -1034,7 +1089,7 @@ async function uploadByMultipart(file, parentId, status, bar, knownHash = "") {
   const chunkSize = Math.max(1, chunkSizeMB) * 1024 * 1024;
   const totalChunks = Math.max(1, Math.ceil(file.size / chunkSize));
 
-  const initData = await apiFetch("/file/upload/multipart/init", {
+  const init = (proof = "") => apiFetch("/file/upload/multipart/init", {
     method: "POST",
     body: JSON.stringify({
       user_id: payload.user_id,
@@ -1045,10 +1100,14 @@ async function uploadByMultipart(file, parentId, status, bar, knownHash = "") {
       chunk_size: chunkSize,
       total_chunks: totalChunks,
       parent_id: parentId,
+      proof,
     }),
   });
 
-  const result = unwrap(initData) || {};
+  let result = unwrap(await init()) || {};
+  if (result.need_proof && result.challenge) {
+    result = unwrap(await init(await proveFile(file, result.challenge))) || {};
+  }
   if (result.instant) {
     if (bar) bar.style.width = "100%";
     return { instant: true };
@@ -1059,7 +1118,7 @@ async function uploadByMultipart(file, parentId, status, bar, knownHash = "") {
     throw new Error("Missing upload ID.");
   }
 
-  const uploaded = new Set(result.uploaded || []);
+  const uploaded = result.chunks ? await verifiedChunks(file, chunkSize, result.chunks) : new Set(result.uploaded || []);
   let completed = 0;
   for (let index = 0; index < totalChunks; index += 1) {
     if (uploaded.has(index)) {
@@ -1075,6 +1134,7 @@ async function uploadByMultipart(file, parentId, status, bar, knownHash = "") {
     const form = new FormData();
     form.append("chunk_index", String(index));
     form.append("upload_id", uploadId);
+    form.append("checksum", await chunkChecksum(chunk));
     form.append("chunk", chunk, file.name);
     setStatus(status, `正在上传分片 ${index + 1}/${totalChunks}`);
     await apiFetch("/file/upload/multipart/chunk", {
@@ -1270,7 +1330,7 @@ async function uploadFileMultipartForFolder(file, parentId, chunkSizeMB, statusC
     throw new Error("Missing upload ID.");
   }
 
-  const uploaded = new Set(result.uploaded || []);
+  const uploaded = result.chunks ? await verifiedChunks(file, chunkSize, result.chunks) : new Set(result.uploaded || []);
   for (let index = 0; index < totalChunks; index += 1) {
     if (uploaded.has(index)) continue;
     const start = index * chunkSize;
@@ -1279,6 +1339,7 @@ async function uploadFileMultipartForFolder(file, parentId, chunkSizeMB, statusC
     const form = new FormData();
     form.append("chunk_index", String(index));
     form.append("upload_id", uploadId);
+    form.append("checksum", await chunkChecksum(chunk));
     form.append("chunk", chunk, file.name);
     if (statusCb) {
       statusCb(`正在上传 ${file.name} (${index + 1}/${totalChunks})`);
@@ -1314,17 +1375,27 @@ async function handleFolderUpload() {
     const baseParentId = await resolveUploadTarget();
     const chunkSizeMB = Number($("folderChunkSize").value) || 5;
 
-    const folderCache = {};
-    const pathMap = {};
+    // 先声明整棵目录树 服务端一次性创建所有文件夹并返回每个文件的目标目录
+    const manifest = unwrap(await apiFetch("/file/upload/manifest", {
+      method: "POST",
+      body: JSON.stringify({
+        parent_id: baseParentId,
+        entries: files.map((file) => ({ path: file.webkitRelativePath || file.name, size: file.size })),
+      }),
+    })) || {};
+    const targets = {};
+    for (const item of manifest.files || []) {
+      targets[item.path] = item;
+    }
 
     let completed = 0;
     for (const file of files) {
-      const relativePath = file.webkitRelativePath || file.name;
-      const parts = relativePath.split("/").filter(Boolean);
-      const fileName = parts.pop();
-      const parentId = await ensureFolderPath(baseParentId, parts, folderCache, pathMap);
-      setStatus(status, `正在上传 ${fileName} (${completed + 1}/${files.length})`);
-      await uploadFileMultipartForFolder(file, parentId, chunkSizeMB, (msg) => {
+      const target = targets[file.webkitRelativePath || file.name];
+      if (!target) {
+        throw new Error(`清单中缺少 ${file.name}`);
+      }
+      setStatus(status, `正在上传 ${target.file_name} (${completed + 1}/${files.length})`);
+      await uploadFileMultipartForFolder(file, target.parent_id, chunkSizeMB, (msg) => {
         setStatus(status, `${msg} (${completed + 1}/${files.length})`);
       });
       completed += 1;
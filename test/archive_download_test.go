@@ -0,0 +1,283 @@
+package test
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/internal/task"
+	"CloudVault/model"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// brokenReadStore fails reads of one object after a few bytes.
+type brokenReadStore struct {
+	storage.Store
+	object string
+}
+
+func (s *brokenReadStore) GetObject(ctx context.Context, bucket, object string) (io.ReadCloser, storage.ObjectInfo, error) {
+	reader, info, err := s.Store.GetObject(ctx, bucket, object)
+	if err != nil || object != s.object {
+		return reader, info, err
+	}
+	return io.NopCloser(io.MultiReader(io.LimitReader(reader, 3), errReader{})), info, nil
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+// 测试 zip 按内容选择存储或压缩 保留修改时间 读取失败的文件写入错误清单
+func TestWriteArchiveZip(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "archive_zip")
+	folder := createPolicyEntry(t, user.ID, nil, "trip", nil)
+	createPolicyEntry(t, user.ID, &folder.ID, "photo.jpg", storeTestObject(t, user, []byte("\xff\xd8\xff jpeg bytes")))
+	createPolicyEntry(t, user.ID, &folder.ID, "notes.txt", storeTestObject(t, user, []byte("remember the tickets")))
+	lost := storeTestObject(t, user, []byte("gone"))
+	createPolicyEntry(t, user.ID, &folder.ID, "lost.txt", lost)
+	_ = storage.Default.RemoveObject(context.Background(), lost.BucketName, lost.ObjectName)
+
+	entries, err := service.BuildArchiveEntries(user.ID, []uint64{folder.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := map[string]int64{}
+	for _, e := range entries {
+		modified[e.ZipPath] = e.ModTime.Unix()
+	}
+	if modified["trip/photo.jpg"] <= 0 {
+		t.Fatalf("expect entries to carry the modification time")
+	}
+	opts, _ := service.ParseArchiveOptions("", "")
+	var buf bytes.Buffer
+	result, err := service.WriteArchive(context.Background(), &buf, entries, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 2 || len(result.Errors) != 1 || result.Errors[0].Path != "trip/lost.txt" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if f := files["trip/photo.jpg"]; f == nil || f.Method != zip.Store || f.Modified.Unix() != modified["trip/photo.jpg"] {
+		t.Fatalf("expect the jpeg stored with its modification time, got %+v", f)
+	}
+	if f := files["trip/notes.txt"]; f == nil || f.Method != zip.Deflate {
+		t.Fatalf("expect text to be deflated")
+	}
+	manifest := files[service.ArchiveErrorsName]
+	if manifest == nil || files["trip/lost.txt"] != nil {
+		t.Fatalf("expect the missing file in the error manifest only, got %v", zr.File)
+	}
+	rc, _ := manifest.Open()
+	data, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if !strings.Contains(string(data), "trip/lost.txt") {
+		t.Fatalf("manifest does not list the file: %s", data)
+	}
+}
+
+// 测试 tar.gz: 读取中断的文件补齐长度 后续条目仍然完整
+func TestWriteArchiveTarGz(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "archive_tar")
+	broken := storeTestObject(t, user, []byte("0123456789"))
+	first := createPolicyEntry(t, user.ID, nil, "broken.bin", broken)
+	second := createPolicyEntry(t, user.ID, nil, "ok.txt", storeTestObject(t, user, []byte("intact")))
+
+	old := storage.Default
+	storage.Default = &brokenReadStore{Store: old, object: broken.ObjectName}
+	defer func() { storage.Default = old }()
+
+	entries, err := service.BuildArchiveEntries(user.ID, []uint64{first.ID, second.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var okModified int64
+	for _, e := range entries {
+		if e.ZipPath == "ok.txt" {
+			okModified = e.ModTime.Unix()
+		}
+	}
+	var buf bytes.Buffer
+	result, err := service.WriteArchive(context.Background(), &buf, entries, service.ArchiveOptions{Format: service.ArchiveTarGz})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error, "truncated after 3 of 10 bytes") {
+		t.Fatalf("expect a truncation error, got %+v", result.Errors)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	contents := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("archive is not well-formed: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		contents[hdr.Name] = string(data)
+		if hdr.Name == "ok.txt" && (okModified <= 0 || hdr.ModTime.Unix() != okModified) {
+			t.Fatalf("expect the modification time to be kept")
+		}
+	}
+	if contents["ok.txt"] != "intact" || contents["broken.bin"] != "012\x00\x00\x00\x00\x00\x00\x00" || contents[service.ArchiveErrorsName] == "" {
+		t.Fatalf("unexpected contents %q", contents)
+	}
+}
+
+// 测试预估: 超过 4GB 时默认改用 zip64 明确指定 zip 时拒绝
+func TestEstimateArchive(t *testing.T) {
+	entries := []service.ArchiveEntry{
+		{ZipPath: "big.iso", FileObj: &model.FileObject{Size: 5 << 30}},
+		{ZipPath: "docs/", IsDir: true},
+	}
+	est, err := service.EstimateArchive(entries, service.ArchiveOptions{})
+	if err != nil || est.Format != service.ArchiveZip64 || !est.NeedsZip64 || est.Files != 1 || est.Folders != 1 {
+		t.Fatalf("expect zip64 to be chosen, got %+v %v", est, err)
+	}
+	if est.EstimatedSize < est.ContentSize {
+		t.Fatalf("estimate %d below content size %d", est.EstimatedSize, est.ContentSize)
+	}
+	if _, err := service.EstimateArchive(entries, service.ArchiveOptions{Format: service.ArchiveZip}); !errors.Is(err, service.ErrArchiveNeedsZip64) {
+		t.Fatalf("expect ErrArchiveNeedsZip64, got %v", err)
+	}
+	tarEst, err := service.EstimateArchive(entries[:1], service.ArchiveOptions{Format: service.ArchiveTar})
+	if err != nil || tarEst.EstimatedSize != 512+(5<<30)+1024 {
+		t.Fatalf("unexpected tar estimate %+v %v", tarEst, err)
+	}
+	if _, err := service.ParseArchiveOptions("rar", ""); !errors.Is(err, service.ErrArchiveFormat) {
+		t.Fatalf("expect ErrArchiveFormat, got %v", err)
+	}
+}
+
+func TestDownloadArchiveHandler(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "archive_http")
+	entry := createPolicyEntry(t, user.ID, nil, "a.txt", storeTestObject(t, user, []byte("hello")))
+	tc := newTusClient(t, user)
+
+	body := []byte(`{"file_ids":[` + strconv.FormatUint(entry.ID, 10) + `],"name":"bundle","format":"tar"}`)
+	rec := tc.do(http.MethodPost, "/api/file/download/archive", body, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-tar" ||
+		!strings.Contains(rec.Header().Get("Content-Disposition"), `filename="bundle.tar"`) {
+		t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+	if got := rec.Result().Trailer.Get("X-Archive-Errors"); got != "0" {
+		t.Fatalf("expect X-Archive-Errors trailer 0, got %q", got)
+	}
+	hdr, err := tar.NewReader(rec.Body).Next()
+	if err != nil || hdr.Name != "a.txt" {
+		t.Fatalf("unexpected tar entry %+v %v", hdr, err)
+	}
+
+	rec = tc.do(http.MethodPost, "/api/file/download/archive/estimate", []byte(`{"file_ids":[`+strconv.FormatUint(entry.ID, 10)+`]}`), nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"format":"zip"`) {
+		t.Fatalf("unexpected estimate %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// 测试异步打包任务: 执行后生成临时对象与下载链接 过期清理后对象删除 链接不再返回
+func TestArchiveTask(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "archive_task")
+	folder := createPolicyEntry(t, user.ID, nil, "album", nil)
+	createPolicyEntry(t, user.ID, &folder.ID, "a.txt", storeTestObject(t, user, []byte("first file")))
+	createPolicyEntry(t, user.ID, &folder.ID, "b.txt", storeTestObject(t, user, []byte("second file")))
+
+	if _, err := task.CreateArchiveTask(user.ID, []uint64{folder.ID}, "album", service.ArchiveOptions{Format: "rar"}); !errors.Is(err, service.ErrArchiveFormat) {
+		t.Fatalf("expect ErrArchiveFormat, got %v", err)
+	}
+	created, err := task.CreateArchiveTask(user.ID, []uint64{folder.ID}, "album", service.ArchiveOptions{Format: service.ArchiveTarGz})
+	var archiveTask model.DownloadTask
+	if err != nil { // 没有 RabbitMQ 时任务被标记失败 恢复为 pending 直接处理
+		if err := repo.Db.Where("user_id = ? AND type = ?", user.ID, "archive").Order("id desc").First(&archiveTask).Error; err != nil {
+			t.Fatalf("task not stored: %v", err)
+		}
+		repo.Db.Model(&archiveTask).Update("status", "pending")
+	} else {
+		archiveTask = *created
+	}
+	if archiveTask.FileName != "album.tar.gz" {
+		t.Fatalf("unexpected file name %s", archiveTask.FileName)
+	}
+	if err := task.ProcessDownloadTask(context.Background(), archiveTask.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, url, err := task.GetArchiveTask(context.Background(), user.ID, archiveTask.ID)
+	if err != nil || stored.Status != "completed" || stored.ExpiresAt == nil || !strings.Contains(url, stored.ObjectName) {
+		t.Fatalf("expect a completed task with a link, got %+v %q %v", stored, url, err)
+	}
+	if !strings.Contains(stored.Result, `"files":2`) {
+		t.Fatalf("unexpected result %s", stored.Result)
+	}
+	reader, _, err := storage.Default.GetObject(context.Background(), stored.Bucket, stored.ObjectName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	_ = reader.Close()
+	if strings.Join(names, ",") != "album/,album/a.txt,album/b.txt" {
+		t.Fatalf("unexpected entries %v", names)
+	}
+	if _, _, err := task.GetArchiveTask(context.Background(), user.ID+1, archiveTask.ID); err == nil {
+		t.Fatalf("expect other users not to see the task")
+	}
+
+	// 过期后清理
+	expired := time.Now().Add(-time.Minute)
+	repo.Db.Model(&model.DownloadTask{}).Where("id = ?", archiveTask.ID).Update("expires_at", &expired)
+	if _, _, err := task.GetArchiveTask(context.Background(), user.ID, archiveTask.ID); !errors.Is(err, task.ErrArchiveExpired) {
+		t.Fatalf("expect ErrArchiveExpired before the sweep, got %v", err)
+	}
+	if removed, err := task.SweepExpiredArchives(context.Background()); err != nil || removed != 1 {
+		t.Fatalf("expect one archive swept, got %d %v", removed, err)
+	}
+	if _, _, err := storage.Default.GetObject(context.Background(), stored.Bucket, stored.ObjectName); err == nil {
+		t.Fatalf("expect the archive object to be deleted")
+	}
+	stored, _, err = task.GetArchiveTask(context.Background(), user.ID, archiveTask.ID)
+	if !errors.Is(err, task.ErrArchiveExpired) || stored.Status != "expired" {
+		t.Fatalf("expect an expired task, got %+v %v", stored, err)
+	}
+}
@@ -0,0 +1,321 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// newMemoryCluster builds a cluster of in-memory nodes with placement in the test database.
+func newMemoryCluster(t *testing.T, names ...string) (*storage.StorageCluster, []*storage.MemoryStore) {
+	t.Helper()
+	for _, table := range []string{"object_replica", "replica_tombstone", "migration_item", "migration_job"} {
+		if err := repo.Db.Exec("DELETE FROM " + table).Error; err != nil {
+			t.Fatalf("clean %s failed: %v", table, err)
+		}
+	}
+	nodes := make([]*storage.StorageNode, 0, len(names))
+	stores := make([]*storage.MemoryStore, 0, len(names))
+	for _, name := range names {
+		store := storage.NewMemoryStore()
+		nodes = append(nodes, storage.NewStorageNodeWithStore(config.MinioClusterConfig{
+			Name:      name,
+			Available: true,
+			TotalSize: 1000,
+			Weight:    1,
+		}, store))
+		stores = append(stores, store)
+	}
+	return storage.NewStorageCluster(nodes, storage.NewDBPlacement(repo.Db)), stores
+}
+
+func loadReplicaNodes(t *testing.T, object string) []string {
+	t.Helper()
+	var replicas []model.ObjectReplica
+	if err := repo.Db.Where("object_name = ?", object).Order("id asc").Find(&replicas).Error; err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(replicas))
+	for _, replica := range replicas {
+		names = append(names, replica.NodeName)
+	}
+	return names
+}
+
+func readAll(t *testing.T, store storage.Store, bucket, object string) string {
+	t.Helper()
+	reader, _, err := store.GetObject(context.Background(), bucket, object)
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// 测试集群写入多副本并在节点不可用时故障转移读取
+func TestClusterStoreReplicaFailover(t *testing.T) {
+	cluster, _ := newMemoryCluster(t, "node-a", "node-b", "node-c")
+	store := storage.NewClusterStore(cluster)
+	ctx := context.Background()
+	bucket := config.AppConfig.BucketName
+	object := fmt.Sprintf("cluster/failover_%d", time.Now().UnixNano())
+
+	if err := store.PutObject(ctx, bucket, object, bytes.NewReader([]byte("replicated")), 10, storage.PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	placed := loadReplicaNodes(t, object)
+	if len(placed) != config.StorageConfigInstance.ReplicaCount {
+		t.Fatalf("expect %d replicas, got %v", config.StorageConfigInstance.ReplicaCount, placed)
+	}
+
+	for _, node := range cluster.Nodes {
+		if node.Name() == placed[0] {
+			node.SetAvailable(false)
+		}
+	}
+	if got := readAll(t, store, bucket, object); got != "replicated" {
+		t.Fatalf("unexpected content after failover: %q", got)
+	}
+
+	for _, node := range cluster.Nodes {
+		node.SetAvailable(false)
+	}
+	if _, _, err := store.GetObject(ctx, bucket, object); err == nil {
+		t.Fatal("expect error when every replica is unavailable")
+	}
+	for _, node := range cluster.Nodes {
+		node.SetAvailable(true)
+	}
+
+	if err := store.RemoveObject(ctx, bucket, object); err != nil {
+		t.Fatalf("RemoveObject failed: %v", err)
+	}
+	if placed := loadReplicaNodes(t, object); len(placed) != 0 {
+		t.Fatalf("placement should be cleared, got %v", placed)
+	}
+}
+
+// 测试删除对象时不可用节点上的副本记为待删除 节点恢复后由 PurgeTombstones 删除
+func TestClusterStoreRemoveDefersDownReplicas(t *testing.T) {
+	cluster, stores := newMemoryCluster(t, "node-a", "node-b")
+	store := storage.NewClusterStore(cluster)
+	ctx := context.Background()
+	bucket := config.AppConfig.BucketName
+	object := fmt.Sprintf("cluster/tombstone_%d", time.Now().UnixNano())
+
+	if err := store.PutObject(ctx, bucket, object, bytes.NewReader([]byte("orphan")), 6, storage.PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if placed := loadReplicaNodes(t, object); len(placed) != 2 {
+		t.Fatalf("expect replicas on both nodes, got %v", placed)
+	}
+	down := cluster.Nodes[1]
+	down.SetAvailable(false)
+	if err := store.RemoveObject(ctx, bucket, object); err != nil {
+		t.Fatalf("RemoveObject failed: %v", err)
+	}
+	if placed := loadReplicaNodes(t, object); len(placed) != 0 {
+		t.Fatalf("placement should be cleared, got %v", placed)
+	}
+	var tombstones []model.ReplicaTombstone
+	repo.Db.Where("object_name = ?", object).Find(&tombstones)
+	if len(tombstones) != 1 || tombstones[0].NodeName != down.Name() || stores[1].Len() != 1 {
+		t.Fatalf("expect a tombstone for the replica on %s, got %+v", down.Name(), tombstones)
+	}
+
+	if purged, err := cluster.PurgeTombstones(ctx); err != nil || purged != 0 {
+		t.Fatalf("expect tombstones on unavailable nodes to be kept, got %d %v", purged, err)
+	}
+	down.SetAvailable(true)
+	if purged, err := cluster.PurgeTombstones(ctx); err != nil || purged != 1 {
+		t.Fatalf("expect the tombstone to be purged, got %d %v", purged, err)
+	}
+	if stores[0].Len() != 0 || stores[1].Len() != 0 {
+		t.Fatalf("expect no replica left, got %d %d", stores[0].Len(), stores[1].Len())
+	}
+	var left int64
+	repo.Db.Model(&model.ReplicaTombstone{}).Count(&left)
+	if left != 0 {
+		t.Fatalf("expect tombstones cleared, got %d", left)
+	}
+}
+
+// 测试分片分散在不同节点时仍能合并
+func TestClusterStoreComposeAcrossNodes(t *testing.T) {
+	cluster, _ := newMemoryCluster(t, "node-a", "node-b", "node-c")
+	store := storage.NewClusterStore(cluster)
+	ctx := context.Background()
+	bucket := config.AppConfig.BucketName
+	prefix := fmt.Sprintf("cluster/compose_%d", time.Now().UnixNano())
+
+	parts := []string{"hello ", "cluster ", "world"}
+	sources := make([]storage.CopySource, 0, len(parts))
+	for i, part := range parts {
+		name := fmt.Sprintf("%s/chunk_%d", prefix, i)
+		if err := store.PutObject(ctx, bucket, name, bytes.NewReader([]byte(part)), int64(len(part)), storage.PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, storage.CopySource{Bucket: bucket, Object: name})
+	}
+	dest := prefix + "/merged"
+	if err := store.ComposeObject(ctx, storage.CopyDest{Bucket: bucket, Object: dest}, sources...); err != nil {
+		t.Fatalf("ComposeObject failed: %v", err)
+	}
+	if got := readAll(t, store, bucket, dest); got != "hello cluster world" {
+		t.Fatalf("unexpected merged content: %q", got)
+	}
+	if placed := loadReplicaNodes(t, dest); len(placed) != config.StorageConfigInstance.ReplicaCount {
+		t.Fatalf("merged object should be replicated, got %v", placed)
+	}
+}
+
+// 测试迁移按 placement 记录搬移对象并更新副本位置
+func TestClusterCheckAndMigrate(t *testing.T) {
+	cluster, stores := newMemoryCluster(t, "node-a", "node-b")
+	ctx := context.Background()
+	bucket := config.AppConfig.BucketName
+	object := fmt.Sprintf("cluster/migrate_%d", time.Now().UnixNano())
+
+	source, target := cluster.Nodes[0], cluster.Nodes[1]
+	target.SetAvailable(false) // 只写入源节点
+	if err := cluster.UploadFileWithReplication(ctx, bucket, object, bytes.NewReader([]byte("migrate-me")), 10,
+		minio.PutObjectOptions{ContentType: "text/plain"}); err != nil {
+		t.Fatalf("UploadFileWithReplication failed: %v", err)
+	}
+	target.SetAvailable(true)
+	if placed := loadReplicaNodes(t, object); len(placed) != 1 || placed[0] != source.Name() {
+		t.Fatalf("expect replica on %s, got %v", source.Name(), placed)
+	}
+
+	source.Cluster.UsedSize = source.Cluster.TotalSize * 90 / 100
+	if err := cluster.CheckAndMigrate(ctx); err != nil {
+		t.Fatalf("CheckAndMigrate failed: %v", err)
+	}
+	if placed := loadReplicaNodes(t, object); len(placed) != 1 || placed[0] != target.Name() {
+		t.Fatalf("expect replica moved to %s, got %v", target.Name(), placed)
+	}
+	if stores[0].Len() != 0 || stores[1].Len() != 1 {
+		t.Fatalf("object should live only on target, got source=%d target=%d", stores[0].Len(), stores[1].Len())
+	}
+	if got := readAll(t, storage.NewClusterStore(cluster), bucket, object); got != "migrate-me" {
+		t.Fatalf("unexpected content after migration: %q", got)
+	}
+}
+
+// newHashCluster builds in-memory nodes with the given weights, without placement.
+func newHashCluster(names []string, weights []int) *storage.StorageCluster {
+	nodes := make([]*storage.StorageNode, 0, len(names))
+	for i, name := range names {
+		nodes = append(nodes, storage.NewStorageNodeWithStore(config.MinioClusterConfig{
+			Name:      name,
+			Available: true,
+			Weight:    weights[i],
+		}, storage.NewMemoryStore()))
+	}
+	return storage.NewStorageCluster(nodes, nil)
+}
+
+func useHashStrategy(t *testing.T) {
+	t.Helper()
+	previous := config.StorageConfigInstance.LoadBalanceStrategy
+	config.StorageConfigInstance.LoadBalanceStrategy = "hash"
+	t.Cleanup(func() { config.StorageConfigInstance.LoadBalanceStrategy = previous })
+}
+
+func primaryNode(t *testing.T, cluster *storage.StorageCluster, hash string) string {
+	t.Helper()
+	nodes, err := cluster.PlacementNodes(hash)
+	if err != nil {
+		t.Fatalf("PlacementNodes failed: %v", err)
+	}
+	return nodes[0].Name()
+}
+
+// 测试同一 hash 总是映射到相同的主副本节点
+func TestHashPlacementDeterministic(t *testing.T) {
+	useHashStrategy(t)
+	names := []string{"node-a", "node-b", "node-c"}
+	first := newHashCluster(names, []int{1, 1, 1})
+	second := newHashCluster(names, []int{1, 1, 1})
+
+	for i := 0; i < 200; i++ {
+		hash := fmt.Sprintf("hash-%d", i)
+		a, err := first.PlacementNodes(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := second.PlacementNodes(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a) != 2 || len(b) != 2 || a[0].Name() == a[1].Name() {
+			t.Fatalf("expect 2 distinct replicas, got %d/%d", len(a), len(b))
+		}
+		for j := range a {
+			if a[j].Name() != b[j].Name() {
+				t.Fatalf("placement of %s differs: %s vs %s", hash, a[j].Name(), b[j].Name())
+			}
+		}
+	}
+
+	// 主节点下线后顺延到环上的下一个节点 其余对象不受影响
+	nodes, _ := first.PlacementNodes("hash-0")
+	nodes[0].SetAvailable(false)
+	if got := primaryNode(t, first, "hash-0"); got != nodes[1].Name() {
+		t.Fatalf("expect failover primary %s, got %s", nodes[1].Name(), got)
+	}
+}
+
+// 测试增加节点时只有迁往新节点的对象改变位置
+func TestHashPlacementMinimalMovement(t *testing.T) {
+	useHashStrategy(t)
+	before := newHashCluster([]string{"node-a", "node-b", "node-c"}, []int{1, 1, 1})
+	after := newHashCluster([]string{"node-a", "node-b", "node-c", "node-d"}, []int{1, 1, 1, 1})
+
+	const total = 2000
+	moved := 0
+	for i := 0; i < total; i++ {
+		hash := fmt.Sprintf("hash-%d", i)
+		old, cur := primaryNode(t, before, hash), primaryNode(t, after, hash)
+		if old == cur {
+			continue
+		}
+		if cur != "node-d" {
+			t.Fatalf("%s moved from %s to %s, only moves to the new node are expected", hash, old, cur)
+		}
+		moved++
+	}
+	if ratio := float64(moved) / total; ratio < 0.15 || ratio > 0.35 {
+		t.Fatalf("expect about 1/4 of objects to move, got %.2f", ratio)
+	}
+}
+
+// 测试权重影响对象分布
+func TestHashPlacementWeighted(t *testing.T) {
+	useHashStrategy(t)
+	cluster := newHashCluster([]string{"heavy", "light-a", "light-b"}, []int{3, 1, 1})
+
+	const total = 3000
+	heavy := 0
+	for i := 0; i < total; i++ {
+		if primaryNode(t, cluster, fmt.Sprintf("hash-%d", i)) == "heavy" {
+			heavy++
+		}
+	}
+	if ratio := float64(heavy) / total; ratio < 0.5 || ratio > 0.7 {
+		t.Fatalf("expect about 3/5 of objects on the heavy node, got %.2f", ratio)
+	}
+}
@@ -0,0 +1,205 @@
+package test
+
+import (
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/model"
+	"context"
+	"errors"
+	"testing"
+)
+
+// createPolicyEntry creates a file (objectID != nil) or folder for the conflict tests.
+func createPolicyEntry(t *testing.T, userID uint64, parentID *uint64, name string, obj *model.FileObject) *model.UserFile {
+	t.Helper()
+	entry := &model.UserFile{UserID: userID, ParentID: parentID, Name: name, IsDir: obj == nil}
+	if obj != nil {
+		entry.ObjectID = &obj.ID
+		entry.Size = obj.Size
+	}
+	if err := service.CreateUserFileEntry(entry); err != nil {
+		t.Fatalf("create %s failed: %v", name, err)
+	}
+	return entry
+}
+
+// 测试创建条目时四种重名策略 以及 rename 的编号规则
+func TestCreateUserFileEntryConflictPolicy(t *testing.T) {
+	cleanUserFileTables(t)
+	user := createQuotaTestUser(t, 0)
+	oldObj := createQuotaTestObject(t, user.ID, 100)
+	newObj := createQuotaTestObject(t, user.ID, 40)
+	repo.Db.Model(&model.FileObject{}).Where("id = ?", oldObj.ID).Update("ref_count", 2)
+
+	original := createPolicyEntry(t, user.ID, nil, "report.pdf", oldObj)
+	create := func(name string, policy service.ConflictPolicy) (*dto.EntryResult, error) {
+		return service.CreateUserFileEntryWithPolicy(&model.UserFile{
+			UserID:   user.ID,
+			Name:     name,
+			ObjectID: &newObj.ID,
+			Size:     newObj.Size,
+		}, policy)
+	}
+
+	if _, err := create("report.pdf", service.ConflictFail); !errors.Is(err, service.ErrNameConflict) {
+		t.Fatalf("expect ErrNameConflict at root, got %v", err)
+	}
+	for _, want := range []string{"report (1).pdf", "report (2).pdf"} {
+		result, err := create("report.pdf", service.ConflictRename)
+		if err != nil || result.Name != want || result.Action != service.ActionRenamed {
+			t.Fatalf("expect %s, got %+v %v", want, result, err)
+		}
+	}
+	result, err := create("report.pdf", service.ConflictSkip)
+	if !errors.Is(err, service.ErrEntrySkipped) || result.FileID != original.ID {
+		t.Fatalf("expect skip to report the existing entry, got %+v %v", result, err)
+	}
+
+	before := loadUseSpace(t, user.ID)
+	result, err = create("report.pdf", service.ConflictOverwrite)
+	if err != nil || result.FileID != original.ID || result.Action != service.ActionOverwritten {
+		t.Fatalf("expect overwrite in place, got %+v %v", result, err)
+	}
+	var updated model.UserFile
+	repo.Db.First(&updated, original.ID)
+	if *updated.ObjectID != newObj.ID || updated.Size != newObj.Size {
+		t.Fatalf("expect entry to point at the new object, got %+v", updated)
+	}
+	// 旧内容保留为历史版本 仍占用空间与引用
+	if used := loadUseSpace(t, user.ID); used != before+40 {
+		t.Fatalf("expect use_space %d after overwrite, got %d", before+40, used)
+	}
+	var old model.FileObject
+	repo.Db.First(&old, oldObj.ID)
+	if old.RefCount != 2 {
+		t.Fatalf("expect replaced object to stay referenced by its version, got %d", old.RefCount)
+	}
+
+	dir := createPolicyEntry(t, user.ID, nil, ".config", nil)
+	result, err = service.CreateUserFileEntryWithPolicy(&model.UserFile{UserID: user.ID, Name: ".config", IsDir: true}, service.ConflictOverwrite)
+	if err != nil || result.FileID != dir.ID || result.Action != service.ActionMerged {
+		t.Fatalf("expect folder to be reused, got %+v %v", result, err)
+	}
+	result, err = service.CreateUserFileEntryWithPolicy(&model.UserFile{UserID: user.ID, Name: ".config", IsDir: true}, service.ConflictRename)
+	if err != nil || result.Name != ".config (1)" {
+		t.Fatalf("expect folder rename, got %+v %v", result, err)
+	}
+	if _, err := create(".config", service.ConflictOverwrite); !errors.Is(err, service.ErrNameConflict) {
+		t.Fatalf("expect a file not to overwrite a folder, got %v", err)
+	}
+}
+
+// 测试移动与复制: overwrite 合并同名文件夹 rename 与 skip 报告最终名字
+func TestMoveAndCopyConflictPolicy(t *testing.T) {
+	cleanUserFileTables(t)
+	user := createQuotaTestUser(t, 0)
+	objA := createQuotaTestObject(t, user.ID, 10)
+	objB := createQuotaTestObject(t, user.ID, 20)
+
+	src := createPolicyEntry(t, user.ID, nil, "album", nil)
+	createPolicyEntry(t, user.ID, &src.ID, "a.jpg", objA)
+	createPolicyEntry(t, user.ID, &src.ID, "b.jpg", objB)
+	target := createPolicyEntry(t, user.ID, nil, "backup", nil)
+	dst := createPolicyEntry(t, user.ID, &target.ID, "album", nil)
+	kept := createPolicyEntry(t, user.ID, &dst.ID, "a.jpg", objB)
+
+	if err := service.MoveFiles(user.ID, []uint64{src.ID}, &target.ID); err == nil {
+		t.Fatal("expect default move to fail on a taken name")
+	}
+
+	results, err := service.CopyFilesWithPolicy(user.ID, []uint64{src.ID}, &target.ID, service.ConflictRename)
+	if err != nil || len(results) != 1 || results[0].Name != "album (1)" || results[0].SourceID != src.ID {
+		t.Fatalf("expect renamed copy, got %+v %v", results, err)
+	}
+	copied := findUserEntry(t, user.ID, target.ID, "album (1)")
+	findUserEntry(t, user.ID, copied.ID, "a.jpg")
+	findUserEntry(t, user.ID, copied.ID, "b.jpg")
+
+	results, err = service.CopyFilesWithPolicy(user.ID, []uint64{src.ID}, &target.ID, service.ConflictSkip)
+	if err != nil || results[0].Action != service.ActionSkipped || results[0].FileID != dst.ID {
+		t.Fatalf("expect skipped copy, got %+v %v", results, err)
+	}
+	if _, err := service.CopyFilesWithPolicy(user.ID, []uint64{src.ID}, &src.ID, service.ConflictRename); err == nil {
+		t.Fatal("expect copying a folder into itself to fail")
+	}
+
+	results, err = service.MoveFilesWithPolicy(user.ID, []uint64{src.ID}, &target.ID, service.ConflictOverwrite)
+	if err != nil || results[0].Action != service.ActionMerged || results[0].FileID != dst.ID {
+		t.Fatalf("expect merged move, got %+v %v", results, err)
+	}
+	overwritten := findUserEntry(t, user.ID, dst.ID, "a.jpg")
+	if overwritten.ID != kept.ID || *overwritten.ObjectID != objA.ID {
+		t.Fatalf("expect a.jpg to be overwritten in place, got %+v", overwritten)
+	}
+	findUserEntry(t, user.ID, dst.ID, "b.jpg")
+	var count int64
+	repo.Db.Unscoped().Model(&model.UserFile{}).Where("id = ?", src.ID).Count(&count)
+	if count != 0 {
+		t.Fatal("expect the emptied source folder to be removed")
+	}
+	if used, _ := service.ReconcileUserSpace(user.ID); loadUseSpace(t, user.ID) != used {
+		t.Fatalf("expect use_space to stay consistent with file rows")
+	}
+}
+
+// 测试恢复与秒传使用重名策略
+func TestRestoreAndUploadConflictPolicy(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "conflict_upload")
+	obj := createQuotaTestObject(t, user.ID, 8)
+
+	recycled := createPolicyEntry(t, user.ID, nil, "notes.txt", obj)
+	if err := service.MoveToRecycle(user.ID, recycled.ID); err != nil {
+		t.Fatal(err)
+	}
+	createPolicyEntry(t, user.ID, nil, "notes.txt", obj)
+	if err := service.RestoreFile(uint(user.ID), uint(recycled.ID)); !errors.Is(err, service.ErrNameConflict) {
+		t.Fatalf("expect ErrNameConflict on restore, got %v", err)
+	}
+	result, err := service.RestoreFileWithPolicy(uint(user.ID), uint(recycled.ID), service.ConflictRename)
+	if err != nil || result.FileID != recycled.ID || result.Name != "notes (1).txt" {
+		t.Fatalf("expect restore under a new name, got %+v %v", result, err)
+	}
+
+	if _, err := service.ParseConflictPolicy("replace"); !errors.Is(err, service.ErrInvalidConflictPolicy) {
+		t.Fatalf("expect ErrInvalidConflictPolicy, got %v", err)
+	}
+	data := []byte("conflict upload")
+	hash := sha256Hex(data)
+	startMultipart(t, user, "upload.txt", hash, [][]byte{data}, []int{0})
+	if _, err := service.CompleteFile(context.Background(), dto.MultipartCompleteRequest{
+		FileHash:    hash,
+		FileName:    "upload.txt",
+		FileSize:    int64(len(data)),
+		TotalChunks: 1,
+	}, user.UserName); err != nil {
+		t.Fatal(err)
+	}
+	req := &dto.UploadFileByHashRequest{UserId: user.ID, FileName: "upload.txt", Size: int64(len(data)), Hash: hash}
+	if _, err := service.FastUpload(context.Background(), req); !errors.Is(err, service.ErrNameConflict) {
+		t.Fatalf("expect ErrNameConflict on instant upload, got %v", err)
+	}
+	req.ConflictPolicy = "skip"
+	resp, err := service.FastUpload(context.Background(), req)
+	if err != nil || resp.Instant || resp.Action != service.ActionSkipped {
+		t.Fatalf("expect skipped instant upload, got %+v %v", resp, err)
+	}
+	req.ConflictPolicy = "rename"
+	resp, err = service.FastUpload(context.Background(), req)
+	if err != nil || !resp.Instant || resp.FileName != "upload (1).txt" {
+		t.Fatalf("expect renamed instant upload, got %+v %v", resp, err)
+	}
+
+	_, err = service.MultiPartFileInit(context.Background(), dto.MultipartInitRequest{
+		UserId:      user.ID,
+		FileName:    "upload.txt",
+		Size:        1,
+		Hash:        sha256Hex([]byte("x")),
+		ChunkSize:   1,
+		TotalChunks: 1,
+	})
+	if !errors.Is(err, service.ErrNameConflict) {
+		t.Fatalf("expect init to fail before uploading, got %v", err)
+	}
+}
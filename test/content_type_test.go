@@ -0,0 +1,101 @@
+package test
+
+import (
+	"CloudVault/internal/dto"
+	"CloudVault/internal/service"
+	"CloudVault/model"
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 测试按内容识别类型 扩展名只细化通用结果
+func TestSniffContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")
+	zipHead := []byte("PK\x03\x04\x14\x00\x00\x00")
+	cases := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"photo.png", png, "image/png"},
+		{"photo.jpg", png, "image/png"}, // 扩展名不可信
+		{"photo.webp", webp, "image/webp"},
+		{"notes.md", []byte("# Title\n\nbody"), "text/markdown; charset=utf-8"},
+		{"data.json", []byte(`{"a": 1}`), "application/json"},
+		{"report.docx", zipHead, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"bundle.zip", zipHead, "application/zip"},
+		{"logo.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "image/svg+xml"},
+		{"logo.svg", []byte(`<?xml version="1.0"?><svg></svg>`), "image/svg+xml"},
+		{"page.txt", []byte("<!DOCTYPE html><html><script>alert(1)</script>"), "text/html; charset=utf-8"},
+		{"song.mp3", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "audio/mpeg"},
+		{"track.flac", []byte{0x00, 0x01, 0x02, 0x03}, "audio/flac"},
+	}
+	for _, tc := range cases {
+		if got := service.SniffContentType(tc.head, tc.name); got != tc.want {
+			t.Fatalf("SniffContentType(%s) = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+// 测试内联白名单: HTML 与 SVG 不内联 文本一律按 text/plain 返回
+func TestInlineContentType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		want        string
+		inline      bool
+	}{
+		{"image/png", "image/png", true},
+		{"video/mp4", "video/mp4", true},
+		{"application/pdf", "application/pdf", true},
+		{"text/markdown; charset=utf-8", "text/plain; charset=utf-8", true},
+		{"application/json", "text/plain; charset=utf-8", true},
+		{"text/html; charset=utf-8", "", false},
+		{"image/svg+xml", "", false},
+		{"application/zip", "", false},
+	}
+	for _, tc := range cases {
+		got, inline := service.InlineContentType(tc.contentType)
+		if got != tc.want || inline != tc.inline {
+			t.Fatalf("InlineContentType(%s) = %s %v, want %s %v", tc.contentType, got, inline, tc.want, tc.inline)
+		}
+	}
+}
+
+// 测试上传完成时记录识别出的类型 预览按白名单决定是否内联
+func TestStoredContentTypeAndPreview(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "ctype_user")
+	data := []byte("<html><body><script>alert(1)</script></body></html>")
+	hash := sha256Hex(data)
+	startMultipart(t, user, "innocent.png", hash, [][]byte{data}, []int{0})
+	result, err := service.CompleteFile(context.Background(), dto.MultipartCompleteRequest{
+		FileHash:    hash,
+		FileName:    "innocent.png",
+		FileSize:    int64(len(data)),
+		TotalChunks: 1,
+	}, user.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := service.GetFileObjectByHash(user.ID, hash)
+	if err != nil || obj.ContentType != "text/html; charset=utf-8" {
+		t.Fatalf("expect sniffed html type, got %+v %v", obj, err)
+	}
+
+	previewURL, err := service.GetPreviewURL(context.Background(), user.ID, result.FileID, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(previewURL)
+	if disposition := parsed.Query().Get("response-content-disposition"); disposition != `attachment; filename="innocent.png"` {
+		t.Fatalf("expect html not to be previewed inline, got %q", disposition)
+	}
+
+	legacy := &model.FileObject{ContentType: ""}
+	if got := service.ObjectContentType(legacy, "clip.webm"); got != "video/webm" {
+		t.Fatalf("expect extension fallback for objects without a stored type, got %s", got)
+	}
+}
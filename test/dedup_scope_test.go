@@ -0,0 +1,235 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"context"
+	"fmt"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func useDedupScope(t *testing.T, scope string) {
+	t.Helper()
+	old := config.AppConfig.DedupScope
+	config.AppConfig.DedupScope = scope
+	t.Cleanup(func() { config.AppConfig.DedupScope = old })
+}
+
+// 测试按用户 / 租户去重: 其他范围的对象既不复用 也不能通过 hash 查到
+func TestDedupScopeUserAndTenant(t *testing.T) {
+	cleanFileObjectTables(t)
+	useDedupScope(t, service.DedupUser)
+	alice := createFileObjectTestUser(t, "dedup_alice")
+	bob := createFileObjectTestUser(t, "dedup_bob")
+	data := []byte("same bytes, different owners")
+
+	first, err := simpleUpload(t, alice.ID, dto.SimpleUploadRequest{FileName: "a.txt"}, data)
+	if err != nil || first.Deduped {
+		t.Fatalf("expect a new object, got %+v %v", first, err)
+	}
+	fast, err := service.FastUpload(context.Background(), &dto.UploadFileByHashRequest{
+		UserId: bob.ID, Hash: first.Hash, FileName: "b.txt", Size: int64(len(data)),
+	})
+	if err != nil || fast.Instant || fast.Reason != "hash_not_found" {
+		t.Fatalf("expect another user's object to be invisible, got %+v %v", fast, err)
+	}
+	second, err := simpleUpload(t, bob.ID, dto.SimpleUploadRequest{FileName: "b.txt"}, data)
+	if err != nil || second.Deduped {
+		t.Fatalf("expect bob to get his own object, got %+v %v", second, err)
+	}
+	aliceObj, err := service.GetFileObjectByHash(alice.ID, first.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobObj, err := service.GetFileObjectByHash(bob.ID, first.Hash)
+	if err != nil || bobObj.ID == aliceObj.ID || bobObj.UserID != bob.ID {
+		t.Fatalf("expect separate objects per user, got %+v %v", bobObj, err)
+	}
+	again, err := simpleUpload(t, alice.ID, dto.SimpleUploadRequest{FileName: "c.txt"}, data)
+	if err != nil || !again.Deduped || loadRefCount(t, aliceObj.ID) != 2 {
+		t.Fatalf("expect dedup within the same user, got %+v %v", again, err)
+	}
+
+	// 同一租户内的用户之间去重
+	useDedupScope(t, service.DedupTenant)
+	carol := createFileObjectTestUser(t, "dedup_carol")
+	dave := createFileObjectTestUser(t, "dedup_dave")
+	for _, u := range []*model.User{carol, dave} {
+		if err := service.SetUserTenant(u.ID, 7); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tenantData := []byte("tenant shared report")
+	if _, err := simpleUpload(t, carol.ID, dto.SimpleUploadRequest{FileName: "r.txt"}, tenantData); err != nil {
+		t.Fatal(err)
+	}
+	shared, err := simpleUpload(t, dave.ID, dto.SimpleUploadRequest{FileName: "r.txt"}, tenantData)
+	if err != nil || !shared.Deduped {
+		t.Fatalf("expect dedup within the tenant, got %+v %v", shared, err)
+	}
+	outside, err := simpleUpload(t, alice.ID, dto.SimpleUploadRequest{FileName: "r.txt"}, tenantData)
+	if err != nil || outside.Deduped {
+		t.Fatalf("expect a user without tenant not to share the object, got %+v %v", outside, err)
+	}
+}
+
+// 测试关闭去重: 相同内容每次保存一份 删除其中一份不影响另一份
+func TestDedupScopeNone(t *testing.T) {
+	cleanFileObjectTables(t)
+	useDedupScope(t, service.DedupNone)
+	user := createFileObjectTestUser(t, "dedup_none")
+	data := []byte("stored twice")
+
+	for _, name := range []string{"one.txt", "two.txt"} {
+		resp, err := simpleUpload(t, user.ID, dto.SimpleUploadRequest{FileName: name}, data)
+		if err != nil || resp.Deduped {
+			t.Fatalf("expect no dedup, got %+v %v", resp, err)
+		}
+	}
+	var objects []model.FileObject
+	repo.Db.Where("hash = ?", sha256Hex(data)).Find(&objects)
+	if len(objects) != 2 || objects[0].ObjectName == objects[1].ObjectName || objects[0].DedupKey == objects[1].DedupKey {
+		t.Fatalf("expect two independent objects, got %+v", objects)
+	}
+	if _, err := service.GetFileObjectByHash(user.ID, sha256Hex(data)); err == nil {
+		t.Fatalf("expect no hash lookup without dedup")
+	}
+}
+
+// 测试切换范围后迁移旧数据: 只被一个用户引用的对象改为该用户的 key 多人共用的保持不变
+func TestMigrateDedupScope(t *testing.T) {
+	cleanFileObjectTables(t)
+	useDedupScope(t, service.DedupGlobal)
+	alice := createFileObjectTestUser(t, "migrate_alice")
+	bob := createFileObjectTestUser(t, "migrate_bob")
+	own := storeTestObject(t, alice, []byte("only alice"))
+	createPolicyEntry(t, alice.ID, nil, "own.txt", own)
+	common := storeTestObject(t, alice, []byte("alice and bob"))
+	createPolicyEntry(t, alice.ID, nil, "common.txt", common)
+	createPolicyEntry(t, bob.ID, nil, "common.txt", common)
+	if own.DedupKey != "" || common.DedupKey != "" {
+		t.Fatalf("expect global keys, got %q %q", own.DedupKey, common.DedupKey)
+	}
+
+	useDedupScope(t, service.DedupUser)
+	result, err := service.MigrateDedupScope(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Scanned != 2 || result.Rekeyed != 1 || result.Shared != 1 {
+		t.Fatalf("unexpected migration result %+v", result)
+	}
+	found, err := service.GetFileObjectByHash(alice.ID, own.Hash)
+	if err != nil || found.ID != own.ID {
+		t.Fatalf("expect alice's object under her key, got %+v %v", found, err)
+	}
+	if _, err := service.GetFileObjectByHash(bob.ID, common.Hash); err == nil {
+		t.Fatalf("expect the shared object not to be found in bob's scope")
+	}
+
+	// 切回全局 已迁移的对象回到空 key
+	useDedupScope(t, service.DedupGlobal)
+	if result, err = service.MigrateDedupScope(context.Background()); err != nil || result.Rekeyed != 1 {
+		t.Fatalf("expect the object to move back, got %+v %v", result, err)
+	}
+	if found, err := service.GetFileObjectByHash(bob.ID, own.Hash); err != nil || found.ID != own.ID {
+		t.Fatalf("expect global lookup to find the object, got %+v %v", found, err)
+	}
+}
+
+// 测试切换范围后同一内容在新 key 下再次上传 两个对象共用存储路径 删除其一不影响另一个
+func TestRemoveObjectKeepsContentSharedAcrossScopes(t *testing.T) {
+	cleanFileObjectTables(t)
+	useDedupScope(t, service.DedupGlobal)
+	alice := createFileObjectTestUser(t, "scope_switch_alice")
+	bob := createFileObjectTestUser(t, "scope_switch_bob")
+	data := []byte("content stored before the scope switch")
+	global := storeTestObject(t, alice, data)
+	createPolicyEntry(t, bob.ID, nil, "kept.txt", global)
+
+	useDedupScope(t, service.DedupUser)
+	hash := sha256Hex(data)
+	startMultipart(t, alice, "again.txt", hash, [][]byte{data}, []int{0})
+	if _, err := service.CompleteFile(context.Background(), dto.MultipartCompleteRequest{
+		FileHash:    hash,
+		FileName:    "again.txt",
+		FileSize:    int64(len(data)),
+		TotalChunks: 1,
+	}, alice.UserName); err != nil {
+		t.Fatalf("CompleteFile failed: %v", err)
+	}
+	scoped, err := service.GetFileObjectByHash(alice.ID, hash)
+	if err != nil || scoped.ID == global.ID {
+		t.Fatalf("expect a new object under alice's key, got %+v %v", scoped, err)
+	}
+	if scoped.BucketName != global.BucketName || scoped.ObjectName != global.ObjectName {
+		t.Fatalf("expect both objects at %s, got %s", global.ObjectName, scoped.ObjectName)
+	}
+
+	if err := service.RemoveObject(scoped.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, storage.Default, global.BucketName, global.ObjectName); got != string(data) {
+		t.Fatalf("bob's content changed: %q", got)
+	}
+	if err := service.RemoveObject(global.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := storage.Default.GetObject(context.Background(), global.BucketName, global.ObjectName); err == nil {
+		t.Fatalf("expect the content to be removed with the last object")
+	}
+}
+
+// 测试迁移检查之后目标 key 被并发上传占用: 计为冲突并继续 不中断整个迁移
+func TestMigrateDedupScopeRaceOnTargetKey(t *testing.T) {
+	cleanFileObjectTables(t)
+	useDedupScope(t, service.DedupGlobal)
+	alice := createFileObjectTestUser(t, "migrate_race_alice")
+	raced := storeTestObject(t, alice, []byte("taken while migrating"))
+	createPolicyEntry(t, alice.ID, nil, "raced.txt", raced)
+	other := storeTestObject(t, alice, []byte("migrated normally"))
+	createPolicyEntry(t, alice.ID, nil, "other.txt", other)
+
+	// 模拟 Count 与 Update 之间的并发上传: 第一次改 key 之前插入同 key 同 hash 的对象
+	const callback = "test:dedup_migrate_race"
+	inserted := false
+	if err := repo.Db.Callback().Update().Before("gorm:update").Register(callback, func(tx *gorm.DB) {
+		if inserted || tx.Statement.Table != "file_object" {
+			return
+		}
+		inserted = true
+		concurrent := &model.FileObject{
+			UserID:     alice.ID,
+			DedupKey:   fmt.Sprintf("u:%d", alice.ID),
+			Hash:       raced.Hash,
+			BucketName: raced.BucketName,
+			ObjectName: raced.ObjectName,
+			Size:       raced.Size,
+			RefCount:   1,
+		}
+		if err := tx.Session(&gorm.Session{NewDB: true}).Create(concurrent).Error; err != nil {
+			t.Error(err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.Db.Callback().Update().Remove(callback) })
+
+	useDedupScope(t, service.DedupUser)
+	result, err := service.MigrateDedupScope(context.Background())
+	if err != nil {
+		t.Fatalf("expect the migration to go on, got %v", err)
+	}
+	if !inserted || result.Scanned != 2 || result.Conflicts != 1 || result.Rekeyed != 1 {
+		t.Fatalf("unexpected migration result %+v", result)
+	}
+	if found, err := service.GetFileObjectByHash(alice.ID, other.Hash); err != nil || found.ID != other.ID {
+		t.Fatalf("expect the later object to be migrated, got %+v %v", found, err)
+	}
+}
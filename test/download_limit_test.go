@@ -0,0 +1,132 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/service"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// useDownloadTiers replaces the download limits for one test.
+func useDownloadTiers(t *testing.T, base config.DownloadTier, tiers map[string]config.DownloadTier) {
+	t.Helper()
+	oldBase, oldTiers := config.AppConfig.DownloadDefaultTier, config.AppConfig.DownloadTiers
+	config.AppConfig.DownloadDefaultTier, config.AppConfig.DownloadTiers = base, tiers
+	t.Cleanup(func() {
+		config.AppConfig.DownloadDefaultTier, config.AppConfig.DownloadTiers = oldBase, oldTiers
+	})
+}
+
+// 测试并发下载数: 超出上限返回 ErrTooManyStreams 释放后可再次下载 tier 覆盖默认限制
+func TestDownloadStreamLimit(t *testing.T) {
+	cleanFileObjectTables(t)
+	useDownloadTiers(t, config.DownloadTier{Streams: 1}, map[string]config.DownloadTier{"vip": {Streams: 2}})
+	user := createFileObjectTestUser(t, "stream_limit")
+	ctx := context.Background()
+
+	first, err := service.AcquireUserDownload(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.AcquireUserDownload(ctx, user.ID); !errors.Is(err, service.ErrTooManyStreams) {
+		t.Fatalf("expect ErrTooManyStreams, got %v", err)
+	}
+	first.Release()
+	first.Release()
+	second, err := service.AcquireUserDownload(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("expect a slot after release, got %v", err)
+	}
+	defer second.Release()
+
+	if err := service.SetUserTier(user.ID, "gold"); !errors.Is(err, service.ErrUnknownTier) {
+		t.Fatalf("expect ErrUnknownTier, got %v", err)
+	}
+	if err := service.SetUserTier(user.ID, "VIP"); err != nil {
+		t.Fatal(err)
+	}
+	third, err := service.AcquireUserDownload(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("expect the vip tier to allow two streams, got %v", err)
+	}
+	third.Release()
+}
+
+// 测试限速: 超出一秒的量后按速率等待 同一用户的多个下载共用令牌桶
+func TestDownloadRateLimit(t *testing.T) {
+	cleanFileObjectTables(t)
+	useDownloadTiers(t, config.DownloadTier{Rate: 16 << 10}, nil)
+	user := createFileObjectTestUser(t, "rate_limit")
+
+	stream, err := service.AcquireUserDownload(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Release()
+	var a, b bytes.Buffer
+	start := time.Now()
+	if _, err := stream.Writer(&a).Write(make([]byte, 16<<10)); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 200*time.Millisecond {
+		t.Fatalf("expect the first second of data without waiting")
+	}
+	other, err := service.AcquireUserDownload(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Release()
+	if _, err := other.Writer(&b).Write(make([]byte, 8<<10)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("expect the second stream to wait for the shared bucket, took %v", elapsed)
+	}
+	if a.Len() != 16<<10 || b.Len() != 8<<10 {
+		t.Fatalf("unexpected output %d %d", a.Len(), b.Len())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limited, _ := service.AcquireUserDownload(ctx, user.ID)
+	if _, err := limited.Writer(&b).Write(make([]byte, 32<<10)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect the wait to stop with the request, got %v", err)
+	}
+}
+
+// 测试分享下载的并发限制按分享者的 tier 返回 429
+func TestShareDownloadStreamLimit(t *testing.T) {
+	cleanFileObjectTables(t)
+	useDownloadTiers(t, config.DownloadTier{ShareStreams: 1}, nil)
+	user := createFileObjectTestUser(t, "share_limit")
+	entry := createPolicyEntry(t, user.ID, nil, "shared.txt", storeTestObject(t, user, []byte("shared content")))
+	share, err := service.CreateShare(user.ID, entry.ID, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := newTusClient(t, user)
+
+	held, err := service.AcquireShareDownload(context.Background(), share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := tc.do(http.MethodGet, "/api/share/download/"+share.ShareID, nil, nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expect 429, got %d", rec.Code)
+	}
+	held.Release()
+	rec = tc.do(http.MethodGet, "/api/share/download/"+share.ShareID, nil, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "shared content" {
+		t.Fatalf("expect the download after release, got %d %q", rec.Code, rec.Body.String())
+	}
+	// 请求结束后名额已释放
+	if again, err := service.AcquireShareDownload(context.Background(), share); err != nil {
+		t.Fatalf("expect the handler to release its slot, got %v", err)
+	} else {
+		again.Release()
+	}
+}
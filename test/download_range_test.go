@@ -0,0 +1,165 @@
+package test
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"CloudVault/utils"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header string
+		want   []utils.ByteRange
+		err    error
+	}{
+		{header: "", want: nil},
+		{header: "items=0-1", want: nil},
+		{header: "bytes=0-9", want: []utils.ByteRange{{Start: 0, Length: 10}}},
+		{header: "bytes=5-", want: []utils.ByteRange{{Start: 5, Length: 95}}},
+		{header: "bytes=-10", want: []utils.ByteRange{{Start: 90, Length: 10}}},
+		{header: "bytes=90-200", want: []utils.ByteRange{{Start: 90, Length: 10}}},
+		{header: "bytes=0-1, 10-11", want: []utils.ByteRange{{Start: 0, Length: 2}, {Start: 10, Length: 2}}},
+		{header: "bytes=0-1,200-300", want: []utils.ByteRange{{Start: 0, Length: 2}}},
+		{header: "bytes=5-1", want: nil},
+		{header: "bytes=0-99,0-99", want: nil}, // 重叠超过整个文件 返回全部
+		{header: "bytes=100-", err: utils.ErrRangeNotSatisfiable},
+		{header: "bytes=-0", err: utils.ErrRangeNotSatisfiable},
+	}
+	for _, tc := range cases {
+		got, err := utils.ParseRange(tc.header, 100)
+		if !errors.Is(err, tc.err) || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseRange(%q) = %+v, %v; want %+v, %v", tc.header, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestMemoryStoreGetObjectRange(t *testing.T) {
+	store := storage.NewMemoryStore()
+	ctx := context.Background()
+	if err := store.PutObject(ctx, "b", "o", strings.NewReader("0123456789"), 10, storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	reader, info, err := store.GetObjectRange(ctx, "b", "o", 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	if string(data) != "3456" || info.Size != 10 {
+		t.Fatalf("unexpected range %q size %d", data, info.Size)
+	}
+	if _, _, err := store.GetObjectRange(ctx, "b", "o", 8, 5); !errors.Is(err, storage.ErrInvalidRange) {
+		t.Fatalf("expect ErrInvalidRange, got %v", err)
+	}
+}
+
+// 测试分享下载的 Range、If-Range 与条件请求
+func TestShareDownloadRange(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "range_user")
+	content := []byte("abcdefghijklmnopqrstuvwxyz")
+	obj := storeTestObject(t, user, content)
+	entry := createPolicyEntry(t, user.ID, nil, "letters.txt", obj)
+	share, err := service.CreateShare(user.ID, entry.ID, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := newTusClient(t, user)
+	url := "/api/share/download/" + share.ShareID
+	get := func(headers map[string]string) (int, http.Header, string) {
+		rec := tc.do(http.MethodGet, url, nil, headers)
+		return rec.Code, rec.Header(), rec.Body.String()
+	}
+
+	code, header, body := get(nil)
+	etag := header.Get("ETag")
+	if code != http.StatusOK || body != string(content) || header.Get("Accept-Ranges") != "bytes" || etag == "" {
+		t.Fatalf("expect full content with validators, got %d %v %q", code, header, body)
+	}
+	if code, _, _ := get(map[string]string{"If-None-Match": etag}); code != http.StatusNotModified {
+		t.Fatalf("expect 304, got %d", code)
+	}
+
+	code, header, body = get(map[string]string{"Range": "bytes=10-"})
+	if code != http.StatusPartialContent || body != "klmnopqrstuvwxyz" || header.Get("Content-Range") != "bytes 10-25/26" {
+		t.Fatalf("expect partial content, got %d %v %q", code, header, body)
+	}
+	// If-Range 不匹配时返回整个文件
+	if code, _, body := get(map[string]string{"Range": "bytes=10-", "If-Range": `"stale"`}); code != http.StatusOK || body != string(content) {
+		t.Fatalf("expect full content for stale If-Range, got %d %q", code, body)
+	}
+	if code, _, _ := get(map[string]string{"Range": "bytes=10-", "If-Range": etag}); code != http.StatusPartialContent {
+		t.Fatalf("expect If-Range with the current ETag to apply, got %d", code)
+	}
+	code, header, _ = get(map[string]string{"Range": "bytes=30-"})
+	if code != http.StatusRequestedRangeNotSatisfiable || header.Get("Content-Range") != "bytes */26" {
+		t.Fatalf("expect 416, got %d %v", code, header)
+	}
+
+	code, header, body = get(map[string]string{"Range": "bytes=0-2,-3"})
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if code != http.StatusPartialContent || err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("expect multipart ranges, got %d %v", code, header)
+	}
+	if header.Get("Content-Length") != strconv.Itoa(len(body)) {
+		t.Fatalf("Content-Length %s does not match body %d", header.Get("Content-Length"), len(body))
+	}
+	mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	var parts []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+"="+string(data))
+	}
+	if want := []string{"bytes 0-2/26=abc", "bytes 23-25/26=xyz"}; !reflect.DeepEqual(parts, want) {
+		t.Fatalf("unexpected parts %v", parts)
+	}
+}
+
+// 测试 Last-Modified 取文件条目的修改时间: 条目指向更早创建的对象时 If-Modified-Since 不会误判为未修改
+func TestDownloadLastModifiedFollowsUserFile(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "modified_user")
+	content := []byte("restored from an older version")
+	obj := storeTestObject(t, user, content)
+	created := time.Now().Add(-48 * time.Hour)
+	if err := repo.Db.Model(&model.FileObject{}).Where("id = ?", obj.ID).UpdateColumn("created_at", created).Error; err != nil {
+		t.Fatal(err)
+	}
+	_ = utils.InvalidateFileObjectCache(context.Background(), obj.ID)
+	entry := createPolicyEntry(t, user.ID, nil, "restored.txt", obj)
+	share, err := service.CreateShare(user.ID, entry.ID, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := newTusClient(t, user)
+	url := "/api/share/download/" + share.ShareID
+
+	rec := tc.do(http.MethodGet, url, nil, nil)
+	modified, err := http.ParseTime(rec.Header().Get("Last-Modified"))
+	if rec.Code != http.StatusOK || err != nil || modified.Before(created.Add(time.Hour)) {
+		t.Fatalf("expect Last-Modified from the file entry, got %d %q", rec.Code, rec.Header().Get("Last-Modified"))
+	}
+	since := time.Now().Add(-24 * time.Hour).UTC().Format(http.TimeFormat)
+	if rec := tc.do(http.MethodGet, url, nil, map[string]string{"If-Modified-Since": since}); rec.Code != http.StatusOK || rec.Body.String() != string(content) {
+		t.Fatalf("expect the changed file to be sent, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,184 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/internal/task"
+	"CloudVault/model"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// createQueuedTask stores a pending offline download task without publishing it.
+func createQueuedTask(t *testing.T, userID uint64, taskType, source string) *model.DownloadTask {
+	t.Helper()
+	downloadTask := &model.DownloadTask{
+		UserID:     userID,
+		Type:       taskType,
+		Source:     source,
+		Bucket:     config.AppConfig.BucketName,
+		ObjectName: "task_" + time.Now().Format("150405.000000000"),
+		FileName:   "remote.bin",
+		Status:     "pending",
+	}
+	if err := repo.Db.Create(downloadTask).Error; err != nil {
+		t.Fatal(err)
+	}
+	return downloadTask
+}
+
+// 测试取消正在执行的离线下载: 经 Redis 广播中断传输 删除部分写入的对象
+func TestCancelRunningDownloadTask(t *testing.T) {
+	cleanFileObjectTables(t)
+	oldPrivate := config.AppConfig.DownloadAllowPrivate
+	config.AppConfig.DownloadAllowPrivate = true
+	t.Cleanup(func() { config.AppConfig.DownloadAllowPrivate = oldPrivate })
+	user := createFileObjectTestUser(t, "task_cancel")
+
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1048576")
+		_, _ = w.Write(make([]byte, 1024))
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done() // 剩余内容一直不发送
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ready := make(chan struct{})
+	go task.ListenTaskControl(ctx, repo.Redis, ready)
+	<-ready
+
+	downloadTask := createQueuedTask(t, user.ID, "http", server.URL)
+	result := make(chan error, 1)
+	go func() { result <- task.ProcessDownloadTask(context.Background(), downloadTask.ID) }()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer did not start")
+	}
+
+	canceled, err := task.CancelDownloadTask(context.Background(), user.ID, downloadTask.ID)
+	if err != nil || canceled.Status != "canceled" || canceled.FinishedAt == nil {
+		t.Fatalf("expect the task to be canceled, got %+v %v", canceled, err)
+	}
+	select {
+	case err := <-result:
+		if !errors.Is(err, task.ErrTaskCanceled) {
+			t.Fatalf("expect ErrTaskCanceled from the worker, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("running transfer was not interrupted")
+	}
+	objectName := service.BuildObjectName(user.UserName, downloadTask.ObjectName)
+	if _, _, err := storage.Default.GetObject(context.Background(), downloadTask.Bucket, objectName); err == nil {
+		t.Fatalf("expect the partial object to be removed")
+	}
+	tasks, err := task.ListDownloadTasks(user.ID, 10)
+	if err != nil || len(tasks) != 1 || tasks[0].Status != "canceled" {
+		t.Fatalf("expect the canceled task in the list, got %+v %v", tasks, err)
+	}
+	if _, err := task.CancelDownloadTask(context.Background(), user.ID, downloadTask.ID); !errors.Is(err, task.ErrTaskState) {
+		t.Fatalf("expect ErrTaskState for a canceled task, got %v", err)
+	}
+}
+
+// 测试暂停排队中的任务: 领取时跳过 只有暂停的任务可以恢复 解压任务不支持
+func TestPauseQueuedDownloadTask(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "task_pause")
+	downloadTask := createQueuedTask(t, user.ID, "http", "http://example.com/file.bin")
+
+	if _, err := task.ResumeDownloadTask(context.Background(), user.ID, downloadTask.ID); !errors.Is(err, task.ErrTaskState) {
+		t.Fatalf("expect ErrTaskState when resuming a pending task, got %v", err)
+	}
+	paused, err := task.PauseDownloadTask(context.Background(), user.ID, downloadTask.ID)
+	if err != nil || paused.Status != "paused" {
+		t.Fatalf("expect the task to be paused, got %+v %v", paused, err)
+	}
+	if err := task.ProcessDownloadTask(context.Background(), downloadTask.ID); err != nil {
+		t.Fatalf("expect the queued message to be skipped, got %v", err)
+	}
+	var stored model.DownloadTask
+	repo.Db.First(&stored, downloadTask.ID)
+	if stored.Status != "paused" || stored.StartedAt != nil {
+		t.Fatalf("expect the paused task untouched, got %+v", stored)
+	}
+	if _, err := task.PauseDownloadTask(context.Background(), user.ID+1, downloadTask.ID); err == nil {
+		t.Fatalf("expect other users not to control the task")
+	}
+
+	extract := createQueuedTask(t, user.ID, "extract", "1")
+	if _, err := task.CancelDownloadTask(context.Background(), user.ID, extract.ID); !errors.Is(err, task.ErrTaskNotControllable) {
+		t.Fatalf("expect ErrTaskNotControllable, got %v", err)
+	}
+}
+
+// getHookStore runs beforeGet before every GetObject.
+type getHookStore struct {
+	storage.Store
+	beforeGet func(object string)
+}
+
+func (s *getHookStore) GetObject(ctx context.Context, bucket, object string) (io.ReadCloser, storage.ObjectInfo, error) {
+	s.beforeGet(object)
+	return s.Store.GetObject(ctx, bucket, object)
+}
+
+// 测试下载结束后 登记完成前任务被取消 (广播尚未到达) 不会覆盖状态 撤销创建的文件与对象
+func TestCancelDownloadTaskBeforeCompletion(t *testing.T) {
+	cleanFileObjectTables(t)
+	oldPrivate := config.AppConfig.DownloadAllowPrivate
+	config.AppConfig.DownloadAllowPrivate = true
+	t.Cleanup(func() { config.AppConfig.DownloadAllowPrivate = oldPrivate })
+	user := createFileObjectTestUser(t, "task_cancel_late")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("downloaded just before the cancel"))
+	}))
+	defer server.Close()
+
+	downloadTask := createQueuedTask(t, user.ID, "http", server.URL)
+	objectName := service.BuildObjectName(user.UserName, downloadTask.ObjectName)
+	original := storage.Default
+	t.Cleanup(func() { storage.Default = original })
+	storage.Default = &getHookStore{Store: original, beforeGet: func(object string) {
+		if object != objectName {
+			return
+		}
+		if err := repo.Db.Model(&model.DownloadTask{}).Where("id = ?", downloadTask.ID).Update("status", "canceled").Error; err != nil {
+			t.Error(err)
+		}
+	}}
+
+	if err := task.ProcessDownloadTask(context.Background(), downloadTask.ID); !errors.Is(err, task.ErrTaskCanceled) {
+		t.Fatalf("expect ErrTaskCanceled, got %v", err)
+	}
+	storage.Default = original
+	var stored model.DownloadTask
+	repo.Db.First(&stored, downloadTask.ID)
+	if stored.Status != "canceled" {
+		t.Fatalf("completion must not overwrite the canceled status, got %s", stored.Status)
+	}
+	var count int64
+	repo.Db.Model(&model.UserFile{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("expect the created file to be removed, got %d", count)
+	}
+	if _, _, err := storage.Default.GetObject(context.Background(), downloadTask.Bucket, objectName); err == nil {
+		t.Fatalf("expect the downloaded object to be removed")
+	}
+	var refreshed model.User
+	repo.Db.First(&refreshed, user.ID)
+	if refreshed.UseSpace != user.UseSpace {
+		t.Fatalf("expect the reserved space to be released, got %d", refreshed.UseSpace)
+	}
+}
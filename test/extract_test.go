@@ -0,0 +1,177 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"testing"
+)
+
+type archiveTestEntry struct {
+	name    string
+	body    string
+	symlink bool
+}
+
+func buildTestZip(t *testing.T, entries []archiveTestEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(e.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTestTarGz(t *testing.T, entries []archiveTestEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.symlink {
+			hdr = &tar.Header{Name: e.name, Linkname: e.body, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if !e.symlink {
+			_, _ = tw.Write([]byte(e.body))
+		}
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	return buf.Bytes()
+}
+
+// storeTestArchive saves data in storage and as a root file of the user.
+func storeTestArchive(t *testing.T, user *model.User, name string, data []byte) *model.UserFile {
+	t.Helper()
+	obj := storeTestObject(t, user, data)
+	return createPolicyEntry(t, user.ID, nil, name, obj)
+}
+
+func storeTestObject(t *testing.T, user *model.User, data []byte) *model.FileObject {
+	t.Helper()
+	hash := sha256Hex(data)
+	obj := &model.FileObject{
+		UserID:     user.ID,
+		Hash:       hash,
+		BucketName: config.AppConfig.BucketName,
+		ObjectName: service.BuildObjectName(user.UserName, hash),
+		Size:       int64(len(data)),
+		RefCount:   1,
+	}
+	if err := storage.Default.PutObject(context.Background(), obj.BucketName, obj.ObjectName,
+		bytes.NewReader(data), obj.Size, storage.PutOptions{Hash: hash}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CreateFilesObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+// 测试解压 zip: 重建目录树 按 hash 复用已有对象 越界路径被限制在目标文件夹内
+func TestExtractZipArchive(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "extract_zip")
+	existing := storeTestObject(t, user, []byte("shared content"))
+	archive := storeTestArchive(t, user, "bundle.zip", buildTestZip(t, []archiveTestEntry{
+		{name: "docs/"},
+		{name: "docs/a.txt", body: "alpha"},
+		{name: "docs/sub/b.txt", body: "shared content"},
+		{name: "../evil.txt", body: "escape"},
+		{name: "/etc/passwd", body: "root"},
+	}))
+	target := createPolicyEntry(t, user.ID, nil, "out", nil)
+
+	result, err := service.ExtractArchive(context.Background(), user.ID, archive, service.ExtractOptions{
+		ParentID: target.ID,
+		Policy:   service.ConflictRename,
+	})
+	if err != nil {
+		t.Fatalf("ExtractArchive failed: %v", err)
+	}
+	if result.Files != 4 {
+		t.Fatalf("expect 4 files, got %+v", result)
+	}
+	docs := findUserEntry(t, user.ID, target.ID, "docs")
+	findUserEntry(t, user.ID, docs.ID, "a.txt")
+	shared := findUserEntry(t, user.ID, findUserEntry(t, user.ID, docs.ID, "sub").ID, "b.txt")
+	if *shared.ObjectID != existing.ID || loadRefCount(t, existing.ID) != 2 {
+		t.Fatalf("expect b.txt to reuse the existing object")
+	}
+	findUserEntry(t, user.ID, findUserEntry(t, user.ID, target.ID, "_").ID, "evil.txt")
+	findUserEntry(t, user.ID, findUserEntry(t, user.ID, target.ID, "etc").ID, "passwd")
+	var outside int64
+	repo.Db.Model(&model.UserFile{}).Where("user_id = ? AND parent_id IS NULL AND name NOT IN ?",
+		user.ID, []string{"bundle.zip", "out"}).Count(&outside)
+	if outside != 0 {
+		t.Fatalf("expect nothing outside the target folder, got %d root entries", outside)
+	}
+
+	// 再次解压到同一位置 文件夹复用 文件按 rename 改名
+	if _, err := service.ExtractArchive(context.Background(), user.ID, archive, service.ExtractOptions{
+		ParentID: target.ID,
+		Policy:   service.ConflictRename,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	findUserEntry(t, user.ID, docs.ID, "a (1).txt")
+}
+
+// 测试 tar.gz 跳过符号链接 以及条目数与解压大小限制
+func TestExtractTarArchiveLimits(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "extract_tar")
+	archive := storeTestArchive(t, user, "logs.tar.gz", buildTestTarGz(t, []archiveTestEntry{
+		{name: "logs/app.log", body: "line"},
+		{name: "logs/latest", body: "app.log", symlink: true},
+	}))
+	result, err := service.ExtractArchive(context.Background(), user.ID, archive, service.ExtractOptions{})
+	if err != nil || result.Files != 1 || result.Skipped != 1 {
+		t.Fatalf("expect the symlink to be skipped, got %+v %v", result, err)
+	}
+	findUserEntry(t, user.ID, findUserEntry(t, user.ID, 0, "logs").ID, "app.log")
+
+	oldEntries, oldSize := config.AppConfig.ExtractMaxEntries, config.AppConfig.ExtractMaxSize
+	defer func() {
+		config.AppConfig.ExtractMaxEntries, config.AppConfig.ExtractMaxSize = oldEntries, oldSize
+	}()
+	config.AppConfig.ExtractMaxEntries = 1
+	rename := service.ExtractOptions{Policy: service.ConflictRename}
+	if _, err := service.ExtractArchive(context.Background(), user.ID, archive, rename); !errors.Is(err, service.ErrArchiveLimit) {
+		t.Fatalf("expect entry limit, got %v", err)
+	}
+
+	config.AppConfig.ExtractMaxEntries = 10
+	config.AppConfig.ExtractMaxSize = 1024
+	bomb := storeTestArchive(t, user, "bomb.tar.gz", buildTestTarGz(t, []archiveTestEntry{
+		{name: "zeros.bin", body: string(make([]byte, 64<<10))},
+	}))
+	if _, err := service.ExtractArchive(context.Background(), user.ID, bomb, rename); !errors.Is(err, service.ErrArchiveLimit) {
+		t.Fatalf("expect size limit, got %v", err)
+	}
+
+	text := storeTestArchive(t, user, "notes.zip", []byte("not an archive"))
+	if _, err := service.ExtractArchive(context.Background(), user.ID, text, service.ExtractOptions{}); !errors.Is(err, service.ErrInvalidArchive) {
+		t.Fatalf("expect ErrInvalidArchive, got %v", err)
+	}
+}
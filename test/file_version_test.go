@@ -0,0 +1,140 @@
+package test
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/model"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// overwriteEntry replaces the content of name at the root with obj.
+func overwriteEntry(t *testing.T, userID uint64, name string, obj *model.FileObject) {
+	t.Helper()
+	if _, err := service.CreateUserFileEntryWithPolicy(&model.UserFile{
+		UserID:   userID,
+		Name:     name,
+		ObjectID: &obj.ID,
+		Size:     obj.Size,
+	}, service.ConflictOverwrite); err != nil {
+		t.Fatalf("overwrite %s failed: %v", name, err)
+	}
+}
+
+func loadRefCount(t *testing.T, objectID uint64) int {
+	t.Helper()
+	var obj model.FileObject
+	if err := repo.Db.First(&obj, objectID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return int(obj.RefCount)
+}
+
+// 测试覆盖写入保留历史版本 恢复版本后当前内容成为新版本
+func TestFileVersionOverwriteAndRestore(t *testing.T) {
+	cleanUserFileTables(t)
+	user := createQuotaTestUser(t, 0)
+	v1 := createQuotaTestObject(t, user.ID, 10)
+	v2 := createQuotaTestObject(t, user.ID, 20)
+	v3 := createQuotaTestObject(t, user.ID, 30)
+
+	file := createPolicyEntry(t, user.ID, nil, "plan.md", v1)
+	overwriteEntry(t, user.ID, "plan.md", v2)
+	overwriteEntry(t, user.ID, "plan.md", v3)
+
+	_, versions, err := service.ListFileVersions(user.ID, file.ID)
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("expect 2 versions, got %+v %v", versions, err)
+	}
+	if versions[0].Version != 2 || versions[0].ObjectID != v2.ID || versions[1].ObjectID != v1.ID {
+		t.Fatalf("expect newest version first, got %+v", versions)
+	}
+	if used := loadUseSpace(t, user.ID); used != 60 {
+		t.Fatalf("expect versions to count toward quota, got %d", used)
+	}
+
+	// 同一对象覆盖不产生新版本 调用方持有的引用被归还
+	repo.Db.Model(&model.FileObject{}).Where("id = ?", v3.ID).Update("ref_count", 2)
+	overwriteEntry(t, user.ID, "plan.md", v3)
+	if _, versions, _ = service.ListFileVersions(user.ID, file.ID); len(versions) != 2 {
+		t.Fatalf("expect identical content not to add a version, got %d", len(versions))
+	}
+	if refs := loadRefCount(t, v3.ID); refs != 1 {
+		t.Fatalf("expect identical overwrite to keep one reference, got %d", refs)
+	}
+
+	restored, err := service.RestoreFileVersion(user.ID, file.ID, versions[1].ID)
+	if err != nil || *restored.ObjectID != v1.ID || restored.Size != 10 {
+		t.Fatalf("expect v1 to be current, got %+v %v", restored, err)
+	}
+	_, versions, _ = service.ListFileVersions(user.ID, file.ID)
+	if len(versions) != 2 || versions[0].Version != 3 || versions[0].ObjectID != v3.ID {
+		t.Fatalf("expect replaced content to become the newest version, got %+v", versions)
+	}
+	if used := loadUseSpace(t, user.ID); used != 60 {
+		t.Fatalf("expect restore not to change use_space, got %d", used)
+	}
+	if _, err := service.RestoreFileVersion(user.ID, file.ID, 999999); !errors.Is(err, service.ErrVersionNotFound) {
+		t.Fatalf("expect ErrVersionNotFound, got %v", err)
+	}
+	other := createQuotaTestUser(t, 0)
+	if _, _, err := service.GetFileVersion(other.ID, file.ID, versions[0].ID); err == nil {
+		t.Fatal("expect another user not to read the versions")
+	}
+}
+
+// 测试按保留个数与天数清理版本 以及彻底删除文件时一并清理版本
+func TestFileVersionPruneAndPurge(t *testing.T) {
+	cleanUserFileTables(t)
+	user := createQuotaTestUser(t, 0)
+	objs := make([]*model.FileObject, 4)
+	for i := range objs {
+		objs[i] = createQuotaTestObject(t, user.ID, int64(i+1)*10)
+	}
+	file := createPolicyEntry(t, user.ID, nil, "log.txt", objs[0])
+	for _, obj := range objs[1:] {
+		overwriteEntry(t, user.ID, "log.txt", obj)
+	}
+
+	keep, days := 2, 0
+	repo.Db.Model(&model.User{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"version_keep": keep, "version_days": days})
+	if _, err := service.PruneFileVersions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_, versions, _ := service.ListFileVersions(user.ID, file.ID)
+	if len(versions) != 2 || versions[1].ObjectID != objs[1].ID {
+		t.Fatalf("expect the 2 newest versions to be kept, got %+v", versions)
+	}
+	var count int64
+	repo.Db.Model(&model.FileObject{}).Where("id = ?", objs[0].ID).Count(&count)
+	if count != 0 {
+		t.Fatal("expect the pruned object to be removed")
+	}
+	if used := loadUseSpace(t, user.ID); used != 20+30+40 {
+		t.Fatalf("expect pruned bytes to be released, got %d", used)
+	}
+
+	repo.Db.Model(&model.User{}).Where("id = ?", user.ID).Update("version_days", 7)
+	repo.Db.Model(&model.FileVersion{}).Where("id = ?", versions[1].ID).
+		Update("created_at", time.Now().AddDate(0, 0, -8))
+	if removed, err := service.PruneFileVersions(context.Background()); err != nil || removed != 1 {
+		t.Fatalf("expect 1 expired version, got %d %v", removed, err)
+	}
+
+	if err := service.MoveToRecycle(user.ID, file.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeleteFileRecord(uint(user.ID), uint(file.ID)); err != nil {
+		t.Fatal(err)
+	}
+	repo.Db.Model(&model.FileVersion{}).Where("user_file_id = ?", file.ID).Count(&count)
+	if count != 0 {
+		t.Fatal("expect versions to be purged with the file")
+	}
+	if used := loadUseSpace(t, user.ID); used != 0 {
+		t.Fatalf("expect use_space 0 after purge, got %d", used)
+	}
+}
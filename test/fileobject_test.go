@@ -12,8 +12,6 @@ import (
 	"fmt"
 	"testing"
 	"time"
-
-	"github.com/minio/minio-go/v7"
 )
 
 // 清理测试数据
@@ -23,7 +21,7 @@ func cleanFileObjectTables(t *testing.T) {
 	repo.Db.Exec("SET FOREIGN_KEY_CHECKS = 0")
 
 	// 按照外键依赖关系的顺序删除表数据
-	tables := []string{"file_share", "file_chunk", "upload_session", "user_file", "file_object", "user_db"}
+	tables := []string{"file_share", "file_chunk", "upload_session", "file_version", "user_file", "file_object", "user_db"}
 	for _, table := range tables {
 		if err := repo.Db.Exec("DELETE FROM " + table).Error; err != nil {
 			t.Fatalf("clean %s failed: %v", table, err)
@@ -134,7 +132,7 @@ func TestGetFileObjectByHash(t *testing.T) {
 	}
 
 	// 通过hash获取文件对象
-	found, err := service.GetFileObjectByHash(fileObj.Hash)
+	found, err := service.GetFileObjectByHash(user.ID, fileObj.Hash)
 	if err != nil {
 		t.Fatalf("GetFileObjectByHash failed: %v", err)
 	}
@@ -227,13 +225,13 @@ func TestFastUploadInstant(t *testing.T) {
 	if err := service.CreateFilesObject(fileObj); err != nil {
 		t.Fatal(err)
 	}
-	_, err := storage.Minio.Client.PutObject(
+	err := storage.Default.PutObject(
 		context.Background(),
 		fileObj.BucketName,
 		fileObj.ObjectName,
 		bytes.NewReader([]byte("fast-upload-data")),
 		int64(len("fast-upload-data")),
-		minio.PutObjectOptions{ContentType: "application/octet-stream"},
+		storage.PutOptions{ContentType: "application/octet-stream"},
 	)
 	if err != nil {
 		t.Fatalf("put object failed: %v", err)
@@ -310,13 +308,13 @@ func TestFastUploadSizeMismatchFallback(t *testing.T) {
 	if err := service.CreateFilesObject(fileObj); err != nil {
 		t.Fatal(err)
 	}
-	_, err := storage.Minio.Client.PutObject(
+	err := storage.Default.PutObject(
 		context.Background(),
 		fileObj.BucketName,
 		fileObj.ObjectName,
 		bytes.NewReader([]byte("size-mismatch-data")),
 		int64(len("size-mismatch-data")),
-		minio.PutObjectOptions{ContentType: "application/octet-stream"},
+		storage.PutOptions{ContentType: "application/octet-stream"},
 	)
 	if err != nil {
 		t.Fatalf("put object failed: %v", err)
@@ -428,7 +426,7 @@ func TestCompleteFileRepairStaleObject(t *testing.T) {
 	user := createFileObjectTestUser(t, "repair_stale_obj")
 	fileObj := &model.FileObject{
 		UserID:     user.ID,
-		Hash:       "repair_hash",
+		Hash:       sha256Hex(nil), // 服务端会校验内容 hash 空文件即空内容的 SHA-256
 		BucketName: config.AppConfig.BucketName,
 		ObjectName: "files/stale/repair_hash",
 		Size:       1,
@@ -458,7 +456,7 @@ func TestCompleteFileRepairStaleObject(t *testing.T) {
 		ParentId:    0,
 		IsDir:       false,
 	}
-	if err := service.CompleteFile(context.Background(), completeReq, user.UserName); err != nil {
+	if _, err := service.CompleteFile(context.Background(), completeReq, user.UserName); err != nil {
 		t.Fatalf("CompleteFile failed: %v", err)
 	}
 
@@ -475,7 +473,7 @@ func TestCompleteFileRepairStaleObject(t *testing.T) {
 		t.Fatalf("repaired object missing: %v", err)
 	}
 	_ = object.Close()
-	_ = storage.Minio.Client.RemoveObject(context.Background(), config.AppConfig.BucketName, fileObj.ObjectName, minio.RemoveObjectOptions{})
+	_ = storage.Default.RemoveObject(context.Background(), config.AppConfig.BucketName, fileObj.ObjectName)
 }
 
 // 测试FindObjectIdByName
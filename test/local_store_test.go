@@ -0,0 +1,123 @@
+package test
+
+import (
+	"CloudVault/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocalStore(t *testing.T) *storage.LocalStore {
+	t.Helper()
+	store, err := storage.NewLocalStore(t.TempDir(), "local-secret", "http://localhost:8000")
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+	return store
+}
+
+func readLocalObject(t *testing.T, store *storage.LocalStore, bucket, object string) string {
+	t.Helper()
+	reader, info, err := store.GetObject(context.Background(), bucket, object)
+	if err != nil {
+		t.Fatalf("GetObject %s failed: %v", object, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != info.Size {
+		t.Fatalf("size mismatch: info %d, read %d", info.Size, len(data))
+	}
+	return string(data)
+}
+
+// 测试本地存储的上传 合并 删除
+func TestLocalStorePutComposeRemove(t *testing.T) {
+	store := newTestLocalStore(t)
+	ctx := context.Background()
+
+	parts := []string{"hello ", "local ", "store"}
+	sources := make([]storage.CopySource, 0, len(parts))
+	for i, part := range parts {
+		object := "chunks/upload/" + string(rune('0'+i))
+		if err := store.PutObject(ctx, "bucket", object, strings.NewReader(part), int64(len(part)), storage.PutOptions{}); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+		sources = append(sources, storage.CopySource{Bucket: "bucket", Object: object})
+	}
+	if err := store.ComposeObject(ctx, storage.CopyDest{Bucket: "bucket", Object: "files/u/hash"}, sources...); err != nil {
+		t.Fatalf("ComposeObject failed: %v", err)
+	}
+	if got := readLocalObject(t, store, "bucket", "files/u/hash"); got != "hello local store" {
+		t.Fatalf("unexpected composed content %q", got)
+	}
+
+	if err := store.PutObject(ctx, "bucket", "short", bytes.NewReader([]byte("abc")), 10, storage.PutOptions{}); err == nil {
+		t.Fatal("PutObject should fail on short reader")
+	}
+
+	if err := store.RemoveObject(ctx, "bucket", "files/u/hash"); err != nil {
+		t.Fatalf("RemoveObject failed: %v", err)
+	}
+	if _, _, err := store.GetObject(ctx, "bucket", "files/u/hash"); err == nil {
+		t.Fatal("object should be removed")
+	}
+	if err := store.RemoveObject(ctx, "bucket", "files/u/hash"); err != nil {
+		t.Fatalf("removing a missing object should not fail: %v", err)
+	}
+}
+
+// 测试对象名不能穿越根目录
+func TestLocalStoreRejectsTraversal(t *testing.T) {
+	store := newTestLocalStore(t)
+	for _, object := range []string{"../escape", "a/../../escape", "/abs", "a//b", ""} {
+		err := store.PutObject(context.Background(), "bucket", object, strings.NewReader("x"), 1, storage.PutOptions{})
+		if !errors.Is(err, storage.ErrInvalidObjectName) {
+			t.Fatalf("object %q: expect ErrInvalidObjectName, got %v", object, err)
+		}
+	}
+}
+
+// 测试预签名链接的签名与过期校验
+func TestLocalStorePresignedURL(t *testing.T) {
+	store := newTestLocalStore(t)
+	raw, err := store.PresignedGetObjectWithResponse(
+		context.Background(),
+		"bucket",
+		"files/u/my file.txt",
+		time.Minute,
+		map[string]string{"response-content-type": "text/plain"},
+	)
+	if err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(parsed.Path, storage.LocalObjectRoute+"/bucket/files/u/") {
+		t.Fatalf("unexpected presigned path %s", parsed.Path)
+	}
+	query := parsed.Query()
+	if err := store.VerifyPresigned("bucket", "files/u/my file.txt", query, time.Now()); err != nil {
+		t.Fatalf("VerifyPresigned failed: %v", err)
+	}
+	if err := store.VerifyPresigned("bucket", "files/u/other.txt", query, time.Now()); !errors.Is(err, storage.ErrPresignSignature) {
+		t.Fatalf("expect signature mismatch for another object, got %v", err)
+	}
+	query.Set("response-content-type", "text/html")
+	if err := store.VerifyPresigned("bucket", "files/u/my file.txt", query, time.Now()); !errors.Is(err, storage.ErrPresignSignature) {
+		t.Fatalf("expect signature mismatch for tampered params, got %v", err)
+	}
+	query.Set("response-content-type", "text/plain")
+	if err := store.VerifyPresigned("bucket", "files/u/my file.txt", query, time.Now().Add(2*time.Minute)); !errors.Is(err, storage.ErrPresignExpired) {
+		t.Fatalf("expect expired, got %v", err)
+	}
+}
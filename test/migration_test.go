@@ -0,0 +1,171 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// corruptStore flips the last byte of everything written through it.
+type corruptStore struct {
+	storage.Store
+}
+
+func (s *corruptStore) PutObject(ctx context.Context, bucket, object string, reader io.Reader, size int64, opts storage.PutOptions) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		data[len(data)-1] ^= 0xff
+	}
+	return s.Store.PutObject(ctx, bucket, object, bytes.NewReader(data), int64(len(data)), opts)
+}
+
+// hookStore calls afterPut after every successful write.
+type hookStore struct {
+	storage.Store
+	afterPut func()
+}
+
+func (s *hookStore) PutObject(ctx context.Context, bucket, object string, reader io.Reader, size int64, opts storage.PutOptions) error {
+	if err := s.Store.PutObject(ctx, bucket, object, reader, size, opts); err != nil {
+		return err
+	}
+	s.afterPut()
+	return nil
+}
+
+// putOnSource writes objects while the target node is offline so they only live on the source.
+func putOnSource(t *testing.T, cluster *storage.StorageCluster, count int) []string {
+	t.Helper()
+	cluster.Nodes[1].SetAvailable(false)
+	defer cluster.Nodes[1].SetAvailable(true)
+	store := storage.NewClusterStore(cluster)
+	names := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("migration/object_%d_%d", time.Now().UnixNano(), i)
+		data := []byte(fmt.Sprintf("payload-%d", i))
+		if err := store.PutObject(context.Background(), config.AppConfig.BucketName, name,
+			bytes.NewReader(data), int64(len(data)), storage.PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func loadMigrationJob(t *testing.T, id uint64) model.MigrationJob {
+	t.Helper()
+	var job model.MigrationJob
+	if err := repo.Db.Where("id = ?", id).First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// 测试校验失败时不切换 placement 也不删除源副本
+func TestMigrationRejectsCorruptCopy(t *testing.T) {
+	cluster, stores := newMemoryCluster(t, "node-a", "node-b")
+	names := putOnSource(t, cluster, 1)
+	cluster.Nodes[1].Store = &corruptStore{Store: stores[1]}
+
+	job, err := cluster.StartMigration(context.Background(), "node-a", "node-b")
+	if err != nil {
+		t.Fatalf("StartMigration failed: %v", err)
+	}
+	job2 := loadMigrationJob(t, job.ID)
+	if job2.Status != model.MigrationCompleted || job2.Failed != 1 || job2.Done != 0 {
+		t.Fatalf("unexpected job state: %+v", job2)
+	}
+	if placed := loadReplicaNodes(t, names[0]); len(placed) != 1 || placed[0] != "node-a" {
+		t.Fatalf("placement should stay on node-a, got %v", placed)
+	}
+	if stores[0].Len() != 1 || stores[1].Len() != 0 {
+		t.Fatalf("source must be kept and bad copy removed, got source=%d target=%d", stores[0].Len(), stores[1].Len())
+	}
+}
+
+// 测试迁移中途崩溃后从未完成的对象继续
+func TestMigrationResumesAfterCrash(t *testing.T) {
+	cluster, stores := newMemoryCluster(t, "node-a", "node-b")
+	names := putOnSource(t, cluster, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cluster.Nodes[1].Store = &hookStore{Store: stores[1], afterPut: cancel}
+	job, err := cluster.StartMigration(ctx, "node-a", "node-b")
+	if err == nil {
+		t.Fatal("expect migration to stop when its context is cancelled")
+	}
+	if got := loadMigrationJob(t, job.ID); got.Status != model.MigrationRunning || got.Done == len(names) {
+		t.Fatalf("job should be left running, got %+v", got)
+	}
+
+	// 模拟重启: 新的集群实例 同样的节点与数据库
+	restarted := storage.NewStorageCluster([]*storage.StorageNode{
+		storage.NewStorageNodeWithStore(cluster.Nodes[0].Cluster, stores[0]),
+		storage.NewStorageNodeWithStore(cluster.Nodes[1].Cluster, stores[1]),
+	}, storage.NewDBPlacement(repo.Db))
+	if err := restarted.ResumeMigrations(context.Background()); err != nil {
+		t.Fatalf("ResumeMigrations failed: %v", err)
+	}
+
+	finished := loadMigrationJob(t, job.ID)
+	if finished.Status != model.MigrationCompleted || finished.Done != len(names) || finished.Failed != 0 {
+		t.Fatalf("unexpected job state after resume: %+v", finished)
+	}
+	if stores[0].Len() != 0 || stores[1].Len() != len(names) {
+		t.Fatalf("objects should all be on target, got source=%d target=%d", stores[0].Len(), stores[1].Len())
+	}
+	store := storage.NewClusterStore(restarted)
+	for i, name := range names {
+		if placed := loadReplicaNodes(t, name); len(placed) != 1 || placed[0] != "node-b" {
+			t.Fatalf("placement of %s should be node-b, got %v", name, placed)
+		}
+		if got := readAll(t, store, config.AppConfig.BucketName, name); got != fmt.Sprintf("payload-%d", i) {
+			t.Fatalf("unexpected content of %s: %q", name, got)
+		}
+	}
+}
+
+// 测试复制期间源副本记录被删除时跳过该对象 删除目标拷贝 任务继续
+func TestMigrationSkipsObjectRemovedDuringCopy(t *testing.T) {
+	cluster, stores := newMemoryCluster(t, "node-a", "node-b")
+	names := putOnSource(t, cluster, 2)
+
+	removed := false
+	cluster.Nodes[1].Store = &hookStore{Store: stores[1], afterPut: func() {
+		if removed {
+			return
+		}
+		removed = true
+		if err := repo.Db.Where("object_name = ? AND node_name = ?", names[0], "node-a").
+			Delete(&model.ObjectReplica{}).Error; err != nil {
+			t.Error(err)
+		}
+	}}
+	job, err := cluster.StartMigration(context.Background(), "node-a", "node-b")
+	if err != nil {
+		t.Fatalf("StartMigration failed: %v", err)
+	}
+	finished := loadMigrationJob(t, job.ID)
+	if finished.Status != model.MigrationCompleted || finished.Skipped != 1 || finished.Done != 1 {
+		t.Fatalf("unexpected job state: %+v", finished)
+	}
+	if placed := loadReplicaNodes(t, names[0]); len(placed) != 0 {
+		t.Fatalf("removed object should have no placement, got %v", placed)
+	}
+	if placed := loadReplicaNodes(t, names[1]); len(placed) != 1 || placed[0] != "node-b" {
+		t.Fatalf("placement of %s should be node-b, got %v", names[1], placed)
+	}
+	if stores[1].Len() != 1 {
+		t.Fatalf("copy of the removed object should be deleted from target, got %d objects", stores[1].Len())
+	}
+}
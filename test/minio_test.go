@@ -64,6 +64,12 @@ func TestGetContentBook(t *testing.T) {
 		{"test.unknown", "application/octet-stream"},
 		{"TEST.JPG", "image/jpeg"},
 		{"TEST.PNG", "image/png"},
+		{"photo.webp", "image/webp"},
+		{"logo.svg", "image/svg+xml"},
+		{"README.md", "text/markdown; charset=utf-8"},
+		{"data.json", "application/json"},
+		{"song.mp3", "audio/mpeg"},
+		{"report.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/model"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func createQuotaTestUser(t *testing.T, totalSpace uint64) *model.User {
+	t.Helper()
+	suffix := time.Now().UnixNano()
+	user := &model.User{
+		UserName:   fmt.Sprintf("quota_user_%d", suffix),
+		Password:   "123456",
+		Email:      fmt.Sprintf("quota_%d@test.com", suffix),
+		IsActive:   true,
+		TotalSpace: totalSpace,
+	}
+	if err := service.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createQuotaTestObject(t *testing.T, userID uint64, size int64) *model.FileObject {
+	t.Helper()
+	obj := &model.FileObject{
+		UserID:     userID,
+		Hash:       fmt.Sprintf("quota_hash_%d", time.Now().UnixNano()),
+		BucketName: "test-bucket",
+		ObjectName: fmt.Sprintf("quota_object_%d", time.Now().UnixNano()),
+		Size:       size,
+		RefCount:   1,
+	}
+	if err := service.CreateFilesObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func loadUseSpace(t *testing.T, userID uint64) uint64 {
+	t.Helper()
+	var user model.User
+	if err := repo.Db.Where("id = ?", userID).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.UseSpace
+}
+
+// 测试上传超出容量时返回 QuotaExceededError
+func TestCreateUserFileQuotaExceeded(t *testing.T) {
+	cleanUserFileTables(t)
+	user := createQuotaTestUser(t, 1000)
+	obj := createQuotaTestObject(t, user.ID, 1024)
+
+	err := service.CreateUserFileEntry(&model.UserFile{
+		UserID:   user.ID,
+		Name:     "too_big.bin",
+		ObjectID: &obj.ID,
+		Size:     1024,
+	})
+	var quotaErr *service.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("expect QuotaExceededError, got %v", err)
+	}
+	if !quotaErr.TooLarge() {
+		t.Fatal("request larger than total space should be TooLarge")
+	}
+	if used := loadUseSpace(t, user.ID); used != 0 {
+		t.Fatalf("use_space should stay 0, got %d", used)
+	}
+}
+
+// 测试上传扣减容量 彻底删除后释放
+func TestQuotaChargeAndRelease(t *testing.T) {
+	cleanUserFileTables(t)
+	user := createQuotaTestUser(t, 4096)
+	obj := createQuotaTestObject(t, user.ID, 1024)
+
+	file := &model.UserFile{
+		UserID:   user.ID,
+		Name:     "charged.bin",
+		ObjectID: &obj.ID,
+		Size:     1024,
+	}
+	if err := service.CreateUserFileEntry(file); err != nil {
+		t.Fatalf("CreateUserFileEntry failed: %v", err)
+	}
+	if used := loadUseSpace(t, user.ID); used != 1024 {
+		t.Fatalf("expect use_space 1024, got %d", used)
+	}
+	if err := service.CheckQuota(user.ID, 4096); !service.IsQuotaExceeded(err) {
+		t.Fatalf("expect quota exceeded for 4096 more bytes, got %v", err)
+	}
+
+	if err := service.MoveToRecycle(user.ID, file.ID); err != nil {
+		t.Fatal(err)
+	}
+	if used := loadUseSpace(t, user.ID); used != 1024 {
+		t.Fatalf("recycled file should still be charged, got %d", used)
+	}
+	if err := service.DeleteFileRecord(uint(user.ID), uint(file.ID)); err != nil {
+		t.Fatalf("DeleteFileRecord failed: %v", err)
+	}
+	if used := loadUseSpace(t, user.ID); used != 0 {
+		t.Fatalf("expect use_space 0 after delete, got %d", used)
+	}
+}
+
+// 测试根据 user_file 校准 use_space
+func TestReconcileUserSpace(t *testing.T) {
+	cleanUserFileTables(t)
+	user := createQuotaTestUser(t, 0)
+	obj := createQuotaTestObject(t, user.ID, 512)
+
+	for i := 0; i < 2; i++ {
+		if err := service.CreateUserFileEntry(&model.UserFile{
+			UserID:   user.ID,
+			Name:     fmt.Sprintf("reconcile_%d.bin", i),
+			ObjectID: &obj.ID,
+			Size:     512,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Db.Model(&model.User{}).Where("id = ?", user.ID).
+		UpdateColumn("use_space", 99999).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := service.ReconcileUserSpace(user.ID)
+	if err != nil {
+		t.Fatalf("ReconcileUserSpace failed: %v", err)
+	}
+	if used != 1024 || loadUseSpace(t, user.ID) != 1024 {
+		t.Fatalf("expect use_space 1024, got %d", used)
+	}
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 测试损坏副本从健康副本修复 副本不足时补齐
+func TestScrubRepairsReplicas(t *testing.T) {
+	cluster, stores := newMemoryCluster(t, "node-a", "node-b", "node-c")
+	store := storage.NewClusterStore(cluster)
+	ctx := context.Background()
+	bucket := config.AppConfig.BucketName
+	data := []byte("scrub-me")
+	hash := sha256Hex(data)
+	object := fmt.Sprintf("scrub/%d/%s", time.Now().UnixNano(), hash)
+
+	if err := store.PutObject(ctx, bucket, object, bytes.NewReader(data), int64(len(data)), storage.PutOptions{Hash: hash}); err != nil {
+		t.Fatal(err)
+	}
+	placed := loadReplicaNodes(t, object)
+	storeOf := func(name string) *storage.MemoryStore {
+		for i, node := range cluster.Nodes {
+			if node.Name() == name {
+				return stores[i]
+			}
+		}
+		t.Fatalf("unknown node %s", name)
+		return nil
+	}
+
+	// 同样大小但内容被篡改
+	bad := []byte("scrub-m3")
+	if err := storeOf(placed[0]).PutObject(ctx, bucket, object, bytes.NewReader(bad), int64(len(bad)), storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := cluster.ScrubObject(ctx, bucket, object, int64(len(data)), hash)
+	if err != nil {
+		t.Fatalf("ScrubObject failed: %v", err)
+	}
+	if len(result.Repaired) != 1 || result.Repaired[0] != placed[0] || len(result.Broken) != 0 {
+		t.Fatalf("expect %s repaired, got %+v", placed[0], result)
+	}
+	if err := storage.VerifyObject(ctx, storeOf(placed[0]), bucket, object, int64(len(data)), hash); err != nil {
+		t.Fatalf("repaired replica still bad: %v", err)
+	}
+
+	// 丢失一条 placement 记录后补齐副本数
+	if err := repo.Db.Where("object_name = ? AND node_name = ?", object, placed[1]).Delete(&model.ObjectReplica{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	result, err = cluster.ScrubObject(ctx, bucket, object, int64(len(data)), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Repaired) != 1 || len(loadReplicaNodes(t, object)) != config.StorageConfigInstance.ReplicaCount {
+		t.Fatalf("expect replica count restored, got %+v placed=%v", result, loadReplicaNodes(t, object))
+	}
+
+	// 所有副本都丢失时无法恢复
+	for _, name := range loadReplicaNodes(t, object) {
+		_ = storeOf(name).RemoveObject(ctx, bucket, object)
+	}
+	result, err = cluster.ScrubObject(ctx, bucket, object, int64(len(data)), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Unrecoverable() {
+		t.Fatalf("expect unrecoverable, got %+v", result)
+	}
+}
+
+// 测试扫描 file_object 并记录无法恢复的对象
+func TestScrubFileObjectsReportsIssues(t *testing.T) {
+	cleanFileObjectTables(t)
+	if err := repo.Db.Exec("DELETE FROM object_scrub_issue").Error; err != nil {
+		t.Fatal(err)
+	}
+	user := createQuotaTestUser(t, 0)
+	ctx := context.Background()
+	bucket := config.AppConfig.BucketName
+
+	data := []byte("healthy-object")
+	healthy := &model.FileObject{
+		UserID:     user.ID,
+		Hash:       sha256Hex(data),
+		BucketName: bucket,
+		ObjectName: fmt.Sprintf("scrub/healthy_%d", time.Now().UnixNano()),
+		Size:       int64(len(data)),
+		RefCount:   1,
+	}
+	if err := storage.Default.PutObject(ctx, bucket, healthy.ObjectName, bytes.NewReader(data), healthy.Size, storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	missing := &model.FileObject{
+		UserID:     user.ID,
+		Hash:       sha256Hex([]byte("missing-object")),
+		BucketName: bucket,
+		ObjectName: fmt.Sprintf("scrub/missing_%d", time.Now().UnixNano()),
+		Size:       14,
+		RefCount:   1,
+	}
+	for _, obj := range []*model.FileObject{healthy, missing} {
+		if err := service.CreateFilesObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := service.ScrubFileObjects(ctx)
+	if err != nil {
+		t.Fatalf("ScrubFileObjects failed: %v", err)
+	}
+	if summary.Checked != 2 || summary.Healthy != 1 || summary.Unrecoverable != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	issues, err := service.ListScrubIssues(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || issues[0].FileObjectID != missing.ID {
+		t.Fatalf("expect one issue for object %d, got %+v", missing.ID, issues)
+	}
+
+	// 对象恢复后再次扫描清除记录
+	if err := storage.Default.PutObject(ctx, bucket, missing.ObjectName, bytes.NewReader([]byte("missing-object")), 14, storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ScrubFileObjects(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if issues, _ := service.ListScrubIssues(10); len(issues) != 0 {
+		t.Fatalf("issue should be cleared, got %+v", issues)
+	}
+}
@@ -72,18 +72,17 @@ func createUserWithName(t *testing.T, name string) *model.User {
 	return user
 }
 
-// putObject stores data in MinIO for test use.
-// MinIO
+// putObject stores data in the default store for test use.
 func putObject(t *testing.T, objectName string, data []byte) {
 	t.Helper()
 	reader := bytes.NewReader(data)
-	_, err := storage.Minio.Client.PutObject(
+	err := storage.Default.PutObject(
 		context.Background(),
 		config.AppConfig.BucketName,
 		objectName,
 		reader,
 		int64(len(data)),
-		minio.PutObjectOptions{ContentType: "text/plain"},
+		storage.PutOptions{ContentType: "text/plain"},
 	)
 	if err != nil {
 		t.Fatalf("put object failed: %v", err)
@@ -92,6 +91,9 @@ func putObject(t *testing.T, objectName string, data []byte) {
 
 // TestStorageClusterOps exercises storage cluster helpers.
 func TestStorageClusterOps(t *testing.T) {
+	if storage.Minio == nil {
+		t.Skip("storage cluster requires the minio backend")
+	}
 	cluster := storage.GetStorageCluster()
 	node, err := cluster.SelectNode()
 	if err != nil {
@@ -139,6 +141,7 @@ func TestStorageClusterOps(t *testing.T) {
 
 // TestDownloadTaskWorker verifies async download task processing.
 func TestDownloadTaskWorker(t *testing.T) {
+	requireExternalServices(t)
 	cleanExtraTables(t)
 	purgeDownloadQueues(t)
 	user := createUserWithName(t, fmt.Sprintf("download_user_%d", time.Now().UnixNano()))
@@ -210,7 +213,7 @@ func TestDownloadTaskWorker(t *testing.T) {
 	}
 
 	objectName := service.BuildObjectName(user.UserName, stored.ObjectName)
-	_ = storage.Minio.Client.RemoveObject(context.Background(), config.AppConfig.BucketName, objectName, minio.RemoveObjectOptions{})
+	_ = storage.Default.RemoveObject(context.Background(), config.AppConfig.BucketName, objectName)
 }
 
 // TestSearchAndPreview checks search and preview URL generation.
@@ -312,15 +315,15 @@ func TestMinioUploadAndHTTPDownload(t *testing.T) {
 		t.Fatalf("DownloadByHTTP failed: %v", err)
 	}
 
-	stat, err := storage.Minio.Client.StatObject(
+	object, info, err := storage.Default.GetObject(
 		context.Background(),
 		config.AppConfig.BucketName,
 		service.BuildObjectName(user.UserName, "http_hash"),
-		minio.StatObjectOptions{},
 	)
-	if err != nil || stat.Size <= 0 {
+	if err != nil || info.Size <= 0 {
 		t.Fatalf("downloaded object missing: %v", err)
 	}
+	_ = object.Close()
 }
 
 // TestFileObjectRefCountAndRemove covers ref count decrement and removal.
@@ -357,13 +360,13 @@ func TestFileObjectRefCountAndRemove(t *testing.T) {
 		t.Fatal("file object should be deleted")
 	}
 
-	if _, err := storage.Minio.Client.StatObject(
+	if object, _, err := storage.Default.GetObject(
 		context.Background(),
 		config.AppConfig.BucketName,
 		objectName,
-		minio.StatObjectOptions{},
 	); err == nil {
-		t.Fatal("object should be removed from minio")
+		_ = object.Close()
+		t.Fatal("object should be removed from storage")
 	}
 }
 
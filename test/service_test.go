@@ -3,17 +3,23 @@ package test
 import (
 	"CloudVault/config"
 	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
 	"CloudVault/internal/storage"
 	"log"
 	"os"
 	"testing"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/minio/minio-go/v7"
+	"github.com/redis/go-redis/v9"
 	"golang.org/x/net/context"
 )
 
 // ensureTestBucket ensures the test bucket exists.
 func ensureTestBucket() {
+	if storage.Minio == nil { // 本地存储无需创建 bucket
+		return
+	}
 	ctx := context.Background()
 	exists, err := storage.Minio.Client.BucketExists(ctx, storage.Minio.Bucket)
 	if err != nil {
@@ -27,23 +33,67 @@ func ensureTestBucket() {
 	}
 }
 
-// TestMain sets up the test environment.
-func TestMain(m *testing.M) {
-	_ = os.Setenv("DOWNLOAD_ALLOW_PRIVATE", "true")
-	config.InitConfig()
+// useExternalServices reports whether tests run against real MySQL/Redis/MinIO/RabbitMQ.
+// 默认使用 SQLite + miniredis + 内存存储 无需任何外部服务
+func useExternalServices() bool {
+	switch os.Getenv("TEST_EXTERNAL_SERVICES") {
+	case "1", "true", "yes", "on":
+		return true
+	default:
+		return false
+	}
+}
+
+// requireExternalServices skips tests that need services the hermetic setup cannot fake.
+func requireExternalServices(t *testing.T) {
+	t.Helper()
+	if !useExternalServices() {
+		t.Skip("requires TEST_EXTERNAL_SERVICES=true")
+	}
+}
+
+// setupExternal connects to the services configured through environment variables.
+func setupExternal() {
 	repo.InitMysqlTest()
-	storage.InitMinio()
+	storage.InitStorage()
 	repo.InitRedis()
 	if err := repo.EnableKeyspaceNotifications(context.Background()); err != nil {
 		log.Printf("[testmain] enable redis keyspace notifications failed: %v", err)
 	}
+	ensureTestBucket()
+}
+
+// setupHermetic wires in-process replacements for every outside dependency.
+func setupHermetic() {
+	mr, err := miniredis.Run()
+	if err != nil {
+		log.Fatalf("[testmain] start miniredis failed: %v", err)
+	}
+	db, err := repo.OpenSqlite("file:cloudvault_test?mode=memory&cache=shared")
+	if err != nil {
+		log.Fatalf("[testmain] open sqlite failed: %v", err)
+	}
+	service.Configure(service.Dependencies{
+		DB:    db,
+		Redis: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		Store: storage.NewMemoryStore(),
+	})
+}
+
+// TestMain sets up the test environment.
+func TestMain(m *testing.M) {
+	_ = os.Setenv("DOWNLOAD_ALLOW_PRIVATE", "true")
+	config.InitConfig()
+	if useExternalServices() {
+		setupExternal()
+	} else {
+		setupHermetic()
+	}
 	log.Println("[testmain] redis db =", repo.Redis.Options().DB)
 	ready := make(chan struct{})
 	go repo.ListenRedisExpired(context.Background(), repo.Redis, ready)
 	<-ready
 
-	ensureTestBucket()
-
 	// 在测试开始前清理所有表的数
 	cleanupAllTables()
 
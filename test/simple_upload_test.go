@@ -0,0 +1,143 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func simpleUpload(t *testing.T, userID uint64, req dto.SimpleUploadRequest, data []byte) (*dto.SimpleUploadResponse, error) {
+	t.Helper()
+	return service.SimpleUpload(context.Background(), userID, req, bytes.NewReader(data), int64(len(data)))
+}
+
+// 测试单请求上传: 写入存储时计算 hash 相同内容复用已有对象
+func TestSimpleUploadDedup(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "simple_upload")
+	folder := createPolicyEntry(t, user.ID, nil, "inbox", nil)
+	data := []byte("# simple upload\n")
+
+	first, err := simpleUpload(t, user.ID, dto.SimpleUploadRequest{FileName: "a.md", ParentID: folder.ID}, data)
+	if err != nil || first.Deduped || first.Hash != sha256Hex(data) {
+		t.Fatalf("expect a new object, got %+v %v", first, err)
+	}
+	entry := findUserEntry(t, user.ID, folder.ID, "a.md")
+	obj, err := service.GetFileObjectById(*entry.ObjectID)
+	if err != nil || obj.Hash != first.Hash || obj.ContentType != "text/markdown; charset=utf-8" {
+		t.Fatalf("expect object with hash and sniffed type, got %+v %v", obj, err)
+	}
+	reader, _, err := storage.Default.GetObject(context.Background(), obj.BucketName, obj.ObjectName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if !bytes.Equal(stored, data) {
+		t.Fatalf("stored content mismatch")
+	}
+
+	second, err := simpleUpload(t, user.ID, dto.SimpleUploadRequest{FileName: "b.md"}, data)
+	if err != nil || !second.Deduped {
+		t.Fatalf("expect the second upload to be deduped, got %+v %v", second, err)
+	}
+	if loadRefCount(t, obj.ID) != 2 {
+		t.Fatalf("expect the existing object to gain a reference")
+	}
+	var objects int64
+	repo.Db.Model(&model.FileObject{}).Where("hash = ?", first.Hash).Count(&objects)
+	if objects != 1 {
+		t.Fatalf("expect one object per hash, got %d", objects)
+	}
+	if used := loadUseSpace(t, user.ID); used != uint64(2*len(data)) {
+		t.Fatalf("expect both files to be charged, got %d", used)
+	}
+}
+
+// 测试单请求上传的重名策略、大小上限与容量
+func TestSimpleUploadLimits(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "simple_limits")
+	data := []byte("limits")
+	if _, err := simpleUpload(t, user.ID, dto.SimpleUploadRequest{FileName: "x.txt"}, data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := simpleUpload(t, user.ID, dto.SimpleUploadRequest{FileName: "x.txt"}, data); !errors.Is(err, service.ErrNameConflict) {
+		t.Fatalf("expect ErrNameConflict, got %v", err)
+	}
+	resp, err := simpleUpload(t, user.ID, dto.SimpleUploadRequest{FileName: "x.txt", ConflictPolicy: "rename"}, data)
+	if err != nil || resp.FileName != "x (1).txt" {
+		t.Fatalf("expect renamed upload, got %+v %v", resp, err)
+	}
+	resp, err = simpleUpload(t, user.ID, dto.SimpleUploadRequest{RelativePath: "docs/y.txt"}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	findUserEntry(t, user.ID, findUserEntry(t, user.ID, 0, "docs").ID, "y.txt")
+
+	oldMax := config.AppConfig.SimpleUploadMaxSize
+	defer func() { config.AppConfig.SimpleUploadMaxSize = oldMax }()
+	config.AppConfig.SimpleUploadMaxSize = 4
+	if _, err := simpleUpload(t, user.ID, dto.SimpleUploadRequest{FileName: "big.bin"}, data); !errors.Is(err, service.ErrFileTooLarge) {
+		t.Fatalf("expect ErrFileTooLarge, got %v", err)
+	}
+	config.AppConfig.SimpleUploadMaxSize = oldMax
+
+	repo.Db.Model(&model.User{}).Where("id = ?", user.ID).Update("total_space", loadUseSpace(t, user.ID)+1)
+	if _, err := simpleUpload(t, user.ID, dto.SimpleUploadRequest{FileName: "full.txt"}, []byte("too much")); !service.IsQuotaExceeded(err) {
+		t.Fatalf("expect quota exceeded, got %v", err)
+	}
+}
+
+// postUploadForm sends data as the file field of a multipart request to /api/file/upload.
+func postUploadForm(t *testing.T, user *model.User, name string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("conflict_policy", "rename")
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(data)
+	_ = writer.Close()
+	tc := newTusClient(t, user)
+	req := httptest.NewRequest(http.MethodPost, "/api/file/upload", &body)
+	req.Header.Set("Authorization", "Bearer "+tc.token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	tc.engine.ServeHTTP(rec, req)
+	return rec
+}
+
+// 测试上传接口: 请求体超过限制时返回 413 而不是表单解析失败的 400
+func TestUploadFileHandlerTooLarge(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "simple_upload_http")
+	oldMax := config.AppConfig.SimpleUploadMaxSize
+	t.Cleanup(func() { config.AppConfig.SimpleUploadMaxSize = oldMax })
+	config.AppConfig.SimpleUploadMaxSize = 16
+
+	if rec := postUploadForm(t, user, "small.txt", []byte("fits")); rec.Code != http.StatusOK {
+		t.Fatalf("expect 200 for a small file, got %d %s", rec.Code, rec.Body.String())
+	}
+	// 超过表单余量 读取请求体时即被截断
+	if rec := postUploadForm(t, user, "huge.bin", make([]byte, 2<<20)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413 when the body exceeds the limit, got %d %s", rec.Code, rec.Body.String())
+	}
+	// 请求体未超限 但文件超过限制 由服务端拒绝
+	if rec := postUploadForm(t, user, "big.bin", make([]byte, 64)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413 for a file over the limit, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyStore fails every call while down is set.
+type flakyStore struct {
+	storage.Store
+	down atomic.Bool
+}
+
+var errNodeDown = errors.New("node down")
+
+func (s *flakyStore) PutObject(ctx context.Context, bucket, object string, reader io.Reader, size int64, opts storage.PutOptions) error {
+	if s.down.Load() {
+		return errNodeDown
+	}
+	return s.Store.PutObject(ctx, bucket, object, reader, size, opts)
+}
+
+func (s *flakyStore) GetObject(ctx context.Context, bucket, object string) (io.ReadCloser, storage.ObjectInfo, error) {
+	if s.down.Load() {
+		return nil, storage.ObjectInfo{}, errNodeDown
+	}
+	return s.Store.GetObject(ctx, bucket, object)
+}
+
+// 测试健康检查的滞回: 连续失败达到阈值才摘除 连续成功达到阈值才恢复
+func TestHealthCheckerHysteresis(t *testing.T) {
+	cluster, _ := newMemoryCluster(t, "node-a", "node-b", "node-c")
+	flaky := &flakyStore{Store: storage.NewMemoryStore()}
+	sick := cluster.Nodes[0]
+	sick.Store = flaky
+
+	checker := storage.NewHealthChecker(cluster, config.AppConfig.BucketName)
+	ctx := context.Background()
+	failThreshold := config.StorageConfigInstance.HealthFailThreshold
+	recoverThreshold := config.StorageConfigInstance.HealthRecoverThreshold
+
+	flaky.down.Store(true)
+	for i := 1; i < failThreshold; i++ {
+		checker.CheckOnce(ctx)
+		if !sick.IsAvailable() {
+			t.Fatalf("node removed after only %d failed checks", i)
+		}
+	}
+	checker.CheckOnce(ctx)
+	if sick.IsAvailable() {
+		t.Fatalf("node should be unavailable after %d failed checks", failThreshold)
+	}
+
+	// 摘除后写入只落到健康节点
+	store := storage.NewClusterStore(cluster)
+	for i := 0; i < 5; i++ {
+		object := fmt.Sprintf("health/object_%d_%d", time.Now().UnixNano(), i)
+		if err := store.PutObject(ctx, config.AppConfig.BucketName, object, bytes.NewReader([]byte("x")), 1, storage.PutOptions{}); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+		for _, name := range loadReplicaNodes(t, object) {
+			if name == sick.Name() {
+				t.Fatalf("object %s placed on unavailable node", object)
+			}
+		}
+	}
+
+	flaky.down.Store(false)
+	for i := 1; i < recoverThreshold; i++ {
+		checker.CheckOnce(ctx)
+		if sick.IsAvailable() {
+			t.Fatalf("node restored after only %d successful checks", i)
+		}
+	}
+	checker.CheckOnce(ctx)
+	if !sick.IsAvailable() {
+		t.Fatalf("node should be available after %d successful checks", recoverThreshold)
+	}
+
+	for _, state := range checker.Snapshot() {
+		if !state.Available || state.ConsecutiveFailures != 0 || state.LastCheckAt.IsZero() {
+			t.Fatalf("unexpected node state: %+v", state)
+		}
+	}
+}
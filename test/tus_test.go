@@ -0,0 +1,204 @@
+package test
+
+import (
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"CloudVault/router"
+	"CloudVault/utils"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tusClient struct {
+	t      *testing.T
+	engine *gin.Engine
+	token  string
+}
+
+func newTusClient(t *testing.T, user *model.User) *tusClient {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	token, err := utils.GenerateToken(user.ID, user.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tusClient{t: t, engine: router.InitRouter(), token: token}
+}
+
+func (tc *tusClient) do(method, path string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+tc.token)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	tc.engine.ServeHTTP(rec, req)
+	return rec
+}
+
+func (tc *tusClient) create(name string, length int) string {
+	tc.t.Helper()
+	rec := tc.do(http.MethodPost, "/api/tus/files", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(name)) + ",filetype dGV4dC9wbGFpbg==",
+	})
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") == "" {
+		tc.t.Fatalf("create upload: %d %s", rec.Code, rec.Body.String())
+	}
+	return rec.Header().Get("Location")
+}
+
+func (tc *tusClient) patch(location string, offset int, data []byte, checksum string) *httptest.ResponseRecorder {
+	headers := map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	}
+	if checksum != "" {
+		headers["Upload-Checksum"] = checksum
+	}
+	return tc.do(http.MethodPatch, location, data, headers)
+}
+
+func md5Checksum(data []byte) string {
+	sum := md5.Sum(data)
+	return "md5 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// 测试 tus 协议: 能力发现 创建 续传 校验和 完成后按 hash 去重
+func TestTusUpload(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "tus_user")
+	tc := newTusClient(t, user)
+	content := []byte("hello tus, resumable world")
+
+	rec := tc.do(http.MethodOptions, "/api/tus/files", nil, nil)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Tus-Version") != "1.0.0" {
+		t.Fatalf("OPTIONS: %d %v", rec.Code, rec.Header())
+	}
+	rec = tc.do(http.MethodPost, "/api/tus/files", nil, map[string]string{"Tus-Resumable": "0.2.2", "Upload-Length": "1"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expect 412 for unsupported version, got %d", rec.Code)
+	}
+
+	location := tc.create("tus.txt", len(content))
+	if rec = tc.patch(location, 0, content[:8], md5Checksum(content[:8])); rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "8" {
+		t.Fatalf("first PATCH: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec = tc.patch(location, 4, content[4:], ""); rec.Code != http.StatusConflict {
+		t.Fatalf("expect 409 for wrong offset, got %d", rec.Code)
+	}
+	if rec = tc.patch(location, 8, content[8:], md5Checksum([]byte("other"))); rec.Code != 460 {
+		t.Fatalf("expect 460 for checksum mismatch, got %d", rec.Code)
+	}
+	rec = tc.do(http.MethodHead, location, nil, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != "8" || rec.Header().Get("Upload-Length") != strconv.Itoa(len(content)) {
+		t.Fatalf("HEAD: %d %v", rec.Code, rec.Header())
+	}
+	if rec = tc.patch(location, 8, content[8:], ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("last PATCH: %d %s", rec.Code, rec.Body.String())
+	}
+
+	obj, err := service.GetFileObjectByHash(user.ID, sha256Hex(content))
+	if err != nil {
+		t.Fatalf("file object not created: %v", err)
+	}
+	var file model.UserFile
+	if err := repo.Db.Where("user_id = ? AND name = ?", user.ID, "tus.txt").First(&file).Error; err != nil {
+		t.Fatalf("user file not created: %v", err)
+	}
+	if file.ObjectID == nil || *file.ObjectID != obj.ID || file.Size != int64(len(content)) {
+		t.Fatalf("unexpected user file %+v", file)
+	}
+	if rec = tc.do(http.MethodHead, location, nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("finished upload should be gone, got %d", rec.Code)
+	}
+
+	// 相同内容再次上传复用对象
+	again := tc.create("tus-copy.txt", len(content))
+	if rec = tc.patch(again, 0, content, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("PATCH copy: %d %s", rec.Code, rec.Body.String())
+	}
+	if found, _ := service.GetFileObjectById(obj.ID); found.RefCount != 2 {
+		t.Fatalf("expect dedup ref count 2, got %d", found.RefCount)
+	}
+}
+
+// 测试 tus 终止扩展
+func TestTusTermination(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "tus_terminate")
+	tc := newTusClient(t, user)
+
+	location := tc.create("partial.bin", 100)
+	if rec := tc.patch(location, 0, []byte("some bytes"), ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("PATCH: %d", rec.Code)
+	}
+	if rec := tc.do(http.MethodDelete, location, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := tc.do(http.MethodHead, location, nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("terminated upload should be gone, got %d", rec.Code)
+	}
+	var count int64
+	repo.Db.Model(&model.FileChunk{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("chunks should be removed, got %d", count)
+	}
+}
+
+// minPartStore rejects compositions whose non-last sources are smaller than the S3 minimum part size.
+type minPartStore struct {
+	storage.Store
+}
+
+func (s *minPartStore) ComposeObject(ctx context.Context, dest storage.CopyDest, sources ...storage.CopySource) error {
+	for _, src := range sources[:len(sources)-1] {
+		info, err := s.StatObject(ctx, src.Bucket, src.Object)
+		if err != nil {
+			return err
+		}
+		if info.Size < storage.MinComposePartSize {
+			return fmt.Errorf("EntityTooSmall: %s is %d bytes", src.Object, info.Size)
+		}
+	}
+	return s.Store.ComposeObject(ctx, dest, sources...)
+}
+
+// 测试多个小 PATCH 的上传在要求最小分片大小的存储上也能完成
+func TestTusUploadSmallPatches(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "tus_small_patch")
+	tc := newTusClient(t, user)
+	original := storage.Default
+	t.Cleanup(func() { storage.Default = original })
+	storage.Default = &minPartStore{Store: original}
+
+	content := []byte("many small PATCH requests end up as tiny chunks")
+	location := tc.create("small.txt", len(content))
+	for offset := 0; offset < len(content); offset += 10 {
+		end := min(offset+10, len(content))
+		if rec := tc.patch(location, offset, content[offset:end], ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("PATCH at %d: %d %s", offset, rec.Code, rec.Body.String())
+		}
+	}
+
+	obj, err := service.GetFileObjectByHash(user.ID, sha256Hex(content))
+	if err != nil {
+		t.Fatalf("file object not created: %v", err)
+	}
+	if got := readAll(t, storage.Default, obj.BucketName, obj.ObjectName); got != string(content) {
+		t.Fatalf("unexpected object content %q", got)
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/model"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// findUserEntry looks up an active entry by name under parentID (0 = root).
+func findUserEntry(t *testing.T, userID, parentID uint64, name string) *model.UserFile {
+	t.Helper()
+	var file model.UserFile
+	query := repo.Db.Where("user_id = ? AND name = ? AND is_deleted = 0", userID, name)
+	if parentID == 0 {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", parentID)
+	}
+	if err := query.First(&file).Error; err != nil {
+		t.Fatalf("entry %q under %d not found: %v", name, parentID, err)
+	}
+	return &file
+}
+
+// 测试分片上传与秒传携带相对路径时自动创建并复用中间文件夹
+func TestUploadWithRelativePath(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "relpath_user")
+	parts := [][]byte{[]byte("relative path content")}
+	hash := sha256Hex(bytes.Join(parts, nil))
+
+	startMultipart(t, user, "a.txt", hash, parts, []int{0})
+	if _, err := service.CompleteFile(context.Background(), dto.MultipartCompleteRequest{
+		FileHash:     hash,
+		FileSize:     int64(len(parts[0])),
+		TotalChunks:  1,
+		RelativePath: "photos/2024/a.txt",
+	}, user.UserName); err != nil {
+		t.Fatalf("CompleteFile failed: %v", err)
+	}
+	photos := findUserEntry(t, user.ID, 0, "photos")
+	year := findUserEntry(t, user.ID, photos.ID, "2024")
+	if !photos.IsDir || !year.IsDir {
+		t.Fatalf("expect intermediate folders")
+	}
+	findUserEntry(t, user.ID, year.ID, "a.txt")
+
+	resp, err := service.FastUpload(context.Background(), &dto.UploadFileByHashRequest{
+		UserId:       user.ID,
+		Size:         int64(len(parts[0])),
+		Hash:         hash,
+		RelativePath: "photos/2024/b.txt",
+	})
+	if err != nil || !resp.Instant {
+		t.Fatalf("FastUpload failed: %+v %v", resp, err)
+	}
+	findUserEntry(t, user.ID, year.ID, "b.txt")
+	var folders int64
+	repo.Db.Model(&model.UserFile{}).Where("user_id = ? AND is_dir = 1", user.ID).Count(&folders)
+	if folders != 2 {
+		t.Fatalf("expect folders to be reused, got %d", folders)
+	}
+
+	for _, bad := range []string{"../a.txt", "/abs.txt", "a//b.txt", "a/./b.txt", `a\b.txt`} {
+		_, err := service.FastUpload(context.Background(), &dto.UploadFileByHashRequest{
+			UserId:       user.ID,
+			Size:         int64(len(parts[0])),
+			Hash:         hash,
+			RelativePath: bad,
+		})
+		if !errors.Is(err, service.ErrInvalidPath) {
+			t.Fatalf("expect ErrInvalidPath for %q, got %v", bad, err)
+		}
+	}
+}
+
+// 测试清单一次性建好目录树 有 hash 的文件秒传 冲突时整体回滚
+func TestUploadManifest(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "manifest_user")
+	parts := [][]byte{[]byte("already stored")}
+	hash := sha256Hex(parts[0])
+	startMultipart(t, user, "stored.txt", hash, parts, []int{0})
+	if _, err := service.CompleteFile(context.Background(), dto.MultipartCompleteRequest{
+		FileHash:    hash,
+		FileName:    "stored.txt",
+		FileSize:    int64(len(parts[0])),
+		TotalChunks: 1,
+	}, user.UserName); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := service.ApplyUploadManifest(context.Background(), user.ID, dto.UploadManifestRequest{
+		Entries: []dto.ManifestEntry{
+			{Path: "docs/a.txt", Size: 10},
+			{Path: "docs/sub/b.txt", Size: int64(len(parts[0])), Hash: hash},
+			{Path: "empty", IsDir: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ApplyUploadManifest failed: %v", err)
+	}
+	if len(resp.Folders) != 3 || len(resp.Files) != 2 {
+		t.Fatalf("unexpected manifest response %+v", resp)
+	}
+	docs := findUserEntry(t, user.ID, 0, "docs")
+	sub := findUserEntry(t, user.ID, docs.ID, "sub")
+	findUserEntry(t, user.ID, 0, "empty")
+	if f := resp.Files[0]; !f.NeedUpload || f.ParentId != docs.ID || f.FileName != "a.txt" {
+		t.Fatalf("unexpected entry %+v", f)
+	}
+	if f := resp.Files[1]; !f.Instant || f.ParentId != sub.ID {
+		t.Fatalf("expect instant upload into sub, got %+v", f)
+	}
+	findUserEntry(t, user.ID, sub.ID, "b.txt")
+
+	// 路径上有同名文件时不建任何文件夹
+	_, err = service.ApplyUploadManifest(context.Background(), user.ID, dto.UploadManifestRequest{
+		Entries: []dto.ManifestEntry{
+			{Path: "fresh/x.txt", Size: 1},
+			{Path: "stored.txt/y.txt", Size: 1},
+		},
+	})
+	if !errors.Is(err, service.ErrPathConflict) {
+		t.Fatalf("expect ErrPathConflict, got %v", err)
+	}
+	var count int64
+	repo.Db.Model(&model.UserFile{}).Where("user_id = ? AND name = ?", user.ID, "fresh").Count(&count)
+	if count != 0 {
+		t.Fatalf("expect folders of a failed manifest to be rolled back")
+	}
+}
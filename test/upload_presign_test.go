@@ -0,0 +1,229 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/dto"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// putPresignedChunk stands in for the client PUT to a presigned chunk URL.
+func putPresignedChunk(t *testing.T, uploadID string, index int, data []byte) {
+	t.Helper()
+	object := fmt.Sprintf("chunks/%s/%d", uploadID, index)
+	if err := storage.Default.PutObject(context.Background(), config.AppConfig.BucketName, object, bytes.NewReader(data), int64(len(data)), storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func crc32cChecksum(data []byte) string {
+	return fmt.Sprintf("crc32c:%08x", crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+}
+
+// 测试预签名直传: init 返回各分片地址 直传后 confirm 登记分片 complete 合并并校验内容
+func TestPresignedChunkUpload(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "presign_user")
+	parts := [][]byte{[]byte("direct-0|"), []byte("direct-1|"), []byte("tail")}
+	content := bytes.Join(parts, nil)
+	hash := sha256Hex(content)
+
+	resp, err := service.MultiPartFileInit(context.Background(), dto.MultipartInitRequest{
+		UserId:      user.ID,
+		FileName:    "direct.txt",
+		Size:        int64(len(content)),
+		Hash:        hash,
+		ChunkSize:   int64(len(parts[0])),
+		TotalChunks: len(parts),
+		Presign:     true,
+	})
+	if err != nil {
+		t.Fatalf("MultiPartFileInit failed: %v", err)
+	}
+	if len(resp.PresignedChunks) != len(parts) || resp.PresignExpiresAt == 0 {
+		t.Fatalf("expect %d presigned chunks, got %+v", len(parts), resp)
+	}
+	for i, part := range resp.PresignedChunks {
+		if part.Index != i || part.Size != int64(len(parts[i])) {
+			t.Fatalf("unexpected presigned chunk %+v", part)
+		}
+		u, err := url.Parse(part.URL)
+		if err != nil || u.Path != fmt.Sprintf("/chunks/%s/%d", resp.UploadID, i) {
+			t.Fatalf("unexpected presigned url %s", part.URL)
+		}
+	}
+
+	for i, part := range parts {
+		putPresignedChunk(t, resp.UploadID, i, part)
+	}
+	sum := md5.Sum(parts[0])
+	confirmed, err := service.ConfirmChunks(context.Background(), user.ID, dto.MultipartConfirmRequest{
+		UploadID: resp.UploadID,
+		Chunks: []dto.ChunkConfirm{
+			{Index: 0, Checksum: "md5:" + hex.EncodeToString(sum[:])},
+			{Index: 1},
+			{Index: 2, Checksum: crc32cChecksum(parts[2])},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ConfirmChunks failed: %v", err)
+	}
+	if len(confirmed) != 3 || confirmed[2].Checksum != crc32cChecksum(parts[2]) {
+		t.Fatalf("unexpected confirmed chunks %+v", confirmed)
+	}
+
+	// 再次 init 时已确认的分片不再下发地址
+	resp, err = service.MultiPartFileInit(context.Background(), dto.MultipartInitRequest{
+		UserId:      user.ID,
+		FileName:    "direct.txt",
+		Size:        int64(len(content)),
+		Hash:        hash,
+		ChunkSize:   int64(len(parts[0])),
+		TotalChunks: len(parts),
+		Presign:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Uploaded) != 3 || len(resp.PresignedChunks) != 0 {
+		t.Fatalf("expect all chunks uploaded, got %+v", resp)
+	}
+
+	_, err = service.CompleteFile(context.Background(), dto.MultipartCompleteRequest{
+		FileHash:    hash,
+		FileName:    "direct.txt",
+		FileSize:    int64(len(content)),
+		TotalChunks: len(parts),
+	}, user.UserName)
+	if err != nil {
+		t.Fatalf("CompleteFile failed: %v", err)
+	}
+	obj, err := service.GetFileObjectByHash(user.ID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, storage.Default, obj.BucketName, obj.ObjectName); got != string(content) {
+		t.Fatalf("unexpected object content %q", got)
+	}
+}
+
+// 测试 confirm 拒绝未上传 大小不符 校验和不符的分片 以及他人的会话
+func TestConfirmChunksRejectsBadChunks(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "presign_reject")
+	other := createFileObjectTestUser(t, "presign_other")
+	parts := [][]byte{[]byte("0123456789"), []byte("tail")}
+	content := bytes.Join(parts, nil)
+	resp, err := service.MultiPartFileInit(context.Background(), dto.MultipartInitRequest{
+		UserId:      user.ID,
+		FileName:    "reject.txt",
+		Size:        int64(len(content)),
+		Hash:        sha256Hex(content),
+		ChunkSize:   int64(len(parts[0])),
+		TotalChunks: len(parts),
+		Presign:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirm := func(userID uint64, item dto.ChunkConfirm) error {
+		_, err := service.ConfirmChunks(context.Background(), userID, dto.MultipartConfirmRequest{
+			UploadID: resp.UploadID,
+			Chunks:   []dto.ChunkConfirm{item},
+		})
+		return err
+	}
+
+	if err := confirm(user.ID, dto.ChunkConfirm{Index: 0}); !errors.Is(err, service.ErrChunkNotUploaded) {
+		t.Fatalf("expect ErrChunkNotUploaded, got %v", err)
+	}
+	if err := confirm(user.ID, dto.ChunkConfirm{Index: 2}); !errors.Is(err, service.ErrChunkIndex) {
+		t.Fatalf("expect ErrChunkIndex, got %v", err)
+	}
+
+	putPresignedChunk(t, resp.UploadID, 0, []byte("short"))
+	if err := confirm(user.ID, dto.ChunkConfirm{Index: 0}); !errors.Is(err, service.ErrChunkSizeMismatch) {
+		t.Fatalf("expect ErrChunkSizeMismatch, got %v", err)
+	}
+	if _, err := storage.Default.StatObject(context.Background(), config.AppConfig.BucketName, fmt.Sprintf("chunks/%s/0", resp.UploadID)); err == nil {
+		t.Fatalf("expect rejected chunk to be removed")
+	}
+
+	putPresignedChunk(t, resp.UploadID, 1, parts[1])
+	if err := confirm(user.ID, dto.ChunkConfirm{Index: 1, Checksum: crc32cChecksum([]byte("other"))}); !errors.Is(err, service.ErrChunkChecksumMismatch) {
+		t.Fatalf("expect ErrChunkChecksumMismatch, got %v", err)
+	}
+
+	putPresignedChunk(t, resp.UploadID, 1, parts[1])
+	if err := confirm(other.ID, dto.ChunkConfirm{Index: 1}); err == nil {
+		t.Fatalf("expect other user's confirm to fail")
+	}
+	if err := confirm(user.ID, dto.ChunkConfirm{Index: 1}); err != nil {
+		t.Fatalf("ConfirmChunks failed: %v", err)
+	}
+}
+
+// 测试本地存储的预签名 PUT 地址与下载地址互不通用
+func TestLocalStorePresignedPut(t *testing.T) {
+	store := newTestLocalStore(t)
+	raw, err := store.PresignedPutObject(context.Background(), "bucket", "chunks/u/0", time.Minute, storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("presign put failed: %v", err)
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if err := store.VerifyPresignedPut("bucket", "chunks/u/0", query, time.Now()); err != nil {
+		t.Fatalf("VerifyPresignedPut failed: %v", err)
+	}
+	if err := store.VerifyPresigned("bucket", "chunks/u/0", query, time.Now()); !errors.Is(err, storage.ErrPresignSignature) {
+		t.Fatalf("expect PUT url to be rejected for GET, got %v", err)
+	}
+
+	raw, err = store.PresignedGetObject(context.Background(), "bucket", "chunks/u/0", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ = url.Parse(raw)
+	if err := store.VerifyPresignedPut("bucket", "chunks/u/0", parsed.Query(), time.Now()); !errors.Is(err, storage.ErrPresignSignature) {
+		t.Fatalf("expect GET url to be rejected for PUT, got %v", err)
+	}
+}
+
+// 测试预签名地址的有效期不超过上限 确认后的分片不会长期可写
+func TestPresignExpiryIsCapped(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "presign_expiry")
+	previous := config.AppConfig.UploadPresignExpiry
+	t.Cleanup(func() { config.AppConfig.UploadPresignExpiry = previous })
+	config.AppConfig.UploadPresignExpiry = 24 * time.Hour
+
+	content := []byte("short-lived url")
+	resp, err := service.MultiPartFileInit(context.Background(), dto.MultipartInitRequest{
+		UserId:      user.ID,
+		FileName:    "expiry.txt",
+		Size:        int64(len(content)),
+		Hash:        sha256Hex(content),
+		ChunkSize:   int64(len(content)),
+		TotalChunks: 1,
+		Presign:     true,
+	})
+	if err != nil {
+		t.Fatalf("MultiPartFileInit failed: %v", err)
+	}
+	if limit := time.Now().Add(time.Hour + time.Minute).Unix(); resp.PresignExpiresAt == 0 || resp.PresignExpiresAt > limit {
+		t.Fatalf("presigned urls should expire within an hour, got %d", resp.PresignExpiresAt)
+	}
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// assertUploadRemoved checks that the session, its chunk rows and chunk objects are all gone.
+func assertUploadRemoved(t *testing.T, session *model.UploadSession, chunkPaths []string) {
+	t.Helper()
+	var count int64
+	repo.Db.Model(&model.UploadSession{}).Where("upload_id = ?", session.UploadID).Count(&count)
+	if count != 0 {
+		t.Fatalf("session %s should be removed", session.UploadID)
+	}
+	repo.Db.Model(&model.FileChunk{}).Where("upload_id = ?", session.UploadID).Count(&count)
+	if count != 0 {
+		t.Fatalf("chunks of %s should be removed, got %d", session.UploadID, count)
+	}
+	for _, p := range chunkPaths {
+		if _, _, err := storage.Default.GetObject(context.Background(), config.AppConfig.BucketName, p); err == nil {
+			t.Fatalf("chunk object %s should be removed", p)
+		}
+	}
+}
+
+func uploadChunkPaths(t *testing.T, session *model.UploadSession) []string {
+	t.Helper()
+	var chunks []model.FileChunk
+	if err := repo.Db.Where("upload_id = ?", session.UploadID).Find(&chunks).Error; err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0, len(chunks))
+	for _, c := range chunks {
+		paths = append(paths, c.ChunkPath)
+	}
+	return paths
+}
+
+// 测试超过 TTL 未活动的上传会话被清理 活跃会话保留
+func TestSweepExpiredUploads(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "upload_sweep")
+	parts := [][]byte{[]byte("abandoned-0"), []byte("abandoned-1")}
+	stale := startMultipart(t, user, "stale.bin", sha256Hex([]byte("stale")), parts, []int{0, 1})
+	active := startMultipart(t, user, "active.bin", sha256Hex([]byte("active")), parts, []int{0})
+	stalePaths := uploadChunkPaths(t, stale)
+	if len(stalePaths) != 2 {
+		t.Fatalf("expect 2 chunk rows, got %d", len(stalePaths))
+	}
+
+	old := time.Now().Add(-config.AppConfig.UploadSessionTTL - time.Minute)
+	if err := repo.Db.Model(&model.UploadSession{}).Where("id = ?", stale.ID).UpdateColumn("updated_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := service.SweepExpiredUploads(context.Background())
+	if err != nil {
+		t.Fatalf("SweepExpiredUploads failed: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expect 1 session removed, got %d", removed)
+	}
+	assertUploadRemoved(t, stale, stalePaths)
+	if _, err := service.GetUploadSessionByUploadID(active.UploadID); err != nil {
+		t.Fatalf("active session should be kept: %v", err)
+	}
+}
+
+// 测试用户只能中止自己的上传
+func TestAbortUpload(t *testing.T) {
+	cleanFileObjectTables(t)
+	owner := createFileObjectTestUser(t, "upload_abort")
+	other := createFileObjectTestUser(t, "upload_abort_other")
+	session := startMultipart(t, owner, "abort.bin", sha256Hex([]byte("abort")), [][]byte{[]byte("partial")}, []int{0})
+	paths := uploadChunkPaths(t, session)
+
+	ctx := context.Background()
+	if err := service.AbortUpload(ctx, other.ID, session.UploadID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expect not found for other user, got %v", err)
+	}
+	if err := service.AbortUpload(ctx, owner.ID, session.UploadID); err != nil {
+		t.Fatalf("AbortUpload failed: %v", err)
+	}
+	assertUploadRemoved(t, session, paths)
+}
+
+// putHookStore runs afterPut after every successful PutObject.
+type putHookStore struct {
+	storage.Store
+	afterPut func(objectName string)
+}
+
+func (s *putHookStore) PutObject(ctx context.Context, bucket, objectName string, reader io.Reader, size int64, opts storage.PutOptions) error {
+	if err := s.Store.PutObject(ctx, bucket, objectName, reader, size, opts); err != nil {
+		return err
+	}
+	s.afterPut(objectName)
+	return nil
+}
+
+// 测试分片写入存储后 记录前会话被清理 分片对象与记录都不会残留
+func TestUploadChunkRacingSweep(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "upload_sweep_race")
+	parts := [][]byte{[]byte("first-part"), []byte("late-part")}
+	session := startMultipart(t, user, "race.bin", sha256Hex([]byte("race")), parts, []int{0})
+	paths := append(uploadChunkPaths(t, session), "chunks/"+session.UploadID+"/1")
+
+	original := storage.Default
+	t.Cleanup(func() { storage.Default = original })
+	storage.Default = &putHookStore{Store: original, afterPut: func(string) {
+		old := time.Now().Add(-config.AppConfig.UploadSessionTTL - time.Minute)
+		if err := repo.Db.Model(&model.UploadSession{}).Where("id = ?", session.ID).UpdateColumn("updated_at", old).Error; err != nil {
+			t.Error(err)
+		}
+		if removed, err := service.SweepExpiredUploads(context.Background()); err != nil || removed != 1 {
+			t.Errorf("expect the session to be swept, got %d, %v", removed, err)
+		}
+	}}
+
+	err := service.UploadChunk(context.Background(), &dto.MultipartUploadChunkRequest{
+		UploadID:   session.UploadID,
+		BucketName: config.AppConfig.BucketName,
+		ChunkIndex: 1,
+		FileHash:   session.FileHash,
+		File:       chunkFileHeader(t, parts[1]),
+	})
+	if !errors.Is(err, service.ErrUploadRemoved) {
+		t.Fatalf("expect ErrUploadRemoved, got %v", err)
+	}
+	storage.Default = original
+	assertUploadRemoved(t, session, paths)
+}
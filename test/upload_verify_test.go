@@ -0,0 +1,357 @@
+package test
+
+import (
+	"CloudVault/config"
+	"CloudVault/internal/dto"
+	"CloudVault/internal/repo"
+	"CloudVault/internal/service"
+	"CloudVault/internal/storage"
+	"CloudVault/model"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+// chunkFileHeader wraps data in a multipart.FileHeader like gin's c.FormFile.
+func chunkFileHeader(t *testing.T, data []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("chunk", "chunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(data)
+	_ = writer.Close()
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.File["chunk"][0]
+}
+
+// startMultipart initializes an upload of parts and sends the chunks in the given order.
+func startMultipart(t *testing.T, user *model.User, name string, hash string, parts [][]byte, order []int) *model.UploadSession {
+	t.Helper()
+	var size int64
+	for _, p := range parts {
+		size += int64(len(p))
+	}
+	resp, err := service.MultiPartFileInit(context.Background(), dto.MultipartInitRequest{
+		UserId:      user.ID,
+		FileName:    name,
+		Size:        size,
+		Hash:        hash,
+		ChunkSize:   int64(len(parts[0])),
+		TotalChunks: len(parts),
+	})
+	if err != nil {
+		t.Fatalf("MultiPartFileInit failed: %v", err)
+	}
+	for _, index := range order {
+		if err := service.UploadChunk(context.Background(), &dto.MultipartUploadChunkRequest{
+			UploadID:   resp.UploadID,
+			BucketName: config.AppConfig.BucketName,
+			ChunkIndex: index,
+			FileHash:   hash,
+			File:       chunkFileHeader(t, parts[index]),
+		}); err != nil {
+			t.Fatalf("UploadChunk %d failed: %v", index, err)
+		}
+	}
+	session, err := service.GetUploadSessionByUploadID(resp.UploadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+// 测试乱序上传的分片合并后校验 hash 并复制到正式对象
+func TestCompleteFileVerifiesContentHash(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "verify_hash")
+	parts := [][]byte{[]byte("chunk-zero|"), []byte("chunk-one|"), []byte("chunk-two")}
+	hash := sha256Hex(bytes.Join(parts, nil))
+
+	session := startMultipart(t, user, "in_order.txt", hash, parts, []int{0, 2, 1})
+	_, err := service.CompleteFile(context.Background(), dto.MultipartCompleteRequest{
+		FileHash:    hash,
+		FileName:    "in_order.txt",
+		FileSize:    int64(len(bytes.Join(parts, nil))),
+		TotalChunks: len(parts),
+	}, user.UserName)
+	if err != nil {
+		t.Fatalf("CompleteFile failed: %v", err)
+	}
+	obj, err := service.GetFileObjectByHash(user.ID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, storage.Default, obj.BucketName, obj.ObjectName); got != string(bytes.Join(parts, nil)) {
+		t.Fatalf("unexpected object content %q", got)
+	}
+	if _, _, err := storage.Default.GetObject(context.Background(), obj.BucketName, "chunks/"+session.UploadID+"/merged"); err == nil {
+		t.Fatalf("expect the staging object to be removed")
+	}
+}
+
+// mergeHookStore runs beforeMerge before every ComposeObject and before chunks are read back,
+// which covers both ways of merging the chunks of an upload.
+type mergeHookStore struct {
+	storage.Store
+	beforeMerge func()
+}
+
+func (s *mergeHookStore) ComposeObject(ctx context.Context, dest storage.CopyDest, sources ...storage.CopySource) error {
+	s.beforeMerge()
+	return s.Store.ComposeObject(ctx, dest, sources...)
+}
+
+func (s *mergeHookStore) GetObject(ctx context.Context, bucket, object string) (io.ReadCloser, storage.ObjectInfo, error) {
+	if strings.HasPrefix(object, "chunks/") && !strings.HasSuffix(object, "/merged") {
+		s.beforeMerge()
+	}
+	return s.Store.GetObject(ctx, bucket, object)
+}
+
+// 测试分片在合并前被覆盖时 校验的是合并结果 不会以声明的 hash 登记错误内容
+func TestCompleteFileRejectsChunkReplacedBeforeCompose(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "verify_swap")
+	parts := [][]byte{[]byte("genuine-zero|"), []byte("genuine-one")}
+	hash := sha256Hex(bytes.Join(parts, nil))
+	session := startMultipart(t, user, "swap.txt", hash, parts, []int{0, 1})
+
+	original := storage.Default
+	t.Cleanup(func() { storage.Default = original })
+	replaced := false
+	storage.Default = &mergeHookStore{Store: original, beforeMerge: func() {
+		if replaced {
+			return
+		}
+		replaced = true
+		evil := []byte("poisoned-one|")
+		if err := original.PutObject(context.Background(), config.AppConfig.BucketName,
+			"chunks/"+session.UploadID+"/0", bytes.NewReader(evil), int64(len(evil)), storage.PutOptions{}); err != nil {
+			t.Error(err)
+		}
+	}}
+
+	_, err := service.CompleteFile(context.Background(), dto.MultipartCompleteRequest{
+		FileHash:    hash,
+		FileName:    "swap.txt",
+		FileSize:    int64(len(bytes.Join(parts, nil))),
+		TotalChunks: len(parts),
+	}, user.UserName)
+	if !errors.Is(err, service.ErrContentHashMismatch) {
+		t.Fatalf("expect ErrContentHashMismatch, got %v", err)
+	}
+	if _, err := service.GetFileObjectByHash(user.ID, hash); err == nil {
+		t.Fatalf("replaced content must not be registered under the hash")
+	}
+}
+
+// 测试声明的 hash 与上传内容不符时拒绝合并 不创建任何记录
+func TestCompleteFileRejectsHashMismatch(t *testing.T) {
+	cleanFileObjectTables(t)
+	owner := createFileObjectTestUser(t, "hash_owner")
+	attacker := createFileObjectTestUser(t, "hash_claimer")
+	secret := []byte("someone else's file")
+	hash := sha256Hex(secret)
+	victim := &model.FileObject{
+		UserID:     owner.ID,
+		Hash:       hash,
+		BucketName: config.AppConfig.BucketName,
+		ObjectName: service.BuildObjectName(owner.UserName, hash),
+		Size:       int64(len(secret)),
+		RefCount:   1,
+	}
+	if err := service.CreateFilesObject(victim); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Default.PutObject(context.Background(), victim.BucketName, victim.ObjectName, bytes.NewReader(secret), victim.Size, storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有持有证明时不会秒传 而是走普通上传
+	parts := [][]byte{[]byte("garbage claiming the hash")}
+	startMultipart(t, attacker, "stolen.txt", hash, parts, []int{0})
+	_, err := service.CompleteFile(context.Background(), dto.MultipartCompleteRequest{
+		FileHash:    hash,
+		FileName:    "stolen.txt",
+		FileSize:    int64(len(parts[0])),
+		TotalChunks: 1,
+	}, attacker.UserName)
+	if !errors.Is(err, service.ErrContentHashMismatch) {
+		t.Fatalf("expect ErrContentHashMismatch, got %v", err)
+	}
+	var count int64
+	repo.Db.Model(&model.UserFile{}).Where("user_id = ?", attacker.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("mismatched upload must not create files, got %d", count)
+	}
+	repo.Db.Model(&model.UploadSession{}).Where("user_id = ?", attacker.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("mismatched upload session should be cleaned up, got %d", count)
+	}
+	if found, _ := service.GetFileObjectById(victim.ID); found.RefCount != 1 {
+		t.Fatalf("victim ref count changed: %d", found.RefCount)
+	}
+}
+
+// 测试只凭 hash 秒传他人对象时必须先回答区间挑战
+func TestFastUploadRequiresProofOfPossession(t *testing.T) {
+	cleanFileObjectTables(t)
+	owner := createFileObjectTestUser(t, "proof_owner")
+	other := createFileObjectTestUser(t, "proof_other")
+	data := bytes.Repeat([]byte("proof-of-possession "), 5000)
+	hash := sha256Hex(data)
+	obj := &model.FileObject{
+		UserID:     owner.ID,
+		Hash:       hash,
+		BucketName: config.AppConfig.BucketName,
+		ObjectName: service.BuildObjectName(owner.UserName, hash),
+		Size:       int64(len(data)),
+		RefCount:   1,
+	}
+	if err := service.CreateFilesObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Default.PutObject(context.Background(), obj.BucketName, obj.ObjectName, bytes.NewReader(data), obj.Size, storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	req := &dto.UploadFileByHashRequest{UserId: other.ID, FileName: "copy.txt", Size: obj.Size, Hash: hash}
+
+	resp, err := service.FastUpload(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Instant || !resp.NeedProof || resp.Challenge == nil || resp.Reason != "proof_required" {
+		t.Fatalf("expect proof challenge, got %+v", resp)
+	}
+	if resp.Challenge.Length <= 0 || resp.Challenge.Offset+resp.Challenge.Length > obj.Size {
+		t.Fatalf("challenge out of range: %+v", resp.Challenge)
+	}
+
+	req.Proof = sha256Hex([]byte("wrong"))
+	resp, err = service.FastUpload(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Instant || resp.Reason != "proof_mismatch" || resp.Challenge == nil {
+		t.Fatalf("expect proof mismatch, got %+v", resp)
+	}
+
+	// 客户端用本地文件回答挑战
+	challenge := *resp.Challenge
+	end := challenge.Offset + challenge.Length
+	req.Proof = sha256Hex(append([]byte(challenge.Nonce), data[challenge.Offset:end]...))
+	resp, err = service.FastUpload(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Instant || resp.FileId == 0 {
+		t.Fatalf("expect instant upload after valid proof, got %+v", resp)
+	}
+
+	// 已经引用该对象的用户再次秒传无需证明
+	req.FileName = "copy-2.txt"
+	resp, err = service.FastUpload(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Instant {
+		t.Fatalf("user already holding the object should not need a proof, got %+v", resp)
+	}
+}
+
+// 测试分片校验和: 不符的分片被拒绝 通过的分片记录校验和并在 init 时返回
+func TestUploadChunkChecksum(t *testing.T) {
+	cleanFileObjectTables(t)
+	user := createFileObjectTestUser(t, "chunk_checksum")
+	parts := [][]byte{[]byte("first-chunk"), []byte("second")}
+	content := bytes.Join(parts, nil)
+	hash := sha256Hex(content)
+	initReq := dto.MultipartInitRequest{
+		UserId:      user.ID,
+		FileName:    "checksum.txt",
+		Size:        int64(len(content)),
+		Hash:        hash,
+		ChunkSize:   int64(len(parts[0])),
+		TotalChunks: len(parts),
+	}
+	resp, err := service.MultiPartFileInit(context.Background(), initReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func(index int, data []byte, checksum string) error {
+		return service.UploadChunk(context.Background(), &dto.MultipartUploadChunkRequest{
+			UploadID:   resp.UploadID,
+			BucketName: config.AppConfig.BucketName,
+			ChunkIndex: index,
+			FileHash:   hash,
+			Checksum:   checksum,
+			File:       chunkFileHeader(t, data),
+		})
+	}
+
+	crc := crc32.Checksum(parts[0], crc32.MakeTable(crc32.Castagnoli))
+	if err := upload(0, []byte("first-chunK"), fmt.Sprintf("crc32c:%08x", crc)); !errors.Is(err, service.ErrChunkChecksumMismatch) {
+		t.Fatalf("expect checksum mismatch, got %v", err)
+	}
+	if err := upload(0, parts[0], "sha1:abcd"); !errors.Is(err, service.ErrInvalidChecksum) {
+		t.Fatalf("expect invalid checksum, got %v", err)
+	}
+	var count int64
+	repo.Db.Model(&model.FileChunk{}).Where("upload_id = ?", resp.UploadID).Count(&count)
+	if count != 0 {
+		t.Fatalf("rejected chunks must not be recorded, got %d", count)
+	}
+	if err := upload(0, parts[0], fmt.Sprintf("CRC32C:%08X", crc)); err != nil {
+		t.Fatalf("upload with crc32c failed: %v", err)
+	}
+	if err := upload(1, parts[1], ""); err != nil { // 未声明时服务端记录 md5
+		t.Fatalf("upload without checksum failed: %v", err)
+	}
+
+	resp, err = service.MultiPartFileInit(context.Background(), initReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(parts[1])
+	want := []dto.UploadedChunk{
+		{Index: 0, Size: int64(len(parts[0])), Checksum: fmt.Sprintf("crc32c:%08x", crc)},
+		{Index: 1, Size: int64(len(parts[1])), Checksum: "md5:" + hex.EncodeToString(sum[:])},
+	}
+	if len(resp.Chunks) != len(want) {
+		t.Fatalf("expect %d verified chunks, got %+v", len(want), resp.Chunks)
+	}
+	for i := range want {
+		if resp.Chunks[i] != want[i] {
+			t.Fatalf("chunk %d: expect %+v, got %+v", i, want[i], resp.Chunks[i])
+		}
+	}
+
+	// 分片大小之和与文件大小不一致时拒绝合并
+	completeReq := dto.MultipartCompleteRequest{
+		FileHash:    hash,
+		FileName:    "checksum.txt",
+		FileSize:    int64(len(content)) + 1,
+		TotalChunks: len(parts),
+	}
+	if _, err := service.CompleteFile(context.Background(), completeReq, user.UserName); !errors.Is(err, service.ErrChunkSizeMismatch) {
+		t.Fatalf("expect chunk size mismatch, got %v", err)
+	}
+	completeReq.FileSize = int64(len(content))
+	if _, err := service.CompleteFile(context.Background(), completeReq, user.UserName); err != nil {
+		t.Fatalf("CompleteFile failed: %v", err)
+	}
+}
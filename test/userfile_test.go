@@ -14,7 +14,7 @@ func cleanUserFileTables(t *testing.T) {
 	repo.Db.Exec("SET FOREIGN_KEY_CHECKS = 0")
 
 	// 按照外键依赖关系的顺序清理表数据
-	tables := []string{"file_share", "file_chunk", "upload_session", "user_file", "file_object", "user_db"}
+	tables := []string{"file_share", "file_chunk", "upload_session", "file_version", "user_file", "file_object", "user_db"}
 	for _, table := range tables {
 		if err := repo.Db.Exec("DELETE FROM " + table).Error; err != nil {
 			t.Fatalf("clean %s failed: %v", table, err)
@@ -19,6 +19,11 @@ type Cache interface {
 	Exists(ctx context.Context, key string) (bool, error)
 }
 
+// patternDeleter is implemented by caches that can drop keys by glob pattern.
+type patternDeleter interface {
+	DeleteByPattern(ctx context.Context, pattern string) error
+}
+
 type RedisCache struct {
 	client *redis.Client
 }
@@ -94,6 +99,14 @@ type CacheManager struct {
 var globalCacheManager *CacheManager
 var cacheManagerOnce sync.Once
 
+// UseCache replaces the cache backend, e.g. with an in-process MemoryCache in tests.
+func UseCache(cache Cache) {
+	cacheManagerOnce.Do(func() {})
+	globalCacheManager = &CacheManager{
+		cache: cache,
+	}
+}
+
 // InitCacheManager initializes the cache manager.
 func InitCacheManager() {
 	cacheManagerOnce.Do(func() { // 单一用例模式
@@ -174,7 +187,7 @@ func SetUserFileListToCache(
 func InvalidateUserFileListCache(ctx context.Context, userId uint64, parentId uint64) error {
 	manager := GetCacheManager()
 	keyPattern := BuildCacheKey(CacheKeyUserFileList, userId, parentId) + ":*"
-	cache, ok := manager.cache.(*RedisCache)
+	cache, ok := manager.cache.(patternDeleter)
 	if !ok {
 		return manager.cache.Delete(ctx, keyPattern)
 	}
@@ -235,10 +248,10 @@ func InvalidateFileObjectCache(ctx context.Context, objectId uint64) error {
 	return manager.cache.Delete(ctx, key)
 }
 
-// GetFileObjectIDByHash reads cached file object ID by hash.
-func GetFileObjectIDByHash(ctx context.Context, hash string) (uint64, bool) {
+// GetFileObjectIDByHash reads cached file object ID by dedup scope and hash.
+func GetFileObjectIDByHash(ctx context.Context, scope, hash string) (uint64, bool) {
 	manager := GetCacheManager()
-	key := BuildCacheKey(CacheKeyFileObjectHash, hash)
+	key := BuildCacheKey(CacheKeyFileObjectHash, scope, hash)
 
 	var result uint64
 	if err := manager.cache.Get(ctx, key, &result); err != nil {
@@ -250,17 +263,17 @@ func GetFileObjectIDByHash(ctx context.Context, hash string) (uint64, bool) {
 	return result, true
 }
 
-// SetFileObjectIDByHash writes cached file object ID by hash.
-func SetFileObjectIDByHash(ctx context.Context, hash string, objectId uint64, expiration time.Duration) error {
+// SetFileObjectIDByHash writes cached file object ID by dedup scope and hash.
+func SetFileObjectIDByHash(ctx context.Context, scope, hash string, objectId uint64, expiration time.Duration) error {
 	manager := GetCacheManager()
-	key := BuildCacheKey(CacheKeyFileObjectHash, hash)
+	key := BuildCacheKey(CacheKeyFileObjectHash, scope, hash)
 	return manager.cache.Set(ctx, key, objectId, expiration)
 }
 
-// InvalidateFileObjectHashCache clears cached file object ID by hash.
-func InvalidateFileObjectHashCache(ctx context.Context, hash string) error {
+// InvalidateFileObjectHashCache clears cached file object ID by dedup scope and hash.
+func InvalidateFileObjectHashCache(ctx context.Context, scope, hash string) error {
 	manager := GetCacheManager()
-	key := BuildCacheKey(CacheKeyFileObjectHash, hash)
+	key := BuildCacheKey(CacheKeyFileObjectHash, scope, hash)
 	return manager.cache.Delete(ctx, key)
 }
 
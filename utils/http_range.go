@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRangeNotSatisfiable is returned when no requested range overlaps the content.
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// maxByteRanges caps the ranges served in one multipart response.
+const maxByteRanges = 16
+
+// ByteRange is Length bytes starting at Start.
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange formats the Content-Range header value of r within size bytes.
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header for content of size bytes. nil means the whole content should
+// be sent: no header, a unit other than bytes, malformed specs, or more ranges than worth serving.
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil, nil
+	}
+	specs, ok := strings.CutPrefix(header, "bytes=")
+	if !ok { // 未知单位 按规范忽略
+		return nil, nil
+	}
+	var (
+		ranges []ByteRange
+		total  int64
+	)
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, nil
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		var r ByteRange
+		if first == "" { // 后缀形式 "-n" 表示最后 n 字节
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = ByteRange{Start: size - n, Length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size { // 越界的范围不可满足 其余范围仍可返回
+				continue
+			}
+			r = ByteRange{Start: start, Length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+		total += r.Length
+	}
+	if len(ranges) == 0 {
+		return nil, ErrRangeNotSatisfiable
+	}
+	// 范围过多或加起来超过整个文件 (重叠) 时直接返回整个文件
+	if len(ranges) > maxByteRanges || total > size {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// ETagMatch reports whether an If-None-Match / If-Match value lists etag, using weak comparison.
+func ETagMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// IfRangeMatch reports whether the If-Range value still identifies the content, so the Range
+// header applies. An entity tag must match strongly; a date must equal Last-Modified.
+func IfRangeMatch(header, etag string, modified time.Time) bool {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return true
+	}
+	if strings.HasPrefix(header, `"`) || strings.HasPrefix(header, "W/") {
+		return !strings.HasPrefix(header, "W/") && header == etag
+	}
+	t, err := http.ParseTime(header)
+	return err == nil && !modified.IsZero() && modified.Truncate(time.Second).Equal(t)
+}
@@ -19,5 +19,10 @@ func Fail(c *gin.Context, err error) {
 	})
 }
 
-
-
+// FailStatus writes an error JSON response with a custom HTTP status.
+func FailStatus(c *gin.Context, status int, err error) {
+	c.JSON(status, gin.H{
+		"code": -1,
+		"msg":  err.Error(),
+	})
+}
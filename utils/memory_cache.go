@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss is returned by MemoryCache.Get for missing or expired keys.
+var ErrCacheMiss = errors.New("cache miss")
+
+type memoryCacheItem struct {
+	data     []byte
+	expireAt time.Time
+}
+
+// MemoryCache is an in-process Cache, used when Redis is not available.
+type MemoryCache struct {
+	mu    sync.Mutex
+	items map[string]memoryCacheItem
+}
+
+// NewMemoryCache creates an empty in-process cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{items: make(map[string]memoryCacheItem)}
+}
+
+// load returns a live item, dropping it when expired. Caller holds mu.
+func (c *MemoryCache) load(key string) (memoryCacheItem, bool) {
+	item, ok := c.items[key]
+	if !ok {
+		return item, false
+	}
+	if !item.expireAt.IsZero() && time.Now().After(item.expireAt) {
+		delete(c.items, key)
+		return item, false
+	}
+	return item, true
+}
+
+// Get reads a cached value.
+func (c *MemoryCache) Get(ctx context.Context, key string, dest interface{}) error {
+	c.mu.Lock()
+	item, ok := c.load(key)
+	c.mu.Unlock()
+	if !ok {
+		return ErrCacheMiss
+	}
+	return json.Unmarshal(item.data, dest)
+}
+
+// Set writes a cached value; expiration <= 0 keeps it forever.
+func (c *MemoryCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	item := memoryCacheItem{data: data}
+	if expiration > 0 {
+		item.expireAt = time.Now().Add(expiration)
+	}
+	c.mu.Lock()
+	c.items[key] = item
+	c.mu.Unlock()
+	return nil
+}
+
+// Delete removes a cache entry.
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+	return nil
+}
+
+// DeleteByPattern removes entries matching a Redis-style glob pattern.
+func (c *MemoryCache) DeleteByPattern(ctx context.Context, pattern string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.items {
+		if matched, _ := path.Match(pattern, key); matched {
+			delete(c.items, key)
+		}
+	}
+	return nil
+}
+
+// Exists checks whether a cache key exists.
+func (c *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.load(key)
+	return ok, nil
+}
@@ -1,6 +1,7 @@
 ﻿package utils
 
 import (
+	"CloudVault/config"
 	"net/http"
 	"strings"
 
@@ -33,3 +34,18 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminMiddleware only lets users listed in ADMIN_USERS through; it must run after AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.GetString("username")
+		for _, admin := range config.AppConfig.AdminUsers {
+			if username != "" && username == admin {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		c.Abort()
+	}
+}